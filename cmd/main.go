@@ -6,6 +6,7 @@ import (
 	"os"
 
 	"github.com/cyberark/summon/pkg/command"
+	prov "github.com/cyberark/summon/pkg/provider"
 	"github.com/cyberark/summon/pkg/summon"
 	"github.com/urfave/cli"
 )
@@ -26,11 +27,17 @@ func RunCLI() error {
 	app.Writer = CLIWriter
 	app.Flags = command.Flags
 	app.Action = command.Action
+	app.Commands = command.CommandsFor(CLIArgs)
 
 	return app.Run(CLIArgs)
 }
 
 func main() {
+	// Never returns if summon was re-executed to start a sandboxed provider
+	prov.SandboxMain()
+	// Nor if it was re-executed to start the command with a umask or limits
+	summon.SubcommandMain()
+
 	if err := RunCLI(); err != nil {
 		fmt.Println(err.Error())
 		os.Exit(-1)
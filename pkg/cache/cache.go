@@ -0,0 +1,253 @@
+// Package cache provides an encrypted on-disk cache of resolved secret
+// values, keyed by provider and secret path.
+package cache
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	prov "github.com/cyberark/summon/pkg/provider"
+)
+
+const (
+	// CacheDirEnv overrides the directory the cache is stored in
+	CacheDirEnv = "SUMMON_CACHE_DIR"
+	// CacheKeyEnv supplies the encryption key material for the cache. If unset,
+	// a random key is generated and stored in a key file outside the cache
+	// directory, see DefaultKeyPath.
+	CacheKeyEnv = "SUMMON_CACHE_KEY"
+
+	entryExtension = ".entry"
+)
+
+// Cache stores secret values resolved by a single provider for a limited time.
+type Cache struct {
+	dir      string
+	provider string
+	ttl      time.Duration
+	aead     cipher.AEAD
+	now      func() time.Time
+}
+
+type entry struct {
+	Expires time.Time `json:"expires"`
+	Value   []byte    `json:"value"`
+}
+
+// DefaultDir returns the directory the cache lives in: $SUMMON_CACHE_DIR if
+// set, otherwise a `summon` directory in the user's cache directory.
+func DefaultDir() (string, error) {
+	if dir := os.Getenv(CacheDirEnv); dir != "" {
+		return dir, nil
+	}
+	userCacheDir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(userCacheDir, "summon"), nil
+}
+
+// DefaultKeyPath returns the file the generated key is kept in: `cache.key` in
+// a `summon` directory in the user's config directory, away from the entries
+// it encrypts.
+func DefaultKeyPath() (string, error) {
+	userConfigDir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(userConfigDir, "summon", "cache.key"), nil
+}
+
+// New opens the cache in dir for values resolved by provider, which expire
+// ttl after being stored. Unless $SUMMON_CACHE_KEY is set, the key is read
+// from, or generated into, keyPath, which must be outside dir.
+func New(dir, keyPath, provider string, ttl time.Duration) (*Cache, error) {
+	if ttl <= 0 {
+		return nil, fmt.Errorf("cache TTL must be positive, got %s", ttl)
+	}
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, err
+	}
+
+	key, err := loadKey(dir, keyPath)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Cache{
+		dir:      dir,
+		provider: provider,
+		ttl:      ttl,
+		aead:     aead,
+		now:      time.Now,
+	}, nil
+}
+
+// Get returns the cached value of path, if there is one that hasn't expired.
+func (c *Cache) Get(path string) ([]byte, bool) {
+	name := c.entryName(path)
+	sealed, err := os.ReadFile(filepath.Join(c.dir, name))
+	if err != nil {
+		return nil, false
+	}
+
+	nonceSize := c.aead.NonceSize()
+	if len(sealed) < nonceSize {
+		return nil, false
+	}
+	plain, err := c.aead.Open(nil, sealed[:nonceSize], sealed[nonceSize:], []byte(name))
+	if err != nil {
+		return nil, false
+	}
+
+	var e entry
+	if err := json.Unmarshal(plain, &e); err != nil {
+		return nil, false
+	}
+	if !c.now().Before(e.Expires) {
+		os.Remove(filepath.Join(c.dir, name))
+		return nil, false
+	}
+	return e.Value, true
+}
+
+// Put stores the value of path until the cache TTL elapses, or until its lease
+// ends if the provider reported a shorter one along with the value.
+func (c *Cache) Put(path string, value []byte) error {
+	ttl := c.ttl
+	if _, metadata, err := prov.ParseResponse(string(value)); err == nil && metadata != nil {
+		if metadata.LeaseDuration > 0 && metadata.LeaseDuration < ttl {
+			ttl = metadata.LeaseDuration
+		}
+	}
+
+	plain, err := json.Marshal(entry{Expires: c.now().Add(ttl), Value: value})
+	if err != nil {
+		return err
+	}
+
+	nonce := make([]byte, c.aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return err
+	}
+	name := c.entryName(path)
+	sealed := c.aead.Seal(nonce, nonce, plain, []byte(name))
+
+	// Write to a temp file and rename so readers never see a partial entry
+	f, err := os.CreateTemp(c.dir, ".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.Write(sealed); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), filepath.Join(c.dir, name))
+}
+
+// entryName derives the file name of an entry, which doesn't reveal the
+// provider or secret path it holds
+func (c *Cache) entryName(path string) string {
+	sum := sha256.Sum256([]byte(c.provider + "\x00" + path))
+	return hex.EncodeToString(sum[:]) + entryExtension
+}
+
+// Clear removes every cached value in dir, along with the generated key at
+// keyPath.
+func Clear(dir, keyPath string) error {
+	files, err := os.ReadDir(dir)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
+	for _, file := range files {
+		name := file.Name()
+		if !strings.HasSuffix(name, entryExtension) {
+			continue
+		}
+		if err := os.Remove(filepath.Join(dir, name)); err != nil {
+			return err
+		}
+	}
+
+	if err := os.Remove(keyPath); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// loadKey returns the AES-256 key for the cache in dir, derived from
+// $SUMMON_CACHE_KEY or read from (and if necessary generated into) keyPath. The
+// key file is never kept in dir, where whoever could read the entries could
+// read it too.
+func loadKey(dir, keyPath string) ([]byte, error) {
+	if material := os.Getenv(CacheKeyEnv); material != "" {
+		sum := sha256.Sum256([]byte(material))
+		return sum[:], nil
+	}
+
+	if keyPath == "" {
+		return nil, fmt.Errorf("no cache key, set %s", CacheKeyEnv)
+	}
+	if within(dir, keyPath) {
+		return nil, fmt.Errorf("the cache key %s can't be kept in the cache directory %s, set %s or move the cache",
+			keyPath, dir, CacheKeyEnv)
+	}
+
+	key, err := os.ReadFile(keyPath)
+	if err == nil && len(key) == 32 {
+		return key, nil
+	}
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+
+	key = make([]byte, 32)
+	if _, err := io.ReadFull(rand.Reader, key); err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(filepath.Dir(keyPath), 0o700); err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(keyPath, key, 0o600); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// within reports whether path is in dir or one of its subdirectories
+func within(dir, path string) bool {
+	absDir, err := filepath.Abs(dir)
+	if err != nil {
+		return false
+	}
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return false
+	}
+	rel, err := filepath.Rel(absDir, absPath)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
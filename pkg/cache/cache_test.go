@@ -0,0 +1,146 @@
+package cache
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCache(t *testing.T) {
+	t.Run("returns stored values until they expire", func(t *testing.T) {
+		dir := t.TempDir()
+		c, err := New(dir, keyPath(t), "/usr/local/lib/summon/provider", time.Minute)
+		assert.NoError(t, err)
+
+		now := time.Now()
+		c.now = func() time.Time { return now }
+
+		_, ok := c.Get("path/to/secret")
+		assert.False(t, ok)
+
+		assert.NoError(t, c.Put("path/to/secret", []byte("secret-value")))
+		value, ok := c.Get("path/to/secret")
+		assert.True(t, ok)
+		assert.Equal(t, "secret-value", string(value))
+
+		now = now.Add(time.Minute)
+		_, ok = c.Get("path/to/secret")
+		assert.False(t, ok)
+	})
+
+	t.Run("expires values when their lease ends, if sooner", func(t *testing.T) {
+		c, err := New(t.TempDir(), keyPath(t), "provider", time.Hour)
+		assert.NoError(t, err)
+
+		now := time.Now()
+		c.now = func() time.Time { return now }
+
+		response := `{"summon_metadata": 1, "value": "secret-value", "lease_duration": 60}`
+		assert.NoError(t, c.Put("path/to/secret", []byte(response)))
+		value, ok := c.Get("path/to/secret")
+		assert.True(t, ok)
+		assert.Equal(t, response, string(value))
+
+		now = now.Add(time.Minute)
+		_, ok = c.Get("path/to/secret")
+		assert.False(t, ok)
+	})
+
+	t.Run("keeps values of different providers apart", func(t *testing.T) {
+		dir, key := t.TempDir(), keyPath(t)
+		c1, err := New(dir, key, "provider1", time.Minute)
+		assert.NoError(t, err)
+		c2, err := New(dir, key, "provider2", time.Minute)
+		assert.NoError(t, err)
+
+		assert.NoError(t, c1.Put("path", []byte("value")))
+		_, ok := c2.Get("path")
+		assert.False(t, ok)
+	})
+
+	t.Run("does not store plaintext on disk", func(t *testing.T) {
+		dir := t.TempDir()
+		c, err := New(dir, keyPath(t), "provider", time.Minute)
+		assert.NoError(t, err)
+		assert.NoError(t, c.Put("path/to/secret", []byte("secret-value")))
+
+		files, err := os.ReadDir(dir)
+		assert.NoError(t, err)
+		for _, file := range files {
+			content, err := os.ReadFile(filepath.Join(dir, file.Name()))
+			assert.NoError(t, err)
+			assert.NotContains(t, string(content), "secret-value")
+			assert.NotContains(t, file.Name(), "secret")
+		}
+	})
+
+	t.Run("ignores entries encrypted with another key", func(t *testing.T) {
+		dir := t.TempDir()
+		t.Setenv(CacheKeyEnv, "key1")
+		c1, err := New(dir, keyPath(t), "provider", time.Minute)
+		assert.NoError(t, err)
+		assert.NoError(t, c1.Put("path", []byte("value")))
+
+		t.Setenv(CacheKeyEnv, "key2")
+		c2, err := New(dir, keyPath(t), "provider", time.Minute)
+		assert.NoError(t, err)
+		_, ok := c2.Get("path")
+		assert.False(t, ok)
+	})
+
+	t.Run("keeps the generated key out of the cache directory", func(t *testing.T) {
+		dir, key := t.TempDir(), keyPath(t)
+		_, err := New(dir, key, "provider", time.Minute)
+		assert.NoError(t, err)
+
+		info, err := os.Stat(key)
+		assert.NoError(t, err)
+		assert.Equal(t, os.FileMode(0o600), info.Mode().Perm())
+		files, err := os.ReadDir(dir)
+		assert.NoError(t, err)
+		assert.Empty(t, files)
+	})
+
+	t.Run("refuses a key file in the cache directory", func(t *testing.T) {
+		dir := t.TempDir()
+		_, err := New(dir, filepath.Join(dir, "keys", "key"), "provider", time.Minute)
+		assert.ErrorContains(t, err, "can't be kept in the cache directory")
+
+		t.Setenv(CacheKeyEnv, "key")
+		_, err = New(dir, filepath.Join(dir, "key"), "provider", time.Minute)
+		assert.NoError(t, err)
+	})
+
+	t.Run("rejects a non-positive TTL", func(t *testing.T) {
+		_, err := New(t.TempDir(), keyPath(t), "provider", 0)
+		assert.Error(t, err)
+	})
+}
+
+func TestClear(t *testing.T) {
+	dir, key := t.TempDir(), keyPath(t)
+	c, err := New(dir, key, "provider", time.Minute)
+	assert.NoError(t, err)
+	assert.NoError(t, c.Put("path", []byte("value")))
+
+	unrelated := filepath.Join(dir, "unrelated")
+	assert.NoError(t, os.WriteFile(unrelated, nil, 0o600))
+
+	assert.NoError(t, Clear(dir, key))
+
+	files, err := os.ReadDir(dir)
+	assert.NoError(t, err)
+	assert.Len(t, files, 1)
+	assert.Equal(t, "unrelated", files[0].Name())
+	assert.NoFileExists(t, key)
+
+	assert.NoError(t, Clear(filepath.Join(dir, "missing"), key))
+}
+
+// keyPath returns where a test keeps its generated key, apart from the cache
+func keyPath(t *testing.T) string {
+	return filepath.Join(t.TempDir(), "summon", "cache.key")
+}
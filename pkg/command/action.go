@@ -2,81 +2,670 @@ package command
 
 import (
 	"bytes"
+	"context"
+	"errors"
 	"fmt"
+	"io"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"strconv"
 	"strings"
+	"time"
 
+	"github.com/cyberark/summon/pkg/cache"
+	"github.com/cyberark/summon/pkg/config"
 	prov "github.com/cyberark/summon/pkg/provider"
+	"github.com/cyberark/summon/pkg/secretsyml"
 	"github.com/cyberark/summon/pkg/summon"
+	"github.com/cyberark/summon/pkg/telemetry"
 	"github.com/urfave/cli"
 )
 
 // Action is the runner for the main program logic
 var Action = func(c *cli.Context) {
-	if !c.Args().Present() && !c.Bool("all-provider-versions") {
+	script := c.String("shell")
+	if !c.Args().Present() && script == "" && !c.Bool("all-provider-versions") {
 		fmt.Println("Enter a subprocess to run!")
 		os.Exit(127)
 	}
+	if script != "" && c.Args().Present() {
+		fmt.Println("--shell runs a script instead of a command, not both")
+		os.Exit(summon.ExitUnknownError)
+	}
 
-	provider, err := prov.Resolve(c.String("provider"))
-	// It's okay to not throw this error here, because `Resolve()` throws an
-	// error if there are multiple unspecified providers. `all-provider-versions`
-	// doesn't care about this and just looks in the default provider dir
-	if err != nil && !c.Bool("all-provider-versions") {
-		fmt.Println(err.Error())
-		os.Exit(127)
+	if format := c.String("error-format"); format != errorFormatText && format != errorFormatJSON {
+		fmt.Printf("Unknown error format %q, expected text or json\n", format)
+		os.Exit(summon.ExitUnknownError)
+	}
+
+	switch c.String("ci") {
+	case "", summon.CIGitHub, summon.CIGitLab:
+	default:
+		fmt.Printf("Unknown CI system %q, expected github or gitlab\n", c.String("ci"))
+		os.Exit(summon.ExitUnknownError)
+	}
+	if c.Bool("ci-export") && c.String("ci") != summon.CIGitHub {
+		fmt.Println("--ci-export requires --ci github")
+		os.Exit(summon.ExitUnknownError)
+	}
+
+	switch c.String("deliver") {
+	case summon.DeliverEnv, summon.DeliverFD:
+	default:
+		fmt.Printf("Unknown delivery mode %q, expected env or fd\n", c.String("deliver"))
+		os.Exit(summon.ExitUnknownError)
+	}
+
+	var renewSignal os.Signal
+	if name := c.String("renew-signal"); name != "" {
+		if !c.Bool("renew") {
+			fmt.Println("--renew-signal requires --renew")
+			os.Exit(summon.ExitUnknownError)
+		}
+		var err error
+		if renewSignal, err = summon.ParseSignal(name); err != nil {
+			fmt.Printf("Invalid --renew-signal: %s\n", err)
+			os.Exit(summon.ExitUnknownError)
+		}
+	}
+	if c.Bool("renew") && c.Duration("cache-ttl") > 0 && !c.Bool("no-cache") {
+		fmt.Println("--renew can't be used with --cache-ttl")
+		os.Exit(summon.ExitUnknownError)
+	}
+
+	if c.Bool("upcase") && c.Bool("downcase") {
+		fmt.Println("--upcase and --downcase can't be used together")
+		os.Exit(summon.ExitUnknownError)
+	}
+
+	var umask *os.FileMode
+	if s := c.String("umask"); s != "" {
+		mask, err := summon.ParseUmask(s)
+		if err != nil {
+			fmt.Printf("Invalid --umask: %s\n", err)
+			os.Exit(summon.ExitUnknownError)
+		}
+		umask = &mask
+	}
+	var rlimits []summon.Rlimit
+	for _, spec := range c.StringSlice("rlimit") {
+		limit, err := summon.ParseRlimit(spec)
+		if err != nil {
+			fmt.Printf("Invalid --rlimit: %s\n", err)
+			os.Exit(summon.ExitUnknownError)
+		}
+		rlimits = append(rlimits, limit)
 	}
 
 	if c.Bool("all-provider-versions") {
-		if err := runPrintProviderVersions(); err != nil {
-			fmt.Println(err.Error())
-			os.Exit(127)
+		if err := runPrintProviderVersions(newOutput(c)); err != nil {
+			exitWithError(c, err)
 		}
 		return
 	}
 
+	project, err := findProject(c)
+	if err != nil {
+		exitWithError(c, &summon.ExitCodeError{ExitCode: summon.ExitParseError, Err: err})
+	}
+
+	subs := substitutions(c, project)
+	environment := c.String("environment")
+	secretsFile := c.String("f")
+	if project != nil {
+		if environment == "" {
+			environment = project.Environment
+		}
+		if !c.Bool("up") {
+			secretsFile = projectSecretsFile(c, project)
+		}
+	}
+
+	// Secrets given with --secret make the secrets file optional
+	if len(c.StringSlice("secret")) > 0 && !c.IsSet("f") {
+		secretsFile = ""
+	}
+
+	search, err := setupSearch(c)
+	if err != nil {
+		exitWithError(c, err)
+	}
+	format, err := secretsFormat(c)
+	if err != nil {
+		exitWithError(c, err)
+	}
+
+	// Telemetry must never fail a run
+	tel, err := telemetry.FromEnv(os.Getenv, summon.FullVersionName)
+	if err != nil && !c.Bool("quiet") {
+		fmt.Fprintf(os.Stderr, "summon: telemetry disabled: %s\n", err)
+	}
+
+	args := []string(c.Args())
+	var shell string
+	if script != "" {
+		args = []string{script}
+		if shell = c.String("shell-program"); shell == "" {
+			shell = summon.DefaultShell()
+		}
+	}
+
 	code, err := summon.RunSubprocess(&summon.SubprocessConfig{
-		Args:        c.Args(),
-		Environment: c.String("environment"),
-		Filepath:    c.String("f"),
-		YamlInline:  c.String("yaml"),
-		Ignores:     c.StringSlice("ignore"),
-		IgnoreAll:   c.Bool("ignore-all"),
-		RecurseUp:   c.Bool("up"),
-		Subs:        c.StringSlice("D"),
-		Provider:    provider,
-		FetchSecret: func(secretId string) ([]byte, error) {
-			s, err := prov.Call(provider, secretId)
-			return []byte(s), err
+		Args:               args,
+		Environment:        environment,
+		Filepath:           secretsFile,
+		Secrets:            c.StringSlice("secret"),
+		YamlInline:         c.String("yaml"),
+		Format:             format,
+		Ignores:            c.StringSlice("ignore"),
+		IgnoreAll:          c.Bool("ignore-all"),
+		RecurseUp:          c.Bool("up"),
+		SearchBoundary:     search.boundary,
+		ConfirmOutsideRepo: search.confirmOutsideRepo,
+		Confirm:            summon.TerminalConfirm,
+		Subs:               subs,
+		Retries:            c.Int("retries"),
+		RetryBackoff:       c.Duration("retry-backoff"),
+		ReportSignal:       c.Bool("report-signal"),
+		NewProcessGroup:    c.Bool("new-process-group"),
+		StdinSecret:        c.String("stdin-secret"),
+		Prompt:             summon.TerminalPrompt,
+		PromptOnFailure:    c.Bool("prompt"),
+		CI:                 c.String("ci"),
+		CIExport:           c.Bool("ci-export"),
+		EnvKeep:            c.StringSlice("env-keep"),
+		EnvExclude:         c.StringSlice("env-exclude"),
+		CleanEnv:           c.Bool("clean-env"),
+		Harden:             c.Bool("harden"),
+		Deliver:            c.String("deliver"),
+		Renew:              c.Bool("renew"),
+		RenewSignal:        renewSignal,
+		Naming:             envNaming(c),
+		Telemetry:          tel,
+		Timeout:            c.Duration("timeout"),
+		GracePeriod:        c.Duration("grace-period"),
+		Shell:              shell,
+		Dir:                c.String("chdir"),
+		User:               c.String("user"),
+		Umask:              umask,
+		Rlimits:            rlimits,
+		// The provider may depend on the environment section of secrets.yml
+		UseProvider: func(sc *summon.SubprocessConfig, declared string) error {
+			provider, err := setupProvider(c, project, declared)
+			if err != nil {
+				return err
+			}
+			provider.use(sc, c.Duration("provider-timeout"))
+			return nil
 		},
 	})
 
+	if err := tel.Shutdown(context.Background()); err != nil && !c.Bool("quiet") {
+		fmt.Fprintf(os.Stderr, "summon: %s\n", err)
+	}
+
 	if err != nil {
-		fmt.Println(err.Error())
-		os.Exit(127)
+		exitWithError(c, err)
+	}
+
+	if code != 0 && !c.BoolT("passthrough-exit-code") {
+		err := fmt.Errorf("summon: command exited with status %d", code)
+		if c.String("error-format") == errorFormatJSON {
+			exitWithError(c, &summon.ExitCodeError{ExitCode: summon.ExitSubcommandFailed, Err: err})
+		}
+		fmt.Fprintln(os.Stderr, err)
+		code = summon.ExitSubcommandFailed
 	}
 
 	os.Exit(code)
 }
 
-func runPrintProviderVersions() error {
-	defaultPath, err := prov.GetDefaultPath()
+// envNaming returns how variables from secrets.yml are to be named
+func envNaming(c *cli.Context) summon.EnvNaming {
+	naming := summon.EnvNaming{Prefix: c.String("prefix")}
+	if c.Bool("upcase") {
+		naming.Case = summon.UpperCase
+	}
+	if c.Bool("downcase") {
+		naming.Case = summon.LowerCase
+	}
+	return naming
+}
+
+// providerSetup is the provider secrets are resolved with, and how to run it
+type providerSetup struct {
+	path    string
+	options prov.Options
+	cache   summon.SecretCache
+}
+
+// setupProvider picks the provider from the command line, the environment,
+// .summonrc, the one declared by secrets.yml (or "") or the config file (in
+// that order of precedence) and checks that it may be run. Errors carry the
+// exit code summon should fail with.
+func setupProvider(c *cli.Context, project *config.Project, declared string) (*providerSetup, error) {
+	cfg, err := config.LoadDefault()
+	if err != nil {
+		return nil, err
+	}
+
+	// A provider from .summonrc applies only when none is given explicitly,
+	// and one declared by secrets.yml only when summon isn't told otherwise
+	providerArg := c.String("provider")
+	if providerArg == "" {
+		providerArg = os.Getenv("SUMMON_PROVIDER")
+	}
+	if providerArg == "" && project != nil {
+		providerArg = project.Provider
+	}
+	usesDeclared := providerArg == "" && declared != ""
+	if usesDeclared {
+		providerArg = declared
+	}
+
+	// Any of them may name an alias from the config file
+	cacheName := providerArg
+	alias, isAlias := cfg.Alias(providerArg)
+	if isAlias {
+		providerArg = alias.Provider
+	}
+
+	provider, err := prov.Resolve(providerArg)
+	if err != nil {
+		if usesDeclared {
+			err = fmt.Errorf("provider %s declared in secrets.yml: %s", declared, err)
+		}
+		return nil, &summon.ExitCodeError{ExitCode: summon.ExitProviderNotFound, Err: err}
+	}
+
+	if err := verifyProvider(cfg, provider); err != nil {
+		return nil, &summon.ExitCodeError{ExitCode: summon.ExitProviderNotFound, Err: err}
+	}
+	if err := checkRequirements(cfg, provider); err != nil {
+		return nil, err
+	}
+
+	// Aliases of the same provider may resolve paths differently, so their
+	// cached values are kept apart
+	if !isAlias {
+		cacheName = provider
+	}
+	secretCache, err := openCache(c, cacheName)
 	if err != nil {
+		return nil, err
+	}
+
+	options := providerOptions(c, cfg, provider, alias)
+	if options.MaxOutputSize, err = parseSize(c.String("max-secret-size")); err != nil {
+		return nil, fmt.Errorf("invalid maximum secret size: %s", err)
+	}
+	if options.PathVia, err = pathVia(c, cfg, provider); err != nil {
+		return nil, err
+	}
+	// Interactive mode keeps its own default unless a timeout is given, and
+	// 0 means no limit there too
+	if c.IsSet("provider-timeout") {
+		if options.Timeout = c.Duration("provider-timeout"); options.Timeout <= 0 {
+			options.Timeout = -1
+		}
+	}
+
+	return &providerSetup{
+		path:    provider,
+		options: options,
+		cache:   secretCache,
+	}, nil
+}
+
+// use sets the provider of sc, with its timeout for each call
+func (p *providerSetup) use(sc *summon.SubprocessConfig, timeout time.Duration) {
+	sc.Provider = p.path
+	sc.Cache = p.cache
+	sc.ProviderOptions = p.options
+	sc.FetchSecret = p.fetchSecret(timeout)
+	sc.StreamSecret = p.streamSecret(timeout)
+}
+
+// checkSecret returns a function that asks the provider whether it can
+// resolve a single secret path (--exists), giving up after timeout unless it
+// is zero
+func (p *providerSetup) checkSecret(timeout time.Duration) func(string) error {
+	opts := p.options
+	opts.Args = append(append([]string{}, opts.Args...), "--exists")
+	return func(secretId string) error {
+		ctx, cancel := providerContext(timeout)
+		defer cancel()
+		_, err := prov.CallContext(ctx, p.path, secretId, opts)
 		return err
 	}
-	output, err := printProviderVersions(defaultPath)
+}
+
+// fetchSecret returns a function that resolves a single secret path with the
+// provider, giving up after timeout unless it is zero
+func (p *providerSetup) fetchSecret(timeout time.Duration) func(string) ([]byte, error) {
+	return func(secretId string) ([]byte, error) {
+		ctx, cancel := providerContext(timeout)
+		defer cancel()
+		s, err := prov.CallContext(ctx, p.path, secretId, p.options)
+		return []byte(s), err
+	}
+}
+
+// streamSecret returns a function that writes the value of a single secret
+// path to w as the provider returns it, giving up after timeout unless it is
+// zero
+func (p *providerSetup) streamSecret(timeout time.Duration) summon.SecretStreamer {
+	return func(secretId string, w io.Writer) error {
+		ctx, cancel := providerContext(timeout)
+		defer cancel()
+		return prov.CallStream(ctx, p.path, secretId, p.options, w)
+	}
+}
+
+// parseSize parses a size in bytes, optionally with a K, M or G suffix for
+// KiB, MiB or GiB (e.g. 64M). An empty size is zero.
+func parseSize(size string) (int64, error) {
+	number := strings.TrimSuffix(strings.TrimSuffix(strings.ToUpper(strings.TrimSpace(size)), "B"), "I")
+	if number == "" {
+		return 0, nil
+	}
+
+	multiplier := int64(1)
+	switch number[len(number)-1] {
+	case 'K':
+		multiplier = 1 << 10
+	case 'M':
+		multiplier = 1 << 20
+	case 'G':
+		multiplier = 1 << 30
+	}
+	if multiplier > 1 {
+		number = number[:len(number)-1]
+	}
+
+	n, err := strconv.ParseInt(number, 10, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("%q is not a size in bytes", size)
+	}
+	return n * multiplier, nil
+}
+
+// searchSetup holds the limits of the upward search for the secrets file
+type searchSetup struct {
+	boundary           summon.SearchBoundary
+	confirmOutsideRepo bool
+}
+
+// setupSearch combines the limits of the upward search for the secrets file
+// given on the command line with those in the config file
+func setupSearch(c *cli.Context) (*searchSetup, error) {
+	search := &searchSetup{
+		boundary: summon.SearchBoundary{
+			Root:        c.String("search-root"),
+			StopMarkers: c.StringSlice("search-stop"),
+		},
+		confirmOutsideRepo: c.Bool("confirm-outside-repo"),
+	}
+	if !c.Bool("up") {
+		return search, nil
+	}
+
+	cfg, err := config.LoadDefault()
+	if err != nil {
+		return nil, err
+	}
+	search.boundary = searchBoundary(c, cfg)
+	search.confirmOutsideRepo = search.confirmOutsideRepo || cfg.Search.ConfirmOutsideRepo
+	return search, nil
+}
+
+// searchBoundary returns the limits of upward searches, given on the command
+// line, to summon or to a subcommand, and in the config file
+func searchBoundary(c *cli.Context, cfg *config.Config) summon.SearchBoundary {
+	boundary := summon.SearchBoundary{
+		Root:        c.String("search-root"),
+		StopMarkers: append(append([]string{}, cfg.Search.StopMarkers...), c.StringSlice("search-stop")...),
+	}
+	if boundary.Root == "" {
+		boundary.Root = c.GlobalString("search-root")
+	}
+	if boundary.Root == "" {
+		boundary.Root = cfg.Search.Root
+	}
+	boundary.StopMarkers = append(boundary.StopMarkers, c.GlobalStringSlice("search-stop")...)
+	return boundary
+}
+
+// secretsFormat returns the format of the secrets file given with --format,
+// or "" to tell it by its extension
+func secretsFormat(c *cli.Context) (secretsyml.Format, error) {
+	if c.String("format") == "" {
+		return "", nil
+	}
+	format, err := secretsyml.ParseFormat(c.String("format"))
+	if err != nil {
+		return "", &summon.ExitCodeError{ExitCode: summon.ExitParseError, Err: err}
+	}
+	return format, nil
+}
+
+// substitutions returns the var=value substitutions for a run: those of the
+// project, then those taken from environment variables with --subs-from-env,
+// then -D, each overriding the previous ones
+func substitutions(c *cli.Context, project *config.Project) []string {
+	var subs []string
+	if project != nil {
+		subs = project.SubstitutionPairs()
+	}
+	if prefix := c.String("subs-from-env"); prefix != "" {
+		subs = append(subs, subsFromEnv(prefix, os.Environ())...)
+	}
+	return append(subs, c.StringSlice("D")...)
+}
+
+// subsFromEnv turns the variables in environ whose name starts with prefix
+// into substitutions named after the rest of their name. Their values are
+// taken literally.
+func subsFromEnv(prefix string, environ []string) []string {
+	var subs []string
+	for _, variable := range environ {
+		if name, ok := strings.CutPrefix(variable, prefix); ok && !strings.HasPrefix(name, "=") {
+			subs = append(subs, strings.ReplaceAll(name, "$", "$$"))
+		}
+	}
+	return subs
+}
+
+// findProject returns the project defaults from the .summonrc closest to the
+// working directory, or nil if there is none. The search stops at the same
+// limits as the one for the secrets file. A .summonrc that isn't trusted or
+// doesn't parse is ignored, with a warning, rather than failing every run
+// below it.
+func findProject(c *cli.Context) (*config.Project, error) {
+	currentDir, err := os.Getwd()
+	if err != nil {
+		return nil, err
+	}
+	cfg, err := config.LoadDefault()
+	if err != nil {
+		return nil, err
+	}
+	path, err := summon.FindInParentTreeWithin(config.ProjectFileName, currentDir, searchBoundary(c, cfg))
+	if err != nil {
+		// Most projects don't have a .summonrc
+		return nil, nil
+	}
+
+	project, err := config.LoadProject(path)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "summon: ignoring project defaults: %s\n", err)
+		return nil, nil
+	}
+	return project, nil
+}
+
+// projectSecretsFile returns the secrets file to use with the project: the
+// project's, unless -f was given or the secrets file is in the working
+// directory, where it takes precedence over a .summonrc in a parent directory
+func projectSecretsFile(c *cli.Context, project *config.Project) string {
+	secretsFile := c.String("f")
+	if project == nil || c.IsSet("f") {
+		return secretsFile
+	}
+	if currentDir, err := os.Getwd(); err == nil && project.Dir != currentDir {
+		if _, err := os.Stat(secretsFile); err == nil {
+			return secretsFile
+		}
+	}
+	return project.SecretsPath()
+}
+
+// verifyProvider checks the provider executable against the checksum pinned
+// for it in the config file, if any
+func verifyProvider(cfg *config.Config, provider string) error {
+	providerConfig, ok := cfg.Provider(provider)
+	if !ok || providerConfig.SHA256 == "" {
+		if cfg.RequireProviderChecksums {
+			return fmt.Errorf("provider %s has no checksum pinned in %s", provider, cfg.Source())
+		}
+		return nil
+	}
+	return prov.Verify(provider, providerConfig.SHA256)
+}
+
+// checkRequirements checks the provider against the versions of it the config
+// file requires, if any
+func checkRequirements(cfg *config.Config, provider string) error {
+	requirements := make([]prov.Requirement, len(cfg.Requires))
+	for i, constraint := range cfg.Requires {
+		var err error
+		if requirements[i], err = prov.ParseRequirement(constraint); err != nil {
+			return fmt.Errorf("%s: %s", cfg.Source(), err)
+		}
+	}
+	if err := prov.CheckRequirements(provider, requirements, cfg.Source()); err != nil {
+		return &summon.ExitCodeError{ExitCode: summon.ExitProviderNotFound, Err: err}
+	}
+	return nil
+}
+
+// providerOptions returns how the provider should be run, according to the
+// command line, the config file and the alias the provider was chosen by (the
+// zero Alias if none)
+func providerOptions(c *cli.Context, cfg *config.Config, provider string, alias config.Alias) prov.Options {
+	opts := prov.Options{Args: alias.Args}
+
+	envPatterns := c.StringSlice("provider-env")
+	opts.Sandbox.Enabled = c.Bool("provider-sandbox")
+	opts.Sandbox.SeccompProfile = c.String("provider-seccomp")
+
+	if providerConfig, ok := cfg.Provider(provider); ok {
+		envPatterns = append(envPatterns, providerConfig.Env...)
+		opts.Sandbox.Enabled = opts.Sandbox.Enabled || providerConfig.Sandbox
+		if opts.Sandbox.SeccompProfile == "" {
+			opts.Sandbox.SeccompProfile = providerConfig.Seccomp
+		}
+	}
+
+	if len(envPatterns) > 0 {
+		opts.Env = prov.FilterEnv(os.Environ(), envPatterns)
+	}
+	if len(alias.Env) > 0 {
+		if opts.Env == nil {
+			opts.Env = os.Environ()
+		}
+		opts.Env = append(opts.Env, alias.EnvPairs()...)
+	}
+	if opts.Sandbox.SeccompProfile != "" {
+		opts.Sandbox.Enabled = true
+	}
+
+	return opts
+}
+
+// pathVia returns how secret paths are passed to provider, according to the
+// command line or else the config file. With auto, the provider is asked for
+// the ways it supports, and legacy providers get them as an argument.
+func pathVia(c *cli.Context, cfg *config.Config, provider string) (string, error) {
+	via := c.String("provider-path-via")
+	if providerConfig, ok := cfg.Provider(provider); ok && via == "" {
+		via = providerConfig.PathVia
+	}
+
+	switch via {
+	case "", prov.PathViaArgv, prov.PathViaStdin, prov.PathViaEnv:
+		return via, nil
+	case "auto":
+		return prov.NegotiatePathVia(prov.Capabilities(provider)), nil
+	default:
+		return "", fmt.Errorf("invalid provider path passing %q, expected argv, stdin, env or auto", via)
+	}
+}
+
+// openCache returns the secret cache for values resolved by provider (a path,
+// or the name of an alias), or nil if caching is off
+func openCache(c *cli.Context, provider string) (summon.SecretCache, error) {
+	ttl := c.Duration("cache-ttl")
+	if ttl <= 0 || c.Bool("no-cache") {
+		return nil, nil
+	}
+
+	dir, err := cache.DefaultDir()
+	if err != nil {
+		return nil, err
+	}
+	// Without a config directory, the key must come from SUMMON_CACHE_KEY
+	keyPath, _ := cache.DefaultKeyPath()
+	return cache.New(dir, keyPath, provider, ttl)
+}
+
+// providerContext returns the context a single provider call runs under,
+// bounded by timeout unless it is zero
+func providerContext(timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		return context.WithCancel(context.Background())
+	}
+	return context.WithTimeout(context.Background(), timeout)
+}
+
+func runPrintProviderVersions(out *output) error {
+	if out.quiet {
+		return nil
+	}
+	if out.json {
+		report, err := newVersionReport()
+		if err != nil {
+			return err
+		}
+		return out.print(report, nil)
+	}
+
+	cfg, err := config.LoadDefault()
+	if err != nil {
+		return err
+	}
+	searchPaths, err := prov.GetSearchPaths()
 	if err != nil {
 		return err
 	}
+	for _, providerPath := range searchPaths {
+		versions, err := printProviderVersions(providerPath, cfg)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
 
-	fmt.Print(output)
+		fmt.Print(versions)
+	}
 	return nil
 }
 
-// printProviderVersions returns a string of all provider versions
-func printProviderVersions(providerPath string) (string, error) {
+// printProviderVersions returns a string of all provider versions. Providers
+// that fail their checksum check aren't run.
+func printProviderVersions(providerPath string, cfg *config.Config) (string, error) {
 	var providerVersions bytes.Buffer
 
 	providerVersions.WriteString(fmt.Sprintf("Provider versions in %s:\n", providerPath))
@@ -87,6 +676,10 @@ func printProviderVersions(providerPath string) (string, error) {
 	}
 
 	for _, provider := range providers {
+		if err := verifyProvider(cfg, filepath.Join(providerPath, provider)); err != nil {
+			providerVersions.WriteString(fmt.Sprintf("%s: not run, %s\n", provider, err))
+			continue
+		}
 		version, err := exec.Command(filepath.Join(providerPath, provider), "--version").Output()
 		if err != nil {
 			providerVersions.WriteString(fmt.Sprintf("%s: unknown version\n", provider))
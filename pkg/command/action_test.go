@@ -1,11 +1,16 @@
 package command
 
 import (
+	"flag"
 	"os"
 	"path/filepath"
 	"testing"
+	"time"
 
+	"github.com/cyberark/summon/pkg/config"
+	prov "github.com/cyberark/summon/pkg/provider"
 	"github.com/stretchr/testify/assert"
+	"github.com/urfave/cli"
 	_ "golang.org/x/net/context"
 )
 
@@ -22,7 +27,7 @@ func TestPrintProviderVersions(t *testing.T) {
 		//test1 - regular formating and appending of version # to string
 		//test2 - chopping off of trailing newline
 		//test3 - failed `--version` call
-		output, err := printProviderVersions(pathToTest)
+		output, err := printProviderVersions(pathToTest, &config.Config{})
 		assert.NoError(t, err)
 
 		expected := `Provider versions in /summon/pkg/command/testversions:
@@ -34,3 +39,218 @@ testprovider-trailingnewline version 3.2.1
 		assert.Equal(t, expected, output)
 	})
 }
+
+func TestPrintProviderVersionsVerifiesProviders(t *testing.T) {
+	cfg := &config.Config{Providers: map[string]config.ProviderConfig{
+		"testprovider": {SHA256: "0000"},
+	}}
+
+	output, err := printProviderVersions("testversions", cfg)
+	assert.NoError(t, err)
+	assert.Contains(t, output, "testprovider: not run, provider testversions/testprovider failed integrity check")
+	assert.Contains(t, output, "testprovider-trailingnewline version 3.2.1")
+}
+
+func TestParseSize(t *testing.T) {
+	for size, expected := range map[string]int64{
+		"":      0,
+		"0":     0,
+		"1024":  1024,
+		"16k":   16 << 10,
+		"64M":   64 << 20,
+		"64MiB": 64 << 20,
+		"1GB":   1 << 30,
+	} {
+		n, err := parseSize(size)
+		assert.NoError(t, err, size)
+		assert.Equal(t, expected, n, size)
+	}
+
+	for _, size := range []string{"M", "-1", "10X", "1.5M"} {
+		_, err := parseSize(size)
+		assert.Error(t, err, size)
+	}
+}
+
+func TestSubsFromEnv(t *testing.T) {
+	assert.Equal(t, []string{"ENV=prod", "REGION=eu=west", "PRICE=$$5"}, subsFromEnv("DEPLOY_", []string{
+		"PATH=/bin",
+		"DEPLOY_ENV=prod",
+		"DEPLOY_=ignored",
+		"DEPLOY_REGION=eu=west",
+		"DEPLOY_PRICE=$5",
+	}))
+	assert.Empty(t, subsFromEnv("DEPLOY_", []string{"HOME=/root"}))
+}
+
+func TestPathVia(t *testing.T) {
+	provider := filepath.Join(t.TempDir(), "provider")
+	script := "#!/bin/sh\n[ \"$1\" = --capabilities ] && echo batch path-env\n"
+	assert.NoError(t, os.WriteFile(provider, []byte(script), 0755))
+
+	newContext := func(args ...string) *cli.Context {
+		set := flag.NewFlagSet("summon", flag.ContinueOnError)
+		set.String("provider-path-via", "", "")
+		assert.NoError(t, set.Parse(args))
+		return cli.NewContext(cli.NewApp(), set, nil)
+	}
+	cfg := &config.Config{Providers: map[string]config.ProviderConfig{"provider": {PathVia: "stdin"}}}
+
+	t.Run("the command line takes precedence over the config file", func(t *testing.T) {
+		via, err := pathVia(newContext("--provider-path-via", "argv"), cfg, provider)
+		assert.NoError(t, err)
+		assert.Equal(t, prov.PathViaArgv, via)
+
+		via, err = pathVia(newContext(), cfg, provider)
+		assert.NoError(t, err)
+		assert.Equal(t, prov.PathViaStdin, via)
+	})
+
+	t.Run("auto negotiates with the provider", func(t *testing.T) {
+		via, err := pathVia(newContext("--provider-path-via", "auto"), &config.Config{}, provider)
+		assert.NoError(t, err)
+		assert.Equal(t, prov.PathViaEnv, via)
+	})
+
+	t.Run("unknown ways fail", func(t *testing.T) {
+		_, err := pathVia(newContext("--provider-path-via", "pipe"), &config.Config{}, provider)
+		assert.EqualError(t, err, `invalid provider path passing "pipe", expected argv, stdin, env or auto`)
+	})
+}
+
+func TestFindProject(t *testing.T) {
+	t.Setenv(config.ConfigEnv, filepath.Join(t.TempDir(), "missing.yml"))
+	root, err := filepath.EvalSymlinks(t.TempDir())
+	assert.NoError(t, err)
+	app := filepath.Join(root, "repo", "app")
+	assert.NoError(t, os.MkdirAll(filepath.Join(root, "repo", ".git"), 0o755))
+	assert.NoError(t, os.MkdirAll(app, 0o755))
+	assert.NoError(t, os.WriteFile(filepath.Join(root, config.ProjectFileName), []byte("environment: prod\n"), 0o600))
+
+	newContext := func(args ...string) *cli.Context {
+		set := flag.NewFlagSet("summon", flag.ContinueOnError)
+		set.String("f", "secrets.yml", "")
+		set.String("search-root", "", "")
+		set.Var(&cli.StringSlice{}, "search-stop", "")
+		assert.NoError(t, set.Parse(args))
+		return cli.NewContext(cli.NewApp(), set, nil)
+	}
+	defer chdir(t, app)()
+
+	t.Run("a .summonrc in a parent directory applies", func(t *testing.T) {
+		project, err := findProject(newContext())
+		assert.NoError(t, err)
+		if assert.NotNil(t, project) {
+			assert.Equal(t, "prod", project.Environment)
+			assert.Equal(t, filepath.Join(root, "secrets.yml"), projectSecretsFile(newContext(), project))
+		}
+	})
+
+	t.Run("the search stops at the limits of the one for secrets.yml", func(t *testing.T) {
+		project, err := findProject(newContext("--search-stop", ".git"))
+		assert.NoError(t, err)
+		assert.Nil(t, project)
+
+		project, err = findProject(newContext("--search-root", filepath.Join(root, "repo")))
+		assert.NoError(t, err)
+		assert.Nil(t, project)
+	})
+
+	t.Run("secrets.yml in the working directory takes precedence", func(t *testing.T) {
+		assert.NoError(t, os.WriteFile(filepath.Join(app, "secrets.yml"), []byte("A: a\n"), 0o600))
+		defer os.Remove(filepath.Join(app, "secrets.yml"))
+
+		project, err := findProject(newContext())
+		assert.NoError(t, err)
+		assert.Equal(t, "secrets.yml", projectSecretsFile(newContext(), project))
+	})
+
+	t.Run("a .summonrc that doesn't parse is ignored", func(t *testing.T) {
+		rc := filepath.Join(app, config.ProjectFileName)
+		assert.NoError(t, os.WriteFile(rc, []byte("provider: ["), 0o600))
+		defer os.Remove(rc)
+
+		project, err := findProject(newContext())
+		assert.NoError(t, err)
+		assert.Nil(t, project)
+	})
+}
+
+func TestSetupProvider(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"summon-file", "summon-conjur"} {
+		assert.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte("#!/bin/sh\n"), 0o755))
+	}
+	t.Setenv("SUMMON_PROVIDER_PATH", dir)
+	t.Setenv(config.ConfigEnv, filepath.Join(t.TempDir(), "missing.yml"))
+	t.Setenv("SUMMON_PROVIDER", "")
+
+	newContext := func(args ...string) *cli.Context {
+		set := flag.NewFlagSet("summon", flag.ContinueOnError)
+		for _, f := range Flags {
+			f.Apply(set)
+		}
+		assert.NoError(t, set.Parse(args))
+		return cli.NewContext(cli.NewApp(), set, nil)
+	}
+
+	t.Run("the provider declared by secrets.yml is found in the search path", func(t *testing.T) {
+		provider, err := setupProvider(newContext(), nil, "summon-file")
+		assert.NoError(t, err)
+		assert.Equal(t, filepath.Join(dir, "summon-file"), provider.path)
+	})
+
+	t.Run("the command line, environment and .summonrc take precedence over secrets.yml", func(t *testing.T) {
+		provider, err := setupProvider(newContext("--provider", "summon-conjur"), nil, "summon-file")
+		assert.NoError(t, err)
+		assert.Equal(t, filepath.Join(dir, "summon-conjur"), provider.path)
+
+		provider, err = setupProvider(newContext(), &config.Project{Provider: "summon-conjur"}, "summon-file")
+		assert.NoError(t, err)
+		assert.Equal(t, filepath.Join(dir, "summon-conjur"), provider.path)
+
+		t.Setenv("SUMMON_PROVIDER", "summon-conjur")
+		provider, err = setupProvider(newContext(), nil, "summon-file")
+		assert.NoError(t, err)
+		assert.Equal(t, filepath.Join(dir, "summon-conjur"), provider.path)
+	})
+
+	t.Run("interactive mode is given the provider timeout", func(t *testing.T) {
+		provider, err := setupProvider(newContext(), nil, "summon-file")
+		assert.NoError(t, err)
+		assert.Equal(t, time.Duration(0), provider.options.Timeout)
+
+		provider, err = setupProvider(newContext("--provider-timeout", "30s"), nil, "summon-file")
+		assert.NoError(t, err)
+		assert.Equal(t, 30*time.Second, provider.options.Timeout)
+
+		provider, err = setupProvider(newContext("--provider-timeout", "0"), nil, "summon-file")
+		assert.NoError(t, err)
+		assert.Less(t, provider.options.Timeout, time.Duration(0))
+	})
+
+	t.Run("a declared provider that isn't in the search path fails", func(t *testing.T) {
+		_, err := setupProvider(newContext(), nil, "summon-missing")
+		if assert.Error(t, err) {
+			assert.Contains(t, err.Error(), "provider summon-missing declared in secrets.yml: ")
+		}
+	})
+}
+
+// chdir changes the working directory to dir, and returns a function that
+// restores it
+func chdir(t *testing.T, dir string) func() {
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("chdir %s: %v", dir, err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+
+	return func() {
+		if err := os.Chdir(wd); err != nil {
+			t.Fatalf("restoring working directory: %v", err)
+		}
+	}
+}
@@ -0,0 +1,132 @@
+package command
+
+import (
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"text/tabwriter"
+
+	prov "github.com/cyberark/summon/pkg/provider"
+	"github.com/cyberark/summon/pkg/summon"
+	"github.com/urfave/cli"
+)
+
+// checkReport is the outcome of summon check
+type checkReport struct {
+	Environment string `json:"environment,omitempty"`
+	Provider    string `json:"provider"`
+	// Exists is set if the provider was asked whether paths exist, rather
+	// than for their values
+	Exists  bool                `json:"exists"`
+	Secrets []secretCheckReport `json:"secrets"`
+	Failed  int                 `json:"failed"`
+}
+
+type secretCheckReport struct {
+	Key   string `json:"key"`
+	Path  string `json:"path"`
+	OK    bool   `json:"ok"`
+	Error string `json:"error,omitempty"`
+}
+
+func checkSecrets(c *cli.Context) error {
+	report, err := runCheck(c)
+	if err != nil {
+		return exitError(c, err)
+	}
+
+	if err := newOutput(c).print(report, report.writeText); err != nil {
+		return err
+	}
+	// Like a run that fails to resolve its secrets
+	if report.Failed > 0 {
+		return cli.NewExitError("", summon.ExitProviderError)
+	}
+	return nil
+}
+
+func runCheck(c *cli.Context) (checkReport, error) {
+	var report checkReport
+
+	project, err := findProject(c)
+	if err != nil {
+		return report, &summon.ExitCodeError{ExitCode: summon.ExitParseError, Err: err}
+	}
+	subs := substitutions(c, project)
+	environment := c.String("environment")
+	secretsFile := projectSecretsFile(c, project)
+	if project != nil && environment == "" {
+		environment = project.Environment
+	}
+
+	format, err := secretsFormat(c)
+	if err != nil {
+		return report, err
+	}
+
+	sc := &summon.SubprocessConfig{
+		Environment:  environment,
+		Filepath:     secretsFile,
+		YamlInline:   c.String("yaml"),
+		Format:       format,
+		Subs:         subs,
+		Retries:      c.Int("retries"),
+		RetryBackoff: c.Duration("retry-backoff"),
+		UseProvider: func(sc *summon.SubprocessConfig, declared string) error {
+			provider, err := setupProvider(c, project, declared)
+			if err != nil {
+				return err
+			}
+			provider.use(sc, c.Duration("provider-timeout"))
+			if slices.Contains(prov.Capabilities(provider.path), prov.CapabilityExists) {
+				sc.CheckSecret = provider.checkSecret(c.Duration("provider-timeout"))
+			}
+			return nil
+		},
+	}
+	checks, err := summon.CheckSecrets(sc)
+	if err != nil {
+		return report, err
+	}
+
+	report = checkReport{
+		Environment: environment,
+		Provider:    sc.Provider,
+		Exists:      sc.CheckSecret != nil,
+		Secrets:     []secretCheckReport{},
+	}
+	for _, check := range checks {
+		secret := secretCheckReport{Key: check.Key, Path: check.Path, OK: check.Err == nil}
+		if check.Err != nil {
+			secret.Error = check.Err.Error()
+			report.Failed++
+		}
+		report.Secrets = append(report.Secrets, secret)
+	}
+	return report, nil
+}
+
+// writeText lists every variable with whether it can be resolved, and why
+// not
+func (r checkReport) writeText(out io.Writer) error {
+	w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	for _, secret := range r.Secrets {
+		if secret.OK {
+			fmt.Fprintf(w, "ok\t%s\t%s\n", secret.Key, secret.Path)
+			continue
+		}
+		// Provider errors may hold several lines of stderr
+		fmt.Fprintf(w, "FAILED\t%s\t%s\t%s\n", secret.Key, secret.Path, strings.Join(strings.Fields(secret.Error), " "))
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	if r.Failed > 0 {
+		_, err := fmt.Fprintf(out, "%d of %d secrets can't be resolved by %s\n", r.Failed, len(r.Secrets), r.Provider)
+		return err
+	}
+	_, err := fmt.Fprintf(out, "All %d secrets can be resolved by %s\n", len(r.Secrets), r.Provider)
+	return err
+}
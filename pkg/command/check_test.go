@@ -0,0 +1,36 @@
+package command
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheckReport(t *testing.T) {
+	t.Run("lists failures with why", func(t *testing.T) {
+		var out bytes.Buffer
+		report := checkReport{
+			Provider: "summon-conjur",
+			Secrets: []secretCheckReport{
+				{Key: "API_KEY", Path: "prod/api/key", Error: "exit status 1: 404\nNot Found"},
+				{Key: "DB_PASS", Path: "prod/db/password", OK: true},
+			},
+			Failed: 1,
+		}
+		assert.NoError(t, report.writeText(&out))
+
+		assert.Equal(t, `FAILED  API_KEY  prod/api/key  exit status 1: 404 Not Found
+ok      DB_PASS  prod/db/password
+1 of 2 secrets can't be resolved by summon-conjur
+`, out.String())
+	})
+
+	t.Run("says when all secrets resolve", func(t *testing.T) {
+		var out bytes.Buffer
+		report := checkReport{Provider: "summon-conjur", Secrets: []secretCheckReport{{Key: "DB_PASS", Path: "db", OK: true}}}
+		assert.NoError(t, report.writeText(&out))
+
+		assert.Equal(t, "ok  DB_PASS  db\nAll 1 secrets can be resolved by summon-conjur\n", out.String())
+	})
+}
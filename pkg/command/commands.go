@@ -0,0 +1,425 @@
+package command
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/cyberark/summon/pkg/cache"
+	"github.com/cyberark/summon/pkg/config"
+	prov "github.com/cyberark/summon/pkg/provider"
+	"github.com/cyberark/summon/pkg/summon"
+	"github.com/urfave/cli"
+)
+
+// Commands define the subcommands of the Summon command-line interface. Any
+// other first argument is treated as the command to run with secrets.
+var Commands = []cli.Command{
+	{
+		Name:      "get",
+		Usage:     "Resolve a single secret and print it",
+		ArgsUsage: "<path>",
+		Description: "The path may be preceded by tags as in secrets.yml, e.g.\n" +
+			"   summon get -D env=prod '!var:default=none $env/db/password'",
+		Flags: flagsNamed("p, provider", "D", "subs-from-env", "retries", "retry-backoff", "provider-timeout",
+			"provider-env", "provider-sandbox", "provider-seccomp", "provider-path-via", "max-secret-size", "cache-ttl",
+			"no-cache", "error-format", "quiet, q"),
+		Action: getSecret,
+	},
+	{
+		Name:   "edit",
+		Usage:  "Edit secrets.yml in $EDITOR, saving it only if it is valid",
+		Flags:  flagsNamed("f", "format"),
+		Action: editSecrets,
+	},
+	{
+		Name:      "diff",
+		Usage:     "Compare the secrets of two environments or two secrets files",
+		ArgsUsage: "[<file> [<file>]]",
+		Description: "Shows added and removed variables and variables whose tags or path differ.\n" +
+			"   Give two environments with -e, two files, or both. With --resolve, the values\n" +
+			"   of differing variables are fetched and compared, but never shown. Exits with\n" +
+			"   status 1 if there are differences.",
+		Flags: append(flagsNamed("f", "format", "D", "subs-from-env", "p, provider", "retries", "retry-backoff",
+			"provider-timeout", "provider-env", "provider-sandbox", "provider-seccomp", "provider-path-via",
+			"max-secret-size", "cache-ttl", "no-cache", "error-format", "quiet, q", "json"),
+			cli.StringSliceFlag{
+				Name:  "e, environment",
+				Value: &cli.StringSlice{},
+				Usage: "Environment to compare; give it twice to compare two environments",
+			},
+			cli.BoolFlag{
+				Name:  "resolve",
+				Usage: "Resolve differing variables and report whether their values changed",
+			},
+		),
+		Action: diffSecrets,
+	},
+	{
+		Name:  "check",
+		Usage: "Check that the provider can resolve every secret, without running anything",
+		Description: "Asks the provider whether each path of secrets.yml, or of the section given\n" +
+			"   with -e, exists if it supports it (the exists capability), and otherwise\n" +
+			"   resolves it and throws the value away. Values are never shown. Exits with\n" +
+			"   status 3 if any secret can't be resolved.",
+		Flags: flagsNamed("f", "e, environment", "yaml", "format", "D", "subs-from-env", "p, provider", "retries",
+			"retry-backoff", "provider-timeout", "provider-env", "provider-sandbox", "provider-seccomp", "provider-path-via",
+			"max-secret-size", "error-format", "quiet, q", "json"),
+		Action: checkSecrets,
+	},
+	{
+		Name:  "cache",
+		Usage: "Manage the cache of resolved secrets",
+		Subcommands: []cli.Command{
+			{
+				Name:   "clear",
+				Usage:  "Remove all cached secrets",
+				Flags:  flagsNamed("quiet, q", "json"),
+				Action: clearCache,
+			},
+		},
+	},
+	{
+		Name:  "providers",
+		Usage: "Inspect and install providers",
+		Subcommands: []cli.Command{
+			{
+				Name:   "list",
+				Usage:  "List the providers in the search path with their version, capabilities and health",
+				Flags:  flagsNamed("quiet, q", "json"),
+				Action: listProviders,
+			},
+			{
+				Name:      "install",
+				Usage:     "Download a provider and verify its checksum",
+				ArgsUsage: "<url>",
+				Flags: append(flagsNamed("quiet, q", "json"),
+					cli.StringFlag{
+						Name:  "sha256",
+						Usage: "Expected SHA-256 checksum of the provider (required)",
+					},
+					cli.StringFlag{
+						Name:  "name",
+						Usage: "Name to install the provider as (default: the last element of the URL)",
+					},
+					cli.StringFlag{
+						Name:  "dir",
+						Usage: "Directory to install to (default: first entry of SUMMON_PROVIDER_PATH, or ~/.summon/providers)",
+					},
+					cli.BoolFlag{
+						Name:  "force",
+						Usage: "Replace an existing provider of the same name",
+					},
+				),
+				Action: installProvider,
+			},
+		},
+	},
+	{
+		Name:   "version",
+		Usage:  "Print the version of summon and of the providers in the search path",
+		Flags:  flagsNamed("quiet, q", "json"),
+		Action: printVersion,
+	},
+}
+
+// CommandsFor returns the subcommands summon dispatches to when started with
+// args. There are none if the first argument that isn't a flag of summon
+// follows "--" or an unknown flag, so that e.g. `summon -- diff a b` still
+// runs diff(1) with secrets.
+func CommandsFor(args []string) []cli.Command {
+	takesValue := map[string]bool{}
+	for _, flag := range append(Flags, cli.HelpFlag, cli.VersionFlag) {
+		_, isBool := flag.(cli.BoolFlag)
+		_, isBoolT := flag.(cli.BoolTFlag)
+		for _, name := range strings.Split(flag.GetName(), ",") {
+			takesValue[strings.TrimSpace(name)] = !isBool && !isBoolT
+		}
+	}
+
+	for i := 1; i < len(args); i++ {
+		arg := args[i]
+		if arg == "--" {
+			return nil
+		}
+		if len(arg) < 2 || arg[0] != '-' {
+			return Commands
+		}
+		name, _, hasValue := strings.Cut(strings.TrimLeft(arg, "-"), "=")
+		value, known := takesValue[name]
+		if !known {
+			return nil
+		}
+		if value && !hasValue {
+			i++
+		}
+	}
+	return Commands
+}
+
+// flagsNamed returns the flags of the main command with the given names, for
+// subcommands that accept some of them
+func flagsNamed(names ...string) []cli.Flag {
+	var flags []cli.Flag
+	for _, name := range names {
+		for _, flag := range Flags {
+			if flag.GetName() == name {
+				flags = append(flags, flag)
+			}
+		}
+	}
+	return flags
+}
+
+func getSecret(c *cli.Context) error {
+	value, err := resolveSecret(c)
+	if err != nil {
+		return exitError(c, err)
+	}
+
+	// With --quiet, only whether the secret resolves is reported
+	if !newOutput(c).quiet {
+		fmt.Fprintln(c.App.Writer, value)
+	}
+	return nil
+}
+
+func resolveSecret(c *cli.Context) (string, error) {
+	if c.NArg() == 0 {
+		return "", fmt.Errorf("expected the path of the secret to get")
+	}
+
+	project, err := findProject(c)
+	if err != nil {
+		return "", &summon.ExitCodeError{ExitCode: summon.ExitParseError, Err: err}
+	}
+	subs := substitutions(c, project)
+
+	provider, err := setupProvider(c, project, "")
+	if err != nil {
+		return "", err
+	}
+
+	return summon.ResolveSecret(&summon.SubprocessConfig{
+		Subs:         subs,
+		Provider:     provider.path,
+		Retries:      c.Int("retries"),
+		RetryBackoff: c.Duration("retry-backoff"),
+		Cache:        provider.cache,
+		FetchSecret:  provider.fetchSecret(c.Duration("provider-timeout")),
+	}, strings.Join(c.Args(), " "))
+}
+
+// isFileName reports whether name is a single element of a local path, so
+// that a provider installed under it stays within the install directory
+func isFileName(name string) bool {
+	return name != "." && filepath.IsLocal(name) && filepath.Base(name) == name
+}
+
+func clearCache(c *cli.Context) error {
+	dir, err := cache.DefaultDir()
+	if err != nil {
+		return err
+	}
+	keyPath, _ := cache.DefaultKeyPath()
+	if err := cache.Clear(dir, keyPath); err != nil {
+		return err
+	}
+
+	return newOutput(c).print(map[string]string{"cleared": dir}, func(w io.Writer) error {
+		_, err := fmt.Fprintf(w, "Cleared secret cache in %s\n", dir)
+		return err
+	})
+}
+
+// installedProviders returns the paths of the providers in the search path
+func installedProviders() ([]string, error) {
+	searchPaths, err := prov.GetSearchPaths()
+	if err != nil {
+		return nil, err
+	}
+
+	var paths []string
+	for _, dir := range searchPaths {
+		names, err := prov.GetAllProviders(dir)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		for _, name := range names {
+			paths = append(paths, filepath.Join(dir, name))
+		}
+	}
+	return paths, nil
+}
+
+func listProviders(c *cli.Context) error {
+	cfg, err := config.LoadDefault()
+	if err != nil {
+		return err
+	}
+	paths, err := installedProviders()
+	if err != nil {
+		return err
+	}
+
+	infos := []prov.Info{}
+	for _, path := range paths {
+		// Providers are only run to describe them once they are verified
+		if err := verifyProvider(cfg, path); err != nil {
+			infos = append(infos, prov.Info{
+				Name:         filepath.Base(path),
+				Path:         path,
+				Capabilities: []string{},
+				Health:       prov.HealthUnverified,
+				HealthError:  err.Error(),
+			})
+			continue
+		}
+		infos = append(infos, prov.Describe(path))
+	}
+
+	return newOutput(c).print(infos, func(out io.Writer) error {
+		w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "NAME\tVERSION\tCAPABILITIES\tHEALTH\tPATH")
+		for _, info := range infos {
+			version := info.Version
+			if version == "" {
+				version = "unknown"
+			}
+			capabilities := strings.Join(info.Capabilities, ",")
+			if capabilities == "" {
+				capabilities = "-"
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", info.Name, version, capabilities, info.Health, info.Path)
+		}
+		return w.Flush()
+	})
+}
+
+func installProvider(c *cli.Context) error {
+	if c.NArg() != 1 {
+		return fmt.Errorf("expected the URL of the provider to install")
+	}
+	providerURL := c.Args().First()
+
+	expectedSHA256 := c.String("sha256")
+	if expectedSHA256 == "" {
+		return fmt.Errorf("--sha256 is required to verify the downloaded provider")
+	}
+
+	name := c.String("name")
+	if name == "" {
+		parsed, err := url.Parse(providerURL)
+		if err != nil {
+			return err
+		}
+		name = path.Base(parsed.Path)
+		if !isFileName(name) {
+			return fmt.Errorf("unable to derive a provider name from %s, use --name", providerURL)
+		}
+	} else if !isFileName(name) {
+		return fmt.Errorf("invalid provider name %q, expected a file name rather than a path", name)
+	}
+
+	dir := c.String("dir")
+	if dir == "" {
+		var err error
+		if dir, err = prov.UserInstallDir(); err != nil {
+			return err
+		}
+	}
+
+	// With --force, Install replaces the provider only once the download is
+	// verified
+	dest := filepath.Join(dir, name)
+	if _, err := os.Stat(dest); err == nil && !c.Bool("force") {
+		return fmt.Errorf("provider %s already exists, use --force to replace it", dest)
+	}
+
+	if err := prov.Install(providerURL, dest, expectedSHA256); err != nil {
+		return err
+	}
+
+	return newOutput(c).print(map[string]string{"installed": dest}, func(w io.Writer) error {
+		_, err := fmt.Fprintf(w, "Installed provider %s\n", dest)
+		return err
+	})
+}
+
+// versionReport is the machine-readable form of summon version
+type versionReport struct {
+	Version   string            `json:"version"`
+	Providers []providerVersion `json:"providers"`
+}
+
+type providerVersion struct {
+	Name string `json:"name"`
+	Path string `json:"path"`
+	// Version is empty if the provider doesn't report its version
+	Version string `json:"version,omitempty"`
+	// Error is set if the provider failed its checksum check, and wasn't
+	// asked for its version
+	Error string `json:"error,omitempty"`
+}
+
+func printVersion(c *cli.Context) error {
+	report, err := newVersionReport()
+	if err != nil {
+		return err
+	}
+
+	return newOutput(c).print(report, func(out io.Writer) error {
+		fmt.Fprintf(out, "summon version %s\n", report.Version)
+		if len(report.Providers) == 0 {
+			return nil
+		}
+
+		w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "\nPROVIDER\tVERSION\tPATH")
+		for _, provider := range report.Providers {
+			version := provider.Version
+			if provider.Error != "" {
+				version = "unverified"
+			} else if version == "" {
+				version = "unknown"
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\n", provider.Name, version, provider.Path)
+		}
+		return w.Flush()
+	})
+}
+
+// newVersionReport asks every provider in the search path that passes its
+// checksum check for its version
+func newVersionReport() (versionReport, error) {
+	report := versionReport{Version: summon.FullVersionName, Providers: []providerVersion{}}
+
+	cfg, err := config.LoadDefault()
+	if err != nil {
+		return report, err
+	}
+	paths, err := installedProviders()
+	if err != nil {
+		return report, err
+	}
+	for _, path := range paths {
+		provider := providerVersion{Name: filepath.Base(path), Path: path}
+		if err := verifyProvider(cfg, path); err != nil {
+			provider.Error = err.Error()
+		} else {
+			// Providers that don't support --version are listed without one
+			provider.Version, _ = prov.Version(path)
+		}
+		report.Providers = append(report.Providers, provider)
+	}
+	return report, nil
+}
@@ -0,0 +1,73 @@
+package command
+
+import (
+	"flag"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/urfave/cli"
+)
+
+func TestCommandsFor(t *testing.T) {
+	t.Run("subcommands are dispatched to", func(t *testing.T) {
+		for _, args := range [][]string{
+			{"summon", "diff", "a.yml", "b.yml"},
+			{"summon", "--json", "version"},
+			{"summon", "-p", "summon-conjur", "get", "db/password"},
+			{"summon", "--provider=summon-conjur", "check"},
+			{"summon", "--help"},
+			{"summon"},
+		} {
+			assert.Equal(t, Commands, CommandsFor(args), args)
+		}
+	})
+
+	t.Run("a command after -- is always run with secrets", func(t *testing.T) {
+		for _, args := range [][]string{
+			{"summon", "--", "diff", "a.txt", "b.txt"},
+			{"summon", "-f", "secrets.yml", "--", "version"},
+			{"summon", "--up", "--", "get", "-O", "file"},
+		} {
+			assert.Nil(t, CommandsFor(args), args)
+		}
+	})
+
+	t.Run("a command after an unknown flag is run with secrets", func(t *testing.T) {
+		assert.Nil(t, CommandsFor([]string{"summon", "--no-such-flag", "diff"}))
+	})
+
+	t.Run("a flag value of -- doesn't end summon's flags", func(t *testing.T) {
+		assert.Equal(t, Commands, CommandsFor([]string{"summon", "-f", "--", "diff"}))
+	})
+}
+
+func TestInstallProvider(t *testing.T) {
+	newContext := func(args ...string) *cli.Context {
+		app := cli.NewApp()
+		app.Commands = Commands
+		install := app.Command("providers").Subcommands[1]
+		assert.Equal(t, "install", install.Name)
+
+		set := flag.NewFlagSet("install", flag.ContinueOnError)
+		for _, f := range install.Flags {
+			f.Apply(set)
+		}
+		assert.NoError(t, set.Parse(args))
+		return cli.NewContext(app, set, nil)
+	}
+
+	t.Run("refuses names that aren't a file name", func(t *testing.T) {
+		dir := t.TempDir()
+		for _, name := range []string{"../summon-evil", "bin/summon-evil", "/usr/local/bin/summon-evil", ".", ".."} {
+			err := installProvider(newContext("--sha256", "0", "--dir", dir, "--name", name, "https://example.com/summon-conjur"))
+			assert.EqualError(t, err, `invalid provider name "`+name+`", expected a file name rather than a path`)
+		}
+	})
+
+	t.Run("refuses URLs without a file name", func(t *testing.T) {
+		for _, url := range []string{"https://example.com/", "https://example.com/providers/.."} {
+			err := installProvider(newContext("--sha256", "0", "--dir", t.TempDir(), url))
+			assert.EqualError(t, err, "unable to derive a provider name from "+url+", use --name")
+		}
+	})
+}
@@ -0,0 +1,289 @@
+package command
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/cyberark/summon/pkg/remote"
+	"github.com/cyberark/summon/pkg/secretsyml"
+	"github.com/cyberark/summon/pkg/summon"
+	"github.com/urfave/cli"
+)
+
+// diffSide is one of the two secrets files or sections being compared
+type diffSide struct {
+	file        string
+	environment string
+	secrets     secretsyml.SecretsMap
+	// provider is the provider the secrets file declares, if any
+	provider string
+}
+
+func (s diffSide) String() string {
+	if s.environment == "" {
+		return s.file
+	}
+	return fmt.Sprintf("%s (%s)", s.file, s.environment)
+}
+
+func diffSecrets(c *cli.Context) error {
+	differ, err := runDiff(c)
+	if err != nil {
+		return exitError(c, err)
+	}
+	// Like diff(1), exit with 1 if there are differences
+	if differ {
+		return cli.NewExitError("", 1)
+	}
+	return nil
+}
+
+func runDiff(c *cli.Context) (bool, error) {
+	project, err := findProject(c)
+	if err != nil {
+		return false, &summon.ExitCodeError{ExitCode: summon.ExitParseError, Err: err}
+	}
+	subs := substitutions(c, project)
+	secretsFile := projectSecretsFile(c, project)
+
+	files := []string(c.Args())
+	switch len(files) {
+	case 0:
+		files = []string{secretsFile, secretsFile}
+	case 1:
+		files = []string{files[0], files[0]}
+	case 2:
+	default:
+		return false, fmt.Errorf("expected at most two secrets files to compare")
+	}
+
+	environments := c.StringSlice("environment")
+	switch len(environments) {
+	case 0:
+		environments = []string{"", ""}
+	case 1:
+		environments = []string{environments[0], environments[0]}
+	case 2:
+	default:
+		return false, fmt.Errorf("expected at most two environments to compare")
+	}
+
+	if files[0] == files[1] && environments[0] == environments[1] {
+		return false, fmt.Errorf("nothing to compare: give two environments with -e, or two files")
+	}
+
+	format, err := secretsFormat(c)
+	if err != nil {
+		return false, err
+	}
+
+	sides := make([]diffSide, 2)
+	for i := range sides {
+		sides[i] = diffSide{file: files[i], environment: environments[i]}
+		fileFormat := format
+		if fileFormat == "" {
+			fileFormat = secretsyml.FormatOf(files[i])
+		}
+		var content []byte
+		var yml string
+		var subsMap map[string]string
+		if content, err = remote.ReadFile(files[i]); err == nil {
+			yml, err = secretsyml.Convert(string(content), fileFormat)
+		}
+		if err == nil {
+			if subsMap, err = summon.Substitutions(subs, yml); err == nil {
+				sides[i].secrets, err = secretsyml.ParseFromString(yml, environments[i], subsMap)
+			}
+			// As when running a command, remote files don't pick the provider
+			if err == nil && !remote.IsRemote(files[i]) {
+				sides[i].provider, err = secretsyml.Provider(yml, environments[i])
+			}
+		}
+		if err != nil {
+			return false, &summon.ExitCodeError{
+				ExitCode: summon.ExitParseError,
+				Err:      fmt.Errorf("%s: %s", sides[i], err),
+			}
+		}
+	}
+
+	changes := secretsyml.Diff(sides[0].secrets, sides[1].secrets)
+
+	var valueChanged map[string]bool
+	if c.Bool("resolve") {
+		// Each side is resolved with its own provider, as summon would
+		resolvers := make([]*summon.SubprocessConfig, len(sides))
+		for i, side := range sides {
+			provider, err := setupProvider(c, project, side.provider)
+			if err != nil {
+				return false, err
+			}
+			resolvers[i] = &summon.SubprocessConfig{
+				Provider:     provider.path,
+				Retries:      c.Int("retries"),
+				RetryBackoff: c.Duration("retry-backoff"),
+				Cache:        provider.cache,
+				FetchSecret:  provider.fetchSecret(c.Duration("provider-timeout")),
+			}
+		}
+		valueChanged, err = compareValues(changes, resolvers[0], resolvers[1])
+		if err != nil {
+			return false, &summon.ExitCodeError{ExitCode: summon.ExitProviderError, Err: err}
+		}
+	}
+
+	report := newDiffReport(sides[0], sides[1], changes, valueChanged)
+	return report.Differ, newOutput(c).print(report, report.writeText)
+}
+
+// compareValues resolves both sides of every changed secret, as summon
+// would with from and to, and reports whether their values differ. The values
+// themselves are never shown.
+func compareValues(changes []secretsyml.Change, from, to *summon.SubprocessConfig) (map[string]bool, error) {
+	valueChanged := map[string]bool{}
+	for _, change := range changes {
+		if change.Kind != secretsyml.Changed {
+			continue
+		}
+		fromValue, err := summon.ResolveSpec(from, *change.From)
+		if err != nil {
+			return nil, &summon.FetchError{Key: change.Key, Path: change.From.Path, Provider: from.Provider, Err: err}
+		}
+		toValue, err := summon.ResolveSpec(to, *change.To)
+		if err != nil {
+			return nil, &summon.FetchError{Key: change.Key, Path: change.To.Path, Provider: to.Provider, Err: err}
+		}
+		valueChanged[change.Key] = fromValue != toValue
+	}
+	return valueChanged, nil
+}
+
+// diffReport lists the changes between two sides. If values were compared,
+// secrets whose specs changed but whose values didn't are not counted as
+// differences.
+type diffReport struct {
+	From    string         `json:"from"`
+	To      string         `json:"to"`
+	Changes []changeReport `json:"changes"`
+	Differ  bool           `json:"differ"`
+}
+
+type changeReport struct {
+	Key string `json:"key"`
+	// Kind is added, removed or changed
+	Kind string `json:"kind"`
+	// From and To describe the secret on each side, as describeSpec does
+	From string `json:"from,omitempty"`
+	To   string `json:"to,omitempty"`
+	// ValueChanged is set for changed secrets whose values were compared
+	ValueChanged *bool `json:"value_changed,omitempty"`
+}
+
+func newDiffReport(from, to diffSide, changes []secretsyml.Change, valueChanged map[string]bool) diffReport {
+	report := diffReport{From: from.String(), To: to.String(), Changes: []changeReport{}}
+
+	// The sides declaring different providers may resolve the same paths to
+	// different values
+	if from.provider != to.provider {
+		cr := changeReport{Key: secretsyml.ProviderKey, Kind: "changed", From: from.provider, To: to.provider}
+		switch {
+		case from.provider == "":
+			cr.Kind = "added"
+		case to.provider == "":
+			cr.Kind = "removed"
+		}
+		report.Changes = append(report.Changes, cr)
+		report.Differ = true
+	}
+
+	for _, change := range changes {
+		if change.Kind == secretsyml.Unchanged {
+			continue
+		}
+
+		cr := changeReport{Key: change.Key, Kind: strings.ToLower(change.Kind.String())}
+		if change.From != nil {
+			cr.From = describeSpec(change.From)
+		}
+		if change.To != nil {
+			cr.To = describeSpec(change.To)
+		}
+		if change.Kind == secretsyml.Changed && valueChanged != nil {
+			changed := valueChanged[change.Key]
+			cr.ValueChanged = &changed
+		}
+		if cr.ValueChanged == nil || *cr.ValueChanged {
+			report.Differ = true
+		}
+		report.Changes = append(report.Changes, cr)
+	}
+	return report
+}
+
+// writeText writes the changes the way diff(1) would
+func (r diffReport) writeText(w io.Writer) error {
+	fmt.Fprintf(w, "--- %s\n+++ %s\n", r.From, r.To)
+	for _, change := range r.Changes {
+		switch change.Kind {
+		case "added":
+			fmt.Fprintf(w, "+ %s: %s\n", change.Key, change.To)
+		case "removed":
+			fmt.Fprintf(w, "- %s: %s\n", change.Key, change.From)
+		default:
+			status := ""
+			if change.ValueChanged != nil {
+				if *change.ValueChanged {
+					status = " (value changed)"
+				} else {
+					status = " (value unchanged)"
+				}
+			}
+			fmt.Fprintf(w, "~ %s: %s -> %s%s\n", change.Key, change.From, change.To, status)
+		}
+	}
+	return nil
+}
+
+// describeSpec shows the tags of a secret and, for variables, its path.
+// Literal values and defaults are left out, as they may be sensitive.
+func describeSpec(spec *secretsyml.SecretSpec) string {
+	var tags []string
+	if spec.IsVar() {
+		tags = append(tags, "var")
+	}
+	if spec.IsPrompt() {
+		tags = append(tags, "prompt")
+	}
+	if spec.IsFile() {
+		tags = append(tags, "file")
+	}
+	if len(tags) == 0 {
+		tags = append(tags, "str")
+	}
+	for _, modifier := range spec.Modifiers {
+		tags = append(tags, modifier.String())
+	}
+	if spec.Type != secretsyml.AnyValue {
+		tags = append(tags, string(spec.Type))
+	}
+	if spec.DefaultValue != "" {
+		tags = append(tags, "default")
+	}
+	if spec.IsList() && spec.Separator != secretsyml.DefaultSeparator {
+		tags = append(tags, fmt.Sprintf("join=%q", spec.Separator))
+	}
+	tag := "!" + strings.Join(tags, ":")
+
+	if spec.IsList() {
+		items := make([]string, len(spec.Items))
+		for i := range spec.Items {
+			items[i] = describeSpec(&spec.Items[i])
+		}
+		return tag + " [" + strings.Join(items, ", ") + "]"
+	}
+	if spec.IsVar() {
+		return tag + " " + spec.Path
+	}
+	return tag + " (literal)"
+}
@@ -0,0 +1,131 @@
+package command
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/cyberark/summon/pkg/secretsyml"
+	"github.com/cyberark/summon/pkg/summon"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDiffReport(t *testing.T) {
+	from := diffSide{file: "secrets.yml", environment: "staging", secrets: secretsyml.SecretsMap{
+		"DB_PASS":   {Tags: []secretsyml.YamlTag{secretsyml.Var}, Path: "staging/db"},
+		"API_TOKEN": {Tags: []secretsyml.YamlTag{secretsyml.Literal}, Path: "plaintext-token"},
+	}}
+	to := diffSide{file: "secrets.yml", environment: "production", secrets: secretsyml.SecretsMap{
+		"DB_PASS": {Tags: []secretsyml.YamlTag{secretsyml.Var}, Path: "production/db"},
+		"CERT":    {Tags: []secretsyml.YamlTag{secretsyml.Var, secretsyml.File}, Path: "production/cert"},
+	}}
+	changes := secretsyml.Diff(from.secrets, to.secrets)
+
+	t.Run("lists changes without literal values", func(t *testing.T) {
+		var out bytes.Buffer
+		report := newDiffReport(from, to, changes, nil)
+		assert.NoError(t, report.writeText(&out))
+
+		assert.True(t, report.Differ)
+		assert.Equal(t, `--- secrets.yml (staging)
++++ secrets.yml (production)
+- API_TOKEN: !str (literal)
++ CERT: !var:file production/cert
+~ DB_PASS: !var staging/db -> !var production/db
+`, out.String())
+	})
+
+	t.Run("reports whether resolved values changed", func(t *testing.T) {
+		var out bytes.Buffer
+		assert.NoError(t, newDiffReport(from, to, changes, map[string]bool{"DB_PASS": false}).writeText(&out))
+
+		assert.Contains(t, out.String(), "~ DB_PASS: !var staging/db -> !var production/db (value unchanged)\n")
+	})
+
+	t.Run("doesn't count changes with unchanged values as differences", func(t *testing.T) {
+		changes := secretsyml.Diff(
+			secretsyml.SecretsMap{"DB_PASS": from.secrets["DB_PASS"]},
+			secretsyml.SecretsMap{"DB_PASS": to.secrets["DB_PASS"]},
+		)
+
+		assert.False(t, newDiffReport(from, to, changes, map[string]bool{"DB_PASS": false}).Differ)
+	})
+
+	t.Run("reports different providers", func(t *testing.T) {
+		var out bytes.Buffer
+		from, to := from, to
+		from.provider, to.provider = "summon-file", "summon-conjur"
+		changes := secretsyml.Diff(
+			secretsyml.SecretsMap{"DB_PASS": from.secrets["DB_PASS"]},
+			secretsyml.SecretsMap{"DB_PASS": from.secrets["DB_PASS"]},
+		)
+		report := newDiffReport(from, to, changes, nil)
+		assert.NoError(t, report.writeText(&out))
+
+		assert.True(t, report.Differ)
+		assert.Equal(t, `--- secrets.yml (staging)
++++ secrets.yml (production)
+~ .provider: summon-file -> summon-conjur
+`, out.String())
+	})
+
+	t.Run("prints the changes as JSON", func(t *testing.T) {
+		var out bytes.Buffer
+		report := newDiffReport(from, to, changes, map[string]bool{"DB_PASS": true})
+		assert.NoError(t, (&output{w: &out, json: true}).print(report, report.writeText))
+
+		assert.JSONEq(t, `{
+  "from": "secrets.yml (staging)",
+  "to": "secrets.yml (production)",
+  "changes": [
+    {"key": "API_TOKEN", "kind": "removed", "from": "!str (literal)"},
+    {"key": "CERT", "kind": "added", "to": "!var:file production/cert"},
+    {"key": "DB_PASS", "kind": "changed", "from": "!var staging/db", "to": "!var production/db", "value_changed": true}
+  ],
+  "differ": true
+}`, out.String())
+	})
+}
+
+func TestDiffLists(t *testing.T) {
+	from, err := secretsyml.ParseFromString("HOSTS: !var [db1/host, !str db2.example.com]\n", "", nil)
+	assert.NoError(t, err)
+	to, err := secretsyml.ParseFromString("HOSTS: !var:join=';' [db1/host, db3/host]\n", "", nil)
+	assert.NoError(t, err)
+
+	t.Run("describes every item", func(t *testing.T) {
+		fromSpec, toSpec := from["HOSTS"], to["HOSTS"]
+		assert.Equal(t, `!var [!var db1/host, !str (literal)]`, describeSpec(&fromSpec))
+		assert.Equal(t, `!var:join=";" [!var db1/host, !var db3/host]`, describeSpec(&toSpec))
+	})
+
+	t.Run("resolves and joins the items", func(t *testing.T) {
+		spec := from["HOSTS"]
+		value, err := summon.ResolveSpec(&summon.SubprocessConfig{
+			FetchSecret: func(path string) ([]byte, error) {
+				return []byte("value-of-" + path), nil
+			},
+		}, spec)
+		assert.NoError(t, err)
+		assert.Equal(t, "value-of-db1/host,db2.example.com", value)
+	})
+}
+
+func TestCompareValues(t *testing.T) {
+	from, err := secretsyml.ParseFromString("DB_HOST: !var:default='db.example.com' staging/db/host\n", "", nil)
+	assert.NoError(t, err)
+	to, err := secretsyml.ParseFromString("DB_HOST: !str db.example.com\n", "", nil)
+	assert.NoError(t, err)
+	changes := secretsyml.Diff(from, to)
+
+	resolver := &summon.SubprocessConfig{
+		FetchSecret: func(path string) ([]byte, error) {
+			return []byte{}, nil
+		},
+	}
+
+	t.Run("compares the values summon would inject", func(t *testing.T) {
+		valueChanged, err := compareValues(changes, resolver, resolver)
+		assert.NoError(t, err)
+		assert.Equal(t, map[string]bool{"DB_HOST": false}, valueChanged)
+	})
+}
@@ -0,0 +1,142 @@
+package command
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"github.com/cyberark/summon/pkg/remote"
+	"github.com/cyberark/summon/pkg/secretsyml"
+	"github.com/urfave/cli"
+)
+
+func editSecrets(c *cli.Context) error {
+	secretsFile := c.String("f")
+	if !c.IsSet("f") {
+		project, err := findProject(c)
+		if err != nil {
+			return err
+		}
+		secretsFile = projectSecretsFile(c, project)
+	}
+
+	if remote.IsRemote(secretsFile) {
+		return fmt.Errorf("%s is a remote secrets file, edit it at its source", secretsFile)
+	}
+	format, err := secretsFormat(c)
+	if err != nil {
+		return err
+	}
+	if format == "" {
+		format = secretsyml.FormatOf(secretsFile)
+	}
+	return editFile(secretsFile, format, editorCommand(), os.Stdin, c.App.Writer)
+}
+
+// editorCommand returns the user's editor and its arguments, from $VISUAL or
+// $EDITOR (e.g. "code --wait")
+func editorCommand() []string {
+	for _, name := range []string{"VISUAL", "EDITOR"} {
+		if editor := strings.Fields(os.Getenv(name)); len(editor) > 0 {
+			return editor
+		}
+	}
+	if runtime.GOOS == "windows" {
+		return []string{"notepad"}
+	}
+	return []string{"vi"}
+}
+
+// editFile lets the user edit a copy of the secrets file at path, written in
+// format, with editor, and only replaces the file once the copy is valid. Like
+// visudo, it asks what to do when the copy doesn't parse.
+func editFile(path string, format secretsyml.Format, editor []string, in io.Reader, out io.Writer) error {
+	original, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	mode := os.FileMode(0o644)
+	if info, err := os.Stat(path); err == nil {
+		mode = info.Mode().Perm()
+	}
+
+	// With the extension of the format, for editors to highlight it
+	tempFile, err := os.CreateTemp("", "summon-edit-*."+string(format))
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tempFile.Name())
+	_, err = tempFile.Write(original)
+	if closeErr := tempFile.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+
+	answers := bufio.NewScanner(in)
+	for {
+		cmd := exec.Command(editor[0], append(editor[1:], tempFile.Name())...)
+		cmd.Stdin = os.Stdin
+		cmd.Stdout = os.Stdout
+		cmd.Stderr = os.Stderr
+		if err := cmd.Run(); err != nil {
+			return fmt.Errorf("editor %s failed: %s", editor[0], err)
+		}
+
+		edited, err := os.ReadFile(tempFile.Name())
+		if err != nil {
+			return err
+		}
+		if bytes.Equal(edited, original) {
+			fmt.Fprintf(out, "%s unchanged\n", path)
+			return nil
+		}
+
+		converted, validationErr := secretsyml.Convert(string(edited), format)
+		if validationErr == nil {
+			validationErr = secretsyml.Validate(converted)
+		}
+		if validationErr == nil {
+			if err := writeFileAtomic(path, edited, mode); err != nil {
+				return err
+			}
+			fmt.Fprintf(out, "Saved %s\n", path)
+			return nil
+		}
+
+		fmt.Fprintf(out, "%s is not valid: %s\n", path, validationErr)
+		fmt.Fprint(out, "What now? (e)dit again, (q)uit without saving: ")
+		if !answers.Scan() || !strings.HasPrefix(strings.ToLower(strings.TrimSpace(answers.Text())), "e") {
+			return fmt.Errorf("%s was not changed", path)
+		}
+	}
+}
+
+// writeFileAtomic replaces the file at path, so that it is never seen half
+// written
+func writeFileAtomic(path string, data []byte, mode os.FileMode) error {
+	f, err := os.CreateTemp(filepath.Dir(path), ".summon-edit")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(f.Name(), mode); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
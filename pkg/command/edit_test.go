@@ -0,0 +1,82 @@
+package command
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/cyberark/summon/pkg/secretsyml"
+	"github.com/stretchr/testify/assert"
+)
+
+// writeEditor creates an editor script that replaces the edited file with
+// each of contents in turn, one per invocation
+func writeEditor(t *testing.T, contents ...string) []string {
+	dir := t.TempDir()
+	for i, content := range contents {
+		name := filepath.Join(dir, strings.Repeat("x", i+1))
+		assert.NoError(t, os.WriteFile(name, []byte(content), 0o600))
+	}
+	script := `#!/bin/sh
+next="$0.count"
+echo x >> "$next"
+cp "` + dir + `/$(tr -d '\n' < "$next")" "$1"
+`
+	editor := filepath.Join(dir, "editor")
+	assert.NoError(t, os.WriteFile(editor, []byte(script), 0o700))
+	return []string{editor}
+}
+
+func TestEditFile(t *testing.T) {
+	t.Run("saves valid content", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "secrets.yml")
+		assert.NoError(t, os.WriteFile(path, []byte("A: !var a\n"), 0o640))
+
+		var out bytes.Buffer
+		err := editFile(path, secretsyml.YAML, writeEditor(t, "A: !var b\n"), strings.NewReader(""), &out)
+		assert.NoError(t, err)
+
+		content, _ := os.ReadFile(path)
+		assert.Equal(t, "A: !var b\n", string(content))
+		info, _ := os.Stat(path)
+		assert.Equal(t, os.FileMode(0o640), info.Mode().Perm())
+	})
+
+	t.Run("refuses to save invalid content", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "secrets.yml")
+		assert.NoError(t, os.WriteFile(path, []byte("A: !var a\n"), 0o600))
+
+		var out bytes.Buffer
+		err := editFile(path, secretsyml.YAML, writeEditor(t, "A: [b\n"), strings.NewReader("q\n"), &out)
+		assert.EqualError(t, err, path+" was not changed")
+		assert.Contains(t, out.String(), "is not valid")
+
+		content, _ := os.ReadFile(path)
+		assert.Equal(t, "A: !var a\n", string(content))
+	})
+
+	t.Run("lets the user fix invalid content", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "secrets.yml")
+
+		var out bytes.Buffer
+		err := editFile(path, secretsyml.YAML, writeEditor(t, "A: [b\n", "A: !var b\n"), strings.NewReader("e\n"), &out)
+		assert.NoError(t, err)
+
+		content, _ := os.ReadFile(path)
+		assert.Equal(t, "A: !var b\n", string(content))
+	})
+
+	t.Run("checks content in the format of the file", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "secrets.json")
+
+		var out bytes.Buffer
+		err := editFile(path, secretsyml.JSON, writeEditor(t, `{"A": [["b"]]}`, `{"A": "!var b"}`), strings.NewReader("e\n"), &out)
+		assert.NoError(t, err)
+		assert.Contains(t, out.String(), "secret A: list item 0 must be a string, number or boolean (line 1)")
+
+		content, _ := os.ReadFile(path)
+		assert.Equal(t, `{"A": "!var b"}`, string(content))
+	})
+}
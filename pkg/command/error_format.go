@@ -0,0 +1,118 @@
+package command
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	prov "github.com/cyberark/summon/pkg/provider"
+	"github.com/cyberark/summon/pkg/summon"
+	"github.com/urfave/cli"
+)
+
+// Formats accepted by --error-format
+const (
+	errorFormatText = "text"
+	errorFormatJSON = "json"
+)
+
+// errorReport is the machine-readable form of a summon failure
+type errorReport struct {
+	// Class is the kind of failure, matching the exit code
+	Class    string `json:"class"`
+	ExitCode int    `json:"exit_code"`
+	failureReport
+	// Failures lists every secret that failed, if there were several
+	Failures []failureReport `json:"failures,omitempty"`
+}
+
+// failureReport describes why a failure happened
+type failureReport struct {
+	Message string `json:"message"`
+	// Key is the variable that couldn't be resolved
+	Key      string `json:"key,omitempty"`
+	Provider string `json:"provider,omitempty"`
+	// Path is the secret path the provider was asked for
+	Path   string `json:"path,omitempty"`
+	Stderr string `json:"stderr,omitempty"`
+}
+
+// errorClasses names the failures behind each of summon's exit codes
+var errorClasses = map[int]string{
+	summon.ExitParseError:       "parse_error",
+	summon.ExitProviderError:    "provider_error",
+	summon.ExitProviderNotFound: "provider_not_found",
+	summon.ExitSubcommandFailed: "subcommand_failed",
+	summon.ExitTimeout:          "timeout",
+}
+
+func newErrorReport(err error) errorReport {
+	report := errorReport{
+		Class:    "unknown_error",
+		ExitCode: summon.ExitCodeOf(err),
+	}
+	if class, ok := errorClasses[report.ExitCode]; ok {
+		report.Class = class
+	}
+
+	var fetchErrs summon.FetchErrors
+	if errors.As(err, &fetchErrs) {
+		report.Message = err.Error()
+		for _, fetchErr := range fetchErrs {
+			report.Failures = append(report.Failures, newFailureReport(fetchErr))
+		}
+		return report
+	}
+
+	report.failureReport = newFailureReport(err)
+	return report
+}
+
+func newFailureReport(err error) failureReport {
+	report := failureReport{Message: err.Error()}
+
+	var fetchErr *summon.FetchError
+	if errors.As(err, &fetchErr) {
+		report.Key = fetchErr.Key
+		report.Provider = fetchErr.Provider
+		report.Path = fetchErr.Path
+	}
+	var callErr *prov.CallError
+	if errors.As(err, &callErr) {
+		report.Provider = callErr.Provider
+		report.Path = callErr.Path
+		report.Stderr = callErr.Stderr
+	}
+	return report
+}
+
+// formatError renders err in the format chosen with --error-format
+func formatError(c *cli.Context, err error) string {
+	if c.String("error-format") != errorFormatJSON {
+		return err.Error()
+	}
+	out, marshalErr := json.Marshal(newErrorReport(err))
+	if marshalErr != nil {
+		return err.Error()
+	}
+	return string(out)
+}
+
+// exitWithError reports err and exits with the exit code it carries. Errors
+// are printed to stdout as summon always has, or as JSON to stderr.
+func exitWithError(c *cli.Context, err error) {
+	var w io.Writer = os.Stdout
+	if c.String("error-format") == errorFormatJSON {
+		w = os.Stderr
+	}
+	fmt.Fprintln(w, formatError(c, err))
+	os.Exit(summon.ExitCodeOf(err))
+}
+
+// exitError converts err for subcommands to return, so that it is reported on
+// stderr in the format chosen with --error-format
+func exitError(c *cli.Context, err error) error {
+	return cli.NewExitError(formatError(c, err), summon.ExitCodeOf(err))
+}
@@ -0,0 +1,75 @@
+package command
+
+import (
+	"errors"
+	"testing"
+
+	prov "github.com/cyberark/summon/pkg/provider"
+	"github.com/cyberark/summon/pkg/summon"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewErrorReport(t *testing.T) {
+	t.Run("provider errors carry the key, provider, path and stderr", func(t *testing.T) {
+		err := &summon.ExitCodeError{
+			ExitCode: summon.ExitProviderError,
+			Err: &summon.FetchError{
+				Key:  "DB_PASS",
+				Path: "prod/db/password",
+				Err: &prov.CallError{
+					Provider: "/usr/local/lib/summon/summon-conjur",
+					Path:     "prod/db/password",
+					ExitCode: 1,
+					Stderr:   "403 Forbidden",
+					Err:      errors.New("exit status 1"),
+				},
+			},
+		}
+
+		assert.Equal(t, errorReport{
+			Class:    "provider_error",
+			ExitCode: summon.ExitProviderError,
+			failureReport: failureReport{
+				Message:  "Error fetching variable DB_PASS: exit status 1: 403 Forbidden",
+				Key:      "DB_PASS",
+				Provider: "/usr/local/lib/summon/summon-conjur",
+				Path:     "prod/db/password",
+				Stderr:   "403 Forbidden",
+			},
+		}, newErrorReport(err))
+	})
+
+	t.Run("parse errors are classified by exit code", func(t *testing.T) {
+		err := &summon.ExitCodeError{ExitCode: summon.ExitParseError, Err: errors.New("bad yaml")}
+
+		assert.Equal(t, errorReport{
+			Class:         "parse_error",
+			ExitCode:      summon.ExitParseError,
+			failureReport: failureReport{Message: "bad yaml"},
+		}, newErrorReport(err))
+	})
+
+	t.Run("several failures are listed individually", func(t *testing.T) {
+		err := &summon.ExitCodeError{
+			ExitCode: summon.ExitProviderError,
+			Err: summon.FetchErrors{
+				{Key: "A", Path: "a", Provider: "provider", Err: errors.New("not found")},
+				{Key: "B", Path: "b", Provider: "provider", Err: errors.New("forbidden")},
+			},
+		}
+
+		report := newErrorReport(err)
+		assert.Equal(t, "provider_error", report.Class)
+		assert.Equal(t, err.Error(), report.Message)
+		assert.Equal(t, []failureReport{
+			{Message: "Error fetching variable A: not found", Key: "A", Provider: "provider", Path: "a"},
+			{Message: "Error fetching variable B: forbidden", Key: "B", Provider: "provider", Path: "b"},
+		}, report.Failures)
+	})
+
+	t.Run("other errors are unknown", func(t *testing.T) {
+		report := newErrorReport(errors.New("boom"))
+		assert.Equal(t, "unknown_error", report.Class)
+		assert.Equal(t, summon.ExitUnknownError, report.ExitCode)
+	})
+}
@@ -1,6 +1,7 @@
 package command
 
 import (
+	"github.com/cyberark/summon/pkg/summon"
 	"github.com/urfave/cli"
 )
 
@@ -17,20 +18,60 @@ var Flags = []cli.Flag{
 	cli.StringFlag{
 		Name:  "f",
 		Value: "secrets.yml",
-		Usage: "Path to secrets.yml",
+		Usage: "Path to secrets.yml, a remote source (https://, s3://, git::) or - to read it from stdin",
 	},
 	cli.BoolFlag{
 		Name:  "up",
 		Usage: "Go up in the directory hierarchy until the secrets file is found",
 	},
+	cli.StringFlag{
+		Name:   "search-root",
+		EnvVar: "SUMMON_SEARCH_ROOT",
+		Usage:  "Don't look for the secrets file (with --up) or .summonrc above this directory",
+	},
+	cli.StringSliceFlag{
+		Name:  "search-stop",
+		Value: &cli.StringSlice{},
+		Usage: "Stop looking for the secrets file (with --up) or .summonrc in the directory holding this file or directory, e.g. .git (repeatable)",
+	},
+	cli.BoolFlag{
+		Name:  "confirm-outside-repo",
+		Usage: "With --up, ask before using a secrets file found above the current git repository",
+	},
 	cli.StringSliceFlag{
 		Name:  "D",
 		Value: &cli.StringSlice{},
-		Usage: "var=value causes substitution of value to $var",
+		Usage: "var=value causes substitution of value to $var; $NAME or ${NAME} in value expands the environment variable NAME, $$ is a literal $",
+	},
+	cli.StringFlag{
+		Name:   "subs-from-env",
+		EnvVar: "SUMMON_SUBS_FROM_ENV",
+		Usage:  "Turn environment variables starting with this prefix into substitutions, e.g. DEPLOY_ makes DEPLOY_ENV=prod substitute prod to $ENV",
 	},
 	cli.StringFlag{
 		Name:  "yaml",
-		Usage: "secrets.yml as a literal string",
+		Usage: "secrets.yml as a literal string, or - to read it from stdin",
+	},
+	cli.StringFlag{
+		Name:  "format",
+		Usage: "Format of the secrets file: yaml, json or toml (default: by its extension, else yaml)",
+	},
+	cli.StringSliceFlag{
+		Name:  "secret",
+		Value: &cli.StringSlice{},
+		Usage: "NAME=path defines a secret without a secrets.yml; the value may start with tags, e.g. NAME='!var:file path'",
+	},
+	cli.StringFlag{
+		Name:  "prefix",
+		Usage: "Prepend this to the name of every variable from secrets.yml, e.g. APP_",
+	},
+	cli.BoolFlag{
+		Name:  "upcase",
+		Usage: "Convert the names of variables from secrets.yml to upper case",
+	},
+	cli.BoolFlag{
+		Name:  "downcase",
+		Usage: "Convert the names of variables from secrets.yml to lower case",
 	},
 	cli.StringSliceFlag{
 		Name:  "ignore, i",
@@ -41,6 +82,163 @@ var Flags = []cli.Flag{
 		Name:  "ignore-all, I",
 		Usage: "Ignore inaccessible or missing keys",
 	},
+	cli.BoolFlag{
+		Name:  "prompt",
+		Usage: "Ask on the terminal, with hidden input, for any secret the provider fails to resolve",
+	},
+	cli.IntFlag{
+		Name:  "retries",
+		Usage: "Retry a provider call up to this many times if it fails with a transient error",
+	},
+	cli.DurationFlag{
+		Name:  "retry-backoff",
+		Value: summon.DefaultRetryBackoff,
+		Usage: "Delay before the first retry of a provider call, doubled on each further retry",
+	},
+	cli.DurationFlag{
+		Name:   "provider-timeout",
+		EnvVar: "SUMMON_PROVIDER_TIMEOUT",
+		Usage:  "Kill a provider call that takes longer than this (e.g. 30s); 0 means no limit",
+	},
+	cli.DurationFlag{
+		Name:   "timeout",
+		EnvVar: "SUMMON_TIMEOUT",
+		Usage:  "Terminate the command if it runs for longer than this (e.g. 30m), and exit with 124; 0 means no limit",
+	},
+	cli.DurationFlag{
+		Name:   "grace-period",
+		Value:  summon.DefaultGracePeriod,
+		EnvVar: "SUMMON_GRACE_PERIOD",
+		Usage:  "How long the command is given to exit, when it timed out or summon was told to stop, before it is killed",
+	},
+	cli.StringSliceFlag{
+		Name:  "provider-env",
+		Value: &cli.StringSlice{},
+		Usage: "Only pass environment variables matching this glob (e.g. 'CONJUR_*') to the provider, plus basics like PATH and HOME",
+	},
+	cli.BoolFlag{
+		Name:  "provider-sandbox",
+		Usage: "Run the provider with restricted access to the host (Linux and Windows)",
+	},
+	cli.StringFlag{
+		Name:  "provider-seccomp",
+		Usage: "Confine the sandboxed provider with this compiled seccomp BPF program (Linux only)",
+	},
+	cli.StringFlag{
+		Name:   "provider-path-via",
+		EnvVar: "SUMMON_PROVIDER_PATH_VIA",
+		Usage:  "Pass secret paths to the provider as an argument (argv), on its stdin (stdin), in $SUMMON_SECRET_PATH (env), or the safest way it supports (auto)",
+	},
+	cli.StringFlag{
+		Name:   "max-secret-size",
+		Value:  "64M",
+		EnvVar: "SUMMON_MAX_SECRET_SIZE",
+		Usage:  "Fail if the provider returns more than this for a secret, in bytes or with a K, M or G suffix; 0 for no limit",
+	},
+	cli.DurationFlag{
+		Name:   "cache-ttl",
+		EnvVar: "SUMMON_CACHE_TTL",
+		Usage:  "Cache resolved secrets on disk (encrypted) for this long (e.g. 5m); 0 disables caching",
+	},
+	cli.BoolFlag{
+		Name:  "no-cache",
+		Usage: "Don't read or write cached secrets, even if a cache TTL is set",
+	},
+	cli.BoolTFlag{
+		Name:  "passthrough-exit-code",
+		Usage: "Exit with the command's exit status; if false, any command failure exits with 5 so it can't be mistaken for a summon failure",
+	},
+	cli.StringFlag{
+		Name:  "stdin-secret",
+		Usage: "Write the value of this secrets.yml variable to the command's stdin instead of its environment",
+	},
+	cli.StringSliceFlag{
+		Name:  "env-keep",
+		Usage: "Only pass on variables from summon's environment that match this glob pattern, e.g. 'LC_*' (repeatable)",
+	},
+	cli.StringSliceFlag{
+		Name:  "env-exclude",
+		Usage: "Don't pass on variables from summon's environment that match this glob pattern, e.g. 'AWS_*' (repeatable)",
+	},
+	cli.BoolFlag{
+		Name:  "clean-env",
+		Usage: "Pass only the secrets, a minimal environment (PATH, HOME, ...) and variables kept with --env-keep on to the command",
+	},
+	cli.BoolFlag{
+		Name:  "renew",
+		Usage: "Refresh !file secrets before the leases the provider reported for them end, while the command runs",
+	},
+	cli.StringFlag{
+		Name:  "renew-signal",
+		Usage: "Send this signal (e.g. HUP) to the command after a secret was renewed",
+	},
+	cli.StringFlag{
+		Name:   "deliver",
+		Value:  "env",
+		EnvVar: "SUMMON_DELIVER",
+		Usage:  "How to pass secrets to the command: env for its environment, or fd to write them to file descriptor 3 (see $SUMMON_SECRETS_FD)",
+	},
+	cli.BoolFlag{
+		Name:   "harden",
+		EnvVar: "SUMMON_HARDEN",
+		Usage:  "Disable core dumps and keep the command's environment locked in memory until it has started, then wipe it",
+	},
+	cli.StringFlag{
+		Name:  "chdir",
+		Usage: "Run the command in this directory; secrets.yml is still looked for relative to the current one",
+	},
+	cli.StringFlag{
+		Name:  "shell",
+		Usage: "Run this script with a shell instead of a command, e.g. 'make && make test | tee log'",
+	},
+	cli.StringFlag{
+		Name:   "shell-program",
+		EnvVar: "SUMMON_SHELL",
+		Usage:  "Shell --shell runs the script with (default: /bin/sh, or %COMSPEC% on Windows); cmd.exe, powershell and pwsh are supported besides POSIX shells",
+	},
+	cli.BoolFlag{
+		Name:  "new-process-group",
+		Usage: "Run the command in its own process group (a new session on Unix) and forward signals to the whole group",
+	},
+	cli.StringFlag{
+		Name:  "user",
+		Usage: "Run the command as this user, and optionally group, by name or ID (e.g. app:app); summon must be privileged (Unix only)",
+	},
+	cli.StringFlag{
+		Name:  "umask",
+		Usage: "Run the command with this file mode creation mask, in octal (e.g. 027) (Unix only)",
+	},
+	cli.StringSliceFlag{
+		Name:  "rlimit",
+		Value: &cli.StringSlice{},
+		Usage: "Set a resource limit of the command as name=limit or name=soft:hard, e.g. nofile=1024 (Unix only); can be given several times",
+	},
+	cli.BoolFlag{
+		Name:  "report-signal",
+		Usage: "Print the signal that terminated the command, if any",
+	},
+	cli.StringFlag{
+		Name:  "ci",
+		Usage: "Mask secrets in the job log of a CI system: github or gitlab",
+	},
+	cli.BoolFlag{
+		Name:  "ci-export",
+		Usage: "With --ci github, also write secrets to $GITHUB_ENV for later steps of the job",
+	},
+	cli.StringFlag{
+		Name:   "error-format",
+		Value:  "text",
+		EnvVar: "SUMMON_ERROR_FORMAT",
+		Usage:  "How to report errors: text, or json for a JSON object on stderr",
+	},
+	cli.BoolFlag{
+		Name:  "quiet, q",
+		Usage: "Print nothing but errors from summon itself and its subcommands",
+	},
+	cli.BoolFlag{
+		Name:  "json",
+		Usage: "Print the results of subcommands and -V as JSON",
+	},
 	cli.BoolFlag{
 		Name:  "all-provider-versions, V",
 		Usage: "List of all of the providers in the default path and their versions(if they have the --version tag)",
@@ -0,0 +1,40 @@
+package command
+
+import (
+	"encoding/json"
+	"io"
+
+	"github.com/urfave/cli"
+)
+
+// output prints the results of subcommands: as text, as JSON with --json, or
+// not at all with --quiet. Errors are reported either way.
+type output struct {
+	w     io.Writer
+	json  bool
+	quiet bool
+}
+
+// newOutput returns the output chosen for c. The flags may be given to the
+// subcommand or to summon itself, e.g. summon --json providers list.
+func newOutput(c *cli.Context) *output {
+	return &output{
+		w:     c.App.Writer,
+		json:  c.Bool("json") || c.GlobalBool("json"),
+		quiet: c.Bool("quiet") || c.GlobalBool("quiet"),
+	}
+}
+
+// print writes value as JSON, or the text writeText writes for it
+func (o *output) print(value interface{}, writeText func(w io.Writer) error) error {
+	switch {
+	case o.quiet:
+		return nil
+	case o.json:
+		encoder := json.NewEncoder(o.w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(value)
+	default:
+		return writeText(o.w)
+	}
+}
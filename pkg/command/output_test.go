@@ -0,0 +1,55 @@
+package command
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/urfave/cli"
+)
+
+func TestOutput(t *testing.T) {
+	value := map[string]string{"installed": "/providers/summon-conjur"}
+	writeText := func(w io.Writer) error {
+		_, err := fmt.Fprintln(w, "Installed provider /providers/summon-conjur")
+		return err
+	}
+
+	t.Run("prints text by default", func(t *testing.T) {
+		var out bytes.Buffer
+		assert.NoError(t, (&output{w: &out}).print(value, writeText))
+		assert.Equal(t, "Installed provider /providers/summon-conjur\n", out.String())
+	})
+
+	t.Run("prints JSON with --json", func(t *testing.T) {
+		var out bytes.Buffer
+		assert.NoError(t, (&output{w: &out, json: true}).print(value, writeText))
+		assert.Equal(t, "{\n  \"installed\": \"/providers/summon-conjur\"\n}\n", out.String())
+	})
+
+	t.Run("prints nothing with --quiet", func(t *testing.T) {
+		var out bytes.Buffer
+		assert.NoError(t, (&output{w: &out, json: true, quiet: true}).print(value, writeText))
+		assert.Empty(t, out.String())
+	})
+
+	t.Run("takes flags given to summon or to the subcommand", func(t *testing.T) {
+		app := cli.NewApp()
+		global := flag.NewFlagSet("summon", flag.ContinueOnError)
+		global.Bool("json", false, "")
+		global.Bool("quiet", false, "")
+		assert.NoError(t, global.Parse([]string{"--json"}))
+		local := flag.NewFlagSet("list", flag.ContinueOnError)
+		local.Bool("json", false, "")
+		local.Bool("quiet", false, "")
+		assert.NoError(t, local.Parse([]string{"--quiet"}))
+
+		c := cli.NewContext(app, local, cli.NewContext(app, global, nil))
+		out := newOutput(c)
+		assert.True(t, out.json)
+		assert.True(t, out.quiet)
+	})
+}
@@ -0,0 +1,253 @@
+// Package config loads the summon configuration file, which holds
+// operator settings such as provider checksum pins.
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ConfigEnv overrides the location of the configuration file
+const ConfigEnv = "SUMMON_CONFIG"
+
+// Config is the content of the summon configuration file
+type Config struct {
+	// RequireProviderChecksums refuses to run providers without a pinned checksum
+	RequireProviderChecksums bool `yaml:"require_provider_checksums"`
+	// Providers holds settings per provider, keyed by provider name or path
+	Providers map[string]ProviderConfig `yaml:"providers"`
+	// Aliases maps short names accepted by -p to a provider and how to run it
+	Aliases map[string]Alias `yaml:"aliases"`
+	// Search limits the upward search for secrets.yml (--up)
+	Search Search `yaml:"search"`
+	// Requires lists constraints on provider versions, e.g.
+	// "summon-conjur >= 0.7.0"
+	Requires Requirements `yaml:"requires"`
+
+	// Files are the configuration files the settings were read from
+	Files []string `yaml:"-"`
+	// system is the system-wide configuration the user's was merged with,
+	// whose checksum pins take precedence
+	system *Config
+}
+
+// Requirements are constraints on provider versions, given in the config
+// file as a single string or a list
+type Requirements []string
+
+// UnmarshalYAML accepts a single constraint as well as a list
+func (r *Requirements) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.ScalarNode {
+		*r = Requirements{node.Value}
+		return nil
+	}
+	var requirements []string
+	if err := node.Decode(&requirements); err != nil {
+		return err
+	}
+	*r = requirements
+	return nil
+}
+
+// Search holds the limits of the upward search for secrets.yml
+type Search struct {
+	// Root is the highest directory searched
+	Root string `yaml:"root"`
+	// StopMarkers are files or directories, such as .git, marking the top of
+	// a project: the directory holding one is the last searched
+	StopMarkers []string `yaml:"stop_markers"`
+	// ConfirmOutsideRepo asks before using a secrets file found above the
+	// git repository of the working directory
+	ConfirmOutsideRepo bool `yaml:"confirm_outside_repo"`
+}
+
+// Alias is a provider along with arguments and environment to run it with,
+// e.g. the Conjur provider pointed at a particular account
+type Alias struct {
+	// Provider is the provider name or path the alias expands to
+	Provider string `yaml:"provider"`
+	// Args are passed to the provider ahead of the secret path
+	Args []string `yaml:"args"`
+	// Env is added to the environment of the provider
+	Env map[string]string `yaml:"env"`
+}
+
+// ProviderConfig holds the settings for a single provider
+type ProviderConfig struct {
+	// SHA256 is the expected hex-encoded SHA-256 checksum of the executable
+	SHA256 string `yaml:"sha256"`
+	// Env lists glob patterns of the environment variables the provider may
+	// see (e.g. "CONJUR_*"); if empty the provider sees summon's environment
+	Env []string `yaml:"env"`
+	// Sandbox runs the provider with restricted access to the host
+	Sandbox bool `yaml:"sandbox"`
+	// Seccomp is the path to a compiled seccomp BPF program to confine the
+	// provider with; it implies Sandbox (Linux only)
+	Seccomp string `yaml:"seccomp"`
+	// PathVia is how secret paths are passed to the provider, as with
+	// --provider-path-via
+	PathVia string `yaml:"path_via"`
+}
+
+// DefaultPath returns the configuration file settings are changed in: the
+// user's, see UserPath, if there is one, otherwise the system-wide file.
+func DefaultPath() string {
+	if path := UserPath(); path != "" {
+		return path
+	}
+	return systemPath()
+}
+
+// UserPath returns the user's configuration file: $SUMMON_CONFIG if set,
+// otherwise ~/.summon/config.yml if it exists, otherwise "".
+func UserPath() string {
+	if path := os.Getenv(ConfigEnv); path != "" {
+		return path
+	}
+
+	if home, err := os.UserHomeDir(); err == nil {
+		userPath := filepath.Join(home, ".summon", "config.yml")
+		if _, err := os.Stat(userPath); err == nil {
+			return userPath
+		}
+	}
+	return ""
+}
+
+// systemPath returns the system-wide configuration file; swapped out in tests
+var systemPath = defaultSystemPath
+
+func defaultSystemPath() string {
+	if runtime.GOOS == "windows" {
+		programData := os.Getenv("ProgramData")
+		if programData == "" {
+			programData = filepath.Join("C:", "ProgramData")
+		}
+		return filepath.Join(programData, "Cyberark Conjur", "Summon", "config.yml")
+	}
+	return "/etc/summon/config.yml"
+}
+
+// Load reads the configuration file at path. A missing file is not an error
+// and results in an empty configuration.
+func Load(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return &Config{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	config := &Config{}
+	if err := yaml.Unmarshal(data, config); err != nil {
+		return nil, fmt.Errorf("unable to parse config file %s: %s", path, err)
+	}
+	config.Files = []string{path}
+	return config, nil
+}
+
+// LoadDefault loads the system-wide configuration file, and the user's on top
+// of it if there is one, see Merge
+func LoadDefault() (*Config, error) {
+	system, err := Load(systemPath())
+	if err != nil {
+		return nil, err
+	}
+	userPath := UserPath()
+	if userPath == "" || userPath == systemPath() {
+		return system, nil
+	}
+	user, err := Load(userPath)
+	if err != nil {
+		return nil, err
+	}
+	return Merge(system, user), nil
+}
+
+// Merge returns the settings of user on top of those of system. Checksum
+// settings of system can't be loosened: providers must have a checksum if
+// either requires it, and a checksum system pins for a provider is the one
+// it is checked against. Provider requirements of both apply.
+func Merge(system, user *Config) *Config {
+	merged := &Config{
+		RequireProviderChecksums: system.RequireProviderChecksums || user.RequireProviderChecksums,
+		Providers:                map[string]ProviderConfig{},
+		Aliases:                  map[string]Alias{},
+		Search:                   system.Search,
+		Requires:                 append(append(Requirements{}, system.Requires...), user.Requires...),
+		Files:                    append(append([]string{}, system.Files...), user.Files...),
+		system:                   system,
+	}
+	for _, providers := range []map[string]ProviderConfig{system.Providers, user.Providers} {
+		for name, providerConfig := range providers {
+			merged.Providers[name] = providerConfig
+		}
+	}
+	for _, aliases := range []map[string]Alias{system.Aliases, user.Aliases} {
+		for name, alias := range aliases {
+			merged.Aliases[name] = alias
+		}
+	}
+	if user.Search.Root != "" {
+		merged.Search.Root = user.Search.Root
+	}
+	if len(user.Search.StopMarkers) > 0 {
+		merged.Search.StopMarkers = user.Search.StopMarkers
+	}
+	merged.Search.ConfirmOutsideRepo = system.Search.ConfirmOutsideRepo || user.Search.ConfirmOutsideRepo
+	return merged
+}
+
+// Source names the files the settings come from, for error messages
+func (c *Config) Source() string {
+	if len(c.Files) == 0 {
+		return DefaultPath()
+	}
+	return strings.Join(c.Files, " and ")
+}
+
+// Alias returns the alias called name, if there is one
+func (c *Config) Alias(name string) (Alias, bool) {
+	alias, ok := c.Aliases[name]
+	return alias, ok
+}
+
+// EnvPairs returns the alias environment in NAME=value form, sorted by name
+func (a Alias) EnvPairs() []string {
+	pairs := make([]string, 0, len(a.Env))
+	for name, value := range a.Env {
+		pairs = append(pairs, name+"="+value)
+	}
+	sort.Strings(pairs)
+	return pairs
+}
+
+// Provider returns the settings for the provider at providerPath, matching
+// its full path first and then its file name. A checksum pinned in the
+// system-wide file for the provider overrides the user's.
+func (c *Config) Provider(providerPath string) (ProviderConfig, bool) {
+	providerConfig, ok := c.lookupProvider(providerPath)
+	if c.system != nil {
+		if pinned, found := c.system.lookupProvider(providerPath); found && pinned.SHA256 != "" {
+			providerConfig.SHA256 = pinned.SHA256
+			ok = true
+		}
+	}
+	return providerConfig, ok
+}
+
+func (c *Config) lookupProvider(providerPath string) (ProviderConfig, bool) {
+	if providerConfig, ok := c.Providers[providerPath]; ok {
+		return providerConfig, true
+	}
+	providerConfig, ok := c.Providers[filepath.Base(providerPath)]
+	return providerConfig, ok
+}
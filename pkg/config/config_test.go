@@ -0,0 +1,194 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoad(t *testing.T) {
+	t.Run("parses provider settings", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "config.yml")
+		content := `
+require_provider_checksums: true
+providers:
+  summon-conjur:
+    sha256: 0123abcd
+`
+		assert.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+
+		cfg, err := Load(path)
+		assert.NoError(t, err)
+		assert.True(t, cfg.RequireProviderChecksums)
+		assert.Equal(t, "0123abcd", cfg.Providers["summon-conjur"].SHA256)
+	})
+
+	t.Run("parses search limits", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "config.yml")
+		content := `
+search:
+  root: /work
+  stop_markers: [.git, .hg]
+  confirm_outside_repo: true
+`
+		assert.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+
+		cfg, err := Load(path)
+		assert.NoError(t, err)
+		assert.Equal(t, Search{Root: "/work", StopMarkers: []string{".git", ".hg"}, ConfirmOutsideRepo: true}, cfg.Search)
+	})
+
+	t.Run("parses provider requirements, one or a list", func(t *testing.T) {
+		dir := t.TempDir()
+		one := filepath.Join(dir, "one.yml")
+		assert.NoError(t, os.WriteFile(one, []byte("requires: summon-conjur >= 0.7.0\n"), 0o600))
+		list := filepath.Join(dir, "list.yml")
+		assert.NoError(t, os.WriteFile(list, []byte("requires: [summon-conjur >= 0.7.0, summon-aws < 2]\n"), 0o600))
+
+		cfg, err := Load(one)
+		assert.NoError(t, err)
+		assert.Equal(t, Requirements{"summon-conjur >= 0.7.0"}, cfg.Requires)
+
+		cfg, err = Load(list)
+		assert.NoError(t, err)
+		assert.Equal(t, Requirements{"summon-conjur >= 0.7.0", "summon-aws < 2"}, cfg.Requires)
+	})
+
+	t.Run("returns an empty config if the file doesn't exist", func(t *testing.T) {
+		cfg, err := Load(filepath.Join(t.TempDir(), "missing.yml"))
+		assert.NoError(t, err)
+		assert.Equal(t, &Config{}, cfg)
+	})
+
+	t.Run("returns an error for invalid YAML", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "config.yml")
+		assert.NoError(t, os.WriteFile(path, []byte("providers: ["), 0o600))
+
+		_, err := Load(path)
+		assert.Contains(t, err.Error(), "unable to parse config file "+path)
+	})
+}
+
+func TestDefaultPath(t *testing.T) {
+	t.Setenv(ConfigEnv, "/path/to/config.yml")
+	assert.Equal(t, "/path/to/config.yml", DefaultPath())
+}
+
+func TestLoadDefault(t *testing.T) {
+	dir := t.TempDir()
+	system := filepath.Join(dir, "system.yml")
+	user := filepath.Join(dir, "user.yml")
+	assert.NoError(t, os.WriteFile(system, []byte(`
+require_provider_checksums: true
+requires: summon-conjur >= 0.7.0
+providers:
+  summon-conjur:
+    sha256: pinned-by-operator
+`), 0o600))
+	assert.NoError(t, os.WriteFile(user, []byte(`
+requires: summon-aws < 2
+providers:
+  /usr/local/lib/summon/summon-conjur:
+    sha256: pinned-by-user
+    env: ["CONJUR_*"]
+  summon-aws:
+    sha256: aws-by-user
+aliases:
+  prod:
+    provider: summon-conjur
+`), 0o600))
+
+	defaultSystemPath := systemPath
+	systemPath = func() string { return system }
+	defer func() { systemPath = defaultSystemPath }()
+
+	t.Run("the user's file is merged with the system-wide one", func(t *testing.T) {
+		t.Setenv(ConfigEnv, user)
+		cfg, err := LoadDefault()
+		assert.NoError(t, err)
+
+		assert.True(t, cfg.RequireProviderChecksums)
+		assert.Equal(t, Requirements{"summon-conjur >= 0.7.0", "summon-aws < 2"}, cfg.Requires)
+		assert.Equal(t, []string{system, user}, cfg.Files)
+		_, ok := cfg.Alias("prod")
+		assert.True(t, ok)
+
+		// The operator's pin wins, the rest of the user's settings apply
+		providerConfig, ok := cfg.Provider("/usr/local/lib/summon/summon-conjur")
+		assert.True(t, ok)
+		assert.Equal(t, "pinned-by-operator", providerConfig.SHA256)
+		assert.Equal(t, []string{"CONJUR_*"}, providerConfig.Env)
+		// Where the operator pinned nothing, the user's pin applies
+		providerConfig, ok = cfg.Provider("/usr/local/lib/summon/summon-aws")
+		assert.True(t, ok)
+		assert.Equal(t, "aws-by-user", providerConfig.SHA256)
+	})
+
+	t.Run("a user's file can't loosen checksum requirements", func(t *testing.T) {
+		loosening := filepath.Join(dir, "loosening.yml")
+		assert.NoError(t, os.WriteFile(loosening, []byte("require_provider_checksums: false\n"), 0o600))
+		t.Setenv(ConfigEnv, loosening)
+
+		cfg, err := LoadDefault()
+		assert.NoError(t, err)
+		assert.True(t, cfg.RequireProviderChecksums)
+	})
+
+	t.Run("without a user's file, the system-wide one applies", func(t *testing.T) {
+		t.Setenv(ConfigEnv, "")
+		t.Setenv("HOME", t.TempDir())
+		cfg, err := LoadDefault()
+		assert.NoError(t, err)
+		assert.Equal(t, []string{system}, cfg.Files)
+		assert.Equal(t, system, cfg.Source())
+	})
+}
+
+func TestConfigProvider(t *testing.T) {
+	cfg := &Config{Providers: map[string]ProviderConfig{
+		"summon-conjur":                    {SHA256: "by-name"},
+		"/opt/summon/providers/summon-aws": {SHA256: "by-path"},
+	}}
+
+	providerConfig, ok := cfg.Provider("/usr/local/lib/summon/summon-conjur")
+	assert.True(t, ok)
+	assert.Equal(t, "by-name", providerConfig.SHA256)
+
+	providerConfig, ok = cfg.Provider("/opt/summon/providers/summon-aws")
+	assert.True(t, ok)
+	assert.Equal(t, "by-path", providerConfig.SHA256)
+
+	_, ok = cfg.Provider("/usr/local/lib/summon/summon-aws")
+	assert.False(t, ok)
+}
+
+func TestAlias(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yml")
+	content := `
+aliases:
+  prod-conjur:
+    provider: /usr/local/lib/summon/summon-conjur
+    args: [--verbose]
+    env:
+      CONJUR_ACCOUNT: prod
+      CONJUR_APPLIANCE_URL: https://conjur.example.com
+`
+	assert.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+
+	cfg, err := Load(path)
+	assert.NoError(t, err)
+
+	alias, ok := cfg.Alias("prod-conjur")
+	assert.True(t, ok)
+	assert.Equal(t, "/usr/local/lib/summon/summon-conjur", alias.Provider)
+	assert.Equal(t, []string{"--verbose"}, alias.Args)
+	assert.Equal(t, []string{
+		"CONJUR_ACCOUNT=prod",
+		"CONJUR_APPLIANCE_URL=https://conjur.example.com",
+	}, alias.EnvPairs())
+
+	_, ok = cfg.Alias("summon-conjur")
+	assert.False(t, ok)
+}
@@ -0,0 +1,84 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/cyberark/summon/pkg/remote"
+	"gopkg.in/yaml.v3"
+)
+
+// ProjectFileName is the name of the per-project defaults file, which is
+// looked up from the working directory towards the root of the file system
+const ProjectFileName = ".summonrc"
+
+// Project holds per-project defaults, read from a .summonrc file kept
+// alongside the project's secrets.yml. Command line flags take precedence.
+type Project struct {
+	// Provider is the name of a provider in the search path, or an alias.
+	// Paths are refused, so that a checked out project can't pick the
+	// executable summon runs.
+	Provider string `yaml:"provider"`
+	// Environment is the default section of secrets.yml to use (-e)
+	Environment string `yaml:"environment"`
+	// SecretsFile is the secrets file relative to the directory of the
+	// .summonrc, "secrets.yml" by default
+	SecretsFile string `yaml:"secrets_file"`
+	// Substitutions are default values for -D substitutions
+	Substitutions map[string]string `yaml:"substitutions"`
+
+	// Dir is the directory the .summonrc was found in
+	Dir string `yaml:"-"`
+}
+
+// LoadProject reads the .summonrc at path, which must belong to the current
+// user or root
+func LoadProject(path string) (*Project, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkOwner(path, info); err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	project := &Project{}
+	if err := yaml.Unmarshal(data, project); err != nil {
+		return nil, fmt.Errorf("unable to parse %s: %s", path, err)
+	}
+	if strings.ContainsAny(project.Provider, `/\`) || project.Provider == "." || project.Provider == ".." {
+		return nil, fmt.Errorf("%s: provider must be the name of a provider or an alias, not a path", path)
+	}
+	project.Dir = filepath.Dir(path)
+	return project, nil
+}
+
+// SecretsPath returns the path of the project's secrets file
+func (p *Project) SecretsPath() string {
+	secretsFile := p.SecretsFile
+	if secretsFile == "" {
+		secretsFile = "secrets.yml"
+	}
+	if filepath.IsAbs(secretsFile) || remote.IsRemote(secretsFile) {
+		return secretsFile
+	}
+	return filepath.Join(p.Dir, secretsFile)
+}
+
+// SubstitutionPairs returns the substitutions in the var=value form of -D,
+// sorted by name
+func (p *Project) SubstitutionPairs() []string {
+	pairs := make([]string, 0, len(p.Substitutions))
+	for name, value := range p.Substitutions {
+		pairs = append(pairs, name+"="+value)
+	}
+	sort.Strings(pairs)
+	return pairs
+}
@@ -0,0 +1,55 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoadProject(t *testing.T) {
+	t.Run("parses project defaults", func(t *testing.T) {
+		dir := t.TempDir()
+		path := filepath.Join(dir, ProjectFileName)
+		content := `
+provider: summon-conjur
+environment: dev
+substitutions:
+  region: eu
+  app: web
+`
+		assert.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+
+		project, err := LoadProject(path)
+		assert.NoError(t, err)
+		assert.Equal(t, dir, project.Dir)
+		assert.Equal(t, "dev", project.Environment)
+		assert.Equal(t, "summon-conjur", project.Provider)
+		assert.Equal(t, filepath.Join(dir, "secrets.yml"), project.SecretsPath())
+		assert.Equal(t, []string{"app=web", "region=eu"}, project.SubstitutionPairs())
+	})
+
+	t.Run("keeps remote secrets files as they are", func(t *testing.T) {
+		project := &Project{Dir: t.TempDir(), SecretsFile: "https://config.example.com/secrets.yml"}
+		assert.Equal(t, "https://config.example.com/secrets.yml", project.SecretsPath())
+	})
+
+	t.Run("refuses a provider path", func(t *testing.T) {
+		for _, provider := range []string{"./tool", "bin/provider", "/usr/bin/tool", `..\tool.exe`, ".."} {
+			path := filepath.Join(t.TempDir(), ProjectFileName)
+			assert.NoError(t, os.WriteFile(path, []byte("provider: '"+provider+"'"), 0o600))
+
+			_, err := LoadProject(path)
+			assert.EqualError(t, err, path+": provider must be the name of a provider or an alias, not a path")
+		}
+	})
+
+	t.Run("returns an error for invalid YAML", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), ProjectFileName)
+		assert.NoError(t, os.WriteFile(path, []byte("provider: ["), 0o600))
+
+		_, err := LoadProject(path)
+		assert.Contains(t, err.Error(), "unable to parse "+path)
+	})
+}
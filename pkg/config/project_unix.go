@@ -0,0 +1,22 @@
+//go:build !windows
+
+package config
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+)
+
+// checkOwner refuses a .summonrc owned by another user than the current one
+// or root, which could otherwise pick the provider summon runs
+func checkOwner(path string, info os.FileInfo) error {
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return nil
+	}
+	if uid := int(stat.Uid); uid != os.Getuid() && uid != 0 {
+		return fmt.Errorf("%s is owned by another user (%d)", path, uid)
+	}
+	return nil
+}
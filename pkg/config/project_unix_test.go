@@ -0,0 +1,26 @@
+//go:build !windows
+
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoadProjectOwner(t *testing.T) {
+	if os.Getuid() != 0 {
+		t.Skip("giving a file to another user needs root")
+	}
+	path := filepath.Join(t.TempDir(), ProjectFileName)
+	assert.NoError(t, os.WriteFile(path, []byte("provider: summon-conjur\n"), 0o644))
+
+	_, err := LoadProject(path)
+	assert.NoError(t, err)
+
+	assert.NoError(t, os.Chown(path, 65534, 65534))
+	_, err = LoadProject(path)
+	assert.EqualError(t, err, path+" is owned by another user (65534)")
+}
@@ -0,0 +1,11 @@
+//go:build windows
+
+package config
+
+import "os"
+
+// checkOwner accepts any .summonrc on Windows, where files have no owner ID
+// to compare
+func checkOwner(path string, info os.FileInfo) error {
+	return nil
+}
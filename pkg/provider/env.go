@@ -0,0 +1,51 @@
+package provider
+
+import (
+	"path"
+	"runtime"
+	"strings"
+)
+
+// baseEnv lists variables providers always receive when their environment
+// is restricted, since most programs can't run properly without them
+var baseEnv = []string{
+	"PATH", "HOME", "USER", "LOGNAME", "LANG", "LC_*", "TMPDIR", "TZ",
+	// Windows
+	"SystemRoot", "SystemDrive", "ComSpec", "PATHEXT", "USERPROFILE",
+	"APPDATA", "LOCALAPPDATA", "TEMP", "TMP",
+}
+
+// FilterEnv returns the entries of environ ("NAME=value") whose name matches
+// one of the glob patterns (e.g. "CONJUR_*"), or one of a few basic variables
+// such as PATH and HOME. With no patterns, environ is returned unchanged.
+func FilterEnv(environ []string, patterns []string) []string {
+	if len(patterns) == 0 {
+		return environ
+	}
+
+	allowed := append(append([]string{}, baseEnv...), patterns...)
+	filtered := []string{}
+	for _, entry := range environ {
+		name := strings.SplitN(entry, "=", 2)[0]
+		if matchesAny(name, allowed) {
+			filtered = append(filtered, entry)
+		}
+	}
+	return filtered
+}
+
+func matchesAny(name string, patterns []string) bool {
+	// Environment variable names are case-insensitive on Windows
+	if runtime.GOOS == "windows" {
+		name = strings.ToUpper(name)
+	}
+	for _, pattern := range patterns {
+		if runtime.GOOS == "windows" {
+			pattern = strings.ToUpper(pattern)
+		}
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,81 @@
+package provider
+
+import (
+	"regexp"
+	"strings"
+)
+
+// exitTempFail is the sysexits.h code for a temporary failure. Providers may
+// exit with it to signal that the lookup is worth retrying.
+const exitTempFail = 75
+
+// transientMarkers are fragments of provider stderr that indicate a failure
+// that is likely to go away on its own, e.g. a network blip or rate limiting.
+var transientMarkers = []string{
+	"timeout",
+	"timed out",
+	"temporarily",
+	"temporary failure",
+	"try again",
+	"connection refused",
+	"connection reset",
+	"no route to host",
+	"network is unreachable",
+	"service unavailable",
+	"too many requests",
+	"rate limit",
+	"bad gateway",
+	"gateway timeout",
+}
+
+// transientStatus matches an HTTP status worth retrying when it is given as
+// one, e.g. "HTTP 503" or "status code: 429", and not a bare number that may
+// well be part of a path, an ID or a port
+var transientStatus = regexp.MustCompile(`\b(http|status|status code|code)[ :=/]*(429|502|503|504)\b`)
+
+// CallError is returned when a provider fails to resolve a secret path.
+type CallError struct {
+	Provider string
+	Path     string
+	// ExitCode is the exit status of the provider, or -1 if the provider
+	// could not be run at all.
+	ExitCode int
+	// TimedOut is set when the provider was killed for exceeding its timeout
+	TimedOut bool
+	Stderr   string
+	Err      error
+}
+
+func (e *CallError) Error() string {
+	errstr := e.Err.Error()
+	if e.Stderr != "" {
+		errstr += ": " + e.Stderr
+	}
+	return errstr
+}
+
+func (e *CallError) Unwrap() error {
+	return e.Err
+}
+
+// Transient reports whether the provider timed out or exited with a failure
+// that looks temporary, so that calling it again may succeed.
+func (e *CallError) Transient() bool {
+	if e.TimedOut {
+		return true
+	}
+	if e.ExitCode <= 0 {
+		return false
+	}
+	if e.ExitCode == exitTempFail {
+		return true
+	}
+
+	stderr := strings.ToLower(e.Stderr)
+	for _, marker := range transientMarkers {
+		if strings.Contains(stderr, marker) {
+			return true
+		}
+	}
+	return transientStatus.MatchString(stderr)
+}
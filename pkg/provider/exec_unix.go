@@ -0,0 +1,21 @@
+//go:build !windows
+
+package provider
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// killProcessGroupOnCancel starts cmd in its own process group and makes
+// context cancellation kill the whole group, so helpers forked by the
+// provider can't keep it alive past its deadline.
+func killProcessGroupOnCancel(cmd *exec.Cmd) {
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.Setpgid = true
+	cmd.Cancel = func() error {
+		return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+	}
+}
@@ -0,0 +1,11 @@
+//go:build windows
+
+package provider
+
+import (
+	"os/exec"
+)
+
+// killProcessGroupOnCancel is a no-op on Windows: exec.CommandContext already
+// kills the provider process when the context is cancelled.
+func killProcessGroupOnCancel(cmd *exec.Cmd) {}
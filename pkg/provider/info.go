@@ -0,0 +1,126 @@
+package provider
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Capabilities a provider can advertise in response to --capabilities, as a
+// whitespace-separated list
+const (
+	// CapabilityBatch means the provider supports interactive mode, resolving
+	// many paths in one process
+	CapabilityBatch = "batch"
+	// CapabilityList means the provider can list the paths it can resolve
+	CapabilityList = "list"
+	// CapabilityMetadata means the provider can return metadata (version,
+	// lease) along with values
+	CapabilityMetadata = "metadata"
+	// CapabilityHealth means the provider answers --health with exit status 0
+	// when it can reach its backend
+	CapabilityHealth = "health"
+	// CapabilityExists means the provider answers --exists <path> with exit
+	// status 0 when it could resolve the path, without returning its value
+	CapabilityExists = "exists"
+	// CapabilityPathStdin means the provider reads the secret path from its
+	// standard input when run without one as an argument
+	CapabilityPathStdin = "path-stdin"
+	// CapabilityPathEnv means the provider takes the secret path from
+	// PathEnvVar when run without one as an argument
+	CapabilityPathEnv = "path-env"
+)
+
+var knownCapabilities = []string{
+	CapabilityBatch, CapabilityList, CapabilityMetadata, CapabilityHealth, CapabilityExists,
+	CapabilityPathStdin, CapabilityPathEnv,
+}
+
+// Health statuses reported by Describe
+const (
+	HealthOK      = "ok"
+	HealthFailing = "failing"
+	HealthUnknown = "unknown"
+	// HealthUnverified is reported, instead of describing the provider, for a
+	// provider that failed its checksum check and so wasn't run
+	HealthUnverified = "unverified"
+)
+
+// probeTimeout bounds each call Describe makes to a provider
+var probeTimeout = 5 * time.Second
+
+// Info describes an installed provider
+type Info struct {
+	Name         string   `json:"name"`
+	Path         string   `json:"path"`
+	Version      string   `json:"version,omitempty"`
+	Capabilities []string `json:"capabilities"`
+	// Health is HealthOK, HealthFailing or, for providers that don't support
+	// health checks, HealthUnknown
+	Health      string `json:"health"`
+	HealthError string `json:"health_error,omitempty"`
+}
+
+// Describe asks the provider at path for its version and capabilities, and
+// runs its health check if it has one. Providers that don't understand these
+// flags are reported without a version or capabilities.
+func Describe(path string) Info {
+	info := Info{
+		Name:         filepath.Base(path),
+		Path:         path,
+		Capabilities: Capabilities(path),
+		Health:       HealthUnknown,
+	}
+
+	if out, err := Version(path); err == nil {
+		info.Version = out
+	}
+
+	if contains(info.Capabilities, CapabilityHealth) {
+		if _, err := probe(path, "--health"); err != nil {
+			info.Health = HealthFailing
+			info.HealthError = err.Error()
+		} else {
+			info.Health = HealthOK
+		}
+	}
+
+	return info
+}
+
+// Capabilities asks the provider at path for the capabilities it advertises
+// (--capabilities). Older providers take the flag for a secret path, so
+// anything that isn't a known capability is ignored.
+func Capabilities(path string) []string {
+	capabilities := []string{}
+	if out, err := probe(path, "--capabilities"); err == nil {
+		for _, capability := range strings.Fields(out) {
+			if contains(knownCapabilities, capability) && !contains(capabilities, capability) {
+				capabilities = append(capabilities, capability)
+			}
+		}
+	}
+	return capabilities
+}
+
+// Version asks the provider at path for its version (--version)
+func Version(path string) (string, error) {
+	return probe(path, "--version")
+}
+
+// probe runs the provider with a single flag and returns its trimmed output
+func probe(path, flag string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), probeTimeout)
+	defer cancel()
+	return CallContext(ctx, path, flag, Options{})
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
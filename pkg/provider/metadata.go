@@ -0,0 +1,91 @@
+package provider
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// MetadataEnvVar is set to 1 in the environment of providers whose responses
+// summon reads as metadata envelopes when they are. A provider that supports
+// metadata may then answer with an envelope instead of the plain value.
+const MetadataEnvVar = "SUMMON_PROVIDER_METADATA"
+
+// metadataVersion is the version of the envelope format summon understands
+const metadataVersion = 1
+
+// Metadata describes a secret value, as reported by the provider
+type Metadata struct {
+	// Version of the secret in the backend, if it keeps versions
+	Version string
+	// LeaseDuration is how long the value is valid for; zero if unknown
+	LeaseDuration time.Duration
+}
+
+// envelope is a provider response carrying metadata along with the value, e.g.
+//
+//	{"summon_metadata": 1, "value": "hunter2", "version": "7", "lease_duration": 3600}
+//
+// Binary values are given base64-encoded in value_base64 instead.
+type envelope struct {
+	Format        int     `json:"summon_metadata"`
+	Value         *string `json:"value"`
+	ValueBase64   *string `json:"value_base64"`
+	Version       string  `json:"version"`
+	LeaseDuration int64   `json:"lease_duration"`
+}
+
+// ParseResponse returns the value and metadata in a provider's response. A
+// response that isn't an envelope is the plain value, returned as is with nil
+// metadata.
+func ParseResponse(response string) (string, *Metadata, error) {
+	trimmed := strings.TrimSpace(response)
+	if !strings.HasPrefix(trimmed, "{") || !strings.Contains(trimmed, `"summon_metadata"`) {
+		return response, nil, nil
+	}
+
+	var e envelope
+	if err := json.Unmarshal([]byte(trimmed), &e); err != nil || e.Format == 0 {
+		// A JSON secret that happens to mention the key
+		return response, nil, nil
+	}
+	if e.Format != metadataVersion {
+		return "", nil, fmt.Errorf("unsupported provider metadata version %d", e.Format)
+	}
+	if e.LeaseDuration < 0 {
+		return "", nil, fmt.Errorf("invalid lease duration %d in provider metadata", e.LeaseDuration)
+	}
+
+	var value string
+	switch {
+	case e.Value != nil && e.ValueBase64 != nil:
+		return "", nil, fmt.Errorf("provider metadata has both value and value_base64")
+	case e.Value != nil:
+		value = *e.Value
+	case e.ValueBase64 != nil:
+		decoded, err := base64.StdEncoding.DecodeString(*e.ValueBase64)
+		if err != nil {
+			return "", nil, fmt.Errorf("invalid value_base64 in provider metadata: %s", err)
+		}
+		value = string(decoded)
+	default:
+		return "", nil, fmt.Errorf("provider metadata has no value")
+	}
+
+	return value, &Metadata{
+		Version:       e.Version,
+		LeaseDuration: time.Duration(e.LeaseDuration) * time.Second,
+	}, nil
+}
+
+// metadataEnv returns env, or summon's own environment if env is nil, telling
+// the provider that it may answer with metadata envelopes
+func metadataEnv(env []string) []string {
+	if env == nil {
+		env = os.Environ()
+	}
+	return append(append([]string{}, env...), MetadataEnvVar+"=1")
+}
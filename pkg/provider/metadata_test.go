@@ -0,0 +1,59 @@
+package provider
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseResponse(t *testing.T) {
+	t.Run("Plain values are returned as is", func(t *testing.T) {
+		for _, response := range []string{"hunter2", `{"password": "hunter2"}`, `{"summon_metadata"`} {
+			value, metadata, err := ParseResponse(response)
+			assert.NoError(t, err)
+			assert.Equal(t, response, value)
+			assert.Nil(t, metadata)
+		}
+	})
+
+	t.Run("Envelopes are unwrapped", func(t *testing.T) {
+		value, metadata, err := ParseResponse(`{"summon_metadata": 1, "value": "hunter2", "version": "7", "lease_duration": 3600}`)
+		assert.NoError(t, err)
+		assert.Equal(t, "hunter2", value)
+		assert.Equal(t, &Metadata{Version: "7", LeaseDuration: time.Hour}, metadata)
+	})
+
+	t.Run("Binary values are base64-encoded", func(t *testing.T) {
+		value, metadata, err := ParseResponse(`{"summon_metadata": 1, "value_base64": "AAH/"}`)
+		assert.NoError(t, err)
+		assert.Equal(t, "\x00\x01\xff", value)
+		assert.Equal(t, &Metadata{}, metadata)
+	})
+
+	t.Run("Invalid envelopes fail", func(t *testing.T) {
+		for response, message := range map[string]string{
+			`{"summon_metadata": 2, "value": "x"}`:                         "unsupported provider metadata version 2",
+			`{"summon_metadata": 1}`:                                       "provider metadata has no value",
+			`{"summon_metadata": 1, "value": "x", "value_base64": "eA=="}`: "provider metadata has both value and value_base64",
+			`{"summon_metadata": 1, "value": "x", "lease_duration": -1}`:   "invalid lease duration -1 in provider metadata",
+		} {
+			_, _, err := ParseResponse(response)
+			assert.EqualError(t, err, message)
+		}
+	})
+}
+
+func TestProviderCallAdvertisesMetadata(t *testing.T) {
+	out, err := CallContext(context.Background(), "printenv", MetadataEnvVar, Options{})
+	assert.NoError(t, err)
+	assert.Equal(t, "1", out)
+
+	// Streamed output is written as is, so can't be an envelope
+	var streamed bytes.Buffer
+	err = CallStream(context.Background(), "printenv", MetadataEnvVar, Options{}, &streamed)
+	assert.Error(t, err)
+	assert.Empty(t, streamed.String())
+}
@@ -7,12 +7,14 @@ import (
 	"encoding/base64"
 	"errors"
 	"fmt"
+	"io"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"runtime"
 	"strings"
 	"time"
+	"unicode/utf8"
 
 	"github.com/cyberark/summon/pkg/secretsyml"
 )
@@ -27,15 +29,23 @@ func Resolve(providerArg string) (string, error) {
 	}
 
 	if provider == "" {
-		defaultPath, err := GetDefaultPath()
+		searchPaths, err := GetSearchPaths()
 		if err != nil {
 			return "", err
 		}
-		providers, _ := os.ReadDir(defaultPath)
-		if len(providers) == 1 {
-			provider = providers[0].Name()
-		} else if len(providers) > 1 {
-			return "", fmt.Errorf("More than one provider found in %s, please specify one\n", defaultPath)
+		// The first directory with any providers must hold only one, so
+		// that e.g. a provider installed for the user doesn't make the
+		// system's one ambiguous
+		for _, dir := range searchPaths {
+			names, _ := GetAllProviders(dir)
+			if len(names) == 1 {
+				provider = filepath.Join(dir, names[0])
+			} else if len(names) > 1 {
+				return "", fmt.Errorf("More than one provider found in %s, please specify one\n", dir)
+			}
+			if len(names) > 0 {
+				break
+			}
 		}
 	}
 
@@ -55,30 +65,184 @@ func Resolve(providerArg string) (string, error) {
 	return provider, nil
 }
 
+// Options control how provider processes are run. The zero value runs the
+// provider the way summon always has.
+type Options struct {
+	// Env is the environment of the provider process; nil means summon's own
+	Env []string
+	// Sandbox restricts what the provider process can do to the host
+	Sandbox Sandbox
+	// Args are passed to the provider ahead of the secret path
+	Args []string
+	// MaxOutputSize is the most a provider may return for a secret, in bytes;
+	// zero means no limit
+	MaxOutputSize int64
+	// Timeout is how long a provider in interactive mode, which resolves every
+	// secret in a single call, may run: DefaultInteractiveTimeout if zero, and
+	// no limit if negative. Other calls are bounded by their context.
+	Timeout time.Duration
+	// PathVia is how the secret path is passed to the provider: PathViaArgv
+	// (or "") as its last argument, PathViaStdin on its standard input or
+	// PathViaEnv in PathEnvVar. Arguments can be seen by other users of the
+	// host, e.g. with ps.
+	PathVia string
+}
+
+// Ways of passing the secret path to the provider process, see Options.PathVia
+const (
+	PathViaArgv  = "argv"
+	PathViaStdin = "stdin"
+	PathViaEnv   = "env"
+)
+
+// PathEnvVar holds the secret path for providers it is passed to with
+// PathViaEnv
+const PathEnvVar = "SUMMON_SECRET_PATH"
+
+// NegotiatePathVia returns the safest way of passing secret paths to a
+// provider with the given capabilities: on its standard input, else in its
+// environment, else as an argument, the way legacy providers expect them.
+func NegotiatePathVia(capabilities []string) string {
+	switch {
+	case contains(capabilities, CapabilityPathStdin):
+		return PathViaStdin
+	case contains(capabilities, CapabilityPathEnv):
+		return PathViaEnv
+	default:
+		return PathViaArgv
+	}
+}
+
 // Call shells out to a provider and return its output
 // If call succeeds, stdout is returned with no error
-// If call fails, "" is return with error containing stderr
+// If call fails, "" is return with a *CallError containing stderr
+// Text output is trimmed of surrounding whitespace, but output that isn't
+// valid UTF-8 is binary (e.g. a DER key or a keytab) and returned byte for byte.
 func Call(provider, specPath string) (string, error) {
-	var (
-		stdOut bytes.Buffer
-		stdErr bytes.Buffer
-	)
-	cmd := exec.Command(provider, specPath)
-	cmd.Stdout = &stdOut
+	return CallContext(context.Background(), provider, specPath, Options{})
+}
+
+// CallContext is like Call, but runs the provider according to opts and
+// kills it (and any processes it started) if ctx is done before it exits.
+func CallContext(ctx context.Context, provider, specPath string, opts Options) (string, error) {
+	var stdOut bytes.Buffer
+	if err := callStream(ctx, provider, specPath, opts, metadataEnv(opts.Env), &stdOut); err != nil {
+		return "", err
+	}
+
+	if !utf8.Valid(stdOut.Bytes()) {
+		return stdOut.String(), nil
+	}
+	return strings.TrimSpace(stdOut.String()), nil
+}
+
+// CallStream is like CallContext, but writes the provider's output to w as it
+// comes, as is, instead of holding it in memory. Large secrets can go straight
+// to a file this way.
+func CallStream(ctx context.Context, provider, specPath string, opts Options, w io.Writer) error {
+	// Streamed output is written as is, so it can't be an envelope
+	return callStream(ctx, provider, specPath, opts, opts.Env, w)
+}
+
+func callStream(ctx context.Context, provider, specPath string, opts Options, env []string, w io.Writer) error {
+	var stdErr bytes.Buffer
+
+	// Stop a provider that writes more than it may
+	callCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	stdOut := &limitedWriter{w: w, limit: opts.MaxOutputSize, exceeded: cancel}
+
+	args := append([]string{}, opts.Args...)
+	var stdIn io.Reader
+	switch opts.PathVia {
+	case PathViaStdin:
+		// A single line, like in interactive mode
+		stdIn = strings.NewReader(specPath + "\n")
+	case PathViaEnv:
+		if env == nil {
+			env = os.Environ()
+		}
+		env = append(append([]string{}, env...), PathEnvVar+"="+specPath)
+	default:
+		args = append(args, specPath)
+	}
+	cmd := exec.CommandContext(callCtx, provider, args...)
+	cmd.Env = env
+	cmd.Stdin = stdIn
+	cmd.Stdout = stdOut
 	cmd.Stderr = &stdErr
-	err := cmd.Run()
+	// Don't wait forever on orphaned grandchildren holding our pipes open
+	cmd.WaitDelay = time.Second
+	killProcessGroupOnCancel(cmd)
 
+	releaseSandbox, err := applySandbox(cmd, opts.Sandbox)
 	if err != nil {
-		errstr := err.Error()
-		if stdErr.Len() > 0 {
-			errstr += ": " + strings.TrimSpace(stdErr.String())
+		return &CallError{Provider: provider, Path: specPath, ExitCode: -1, Err: err}
+	}
+	defer releaseSandbox()
+
+	err = cmd.Run()
+
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return &CallError{
+			Provider: provider,
+			Path:     specPath,
+			ExitCode: -1,
+			TimedOut: true,
+			Stderr:   strings.TrimSpace(stdErr.String()),
+			Err:      fmt.Errorf("provider %s timed out resolving path %s", provider, specPath),
 		}
-		return "", fmt.Errorf(errstr)
 	}
 
-	return strings.TrimSpace(stdOut.String()), nil
+	if stdOut.written > opts.MaxOutputSize && opts.MaxOutputSize > 0 {
+		return &CallError{
+			Provider: provider,
+			Path:     specPath,
+			ExitCode: -1,
+			Err: fmt.Errorf("provider %s returned more than the maximum secret size of %d bytes for path %s",
+				provider, opts.MaxOutputSize, specPath),
+		}
+	}
+
+	if err != nil {
+		exitCode := -1
+		if exitErr, ok := err.(*exec.ExitError); ok {
+			exitCode = exitErr.ExitCode()
+		}
+		return &CallError{
+			Provider: provider,
+			Path:     specPath,
+			ExitCode: exitCode,
+			Stderr:   strings.TrimSpace(stdErr.String()),
+			Err:      err,
+		}
+	}
+
+	return nil
+}
+
+// limitedWriter passes at most limit bytes on to w, if limit is positive, and
+// calls exceeded once more is written
+type limitedWriter struct {
+	w        io.Writer
+	limit    int64
+	written  int64
+	exceeded func()
+}
+
+func (l *limitedWriter) Write(p []byte) (int, error) {
+	l.written += int64(len(p))
+	if l.limit > 0 && l.written > l.limit {
+		l.exceeded()
+		return 0, errOutputTooLarge
+	}
+	return l.w.Write(p)
 }
 
+// errOutputTooLarge stops copying the output of a provider that exceeded
+// Options.MaxOutputSize
+var errOutputTooLarge = errors.New("provider output is too large")
+
 // Result represents secret key and its value taken from the provider
 type Result struct {
 	Key   string
@@ -86,17 +250,50 @@ type Result struct {
 	Error error
 }
 
+// maxInteractiveLineSize is the longest line a provider may write in
+// interactive mode without a maximum secret size: the base64 of a 48MiB value
+const maxInteractiveLineSize = 64 << 20
+
+// interactiveLineSize returns the longest line a provider may write in
+// interactive mode, for values of at most maxOutputSize bytes
+func interactiveLineSize(maxOutputSize int64) int {
+	if maxOutputSize <= 0 || maxOutputSize > maxInteractiveLineSize {
+		return maxInteractiveLineSize
+	}
+	// A line feed, and maybe a carriage return, follow the base64
+	return base64.StdEncoding.EncodedLen(int(maxOutputSize)) + 2
+}
+
+// DefaultInteractiveTimeout is how long a provider in interactive mode may run
+// unless Options.Timeout says otherwise
+const DefaultInteractiveTimeout = 10 * time.Second
+
 // ErrInteractiveModeNotSupported is returned when a provider does not support interactive mode
 var ErrInteractiveModeNotSupported = errors.New("interactive mode not supported")
 
 // CallInteractiveMode calls a provider without passing any arguments. It then constantly fetches
 // secrets from its stdout. It returns a channel of results, a channel of errors and a cleanup function.
 func CallInteractiveMode(provider string, secrets secretsyml.SecretsMap) (chan Result, chan error, func()) {
+	return CallInteractiveModeWithOptions(provider, secrets, Options{})
+}
+
+// CallInteractiveModeWithOptions is like CallInteractiveMode, but runs the
+// provider according to opts.
+func CallInteractiveModeWithOptions(provider string, secrets secretsyml.SecretsMap, opts Options) (chan Result, chan error, func()) {
 	resultsCh := make(chan Result)
 	errorsCh := make(chan error, 1)
-	ctxTimeout, ctxCancel := context.WithTimeout(context.Background(), 10*time.Second)
+	ctxTimeout, ctxCancel := interactiveContext(opts.Timeout)
 
-	cmd := exec.CommandContext(ctxTimeout, provider)
+	cmd := exec.CommandContext(ctxTimeout, provider, opts.Args...)
+	cmd.Env = metadataEnv(opts.Env)
+
+	releaseSandbox, err := applySandbox(cmd, opts.Sandbox)
+	if err != nil {
+		errorsCh <- err
+		return resultsCh, errorsCh, func() { ctxCancel() }
+	}
+	// The sandbox is only needed to start the provider
+	defer releaseSandbox()
 
 	// Get a pipe to the command's stdinPipe
 	stdinPipe, err := cmd.StdinPipe()
@@ -156,6 +353,9 @@ func CallInteractiveMode(provider string, secrets secretsyml.SecretsMap) (chan R
 	go func() {
 		defer close(resultsCh)
 		scanner := bufio.NewScanner(stdoutPipe)
+		// Every value is a line of base64, which may be much longer than the
+		// default limit for binary secrets
+		scanner.Buffer(nil, interactiveLineSize(opts.MaxOutputSize))
 		index := 0
 
 		for scanner.Scan() {
@@ -194,6 +394,18 @@ func CallInteractiveMode(provider string, secrets secretsyml.SecretsMap) (chan R
 	return resultsCh, errorsCh, cleanup
 }
 
+// interactiveContext returns the context a provider in interactive mode runs
+// in, given Options.Timeout
+func interactiveContext(timeout time.Duration) (context.Context, context.CancelFunc) {
+	switch {
+	case timeout < 0:
+		return context.WithCancel(context.Background())
+	case timeout == 0:
+		timeout = DefaultInteractiveTimeout
+	}
+	return context.WithTimeout(context.Background(), timeout)
+}
+
 // Given a provider name, it returns a path to executable prefixed with DefaultPath. If
 // the provider has any other pattern (eg. `./provider-name`, `/foo/provider-name`), the
 // parameter is assumed to be a path to the provider and not just a name.
@@ -204,19 +416,74 @@ func expandPath(provider string) (string, error) {
 		return filepath.Abs(provider)
 	}
 
-	defaultPath, err := GetDefaultPath()
+	searchPaths, err := GetSearchPaths()
 	if err != nil {
 		return "", err
 	}
 
-	return filepath.Join(defaultPath, provider), nil
+	// The first directory that has the provider wins
+	for _, dir := range searchPaths {
+		path := filepath.Join(dir, provider)
+		if _, err := os.Stat(path); err == nil {
+			return path, nil
+		}
+	}
+
+	return filepath.Join(searchPaths[0], provider), nil
 }
 
+// GetSearchPaths returns the directories searched for providers, in order:
+// the entries of SUMMON_PROVIDER_PATH (separated like PATH) if it is set,
+// otherwise the default path followed by ~/.summon/providers if it exists.
+// The user's directory comes last, so that it can't shadow the providers of
+// the system.
+func GetSearchPaths() ([]string, error) {
+	if pathOverride := os.Getenv("SUMMON_PROVIDER_PATH"); pathOverride != "" {
+		var dirs []string
+		for _, dir := range filepath.SplitList(pathOverride) {
+			if dir != "" {
+				dirs = append(dirs, dir)
+			}
+		}
+		if len(dirs) > 0 {
+			return dirs, nil
+		}
+	}
+
+	var dirs []string
+	defaultPath, err := GetDefaultPath()
+	if err == nil {
+		dirs = append(dirs, defaultPath)
+	}
+	if userDir, userErr := userProviderDir(); userErr == nil {
+		if _, statErr := os.Stat(userDir); statErr == nil {
+			dirs = append(dirs, userDir)
+		}
+	}
+	if len(dirs) == 0 {
+		return nil, err
+	}
+	return dirs, nil
+}
+
+// userProviderDir is where a user can install providers without root
+func userProviderDir() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, ".summon", "providers"), nil
+}
+
+// GetDefaultPath returns the system-wide provider directory, or the first
+// directory in SUMMON_PROVIDER_PATH if it is set
 func GetDefaultPath() (string, error) {
 	pathOverride := os.Getenv("SUMMON_PROVIDER_PATH")
 
-	if pathOverride != "" {
-		return pathOverride, nil
+	for _, dir := range filepath.SplitList(pathOverride) {
+		if dir != "" {
+			return dir, nil
+		}
 	}
 
 	dir := "/usr/local/lib/summon"
@@ -272,6 +539,7 @@ func GetDefaultPath() (string, error) {
 		"environment variable SUMMON_PROVIDER_PATH to the directory " +
 		"containing providers.\n" +
 		"Provider paths searched: \n" +
+		"	~/.summon/providers\n" +
 		"	/usr/local/lib/summon\n" +
 		"	${summon bin dir}/Providers,\n" +
 		"	${summon bin dir}/../lib/summon\n" +
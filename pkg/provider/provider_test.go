@@ -1,8 +1,15 @@
 package provider
 
 import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
+	"net/http"
+	"net/http/httptest"
 	"os"
+	"os/exec"
 	"path/filepath"
 	"strings"
 	"testing"
@@ -377,6 +384,44 @@ func TestCallInteractiveMode(t *testing.T) {
 	})
 }
 
+func TestCallInteractiveModeTimeout(t *testing.T) {
+	provider := filepath.Join(t.TempDir(), "provider")
+	assert.NoError(t, os.WriteFile(provider, []byte("#!/bin/sh\nexec sleep 30\n"), 0755))
+	secrets := secretsyml.SecretsMap{"key1": secretsyml.SecretSpec{Path: "provider.go"}}
+
+	// Well within the default timeout
+	resultsCh, errorsCh, cleanup := CallInteractiveModeWithOptions(provider, secrets, Options{Timeout: 100 * time.Millisecond})
+	defer cleanup()
+
+	select {
+	case err := <-errorsCh:
+		assert.Error(t, err)
+	case _, ok := <-resultsCh:
+		assert.False(t, ok, "the provider returned a value")
+	case <-time.After(DefaultInteractiveTimeout / 2):
+		assert.Fail(t, "the provider wasn't stopped after its timeout")
+	}
+}
+
+func TestCallInteractiveModeWithLargeBinaryValue(t *testing.T) {
+	provider := filepath.Join(t.TempDir(), "provider")
+	script := "#!/bin/bash\nwhile read -r line; do head -c 100000 /dev/zero | base64 -w0; echo; done\n"
+	assert.NoError(t, os.WriteFile(provider, []byte(script), 0755))
+
+	secrets := secretsyml.SecretsMap{"key1": secretsyml.SecretSpec{Path: "keytab"}}
+	resultsCh, errorsCh, cleanup := CallInteractiveMode(provider, secrets)
+	defer cleanup()
+
+	select {
+	case result := <-resultsCh:
+		assert.Equal(t, strings.Repeat("\x00", 100000), result.Value)
+	case err := <-errorsCh:
+		assert.Fail(t, "Unexpected error: %v", err)
+	case <-time.After(5 * time.Second):
+		assert.Fail(t, "Timeout waiting for result")
+	}
+}
+
 // Mocks the behaviour of a summon provider. The provider reads a list of secrets from stdin
 // and outputs the base64 encoded values to the stdout
 func createMockProvider() (string, error) {
@@ -405,3 +450,380 @@ func createMockProvider() (string, error) {
 
 	return tmpfile.Name(), nil
 }
+
+func TestCallErrorTransient(t *testing.T) {
+	t.Run("provider that could not run is not transient", func(t *testing.T) {
+		err := &CallError{ExitCode: -1, Err: fmt.Errorf("exec: not found")}
+		assert.False(t, err.Transient())
+	})
+
+	t.Run("EX_TEMPFAIL exit status is transient", func(t *testing.T) {
+		err := &CallError{ExitCode: 75, Err: fmt.Errorf("exit status 75")}
+		assert.True(t, err.Transient())
+	})
+
+	t.Run("stderr hinting at a network problem is transient", func(t *testing.T) {
+		err := &CallError{ExitCode: 1, Stderr: "Get https://conjur: dial tcp: i/o Timeout", Err: fmt.Errorf("exit status 1")}
+		assert.True(t, err.Transient())
+	})
+
+	t.Run("stderr giving a retryable HTTP status is transient", func(t *testing.T) {
+		for _, stderr := range []string{"503 Service Unavailable", "502 Bad Gateway", "HTTP 429", "unexpected status code: 504"} {
+			err := &CallError{ExitCode: 1, Stderr: stderr, Err: fmt.Errorf("exit status 1")}
+			assert.True(t, err.Transient(), stderr)
+		}
+	})
+
+	t.Run("other failures are not transient", func(t *testing.T) {
+		for _, stderr := range []string{"404 Not Found", "variable prod/503/password not found", "host db:5029 refused the credentials"} {
+			err := &CallError{ExitCode: 1, Stderr: stderr, Err: fmt.Errorf("exit status 1")}
+			assert.False(t, err.Transient(), stderr)
+		}
+	})
+}
+
+func TestProviderCallReturnsCallError(t *testing.T) {
+	_, err := Call("ls", "README.notafile")
+
+	callErr, ok := err.(*CallError)
+	assert.True(t, ok)
+	if !ok {
+		return
+	}
+	assert.Equal(t, "ls", callErr.Provider)
+	assert.Equal(t, "README.notafile", callErr.Path)
+	assert.NotZero(t, callErr.ExitCode)
+	assert.Contains(t, err.Error(), callErr.Stderr)
+}
+
+func TestProviderCallContextTimeout(t *testing.T) {
+	dir := t.TempDir()
+	provider := filepath.Join(dir, "slowprovider")
+	// The forked sleep keeps stdout open; it must be killed along with the provider
+	script := "#!/bin/bash\nsleep 30 &\nsleep 30\n"
+	assert.NoError(t, os.WriteFile(provider, []byte(script), 0755))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	out, err := CallContext(ctx, provider, "path/to/secret", Options{})
+
+	assert.Empty(t, out)
+	assert.Less(t, time.Since(start), 5*time.Second)
+	assert.EqualError(t, err, fmt.Sprintf("provider %s timed out resolving path path/to/secret", provider))
+
+	callErr, ok := err.(*CallError)
+	assert.True(t, ok)
+	if ok {
+		assert.True(t, callErr.TimedOut)
+		assert.True(t, callErr.Transient())
+	}
+}
+
+func TestVerify(t *testing.T) {
+	provider := filepath.Join(t.TempDir(), "provider")
+	assert.NoError(t, os.WriteFile(provider, []byte("#!/bin/sh\necho hello\n"), 0755))
+	checksum := strings.Repeat("0", 64)
+
+	t.Run("fails if the checksum doesn't match", func(t *testing.T) {
+		err := Verify(provider, checksum)
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "failed integrity check")
+	})
+
+	t.Run("succeeds if the checksum matches, regardless of case", func(t *testing.T) {
+		out, err := exec.Command("sha256sum", provider).Output()
+		assert.NoError(t, err)
+		actual := strings.Fields(string(out))[0]
+
+		assert.NoError(t, Verify(provider, strings.ToUpper(actual)))
+	})
+
+	t.Run("fails if the provider doesn't exist", func(t *testing.T) {
+		assert.Error(t, Verify(provider+"-missing", checksum))
+	})
+}
+
+func TestFilterEnv(t *testing.T) {
+	environ := []string{
+		"PATH=/usr/bin",
+		"HOME=/home/user",
+		"CONJUR_APPLIANCE_URL=https://conjur",
+		"AWS_REGION=us-east-1",
+		"GITHUB_TOKEN=ghp_secret",
+	}
+
+	t.Run("keeps matching and basic variables", func(t *testing.T) {
+		filtered := FilterEnv(environ, []string{"CONJUR_*"})
+		assert.Equal(t, []string{
+			"PATH=/usr/bin",
+			"HOME=/home/user",
+			"CONJUR_APPLIANCE_URL=https://conjur",
+		}, filtered)
+	})
+
+	t.Run("keeps everything without patterns", func(t *testing.T) {
+		assert.Equal(t, environ, FilterEnv(environ, nil))
+	})
+}
+
+func TestProviderCallWithEnv(t *testing.T) {
+	out, err := CallContext(context.Background(), "printenv", "ONLY_VAR", Options{
+		Env: []string{"ONLY_VAR=only-value"},
+	})
+
+	assert.NoError(t, err)
+	assert.Equal(t, "only-value", out)
+}
+
+func TestProviderCallWithBinaryOutput(t *testing.T) {
+	t.Run("Binary output is returned byte for byte", func(t *testing.T) {
+		out, err := Call("printf", `\n\000\001\377 \n`)
+
+		assert.NoError(t, err)
+		assert.Equal(t, "\n\x00\x01\xff \n", out)
+	})
+
+	t.Run("Text output is trimmed", func(t *testing.T) {
+		out, err := Call("printf", `  text \n`)
+
+		assert.NoError(t, err)
+		assert.Equal(t, "text", out)
+	})
+}
+
+func TestProviderCallWithMaxOutputSize(t *testing.T) {
+	t.Run("Output up to the limit is returned", func(t *testing.T) {
+		out, err := CallContext(context.Background(), "printf", "12345", Options{MaxOutputSize: 5})
+
+		assert.NoError(t, err)
+		assert.Equal(t, "12345", out)
+	})
+
+	t.Run("Larger output fails the call", func(t *testing.T) {
+		_, err := CallContext(context.Background(), "printf", "123456", Options{MaxOutputSize: 5})
+
+		assert.EqualError(t, err, "provider printf returned more than the maximum secret size of 5 bytes for path 123456")
+		var callErr *CallError
+		assert.ErrorAs(t, err, &callErr)
+	})
+}
+
+func TestProviderCallStream(t *testing.T) {
+	var out bytes.Buffer
+	err := CallStream(context.Background(), "printf", `  text \n`, Options{}, &out)
+
+	assert.NoError(t, err)
+	// Streamed output is written as is
+	assert.Equal(t, "  text \n", out.String())
+}
+
+func TestProviderCallWithArgs(t *testing.T) {
+	out, err := CallContext(context.Background(), "echo", "path/to/secret", Options{
+		Args: []string{"--account", "prod"},
+	})
+
+	assert.NoError(t, err)
+	assert.Equal(t, "--account prod path/to/secret", out)
+}
+
+func TestGetSearchPaths(t *testing.T) {
+	first, second := t.TempDir(), t.TempDir()
+	t.Setenv("SUMMON_PROVIDER_PATH", first+string(os.PathListSeparator)+second)
+
+	searchPaths, err := GetSearchPaths()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{first, second}, searchPaths)
+
+	defaultPath, err := GetDefaultPath()
+	assert.NoError(t, err)
+	assert.Equal(t, first, defaultPath)
+}
+
+func TestProviderResolutionViaMultipleSearchPaths(t *testing.T) {
+	first, second := t.TempDir(), t.TempDir()
+	t.Setenv("SUMMON_PROVIDER_PATH", first+string(os.PathListSeparator)+second)
+
+	onlyInSecond := filepath.Join(second, "provider-b")
+	assert.NoError(t, os.WriteFile(onlyInSecond, nil, 0755))
+
+	t.Run("finds the only provider in any directory", func(t *testing.T) {
+		provider, err := Resolve("")
+		assert.NoError(t, err)
+		assert.Equal(t, onlyInSecond, provider)
+	})
+
+	t.Run("finds a provider by name in a later directory", func(t *testing.T) {
+		provider, err := Resolve("provider-b")
+		assert.NoError(t, err)
+		assert.Equal(t, onlyInSecond, provider)
+	})
+
+	inBoth := filepath.Join(first, "provider-b")
+	assert.NoError(t, os.WriteFile(inBoth, nil, 0755))
+
+	t.Run("prefers earlier directories", func(t *testing.T) {
+		provider, err := Resolve("provider-b")
+		assert.NoError(t, err)
+		assert.Equal(t, inBoth, provider)
+
+		provider, err = Resolve("")
+		assert.NoError(t, err)
+		assert.Equal(t, inBoth, provider)
+	})
+
+	assert.NoError(t, os.WriteFile(filepath.Join(second, "provider-c"), nil, 0755))
+
+	t.Run("guesses from the first directory with providers only", func(t *testing.T) {
+		provider, err := Resolve("")
+		assert.NoError(t, err)
+		assert.Equal(t, inBoth, provider)
+	})
+
+	assert.NoError(t, os.WriteFile(filepath.Join(first, "provider-c"), nil, 0755))
+
+	t.Run("refuses to guess between providers in the same directory", func(t *testing.T) {
+		_, err := Resolve("")
+		assert.EqualError(t, err, "More than one provider found in "+first+", please specify one\n")
+	})
+}
+
+func TestUserProviderDirComesLast(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("USERPROFILE", home)
+	t.Setenv("SUMMON_PROVIDER_PATH", "")
+	userDir := filepath.Join(home, ".summon", "providers")
+	assert.NoError(t, os.MkdirAll(userDir, 0755))
+
+	searchPaths, err := GetSearchPaths()
+	assert.NoError(t, err)
+	// There may be no system-wide directory on the host running the tests
+	if defaultPath, err := GetDefaultPath(); err == nil {
+		assert.Equal(t, []string{defaultPath, userDir}, searchPaths)
+	} else {
+		assert.Equal(t, []string{userDir}, searchPaths)
+	}
+}
+
+func TestDescribe(t *testing.T) {
+	provider := filepath.Join(t.TempDir(), "provider")
+	script := `#!/bin/sh
+case "$1" in
+  --version) echo 1.0.0 ;;
+  --capabilities) echo "batch health exists not-a-capability" ;;
+  --health) echo "backend unreachable" >&2; exit 1 ;;
+  *) echo "value" ;;
+esac
+`
+	assert.NoError(t, os.WriteFile(provider, []byte(script), 0755))
+
+	info := Describe(provider)
+	assert.Equal(t, "provider", info.Name)
+	assert.Equal(t, provider, info.Path)
+	assert.Equal(t, "1.0.0", info.Version)
+	assert.Equal(t, []string{CapabilityBatch, CapabilityHealth, CapabilityExists}, info.Capabilities)
+	assert.Equal(t, HealthFailing, info.Health)
+	assert.Contains(t, info.HealthError, "backend unreachable")
+
+	t.Run("providers without health checks have unknown health", func(t *testing.T) {
+		info := Describe("/bin/false")
+		assert.Empty(t, info.Version)
+		assert.Empty(t, info.Capabilities)
+		assert.Equal(t, HealthUnknown, info.Health)
+	})
+}
+
+func TestInstall(t *testing.T) {
+	content := []byte("#!/bin/sh\necho installed\n")
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/slow" {
+			select {
+			case <-r.Context().Done():
+			case <-time.After(5 * time.Second):
+			}
+			return
+		}
+		w.Write(content)
+	}))
+	defer server.Close()
+
+	sum := sha256.Sum256(content)
+	checksum := hex.EncodeToString(sum[:])
+
+	t.Run("installs a provider with a matching checksum", func(t *testing.T) {
+		dest := filepath.Join(t.TempDir(), "providers", "provider")
+		assert.NoError(t, Install(server.URL+"/provider", dest, checksum))
+
+		out, err := Call(dest, "path")
+		assert.NoError(t, err)
+		assert.Equal(t, "installed", out)
+	})
+
+	t.Run("refuses a provider with a different checksum", func(t *testing.T) {
+		dest := filepath.Join(t.TempDir(), "provider")
+		err := Install(server.URL+"/provider", dest, strings.Repeat("0", 64))
+		assert.ErrorContains(t, err, "failed integrity check")
+
+		_, err = os.Stat(dest)
+		assert.True(t, os.IsNotExist(err))
+	})
+
+	t.Run("keeps the provider it would replace if it fails", func(t *testing.T) {
+		dir := t.TempDir()
+		dest := filepath.Join(dir, "provider")
+		assert.NoError(t, os.WriteFile(dest, []byte("old"), 0o755))
+
+		err := Install(server.URL+"/provider", dest, strings.Repeat("0", 64))
+		assert.ErrorContains(t, err, "failed integrity check")
+
+		defer func(timeout time.Duration) { InstallTimeout = timeout }(InstallTimeout)
+		InstallTimeout = 100 * time.Millisecond
+		err = Install(server.URL+"/slow", dest, checksum)
+		assert.ErrorContains(t, err, "context deadline exceeded")
+
+		installed, err := os.ReadFile(dest)
+		assert.NoError(t, err)
+		assert.Equal(t, "old", string(installed))
+		files, err := os.ReadDir(dir)
+		assert.NoError(t, err)
+		assert.Len(t, files, 1)
+	})
+}
+
+func TestProviderCallWithPathVia(t *testing.T) {
+	t.Run("The path is passed on stdin", func(t *testing.T) {
+		out, err := CallContext(context.Background(), "sh", "path/to/secret", Options{
+			Args:    []string{"-c", `read path; echo "$# $path"`},
+			PathVia: PathViaStdin,
+		})
+
+		assert.NoError(t, err)
+		assert.Equal(t, "0 path/to/secret", out)
+	})
+
+	t.Run("The path is passed in the environment", func(t *testing.T) {
+		out, err := CallContext(context.Background(), "sh", "path/to/secret", Options{
+			Args:    []string{"-c", `echo "$# $` + PathEnvVar + `"`},
+			Env:     []string{"PATH=" + os.Getenv("PATH")},
+			PathVia: PathViaEnv,
+		})
+
+		assert.NoError(t, err)
+		assert.Equal(t, "0 path/to/secret", out)
+	})
+
+	t.Run("The path is passed as an argument by default", func(t *testing.T) {
+		out, err := CallContext(context.Background(), "echo", "path/to/secret", Options{PathVia: PathViaArgv})
+
+		assert.NoError(t, err)
+		assert.Equal(t, "path/to/secret", out)
+	})
+}
+
+func TestNegotiatePathVia(t *testing.T) {
+	assert.Equal(t, PathViaStdin, NegotiatePathVia([]string{CapabilityPathEnv, CapabilityPathStdin}))
+	assert.Equal(t, PathViaEnv, NegotiatePathVia([]string{CapabilityBatch, CapabilityPathEnv}))
+	assert.Equal(t, PathViaArgv, NegotiatePathVia([]string{}))
+}
@@ -0,0 +1,125 @@
+package provider
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Requirement is a constraint on the version of a provider, e.g.
+// "summon-conjur >= 0.7.0"
+type Requirement struct {
+	// Provider is the name of the provider executable, without extension
+	Provider string
+	// Op is one of >=, >, <=, < and =
+	Op      string
+	Version string
+}
+
+var requirementRegex = regexp.MustCompile(`^\s*([^\s<>=]+)\s*(>=|<=|==|=|>|<)\s*v?(\d+(?:\.\d+)*)\s*$`)
+
+// versionRegex matches the first version number in the output of --version,
+// e.g. 0.7.1 in "summon-conjur v0.7.1-4a1c"
+var versionRegex = regexp.MustCompile(`\d+(?:\.\d+)*`)
+
+// ParseRequirement parses a constraint written as "<provider> <op> <version>"
+func ParseRequirement(s string) (Requirement, error) {
+	match := requirementRegex.FindStringSubmatch(s)
+	if match == nil {
+		return Requirement{}, fmt.Errorf("invalid provider requirement %q, expected e.g. \"summon-conjur >= 0.7.0\"", s)
+	}
+	op := match[2]
+	if op == "==" {
+		op = "="
+	}
+	return Requirement{Provider: match[1], Op: op, Version: match[3]}, nil
+}
+
+func (r Requirement) String() string {
+	return r.Provider + " " + r.Op + " " + r.Version
+}
+
+// AppliesTo tells whether the requirement is on the provider at path
+func (r Requirement) AppliesTo(path string) bool {
+	name := filepath.Base(path)
+	return r.Provider == path || r.Provider == name ||
+		r.Provider == strings.TrimSuffix(name, filepath.Ext(name))
+}
+
+// SatisfiedBy tells whether version, as the provider reports it, meets the
+// requirement
+func (r Requirement) SatisfiedBy(version string) (bool, error) {
+	found := versionRegex.FindString(version)
+	if found == "" {
+		return false, fmt.Errorf("no version number in %q", version)
+	}
+
+	c := compareVersions(found, r.Version)
+	switch r.Op {
+	case ">=":
+		return c >= 0, nil
+	case ">":
+		return c > 0, nil
+	case "<=":
+		return c <= 0, nil
+	case "<":
+		return c < 0, nil
+	default:
+		return c == 0, nil
+	}
+}
+
+// CheckRequirements checks the version of the provider at path against the
+// requirements that apply to it, asking it for its version only if there are
+// any. requiredBy names where the requirements come from, for the error.
+func CheckRequirements(path string, requirements []Requirement, requiredBy string) error {
+	var version string
+	for _, requirement := range requirements {
+		if !requirement.AppliesTo(path) {
+			continue
+		}
+
+		if version == "" {
+			var err error
+			if version, err = Version(path); err != nil {
+				return fmt.Errorf("%s requires %s, but provider %s doesn't report its version (--version): %s",
+					requiredBy, requirement, path, err)
+			}
+		}
+
+		ok, err := requirement.SatisfiedBy(version)
+		if err != nil {
+			return fmt.Errorf("%s requires %s, but the version of provider %s is unknown: %s",
+				requiredBy, requirement, path, err)
+		}
+		if !ok {
+			return fmt.Errorf("%s requires %s, but provider %s is version %s: install a matching version, "+
+				"e.g. with summon providers install", requiredBy, requirement, path, version)
+		}
+	}
+	return nil
+}
+
+// compareVersions compares dotted version numbers, missing numbers counting
+// as 0, and returns -1, 0 or 1
+func compareVersions(a, b string) int {
+	as, bs := strings.Split(a, "."), strings.Split(b, ".")
+	for i := 0; i < len(as) || i < len(bs); i++ {
+		var x, y int
+		if i < len(as) {
+			x, _ = strconv.Atoi(as[i])
+		}
+		if i < len(bs) {
+			y, _ = strconv.Atoi(bs[i])
+		}
+		switch {
+		case x < y:
+			return -1
+		case x > y:
+			return 1
+		}
+	}
+	return 0
+}
@@ -0,0 +1,91 @@
+package provider
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseRequirement(t *testing.T) {
+	t.Run("parses constraints", func(t *testing.T) {
+		for s, expected := range map[string]Requirement{
+			"summon-conjur >= 0.7.0": {Provider: "summon-conjur", Op: ">=", Version: "0.7.0"},
+			"summon-aws<v2":          {Provider: "summon-aws", Op: "<", Version: "2"},
+			" keyring == 1.2 ":       {Provider: "keyring", Op: "=", Version: "1.2"},
+		} {
+			requirement, err := ParseRequirement(s)
+			assert.NoError(t, err, s)
+			assert.Equal(t, expected, requirement, s)
+		}
+	})
+
+	t.Run("fails on anything else", func(t *testing.T) {
+		for _, s := range []string{"", "summon-conjur", "summon-conjur >= latest", ">= 0.7.0", "summon-conjur ~> 0.7"} {
+			_, err := ParseRequirement(s)
+			assert.EqualError(t, err, `invalid provider requirement "`+s+`", expected e.g. "summon-conjur >= 0.7.0"`)
+		}
+	})
+}
+
+func TestRequirementSatisfiedBy(t *testing.T) {
+	for _, tc := range []struct {
+		requirement string
+		version     string
+		satisfied   bool
+	}{
+		{"p >= 0.7.0", "0.7.0", true},
+		{"p >= 0.7.0", "summon-conjur v0.7.1-4a1c", true},
+		{"p >= 0.7.0", "0.6.12", false},
+		{"p >= 0.7", "0.7.0", true},
+		{"p > 0.7", "0.7.0", false},
+		{"p < 1", "0.10.0", true},
+		{"p <= 0.7.0", "0.7", true},
+		{"p = 1.2", "1.2.0", true},
+		{"p = 1.2", "1.2.1", false},
+	} {
+		requirement, err := ParseRequirement(tc.requirement)
+		assert.NoError(t, err)
+		satisfied, err := requirement.SatisfiedBy(tc.version)
+		assert.NoError(t, err)
+		assert.Equal(t, tc.satisfied, satisfied, "%s with %s", tc.requirement, tc.version)
+	}
+
+	_, err := Requirement{Provider: "p", Op: ">=", Version: "1"}.SatisfiedBy("unknown")
+	assert.EqualError(t, err, `no version number in "unknown"`)
+}
+
+func TestCheckRequirements(t *testing.T) {
+	dir := t.TempDir()
+	provider := filepath.Join(dir, "summon-conjur")
+	assert.NoError(t, os.WriteFile(provider, []byte("#!/bin/sh\necho summon-conjur v0.6.2\n"), 0755))
+	mustParse := func(s string) Requirement {
+		requirement, err := ParseRequirement(s)
+		assert.NoError(t, err)
+		return requirement
+	}
+
+	t.Run("succeeds if the version matches", func(t *testing.T) {
+		assert.NoError(t, CheckRequirements(provider, []Requirement{mustParse("summon-conjur >= 0.6")}, "secrets.yml"))
+	})
+
+	t.Run("ignores requirements on other providers", func(t *testing.T) {
+		assert.NoError(t, CheckRequirements(provider, []Requirement{mustParse("summon-aws >= 1.0")}, "secrets.yml"))
+	})
+
+	t.Run("fails if the version doesn't match", func(t *testing.T) {
+		err := CheckRequirements(provider, []Requirement{mustParse("summon-conjur >= 0.7.0")}, "secrets.yml")
+		assert.EqualError(t, err, "secrets.yml requires summon-conjur >= 0.7.0, but provider "+provider+
+			" is version summon-conjur v0.6.2: install a matching version, e.g. with summon providers install")
+	})
+
+	t.Run("fails if the provider doesn't report its version", func(t *testing.T) {
+		broken := filepath.Join(dir, "summon-broken")
+		assert.NoError(t, os.WriteFile(broken, []byte("#!/bin/sh\necho unknown flag >&2\nexit 1\n"), 0755))
+
+		err := CheckRequirements(broken, []Requirement{mustParse("summon-broken >= 1")}, "secrets.yml")
+		assert.Contains(t, err.Error(), "secrets.yml requires summon-broken >= 1, but provider "+broken+
+			" doesn't report its version (--version): ")
+	})
+}
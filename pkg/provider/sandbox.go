@@ -0,0 +1,36 @@
+package provider
+
+import (
+	"os"
+)
+
+// sandboxHelperName is the argv[0] summon is re-executed with to start a
+// provider inside the sandbox
+const sandboxHelperName = "summon-provider-sandbox"
+
+// Sandbox restricts what a provider process can do to the host, so that a
+// compromised or buggy provider can do little beyond answering lookups.
+//
+// On Linux the provider runs in its own user and mount namespace with a
+// private /tmp, cannot gain privileges (no_new_privs) and, optionally, is
+// confined by a seccomp filter. On Windows it runs with a restricted token
+// that has all privileges removed.
+type Sandbox struct {
+	Enabled bool
+	// SeccompProfile is the path to a compiled seccomp BPF program, as written
+	// by libseccomp's seccomp_export_bpf (Linux only)
+	SeccompProfile string
+}
+
+// SandboxMain takes over the process if summon was re-executed to start a
+// sandboxed provider; in that case it never returns. Call it first thing in
+// main.
+func SandboxMain() {
+	if len(os.Args) == 0 || os.Args[0] != sandboxHelperName {
+		return
+	}
+	// Only returns on failure
+	err := runSandboxHelper(os.Args[1:])
+	os.Stderr.WriteString("summon: unable to sandbox provider: " + err.Error() + "\n")
+	os.Exit(126)
+}
@@ -0,0 +1,147 @@
+//go:build linux
+
+package provider
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"syscall"
+	"unsafe"
+)
+
+const (
+	prSetNoNewPrivs   = 38
+	prSetSeccomp      = 22
+	seccompModeFilter = 2
+)
+
+// applySandbox makes cmd start the provider through the sandbox helper
+func applySandbox(cmd *exec.Cmd, sandbox Sandbox) (func(), error) {
+	if !sandbox.Enabled {
+		return func() {}, nil
+	}
+
+	self, err := os.Executable()
+	if err != nil {
+		return nil, err
+	}
+
+	provider := cmd.Path
+	cmd.Path = self
+	cmd.Args = append([]string{sandboxHelperName, sandbox.SeccompProfile, provider}, cmd.Args[1:]...)
+
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	uid, gid := os.Getuid(), os.Getgid()
+	cmd.SysProcAttr.Cloneflags |= syscall.CLONE_NEWUSER | syscall.CLONE_NEWNS
+	cmd.SysProcAttr.UidMappings = []syscall.SysProcIDMap{{ContainerID: uid, HostID: uid, Size: 1}}
+	cmd.SysProcAttr.GidMappings = []syscall.SysProcIDMap{{ContainerID: gid, HostID: gid, Size: 1}}
+	cmd.SysProcAttr.GidMappingsEnableSetgroups = false
+
+	return func() {}, nil
+}
+
+// runSandboxHelper runs in the new namespaces: it locks the process down and
+// then replaces itself with the provider. args are the seccomp profile path
+// (possibly empty), the provider path and the provider arguments.
+func runSandboxHelper(args []string) error {
+	if len(args) < 2 {
+		return errors.New("missing provider")
+	}
+	seccompProfile, provider := args[0], args[1]
+
+	// no_new_privs and seccomp filters apply to the calling thread, which
+	// must therefore be the one calling exec
+	runtime.LockOSThread()
+
+	// Read the seccomp profile and open the provider before they can be hidden
+	// by a private mount. The provider is exec'd through its file descriptor,
+	// which must survive exec for interpreters to read scripts from it.
+	var seccompFilter []sockFilter
+	if seccompProfile != "" {
+		var err error
+		if seccompFilter, err = readSeccompProfile(seccompProfile); err != nil {
+			return err
+		}
+	}
+
+	fd, err := syscall.Open(provider, syscall.O_RDONLY, 0)
+	if err != nil {
+		return fmt.Errorf("opening %s: %s", provider, err)
+	}
+	providerFD := fmt.Sprintf("/proc/self/fd/%d", fd)
+
+	// Keep our mounts from propagating back to the host
+	if err := syscall.Mount("", "/", "", syscall.MS_REC|syscall.MS_PRIVATE, ""); err != nil {
+		return fmt.Errorf("making mounts private: %s", err)
+	}
+	for _, dir := range []string{"/tmp", "/var/tmp"} {
+		if _, err := os.Stat(dir); err != nil {
+			continue
+		}
+		if err := syscall.Mount("tmpfs", dir, "tmpfs", syscall.MS_NOSUID|syscall.MS_NODEV, "mode=1777"); err != nil {
+			return fmt.Errorf("mounting private %s: %s", dir, err)
+		}
+	}
+
+	if _, _, errno := syscall.RawSyscall(syscall.SYS_PRCTL, prSetNoNewPrivs, 1, 0); errno != 0 {
+		return fmt.Errorf("setting no_new_privs: %s", errno)
+	}
+
+	if seccompFilter != nil {
+		if err := loadSeccompFilter(seccompFilter); err != nil {
+			return err
+		}
+	}
+
+	return syscall.Exec(providerFD, append([]string{provider}, args[2:]...), os.Environ())
+}
+
+// sockFilter and sockFprog mirror struct sock_filter and struct sock_fprog
+type sockFilter struct {
+	Code uint16
+	Jt   uint8
+	Jf   uint8
+	K    uint32
+}
+
+type sockFprog struct {
+	Len    uint16
+	Filter *sockFilter
+}
+
+// readSeccompProfile reads the compiled BPF program at path
+func readSeccompProfile(path string) ([]sockFilter, error) {
+	program, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading seccomp profile: %s", err)
+	}
+
+	size := int(unsafe.Sizeof(sockFilter{}))
+	if len(program) == 0 || len(program)%size != 0 {
+		return nil, fmt.Errorf("seccomp profile %s is not a compiled BPF program", path)
+	}
+
+	filter := make([]sockFilter, len(program)/size)
+	for i := range filter {
+		instruction := program[i*size:]
+		// BPF programs are exported in host byte order
+		filter[i] = *(*sockFilter)(unsafe.Pointer(&instruction[0]))
+	}
+	return filter, nil
+}
+
+// loadSeccompFilter installs filter as a seccomp filter on the calling thread
+func loadSeccompFilter(filter []sockFilter) error {
+	fprog := sockFprog{Len: uint16(len(filter)), Filter: &filter[0]}
+
+	_, _, errno := syscall.RawSyscall(syscall.SYS_PRCTL, prSetSeccomp, seccompModeFilter, uintptr(unsafe.Pointer(&fprog)))
+	if errno != 0 {
+		return fmt.Errorf("loading seccomp profile: %s", errno)
+	}
+	return nil
+}
@@ -0,0 +1,85 @@
+//go:build linux
+
+package provider
+
+import (
+	"context"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestMain lets the sandbox tests re-execute the test binary as the sandbox
+// helper
+func TestMain(m *testing.M) {
+	SandboxMain()
+	os.Exit(m.Run())
+}
+
+func sandboxedCall(t *testing.T, script string, sandbox Sandbox) (string, error) {
+	dir := t.TempDir()
+	provider := filepath.Join(dir, "provider")
+	assert.NoError(t, os.WriteFile(provider, []byte(script), 0755))
+
+	out, err := CallContext(context.Background(), provider, "path/to/secret", Options{Sandbox: sandbox})
+	if err != nil && strings.Contains(err.Error(), "operation not permitted") {
+		t.Skip("user namespaces are not available:", err)
+	}
+	return out, err
+}
+
+// writeBPF writes a seccomp program consisting of a single return instruction
+func writeBPF(t *testing.T, ret uint32) string {
+	program := make([]byte, 8)
+	binary.NativeEndian.PutUint16(program[0:], 0x06) // BPF_RET | BPF_K
+	binary.NativeEndian.PutUint32(program[4:], ret)
+
+	path := filepath.Join(t.TempDir(), "profile.bpf")
+	assert.NoError(t, os.WriteFile(path, program, 0600))
+	return path
+}
+
+func TestSandbox(t *testing.T) {
+	t.Run("provider runs without new privileges and with a private /tmp", func(t *testing.T) {
+		marker := filepath.Join(os.TempDir(), "summon-sandbox-test")
+		defer os.Remove(marker)
+
+		script := "#!/bin/sh\ntouch " + marker + "\ngrep NoNewPrivs /proc/self/status | tr -d ' \\t'\n"
+		out, err := sandboxedCall(t, script, Sandbox{Enabled: true})
+
+		assert.NoError(t, err)
+		assert.Equal(t, "NoNewPrivs:1", out)
+		_, err = os.Stat(marker)
+		assert.True(t, os.IsNotExist(err), "provider wrote to the host's /tmp")
+	})
+
+	t.Run("provider runs under an allow-all seccomp profile", func(t *testing.T) {
+		profile := writeBPF(t, 0x7fff0000) // SECCOMP_RET_ALLOW
+		out, err := sandboxedCall(t, "#!/bin/sh\necho $1\n", Sandbox{Enabled: true, SeccompProfile: profile})
+
+		assert.NoError(t, err)
+		assert.Equal(t, "path/to/secret", out)
+	})
+
+	t.Run("seccomp profile is enforced", func(t *testing.T) {
+		// Denying every syscall, including exec, means the provider never runs
+		profile := writeBPF(t, 0x00050000|1) // SECCOMP_RET_ERRNO | EPERM
+		out, err := sandboxedCall(t, "#!/bin/sh\necho $1\n", Sandbox{Enabled: true, SeccompProfile: profile})
+
+		assert.Error(t, err)
+		assert.Empty(t, out)
+	})
+
+	t.Run("invalid seccomp profile is rejected", func(t *testing.T) {
+		profile := filepath.Join(t.TempDir(), "profile.bpf")
+		assert.NoError(t, os.WriteFile(profile, []byte("not bpf"), 0600))
+		_, err := sandboxedCall(t, "#!/bin/sh\necho $1\n", Sandbox{Enabled: true, SeccompProfile: profile})
+
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "is not a compiled BPF program")
+	})
+}
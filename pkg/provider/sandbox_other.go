@@ -0,0 +1,20 @@
+//go:build !linux && !windows
+
+package provider
+
+import (
+	"fmt"
+	"os/exec"
+	"runtime"
+)
+
+func applySandbox(cmd *exec.Cmd, sandbox Sandbox) (func(), error) {
+	if !sandbox.Enabled {
+		return func() {}, nil
+	}
+	return nil, fmt.Errorf("provider sandboxing is not supported on %s", runtime.GOOS)
+}
+
+func runSandboxHelper(args []string) error {
+	return fmt.Errorf("not supported on %s", runtime.GOOS)
+}
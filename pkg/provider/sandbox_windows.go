@@ -0,0 +1,60 @@
+//go:build windows
+
+package provider
+
+import (
+	"errors"
+	"os/exec"
+	"syscall"
+	"unsafe"
+)
+
+const disableMaxPrivilege = 0x1
+
+var (
+	advapi32                  = syscall.NewLazyDLL("advapi32.dll")
+	procCreateRestrictedToken = advapi32.NewProc("CreateRestrictedToken")
+)
+
+// applySandbox makes cmd start the provider with a copy of summon's token
+// that has every privilege removed
+func applySandbox(cmd *exec.Cmd, sandbox Sandbox) (func(), error) {
+	if !sandbox.Enabled {
+		return func() {}, nil
+	}
+	if sandbox.SeccompProfile != "" {
+		return nil, errors.New("seccomp profiles are only supported on Linux")
+	}
+
+	process, err := syscall.GetCurrentProcess()
+	if err != nil {
+		return nil, err
+	}
+	var token syscall.Token
+	access := uint32(syscall.TOKEN_DUPLICATE | syscall.TOKEN_ASSIGN_PRIMARY | syscall.TOKEN_QUERY)
+	if err := syscall.OpenProcessToken(process, access, &token); err != nil {
+		return nil, err
+	}
+	defer token.Close()
+
+	var restricted syscall.Token
+	r, _, err := procCreateRestrictedToken.Call(
+		uintptr(token), disableMaxPrivilege, 0, 0, 0, 0, 0, 0,
+		uintptr(unsafe.Pointer(&restricted)))
+	if r == 0 {
+		return nil, err
+	}
+
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.Token = restricted
+
+	return func() { restricted.Close() }, nil
+}
+
+// runSandboxHelper is never used on Windows, where the restricted token is
+// applied directly to the provider process
+func runSandboxHelper(args []string) error {
+	return errors.New("not supported on Windows")
+}
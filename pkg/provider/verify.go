@@ -0,0 +1,37 @@
+package provider
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// Verify checks that the executable at provider has the expected hex-encoded
+// SHA-256 checksum, so that a provider binary swapped out on the host is
+// never handed secret paths. The check isn't atomic: the provider is run by
+// its path afterwards, so it can still be swapped in between by whoever may
+// write to it. Running the verified file itself (fexecve) isn't an option,
+// as interpreters of script providers are given the path of the descriptor,
+// which is closed once the script starts.
+func Verify(provider, expectedSHA256 string) error {
+	f, err := os.Open(provider)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, f); err != nil {
+		return err
+	}
+
+	actual := hex.EncodeToString(hash.Sum(nil))
+	if !strings.EqualFold(actual, strings.TrimSpace(expectedSHA256)) {
+		return fmt.Errorf("provider %s failed integrity check: expected SHA-256 %s, got %s",
+			provider, expectedSHA256, actual)
+	}
+	return nil
+}
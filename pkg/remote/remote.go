@@ -0,0 +1,262 @@
+// Package remote fetches secrets files kept outside the local file system:
+// over HTTPS, from S3 or from a git repository, optionally pinned to a
+// checksum. Sources use the go-getter syntax, e.g.
+//
+//	https://config.example.com/app/secrets.yml?checksum=sha256:3f1c...
+//	s3://bucket/app/secrets.yml
+//	git::https://github.com/org/config.git//app/secrets.yml?ref=v1.2.0
+package remote
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Timeout bounds fetching a secrets file
+var Timeout = time.Minute
+
+// MaxSize is the largest secrets file that is fetched
+const MaxSize = 1 << 20
+
+// IsRemote tells whether path names a remote secrets file rather than a
+// local one
+func IsRemote(path string) bool {
+	for _, prefix := range []string{"https://", "http://", "s3://", "git::"} {
+		if strings.HasPrefix(path, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// ReadFile returns the content of the secrets file at path, fetching it if
+// it is remote
+func ReadFile(path string) ([]byte, error) {
+	if !IsRemote(path) {
+		return os.ReadFile(path)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), Timeout)
+	defer cancel()
+	return Fetch(ctx, path)
+}
+
+// Fetch returns the content of the remote secrets file source, checking it
+// against the checksum in the source, if any
+func Fetch(ctx context.Context, source string) ([]byte, error) {
+	location, checksum, err := splitChecksum(source)
+	if err != nil {
+		return nil, fmt.Errorf("unable to fetch %s: %s", source, err)
+	}
+
+	var content []byte
+	switch {
+	case strings.HasPrefix(location, "http://") && checksum == nil:
+		err = errors.New("plain HTTP is only allowed with a checksum")
+	case strings.HasPrefix(location, "https://"), strings.HasPrefix(location, "http://"):
+		content, err = fetchHTTP(ctx, location, checksum != nil)
+	case strings.HasPrefix(location, "s3://"):
+		content, err = fetchS3(ctx, location)
+	case strings.HasPrefix(location, "git::"):
+		content, err = fetchGit(ctx, strings.TrimPrefix(location, "git::"))
+	default:
+		err = errors.New("unsupported source")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to fetch %s: %s", location, err)
+	}
+
+	if checksum != nil {
+		if sum := sha256.Sum256(content); !bytes.Equal(sum[:], checksum) {
+			return nil, fmt.Errorf("checksum mismatch for %s: expected sha256:%x, got sha256:%x",
+				location, checksum, sum)
+		}
+	}
+	return content, nil
+}
+
+// splitChecksum removes the checksum=sha256:<hex> parameter from the query
+// of source, leaving the rest of it untouched, and returns the checksum
+func splitChecksum(source string) (string, []byte, error) {
+	base, query, ok := strings.Cut(source, "?")
+	if !ok {
+		return source, nil, nil
+	}
+
+	var kept []string
+	var checksum []byte
+	for _, param := range strings.Split(query, "&") {
+		value, isChecksum := strings.CutPrefix(param, "checksum=")
+		if !isChecksum {
+			kept = append(kept, param)
+			continue
+		}
+		hexSum, isSHA256 := strings.CutPrefix(value, "sha256:")
+		if !isSHA256 {
+			return "", nil, fmt.Errorf("unsupported checksum %q, expected sha256:<hex>", value)
+		}
+		sum, err := hex.DecodeString(hexSum)
+		if err != nil || len(sum) != sha256.Size {
+			return "", nil, fmt.Errorf("invalid SHA-256 checksum %q", hexSum)
+		}
+		checksum = sum
+	}
+
+	if len(kept) > 0 {
+		base += "?" + strings.Join(kept, "&")
+	}
+	return base, checksum, nil
+}
+
+// fetchHTTP downloads url. Without a checksum (pinned), the file is only
+// trusted for coming over HTTPS, so redirects to plain HTTP aren't followed.
+func fetchHTTP(ctx context.Context, url string, pinned bool) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	client := &http.Client{CheckRedirect: checkRedirect(pinned)}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("server returned %s", resp.Status)
+	}
+	return readLimited(resp.Body)
+}
+
+// checkRedirect returns the redirect policy of fetchHTTP: that of the default
+// client, refusing redirects to plain HTTP unless the file is pinned
+func checkRedirect(pinned bool) func(*http.Request, []*http.Request) error {
+	return func(req *http.Request, via []*http.Request) error {
+		if !pinned && req.URL.Scheme != "https" {
+			return errors.New("refusing a redirect to plain HTTP without a checksum")
+		}
+		if len(via) >= 10 {
+			return errors.New("stopped after 10 redirects")
+		}
+		return nil
+	}
+}
+
+// fetchS3 downloads an object with the AWS CLI, so that the usual AWS
+// credentials and settings apply
+func fetchS3(ctx context.Context, url string) ([]byte, error) {
+	return output(exec.CommandContext(ctx, "aws", "s3", "cp", "--only-show-errors", url, "-"))
+}
+
+// fetchGit reads a file from a shallow clone of a git repository. source is
+// <repository>//<path>, optionally followed by ?ref=<branch or tag>.
+func fetchGit(ctx context.Context, source string) ([]byte, error) {
+	repo, path, ref, err := parseGitSource(source)
+	if err != nil {
+		return nil, err
+	}
+
+	dir, err := os.MkdirTemp("", "summon-git")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+
+	args := []string{"clone", "--quiet", "--depth", "1"}
+	if ref != "" {
+		args = append(args, "--branch", ref)
+	}
+	args = append(args, "--", repo, dir)
+	if _, err := output(exec.CommandContext(ctx, "git", args...)); err != nil {
+		return nil, err
+	}
+
+	// Symlinks committed to the repository may only point within the clone,
+	// or the file read could be any the user can read
+	file, err := filepath.EvalSymlinks(filepath.Join(dir, filepath.FromSlash(path)))
+	if err != nil {
+		return nil, fmt.Errorf("%s not found in the repository", path)
+	}
+	root, err := filepath.EvalSymlinks(dir)
+	if err != nil {
+		return nil, err
+	}
+	if rel, err := filepath.Rel(root, file); err != nil || !filepath.IsLocal(rel) {
+		return nil, fmt.Errorf("%s links outside the repository", path)
+	}
+
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, fmt.Errorf("%s not found in the repository", path)
+	}
+	defer f.Close()
+	return readLimited(f)
+}
+
+// parseGitSource splits <repository>//<path>?ref=<ref>. The repository may
+// be a URL, whose scheme's // doesn't count.
+func parseGitSource(source string) (repo, path, ref string, err error) {
+	source, query, _ := strings.Cut(source, "?")
+	for _, param := range strings.Split(query, "&") {
+		if value, ok := strings.CutPrefix(param, "ref="); ok {
+			ref = value
+		} else if param != "" {
+			return "", "", "", fmt.Errorf("unsupported parameter %q", param)
+		}
+	}
+
+	start := 0
+	if i := strings.Index(source, "://"); i >= 0 {
+		start = i + len("://")
+	}
+	i := strings.Index(source[start:], "//")
+	if i < 0 {
+		return "", "", "", errors.New("expected the path of the file in the repository after //")
+	}
+	repo, path = source[:start+i], source[start+i+2:]
+	if path == "" {
+		return "", "", "", errors.New("expected the path of the file in the repository after //")
+	}
+	if !filepath.IsLocal(filepath.FromSlash(path)) {
+		return "", "", "", fmt.Errorf("%s is not a path within the repository", path)
+	}
+	return repo, path, ref, nil
+}
+
+// output runs cmd and returns its output, or an error with what it printed
+// on stderr
+func output(cmd *exec.Cmd) ([]byte, error) {
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return nil, fmt.Errorf("%s: %s", err, msg)
+		}
+		return nil, err
+	}
+	if len(out) > MaxSize {
+		return nil, fmt.Errorf("larger than %d bytes", MaxSize)
+	}
+	return out, nil
+}
+
+func readLimited(r io.Reader) ([]byte, error) {
+	content, err := io.ReadAll(io.LimitReader(r, MaxSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(content) > MaxSize {
+		return nil, fmt.Errorf("larger than %d bytes", MaxSize)
+	}
+	return content, nil
+}
@@ -0,0 +1,214 @@
+package remote
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const secretsYml = "PASSWORD: !var db/password\n"
+
+func sha256Of(content string) string {
+	return fmt.Sprintf("sha256:%x", sha256.Sum256([]byte(content)))
+}
+
+func TestIsRemote(t *testing.T) {
+	for _, path := range []string{
+		"https://example.com/secrets.yml",
+		"http://example.com/secrets.yml",
+		"s3://bucket/secrets.yml",
+		"git::https://github.com/org/config.git//secrets.yml",
+	} {
+		assert.True(t, IsRemote(path), path)
+	}
+	for _, path := range []string{"secrets.yml", "/etc/secrets.yml", `C:\secrets.yml`, "https.yml"} {
+		assert.False(t, IsRemote(path), path)
+	}
+}
+
+func TestFetchHTTP(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/secrets.yml":
+			assert.Equal(t, "env=prod", r.URL.RawQuery)
+			fmt.Fprint(w, secretsYml)
+		case "/large.yml":
+			fmt.Fprint(w, strings.Repeat("#", MaxSize+1))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+	ctx := context.Background()
+
+	t.Run("Fetches the file, without the checksum parameter", func(t *testing.T) {
+		content, err := Fetch(ctx, server.URL+"/secrets.yml?env=prod&checksum="+sha256Of(secretsYml))
+		assert.NoError(t, err)
+		assert.Equal(t, secretsYml, string(content))
+	})
+
+	t.Run("Fails on a checksum mismatch", func(t *testing.T) {
+		_, err := Fetch(ctx, server.URL+"/secrets.yml?env=prod&checksum="+sha256Of("other"))
+		assert.EqualError(t, err, fmt.Sprintf(
+			"checksum mismatch for %s/secrets.yml?env=prod: expected %s, got %s",
+			server.URL, sha256Of("other"), sha256Of(secretsYml)))
+	})
+
+	t.Run("Rejects malformed checksums", func(t *testing.T) {
+		_, err := Fetch(ctx, server.URL+"/secrets.yml?checksum=md5:abc")
+		assert.EqualError(t, err, fmt.Sprintf(
+			`unable to fetch %s/secrets.yml?checksum=md5:abc: unsupported checksum "md5:abc", expected sha256:<hex>`,
+			server.URL))
+
+		_, err = Fetch(ctx, server.URL+"/secrets.yml?checksum=sha256:abc")
+		assert.Contains(t, err.Error(), `invalid SHA-256 checksum "abc"`)
+	})
+
+	t.Run("Requires a checksum over plain HTTP", func(t *testing.T) {
+		// httptest serves plain HTTP
+		_, err := Fetch(ctx, server.URL+"/secrets.yml?env=prod")
+		assert.EqualError(t, err, "unable to fetch "+server.URL+"/secrets.yml?env=prod: plain HTTP is only allowed with a checksum")
+	})
+
+	t.Run("Fails on error responses", func(t *testing.T) {
+		_, err := Fetch(ctx, server.URL+"/missing.yml?checksum="+sha256Of(""))
+		assert.EqualError(t, err, "unable to fetch "+server.URL+"/missing.yml: server returned 404 Not Found")
+	})
+
+	t.Run("Limits the size of the file", func(t *testing.T) {
+		_, err := Fetch(ctx, server.URL+"/large.yml?checksum="+sha256Of(""))
+		assert.EqualError(t, err, fmt.Sprintf("unable to fetch %s/large.yml: larger than %d bytes", server.URL, MaxSize))
+	})
+}
+
+func TestParseGitSource(t *testing.T) {
+	t.Run("Splits the repository URL from the path", func(t *testing.T) {
+		repo, path, ref, err := parseGitSource("https://github.com/org/config.git//app/secrets.yml?ref=v1.2.0")
+		assert.NoError(t, err)
+		assert.Equal(t, "https://github.com/org/config.git", repo)
+		assert.Equal(t, "app/secrets.yml", path)
+		assert.Equal(t, "v1.2.0", ref)
+	})
+
+	t.Run("Accepts scp-like repositories", func(t *testing.T) {
+		repo, path, ref, err := parseGitSource("git@github.com:org/config.git//secrets.yml")
+		assert.NoError(t, err)
+		assert.Equal(t, "git@github.com:org/config.git", repo)
+		assert.Equal(t, "secrets.yml", path)
+		assert.Equal(t, "", ref)
+	})
+
+	t.Run("Requires a path", func(t *testing.T) {
+		for _, source := range []string{"https://github.com/org/config.git", "https://github.com/org/config.git//"} {
+			_, _, _, err := parseGitSource(source)
+			assert.EqualError(t, err, "expected the path of the file in the repository after //")
+		}
+	})
+
+	t.Run("Rejects unknown parameters", func(t *testing.T) {
+		_, _, _, err := parseGitSource("https://github.com/org/config.git//secrets.yml?depth=2")
+		assert.EqualError(t, err, `unsupported parameter "depth=2"`)
+	})
+
+	t.Run("Rejects paths outside the repository", func(t *testing.T) {
+		for _, path := range []string{"..", "../secrets.yml", "app/../../secrets.yml", "/etc/passwd"} {
+			_, _, _, err := parseGitSource("https://github.com/org/config.git//" + path)
+			assert.EqualError(t, err, path+" is not a path within the repository")
+		}
+	})
+}
+
+func TestCheckRedirect(t *testing.T) {
+	via := []*http.Request{httptest.NewRequest(http.MethodGet, "https://config.example.com/secrets.yml", nil)}
+	toHTTPS := httptest.NewRequest(http.MethodGet, "https://cdn.example.com/secrets.yml", nil)
+	toHTTP := httptest.NewRequest(http.MethodGet, "http://cdn.example.com/secrets.yml", nil)
+
+	assert.NoError(t, checkRedirect(false)(toHTTPS, via))
+	assert.EqualError(t, checkRedirect(false)(toHTTP, via), "refusing a redirect to plain HTTP without a checksum")
+	// The checksum vouches for the file, whichever way it comes
+	assert.NoError(t, checkRedirect(true)(toHTTP, via))
+
+	assert.EqualError(t, checkRedirect(true)(toHTTPS, make([]*http.Request, 10)), "stopped after 10 redirects")
+}
+
+func TestFetchGit(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+
+	repo := t.TempDir()
+	git := func(args ...string) {
+		cmd := exec.Command("git", append([]string{"-C", repo}, args...)...)
+		cmd.Env = append(os.Environ(),
+			"GIT_AUTHOR_NAME=test", "GIT_AUTHOR_EMAIL=test@example.com",
+			"GIT_COMMITTER_NAME=test", "GIT_COMMITTER_EMAIL=test@example.com",
+			"GIT_CONFIG_GLOBAL=/dev/null", "GIT_CONFIG_NOSYSTEM=1")
+		out, err := cmd.CombinedOutput()
+		assert.NoError(t, err, string(out))
+	}
+	outside := filepath.Join(t.TempDir(), "credentials")
+	assert.NoError(t, os.WriteFile(outside, []byte("AWS_SECRET: secret\n"), 0600))
+	git("init", "--quiet", "--initial-branch", "main")
+	assert.NoError(t, os.MkdirAll(filepath.Join(repo, "app"), 0755))
+	assert.NoError(t, os.WriteFile(filepath.Join(repo, "app", "secrets.yml"), []byte("OLD: old\n"), 0644))
+	assert.NoError(t, os.Symlink("app/secrets.yml", filepath.Join(repo, "inside.yml")))
+	assert.NoError(t, os.Symlink(outside, filepath.Join(repo, "outside.yml")))
+	git("add", ".")
+	git("commit", "--quiet", "-m", "old")
+	git("tag", "v1")
+	assert.NoError(t, os.WriteFile(filepath.Join(repo, "app", "secrets.yml"), []byte(secretsYml), 0644))
+	git("commit", "--quiet", "-am", "new")
+
+	source := "git::file://" + filepath.ToSlash(repo) + "//app/secrets.yml"
+	ctx := context.Background()
+
+	t.Run("Reads the file from the default branch", func(t *testing.T) {
+		content, err := Fetch(ctx, source+"?checksum="+sha256Of(secretsYml))
+		assert.NoError(t, err)
+		assert.Equal(t, secretsYml, string(content))
+	})
+
+	t.Run("Reads the file at a ref", func(t *testing.T) {
+		content, err := Fetch(ctx, source+"?ref=v1")
+		assert.NoError(t, err)
+		assert.Equal(t, "OLD: old\n", string(content))
+	})
+
+	t.Run("Fails on a missing file", func(t *testing.T) {
+		_, err := Fetch(ctx, "git::file://"+filepath.ToSlash(repo)+"//missing.yml")
+		assert.EqualError(t, err, "unable to fetch git::file://"+filepath.ToSlash(repo)+"//missing.yml: missing.yml not found in the repository")
+	})
+
+	t.Run("Follows symlinks only within the repository", func(t *testing.T) {
+		content, err := Fetch(ctx, "git::file://"+filepath.ToSlash(repo)+"//inside.yml")
+		assert.NoError(t, err)
+		assert.Equal(t, secretsYml, string(content))
+
+		_, err = Fetch(ctx, "git::file://"+filepath.ToSlash(repo)+"//outside.yml")
+		assert.EqualError(t, err, "unable to fetch git::file://"+filepath.ToSlash(repo)+"//outside.yml: outside.yml links outside the repository")
+	})
+
+	t.Run("Fails on a missing ref", func(t *testing.T) {
+		_, err := Fetch(ctx, source+"?ref=v2")
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "v2")
+	})
+}
+
+func TestReadFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "secrets.yml")
+	assert.NoError(t, os.WriteFile(path, []byte(secretsYml), 0644))
+
+	content, err := ReadFile(path)
+	assert.NoError(t, err)
+	assert.Equal(t, secretsYml, string(content))
+}
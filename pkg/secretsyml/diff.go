@@ -0,0 +1,120 @@
+package secretsyml
+
+import (
+	"sort"
+)
+
+// ChangeKind tells how a secret differs between two secrets maps
+type ChangeKind uint8
+
+const (
+	Added ChangeKind = iota
+	Removed
+	Changed
+	Unchanged
+)
+
+func (k ChangeKind) String() string {
+	switch k {
+	case Added:
+		return "Added"
+	case Removed:
+		return "Removed"
+	case Changed:
+		return "Changed"
+	case Unchanged:
+		return "Unchanged"
+	default:
+		panic("unreachable!")
+	}
+}
+
+// Change describes how the secret Key differs between two secrets maps. From
+// is nil for added secrets and To is nil for removed ones.
+type Change struct {
+	Key  string
+	Kind ChangeKind
+	From *SecretSpec
+	To   *SecretSpec
+}
+
+// Diff compares the secrets in from and to, returning a change for every key
+// in either of them, sorted by key. Secrets are changed if their tags, path
+// or default value differ.
+func Diff(from, to SecretsMap) []Change {
+	keys := make([]string, 0, len(from)+len(to))
+	for key := range from {
+		keys = append(keys, key)
+	}
+	for key := range to {
+		if _, ok := from[key]; !ok {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	changes := make([]Change, 0, len(keys))
+	for _, key := range keys {
+		fromSpec, inFrom := from[key]
+		toSpec, inTo := to[key]
+
+		change := Change{Key: key}
+		switch {
+		case !inFrom:
+			change.Kind = Added
+		case !inTo:
+			change.Kind = Removed
+		case sameSpec(fromSpec, toSpec):
+			change.Kind = Unchanged
+		default:
+			change.Kind = Changed
+		}
+		if inFrom {
+			change.From = &fromSpec
+		}
+		if inTo {
+			change.To = &toSpec
+		}
+		changes = append(changes, change)
+	}
+	return changes
+}
+
+// sameSpec compares specs by meaning, so that e.g. !var:file and !file:var
+// are the same
+func sameSpec(a, b SecretSpec) bool {
+	return a.Path == b.Path &&
+		a.DefaultValue == b.DefaultValue &&
+		a.IsVar() == b.IsVar() &&
+		a.IsFile() == b.IsFile() &&
+		a.IsLiteral() == b.IsLiteral() &&
+		a.Type == b.Type &&
+		sameModifiers(a, b) &&
+		sameItems(a, b)
+}
+
+// sameModifiers compares the modifiers of secrets, whose order matters
+func sameModifiers(a, b SecretSpec) bool {
+	if len(a.Modifiers) != len(b.Modifiers) {
+		return false
+	}
+	for i := range a.Modifiers {
+		if a.Modifiers[i] != b.Modifiers[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// sameItems compares the items of list-valued secrets
+func sameItems(a, b SecretSpec) bool {
+	if a.IsList() != b.IsList() || a.Separator != b.Separator || len(a.Items) != len(b.Items) {
+		return false
+	}
+	for i := range a.Items {
+		if !sameSpec(a.Items[i], b.Items[i]) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,51 @@
+package secretsyml
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDiff(t *testing.T) {
+	from, err := ParseFromString(`
+KEPT: !var a/kept
+REORDERED_TAGS: !var:file a/cert
+MOVED: !var a/moved
+REMOVED: !var a/removed
+LIST: !var [a/one, a/two]
+REJOINED: !var [a/one, a/two]`, "", nil)
+	assert.NoError(t, err)
+
+	to, err := ParseFromString(`
+KEPT: !var a/kept
+REORDERED_TAGS: !file:var a/cert
+MOVED: !var b/moved
+ADDED: !str literal
+LIST: !var [a/one, a/two]
+REJOINED: !var:join=';' [a/one, a/two]`, "", nil)
+	assert.NoError(t, err)
+
+	changes := Diff(from, to)
+
+	kinds := map[string]ChangeKind{}
+	for _, change := range changes {
+		kinds[change.Key] = change.Kind
+	}
+	assert.Equal(t, map[string]ChangeKind{
+		"ADDED":          Added,
+		"KEPT":           Unchanged,
+		"LIST":           Unchanged,
+		"MOVED":          Changed,
+		"REJOINED":       Changed,
+		"REMOVED":        Removed,
+		"REORDERED_TAGS": Unchanged,
+	}, kinds)
+
+	assert.Equal(t, "ADDED", changes[0].Key)
+	assert.Nil(t, changes[0].From)
+	assert.Equal(t, "literal", changes[0].To.Path)
+
+	assert.Equal(t, "MOVED", changes[3].Key)
+	assert.Equal(t, "a/moved", changes[3].From.Path)
+	assert.Equal(t, "b/moved", changes[3].To.Path)
+}
@@ -0,0 +1,170 @@
+package secretsyml
+
+import (
+	"fmt"
+	"net/url"
+	"path"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Format is the syntax a secrets file is written in
+type Format string
+
+const (
+	YAML Format = "yaml"
+	JSON Format = "json"
+	TOML Format = "toml"
+)
+
+// ParseFormat returns the format of the given name, as given to --format
+func ParseFormat(name string) (Format, error) {
+	switch format := Format(strings.ToLower(name)); format {
+	case YAML, JSON, TOML:
+		return format, nil
+	case "yml":
+		return YAML, nil
+	default:
+		return "", fmt.Errorf("unknown secrets file format %q, expected yaml, json or toml", name)
+	}
+}
+
+// FormatOf returns the format of the secrets file at path (or URL) according
+// to its extension: JSON for .json, TOML for .toml and YAML otherwise
+func FormatOf(filepath string) Format {
+	// Leave out the query and fragment of URLs
+	if i := strings.IndexAny(filepath, "?#"); i >= 0 && strings.Contains(filepath, "://") {
+		filepath = filepath[:i]
+	}
+	switch strings.ToLower(path.Ext(strings.ReplaceAll(filepath, `\`, "/"))) {
+	case ".json":
+		return JSON
+	case ".toml":
+		return TOML
+	default:
+		return YAML
+	}
+}
+
+// Convert returns the secrets.yml equivalent of content, written in format,
+// so that it can be parsed like any secrets.yml. JSON and TOML have no tags,
+// so secrets carry theirs in strings, as in "!var:file path/to/cert", or as the
+// single key of an object, as in {"!var:join=';'": ["a", "b"]}. Other strings
+// are literals, like untagged values in secrets.yml.
+//
+// Content in JSON or TOML is checked before it is converted, so that errors
+// point at its own lines. YAML content is returned as is.
+func Convert(content string, format Format) (string, error) {
+	var root *yaml.Node
+	var err error
+	switch format {
+	case YAML, "":
+		return content, nil
+	case JSON:
+		root, err = decodeJSON(content)
+	case TOML:
+		root, err = decodeTOML(content)
+	default:
+		return "", fmt.Errorf("unknown secrets file format %q", format)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	if err := tagSecrets(root); err != nil {
+		return "", err
+	}
+	document := map[string]yaml.Node{}
+	if err := root.Decode(&document); err != nil {
+		return "", err
+	}
+	if err := validateDocument(document); err != nil {
+		return "", err
+	}
+
+	out, err := yaml.Marshal(root)
+	if err != nil {
+		return "", err
+	}
+	return string(out), nil
+}
+
+// tagSecrets moves the tags of the secrets in root, at the top level or in
+// environment sections, from their values to their nodes, where secrets.yml
+// has them
+func tagSecrets(root *yaml.Node) error {
+	for i := 0; i+1 < len(root.Content); i += 2 {
+		key, value := root.Content[i].Value, root.Content[i+1]
+		if isReservedKey(key) {
+			continue
+		}
+		if value.Kind != yaml.MappingNode || isTaggedObject(value) {
+			if err := tagValue(key, value); err != nil {
+				return err
+			}
+			continue
+		}
+
+		// An environment section
+		for j := 0; j+1 < len(value.Content); j += 2 {
+			if value.Content[j].Value == ProviderKey {
+				continue
+			}
+			if err := tagValue(value.Content[j].Value, value.Content[j+1]); err != nil {
+				return fmt.Errorf("section %s: %s", key, err)
+			}
+		}
+	}
+	return nil
+}
+
+// isTaggedObject tells whether node is an object holding a tagged value, e.g.
+// {"!var": "path"}. Neither secrets nor sections are named after tags.
+func isTaggedObject(node *yaml.Node) bool {
+	return node.Kind == yaml.MappingNode && len(node.Content) == 2 &&
+		strings.HasPrefix(node.Content[0].Value, "!")
+}
+
+// tagValue sets the tag of the secret key from its value, and of the items of
+// lists
+func tagValue(key string, node *yaml.Node) error {
+	switch {
+	case isTaggedObject(node):
+		tag, value := node.Content[0], node.Content[1]
+		if value.Kind != yaml.ScalarNode && value.Kind != yaml.SequenceNode {
+			return fmt.Errorf("secret %s: the value tagged %s must be a string, number, boolean or list (line %d)",
+				key, tag.Value, value.Line)
+		}
+		if err := setTag(value, tag.Value); err != nil {
+			return fmt.Errorf("secret %s: %s (line %d)", key, err, tag.Line)
+		}
+		*node = *value
+	case node.Kind == yaml.ScalarNode && node.Tag == "!!str" && strings.HasPrefix(node.Value, "!"):
+		tag, value, _ := strings.Cut(node.Value, " ")
+		if err := setTag(node, tag); err != nil {
+			return fmt.Errorf("secret %s: %s (line %d)", key, err, node.Line)
+		}
+		node.Value = value
+	}
+
+	if node.Kind == yaml.SequenceNode {
+		for _, item := range node.Content {
+			if err := tagValue(key, item); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// setTag tags node, decoding %-escapes in tag as YAML does, e.g. join='%0A'
+func setTag(node *yaml.Node, tag string) error {
+	decoded, err := url.PathUnescape(tag)
+	if err != nil {
+		return fmt.Errorf("invalid tag %s: %s", tag, err)
+	}
+	node.Tag = decoded
+	node.Style = yaml.TaggedStyle
+	return nil
+}
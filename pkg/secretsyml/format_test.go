@@ -0,0 +1,150 @@
+package secretsyml
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFormatOf(t *testing.T) {
+	for path, expected := range map[string]Format{
+		"secrets.yml":       YAML,
+		"secrets.yaml":      YAML,
+		"secrets":           YAML,
+		"secrets.json":      JSON,
+		"conf/Secrets.TOML": TOML,
+		"https://example.com/secrets.json?ref=main":              JSON,
+		"git::https://example.com/repo.git//secrets.toml?ref=v1": TOML,
+	} {
+		assert.Equal(t, expected, FormatOf(path), path)
+	}
+}
+
+func TestParseFormat(t *testing.T) {
+	format, err := ParseFormat("JSON")
+	assert.NoError(t, err)
+	assert.Equal(t, JSON, format)
+
+	format, err = ParseFormat("yml")
+	assert.NoError(t, err)
+	assert.Equal(t, YAML, format)
+
+	_, err = ParseFormat("ini")
+	assert.EqualError(t, err, `unknown secrets file format "ini", expected yaml, json or toml`)
+}
+
+func TestConvert(t *testing.T) {
+	expected := SecretsMap{
+		"DB_USER": {Tags: []YamlTag{Literal}, Path: "app"},
+		"DB_PASS": {Tags: []YamlTag{Var}, Path: "prod/db/password"},
+		"PORT":    {Tags: []YamlTag{Literal}, Path: "8080"},
+		"CERT":    {Tags: []YamlTag{Var, File}, Path: "prod/cert", DefaultValue: "none"},
+		"BANG":    {Tags: []YamlTag{Literal}, Path: "!not-a-tag"},
+		"HOSTS": {Tags: []YamlTag{Var}, Separator: "\n", Items: []SecretSpec{
+			{Tags: []YamlTag{Var}, Path: "prod/host/a"},
+			{Tags: []YamlTag{Literal}, Path: "localhost"},
+		}},
+	}
+
+	t.Run("JSON", func(t *testing.T) {
+		content := `{
+  ".substitutions": {"env": "prod"},
+  "production": {
+    ".provider": "summon-conjur",
+    "DB_USER": "app",
+    "DB_PASS": "!var $env/db/password",
+    "PORT": 8080,
+    "CERT": "!var:file:default='none' $env/cert",
+    "BANG": {"!str": "!not-a-tag"},
+    "HOSTS": {"!var:join='%0A'": ["$env/host/a", "!str localhost"]}
+  }
+}`
+		yml, err := Convert(content, JSON)
+		assert.NoError(t, err)
+
+		secrets, err := ParseFromString(yml, "production", map[string]string{"env": "prod"})
+		assert.NoError(t, err)
+		assert.Equal(t, expected, secrets)
+		provider, err := Provider(yml, "production")
+		assert.NoError(t, err)
+		assert.Equal(t, "summon-conjur", provider)
+	})
+
+	t.Run("TOML", func(t *testing.T) {
+		content := `
+".substitutions" = { env = "prod" }
+
+[production]
+".provider" = "summon-conjur"
+DB_USER = 'app'
+DB_PASS = "!var $env/db/password"  # from Conjur
+PORT = 8_080
+CERT = "!var:file:default='none' $env/cert"
+BANG = { "!str" = "!not-a-tag" }
+HOSTS = { "!var:join='%0A'" = [
+  "$env/host/a",
+  "!str localhost",
+] }
+`
+		yml, err := Convert(content, TOML)
+		assert.NoError(t, err)
+
+		secrets, err := ParseFromString(yml, "production", map[string]string{"env": "prod"})
+		assert.NoError(t, err)
+		assert.Equal(t, expected, secrets)
+		provider, err := Provider(yml, "production")
+		assert.NoError(t, err)
+		assert.Equal(t, "summon-conjur", provider)
+	})
+
+	t.Run("TOML strings", func(t *testing.T) {
+		yml, err := Convert(`A = "tab\there \u00e9"
+B = 'C:\path'
+C = """
+first
+second"""
+D = '''
+raw\n'''
+E = 1979-05-27
+`, TOML)
+		assert.NoError(t, err)
+
+		secrets, err := ParseFromString(yml, "", nil)
+		assert.NoError(t, err)
+		assert.Equal(t, "tab\there é", secrets["A"].Path)
+		assert.Equal(t, `C:\path`, secrets["B"].Path)
+		assert.Equal(t, "first\nsecond", secrets["C"].Path)
+		assert.Equal(t, `raw\n`, secrets["D"].Path)
+		assert.Equal(t, "1979-05-27", secrets["E"].Path)
+	})
+
+	t.Run("YAML is returned as is", func(t *testing.T) {
+		yml, err := Convert("A: !var a\n", YAML)
+		assert.NoError(t, err)
+		assert.Equal(t, "A: !var a\n", yml)
+	})
+
+	t.Run("Errors point at the lines of the content", func(t *testing.T) {
+		for content, expected := range map[string]string{
+			"{\n  \"A\": \"a\",\n}":                 "invalid character ',' looking for beginning of value (line 2)",
+			"{\n  \"A\": \"a\",\n  \"A\": \"b\"\n}": "key A is defined twice (line 3)",
+			"[\"A\"]":                               "secrets must be a JSON object (line 1)",
+			"{\n  \"A\": [[\"a\"]]\n}":              "secret A: list item 0 must be a string, number or boolean (line 2)",
+		} {
+			_, err := Convert(content, JSON)
+			assert.EqualError(t, err, expected, content)
+		}
+
+		for content, expected := range map[string]string{
+			"A = \"a\"\nA = \"b\"\n":         "key A is defined twice (line 2)",
+			"A = \"a\nB = 1\n":               "unterminated string (line 1)",
+			"[[production]]\nA = 1\n":        "arrays of tables are not supported (line 1)",
+			"A = \"a\"\n[production]\nB = 1": "secrets file mixes environment sections with top-level secrets",
+			"\n\".requires\" = { a = 1 }\n":  ".requires must be a provider version constraint or a list of them (line 2)",
+			"A = yes\n":                      "invalid value yes (line 1)",
+		} {
+			_, err := Convert(content, TOML)
+			assert.EqualError(t, err, expected, content)
+		}
+	})
+}
@@ -0,0 +1,128 @@
+package secretsyml
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// decodeJSON decodes a secrets file in JSON to the document secrets.yml
+// would be decoded to, keeping the order of keys and their lines
+func decodeJSON(content string) (*yaml.Node, error) {
+	d := &jsonDecoder{decoder: json.NewDecoder(strings.NewReader(content)), lines: lineStarts(content)}
+	d.decoder.UseNumber()
+
+	root, err := d.value()
+	if err == nil && root.Kind != yaml.MappingNode {
+		err = fmt.Errorf("secrets must be a JSON object (line %d)", root.Line)
+	}
+	if err == nil {
+		if _, err = d.decoder.Token(); err == io.EOF {
+			return root, nil
+		}
+		if err == nil {
+			err = fmt.Errorf("unexpected data after the secrets object (line %d)", d.line())
+		}
+	}
+
+	var syntaxErr *json.SyntaxError
+	if errors.As(err, &syntaxErr) {
+		return nil, fmt.Errorf("%s (line %d)", err, lineOf(d.lines, syntaxErr.Offset))
+	}
+	if errors.Is(err, io.EOF) {
+		return nil, errors.New("unexpected end of JSON input")
+	}
+	return nil, err
+}
+
+type jsonDecoder struct {
+	decoder *json.Decoder
+	// lines are the offsets at which lines start
+	lines []int64
+}
+
+// line returns the line of the token last read
+func (d *jsonDecoder) line() int {
+	return lineOf(d.lines, d.decoder.InputOffset()-1)
+}
+
+// value decodes the next value, with all it holds
+func (d *jsonDecoder) value() (*yaml.Node, error) {
+	token, err := d.decoder.Token()
+	if err != nil {
+		return nil, err
+	}
+	line := d.line()
+
+	switch token := token.(type) {
+	case json.Delim:
+		if token == '[' {
+			list := &yaml.Node{Kind: yaml.SequenceNode, Tag: "!!seq", Line: line}
+			for d.decoder.More() {
+				item, err := d.value()
+				if err != nil {
+					return nil, err
+				}
+				list.Content = append(list.Content, item)
+			}
+			_, err := d.decoder.Token()
+			return list, err
+		}
+
+		object := &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map", Line: line}
+		keys := map[string]bool{}
+		for d.decoder.More() {
+			// Keys are always strings
+			token, err := d.decoder.Token()
+			if err != nil {
+				return nil, err
+			}
+			key := &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: token.(string), Line: d.line()}
+			if keys[key.Value] {
+				return nil, fmt.Errorf("key %s is defined twice (line %d)", key.Value, key.Line)
+			}
+			keys[key.Value] = true
+
+			value, err := d.value()
+			if err != nil {
+				return nil, err
+			}
+			object.Content = append(object.Content, key, value)
+		}
+		_, err := d.decoder.Token()
+		return object, err
+	case string:
+		return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: token, Line: line}, nil
+	case json.Number:
+		tag := "!!int"
+		if strings.ContainsAny(token.String(), ".eE") {
+			tag = "!!float"
+		}
+		return &yaml.Node{Kind: yaml.ScalarNode, Tag: tag, Value: token.String(), Line: line}, nil
+	case bool:
+		return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!bool", Value: fmt.Sprint(token), Line: line}, nil
+	default:
+		return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!null", Value: "null", Line: line}, nil
+	}
+}
+
+// lineStarts returns the offsets at which the lines of content start
+func lineStarts(content string) []int64 {
+	starts := []int64{0}
+	for i, c := range content {
+		if c == '\n' {
+			starts = append(starts, int64(i+1))
+		}
+	}
+	return starts
+}
+
+// lineOf returns the line, counted from 1, of the byte at offset
+func lineOf(starts []int64, offset int64) int {
+	return sort.Search(len(starts), func(i int) bool { return starts[i] > offset })
+}
@@ -0,0 +1,103 @@
+package secretsyml
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// Names of the modifiers that can be chained in tags, e.g.
+// !var:json=apikey:base64:trim
+const (
+	ModifierBase64 = "base64"
+	ModifierTrim   = "trim"
+	ModifierJSON   = "json"
+)
+
+// Modifier transforms the value of a secret once it is resolved. The
+// modifiers of a secret are applied in the order of its tags.
+type Modifier struct {
+	Name string
+	// Arg is the argument given after "=", e.g. the key for json
+	Arg string
+}
+
+func (m Modifier) String() string {
+	if m.Arg == "" {
+		return m.Name
+	}
+	return m.Name + "=" + m.Arg
+}
+
+// Apply returns value transformed by the modifier
+func (m Modifier) Apply(value string) (string, error) {
+	var err error
+	switch m.Name {
+	case ModifierBase64:
+		var decoded []byte
+		decoded, err = base64.StdEncoding.DecodeString(strings.TrimSpace(value))
+		value = string(decoded)
+	case ModifierTrim:
+		value = strings.TrimSpace(value)
+	case ModifierJSON:
+		value, err = jsonField(value, m.Arg)
+	default:
+		err = fmt.Errorf("unknown modifier")
+	}
+	if err != nil {
+		return "", fmt.Errorf("%s: %s", m, err)
+	}
+	return value, nil
+}
+
+// jsonField returns the field of a JSON object at path, with dots separating
+// the keys of nested objects. Strings are returned as is, other values as
+// JSON.
+func jsonField(value, path string) (string, error) {
+	// Keep numbers as they are written, e.g. large IDs
+	decoder := json.NewDecoder(strings.NewReader(value))
+	decoder.UseNumber()
+	var field interface{}
+	if err := decoder.Decode(&field); err != nil {
+		return "", fmt.Errorf("value is not JSON")
+	}
+
+	for _, key := range strings.Split(path, ".") {
+		object, ok := field.(map[string]interface{})
+		if !ok {
+			return "", fmt.Errorf("key %s not found", path)
+		}
+		if field, ok = object[key]; !ok || field == nil {
+			return "", fmt.Errorf("key %s not found", path)
+		}
+	}
+
+	if s, ok := field.(string); ok {
+		return s, nil
+	}
+	out, err := json.Marshal(field)
+	return string(out), err
+}
+
+// Transform applies the modifiers of the secret to a value resolved for it,
+// and falls back to the default value if the result is empty. An empty value
+// goes straight to the default, as there is nothing to transform. The result
+// is checked against the type of the secret.
+func (spec *SecretSpec) Transform(value string) (string, error) {
+	if value != "" {
+		for _, modifier := range spec.Modifiers {
+			var err error
+			if value, err = modifier.Apply(value); err != nil {
+				return "", err
+			}
+		}
+	}
+	if value == "" && spec.DefaultValue != "" {
+		value = spec.DefaultValue
+	}
+	if err := spec.Type.Check(value); err != nil {
+		return "", err
+	}
+	return value, nil
+}
@@ -0,0 +1,76 @@
+package secretsyml
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestModifiers(t *testing.T) {
+	t.Run("Modifiers are parsed in order", func(t *testing.T) {
+		parsed, err := ParseFromString("API_KEY: !var:json=credentials.apikey:base64:trim:default='none' prod/api\n", "", nil)
+		assert.NoError(t, err)
+		assert.Equal(t, SecretSpec{
+			Tags: []YamlTag{Var},
+			Path: "prod/api",
+			Modifiers: []Modifier{
+				{Name: ModifierJSON, Arg: "credentials.apikey"},
+				{Name: ModifierBase64},
+				{Name: ModifierTrim},
+			},
+			DefaultValue: "none",
+		}, parsed["API_KEY"])
+	})
+
+	t.Run("Modifiers in a default value are part of it", func(t *testing.T) {
+		parsed, err := ParseFromString("A: !var:default='trim' a\n", "", nil)
+		assert.NoError(t, err)
+		assert.Empty(t, parsed["A"].Modifiers)
+		assert.Equal(t, "trim", parsed["A"].DefaultValue)
+	})
+
+	t.Run("Apply", func(t *testing.T) {
+		for _, tc := range []struct {
+			modifier Modifier
+			in, out  string
+			err      string
+		}{
+			{Modifier{Name: ModifierTrim}, " value\n", "value", ""},
+			{Modifier{Name: ModifierBase64}, "c2VjcmV0\n", "secret", ""},
+			{Modifier{Name: ModifierBase64}, "not base64!", "", "base64: illegal base64 data at input byte 3"},
+			{Modifier{Name: ModifierJSON, Arg: "apikey"}, `{"apikey": "secret"}`, "secret", ""},
+			{Modifier{Name: ModifierJSON, Arg: "a.b"}, `{"a": {"b": 12345678901234567890}}`, "12345678901234567890", ""},
+			{Modifier{Name: ModifierJSON, Arg: "a"}, `{"a": {"b": [1, true]}}`, `{"b":[1,true]}`, ""},
+			{Modifier{Name: ModifierJSON, Arg: "a.c"}, `{"a": {"b": 1}}`, "", "json=a.c: key a.c not found"},
+			{Modifier{Name: ModifierJSON, Arg: "a"}, `secret`, "", "json=a: value is not JSON"},
+		} {
+			out, err := tc.modifier.Apply(tc.in)
+			if tc.err != "" {
+				assert.EqualError(t, err, tc.err)
+				continue
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tc.out, out)
+		}
+	})
+
+	t.Run("Transform applies modifiers, then the default value", func(t *testing.T) {
+		spec := SecretSpec{
+			Modifiers:    []Modifier{{Name: ModifierJSON, Arg: "key"}, {Name: ModifierTrim}},
+			DefaultValue: "fallback",
+		}
+
+		value, err := spec.Transform(`{"key": " secret "}`)
+		assert.NoError(t, err)
+		assert.Equal(t, "secret", value)
+
+		value, err = spec.Transform(`{"key": "  "}`)
+		assert.NoError(t, err)
+		assert.Equal(t, "fallback", value)
+
+		// Empty values aren't transformed
+		value, err = spec.Transform("")
+		assert.NoError(t, err)
+		assert.Equal(t, "fallback", value)
+	})
+}
@@ -0,0 +1,63 @@
+package secretsyml
+
+import (
+	"fmt"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ProviderKey declares the provider that resolves the secrets of secrets.yml,
+// as the name of one in the provider search path or an alias from the config
+// file. Paths aren't allowed, so a secrets file can't have summon run any
+// binary it likes. It may be given at the top level, and in environment
+// sections to override it.
+const ProviderKey = ".provider"
+
+// Provider returns the provider content declares for the environment env:
+// the one in its section, else in the common section, else at the top level.
+// It returns "" if none is declared, or if content isn't valid secrets.yml;
+// parsing it tells why.
+func Provider(content, env string) (string, error) {
+	nodes := map[string]yaml.Node{}
+	if err := yaml.Unmarshal([]byte(content), &nodes); err != nil {
+		return "", nil
+	}
+	return provider(nodes, env)
+}
+
+func provider(nodes map[string]yaml.Node, env string) (string, error) {
+	var sections []string
+	if env != "" {
+		sections = append([]string{env}, COMMON_SECTIONS...)
+	}
+	for _, name := range sections {
+		section, ok := nodes[name]
+		if !ok {
+			continue
+		}
+		entries := map[string]yaml.Node{}
+		if err := resolveAlias(&section).Decode(&entries); err != nil {
+			continue
+		}
+		if node, ok := entries[ProviderKey]; ok {
+			return providerName(name+ProviderKey, &node)
+		}
+	}
+
+	if node, ok := nodes[ProviderKey]; ok {
+		return providerName(ProviderKey, &node)
+	}
+	return "", nil
+}
+
+func providerName(key string, node *yaml.Node) (string, error) {
+	node = resolveAlias(node)
+	if node.Kind != yaml.ScalarNode || node.Value == "" {
+		return "", fmt.Errorf("%s must be the name of a provider (line %d)", key, node.Line)
+	}
+	if strings.ContainsAny(node.Value, `/\`) || node.Value == "." || node.Value == ".." {
+		return "", fmt.Errorf("%s must be the name of a provider or an alias, not a path (line %d)", key, node.Line)
+	}
+	return node.Value, nil
+}
@@ -0,0 +1,79 @@
+package secretsyml
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProvider(t *testing.T) {
+	content := `
+.provider: summon-conjur
+common:
+  DB_USER: app
+production:
+  DB_PASS: !var prod/db/password
+development:
+  .provider: summon-file
+  DB_PASS: !var dev/db/password
+`
+
+	t.Run("Returns the provider of the environment, else the top-level one", func(t *testing.T) {
+		for env, expected := range map[string]string{
+			"development": "summon-file",
+			"production":  "summon-conjur",
+			"":            "summon-conjur",
+		} {
+			provider, err := Provider(content, env)
+			assert.NoError(t, err)
+			assert.Equal(t, expected, provider, env)
+		}
+	})
+
+	t.Run("Falls back to the common section", func(t *testing.T) {
+		provider, err := Provider("common:\n  .provider: keyring\nproduction:\n  A: a\n", "production")
+		assert.NoError(t, err)
+		assert.Equal(t, "keyring", provider)
+	})
+
+	t.Run("Returns none without declarations", func(t *testing.T) {
+		for _, content := range []string{"", "DB_PASS: !var db", "production:\n  A: a", "not: [valid"} {
+			provider, err := Provider(content, "production")
+			assert.NoError(t, err)
+			assert.Equal(t, "", provider)
+		}
+	})
+
+	t.Run("Fails unless it is a name", func(t *testing.T) {
+		_, err := Provider("production:\n  .provider: [a, b]\n", "production")
+		assert.EqualError(t, err, "production.provider must be the name of a provider (line 2)")
+		_, err = Provider(".provider:\nA: a\n", "")
+		assert.EqualError(t, err, ".provider must be the name of a provider (line 1)")
+	})
+
+	t.Run("Fails if it is a path", func(t *testing.T) {
+		for _, provider := range []string{"/tmp/evil", "./evil", "bin/evil", `..\evil.exe`, ".."} {
+			_, err := Provider(".provider: '"+provider+"'\n", "")
+			assert.EqualError(t, err, ".provider must be the name of a provider or an alias, not a path (line 1)", provider)
+		}
+	})
+
+	t.Run("Isn't a secret or an environment", func(t *testing.T) {
+		secrets, err := ParseFromString(content, "development", nil)
+		assert.NoError(t, err)
+		assert.Equal(t, SecretsMap{
+			"DB_USER": {Tags: []YamlTag{Literal}, Path: "app"},
+			"DB_PASS": {Tags: []YamlTag{Var}, Path: "dev/db/password"},
+		}, secrets)
+
+		secrets, err = ParseFromString(".provider: summon-file\nDB_PASS: !var db", "", nil)
+		assert.NoError(t, err)
+		assert.Equal(t, SecretsMap{"DB_PASS": {Tags: []YamlTag{Var}, Path: "db"}}, secrets)
+	})
+
+	t.Run("Is validated", func(t *testing.T) {
+		assert.NoError(t, Validate(content))
+		assert.EqualError(t, Validate("production:\n  .provider: {a: b}\n  A: a\n"),
+			"production.provider must be the name of a provider (line 2)")
+	})
+}
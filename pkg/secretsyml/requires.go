@@ -0,0 +1,37 @@
+package secretsyml
+
+import (
+	"fmt"
+
+	"gopkg.in/yaml.v3"
+)
+
+// RequiresKey is the top-level key of secrets.yml declaring the provider
+// versions it needs, e.g. "summon-conjur >= 0.7.0", as a string or a list
+const RequiresKey = ".requires"
+
+// Requirements returns the provider version constraints declared in content
+// under RequiresKey, unparsed. Content that isn't valid secrets.yml has none;
+// parsing it tells why.
+func Requirements(content string) ([]string, error) {
+	nodes := map[string]yaml.Node{}
+	if err := yaml.Unmarshal([]byte(content), &nodes); err != nil {
+		return nil, nil
+	}
+	return requirements(nodes)
+}
+
+func requirements(nodes map[string]yaml.Node) ([]string, error) {
+	node, ok := nodes[RequiresKey]
+	if !ok {
+		return nil, nil
+	}
+
+	var requirements []string
+	if node.Kind == yaml.ScalarNode {
+		requirements = []string{node.Value}
+	} else if err := node.Decode(&requirements); err != nil {
+		return nil, fmt.Errorf("%s must be a provider version constraint or a list of them (line %d)", RequiresKey, node.Line)
+	}
+	return requirements, nil
+}
@@ -0,0 +1,51 @@
+package secretsyml
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRequirements(t *testing.T) {
+	t.Run("Returns a single constraint", func(t *testing.T) {
+		requirements, err := Requirements(".requires: summon-conjur >= 0.7.0\nDB_PASS: !var db")
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"summon-conjur >= 0.7.0"}, requirements)
+	})
+
+	t.Run("Returns a list of constraints", func(t *testing.T) {
+		requirements, err := Requirements(".requires:\n  - summon-conjur >= 0.7.0\n  - summon-aws < 2\n")
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"summon-conjur >= 0.7.0", "summon-aws < 2"}, requirements)
+	})
+
+	t.Run("Returns none without declarations", func(t *testing.T) {
+		for _, content := range []string{"", "DB_PASS: !var db", "not: [valid"} {
+			requirements, err := Requirements(content)
+			assert.NoError(t, err)
+			assert.Nil(t, requirements)
+		}
+	})
+
+	t.Run("Fails on anything else", func(t *testing.T) {
+		_, err := Requirements("DB_PASS: !var db\n.requires:\n  summon-conjur: 0.7.0\n")
+		assert.EqualError(t, err, ".requires must be a provider version constraint or a list of them (line 3)")
+	})
+
+	t.Run("Aren't secrets or an environment", func(t *testing.T) {
+		secrets, err := ParseFromString(".requires: summon-conjur >= 0.7.0\nDB_PASS: !var db", "", nil)
+		assert.NoError(t, err)
+		assert.Equal(t, SecretsMap{"DB_PASS": {Tags: []YamlTag{Var}, Path: "db"}}, secrets)
+
+		content := ".requires: [summon-conjur >= 0.7.0]\nprod:\n  DB_PASS: !var db"
+		secrets, err = ParseFromString(content, "prod", nil)
+		assert.NoError(t, err)
+		assert.Equal(t, SecretsMap{"DB_PASS": {Tags: []YamlTag{Var}, Path: "db"}}, secrets)
+		assert.NoError(t, Validate(content))
+	})
+
+	t.Run("Are validated", func(t *testing.T) {
+		assert.EqualError(t, Validate(".requires: {a: b}\nDB_PASS: !var db"),
+			".requires must be a provider version constraint or a list of them (line 1)")
+	})
+}
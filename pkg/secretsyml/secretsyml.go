@@ -7,6 +7,7 @@ import (
 	"os"
 	"regexp"
 	"strconv"
+	"strings"
 
 	"gopkg.in/yaml.v3"
 )
@@ -19,10 +20,23 @@ const (
 	File YamlTag = iota
 	Var
 	Literal
+	// Prompt asks for the value on the terminal, using the value in
+	// secrets.yml as the prompt text
+	Prompt
 )
 
 var defaultValueRegex = regexp.MustCompile(`default='(?P<defaultValue>.*)'`)
 
+// joinRegex matches the separator of a list-valued secret, e.g. join=',' or
+// join='%0A' for a newline (YAML decodes escapes in tags)
+var joinRegex = regexp.MustCompile(`join='(?P<separator>[^']*)'`)
+
+// modifierRegex matches the modifiers that can be chained in tags
+var modifierRegex = regexp.MustCompile(`base64|trim|json=[^:']+`)
+
+// DefaultSeparator joins the items of a list-valued secret without a join tag
+const DefaultSeparator = ","
+
 func (t YamlTag) String() string {
 	switch t {
 	case File:
@@ -31,6 +45,8 @@ func (t YamlTag) String() string {
 		return "Var"
 	case Literal:
 		return "Literal"
+	case Prompt:
+		return "Prompt"
 	default:
 		panic("unreachable!")
 	}
@@ -40,6 +56,14 @@ type SecretSpec struct {
 	Tags         []YamlTag
 	Path         string
 	DefaultValue string
+	// Items are the secrets making up a list-valued secret, whose values are
+	// joined with Separator
+	Items     []SecretSpec
+	Separator string
+	// Modifiers transform the resolved value, in order
+	Modifiers []Modifier
+	// Type is checked against the value once modifiers are applied
+	Type ValueType
 }
 
 func (spec *SecretSpec) IsFile() bool {
@@ -54,10 +78,19 @@ func (spec *SecretSpec) IsLiteral() bool {
 	return tagInSlice(Literal, spec.Tags)
 }
 
+func (spec *SecretSpec) IsPrompt() bool {
+	return tagInSlice(Prompt, spec.Tags)
+}
+
+// IsList reports whether the secret is a list of secrets joined into one value
+func (spec *SecretSpec) IsList() bool {
+	return spec.Items != nil
+}
+
 type SecretsMap map[string]SecretSpec
 
 func (spec *SecretSpec) SetYAML(tag string, value interface{}) error {
-	r, _ := regexp.Compile("(var|file|str|int|bool|float|" + defaultValueRegex.String() + ")")
+	r, _ := regexp.Compile("(var|file|str|int|bool|float|url|prompt|" + modifierRegex.String() + "|" + joinRegex.String() + "|" + defaultValueRegex.String() + ")")
 	tags := r.FindAllString(tag, -1)
 	if len(tags) == 0 {
 		spec.Tags = append(spec.Tags, Literal)
@@ -65,30 +98,52 @@ func (spec *SecretSpec) SetYAML(tag string, value interface{}) error {
 
 	for _, t := range tags {
 		switch {
-		case t == "bool":
-			fallthrough
 		case t == "float":
 			fallthrough
-		case t == "int":
-			fallthrough
 		case t == "str":
 			spec.Tags = append(spec.Tags, Literal)
+		case t == "int":
+			spec.Type = IntValue
+		case t == "bool":
+			spec.Type = BoolValue
+		case t == "url":
+			spec.Type = URLValue
 		case t == "file":
 			spec.Tags = append(spec.Tags, File)
 		case t == "var":
 			spec.Tags = append(spec.Tags, Var)
+		case t == "prompt":
+			spec.Tags = append(spec.Tags, Prompt)
+		case t == ModifierBase64 || t == ModifierTrim || strings.HasPrefix(t, ModifierJSON+"="):
+			s := strings.SplitN(t, "=", 2)
+			modifier := Modifier{Name: s[0]}
+			if len(s) == 2 {
+				modifier.Arg = s[1]
+			}
+			spec.Modifiers = append(spec.Modifiers, modifier)
+		case joinRegex.MatchString(t):
+			spec.Separator = joinRegex.FindStringSubmatch(t)[1]
 		case defaultValueRegex.MatchString(t):
 			match := defaultValueRegex.FindStringSubmatch(t)
 			spec.DefaultValue = match[1]
-
-			if len(tags) == 1 {
-				spec.Tags = append(spec.Tags, Literal)
-			}
 		default:
 			return fmt.Errorf("unknown tag type found!")
 		}
 	}
 
+	// Tags such as default='' or int alone don't change the type of the value
+	if len(spec.Tags) == 0 {
+		spec.Tags = append(spec.Tags, Literal)
+	}
+	// Only values from the provider are checked. On their own, type tags are
+	// plain literals, as are the core YAML tags, e.g. !!int for 8080.
+	if !spec.IsVar() {
+		spec.Type = AnyValue
+	}
+	if spec.Type != AnyValue && spec.IsFile() {
+		return fmt.Errorf("!%s checks the value of a variable, not a file", spec.Type)
+	}
+
 	if s, ok := value.(int); ok {
 		spec.Path = strconv.Itoa(s)
 	} else if s, ok := value.(bool); ok {
@@ -104,25 +159,92 @@ func (spec *SecretSpec) SetYAML(tag string, value interface{}) error {
 	return nil
 }
 
-func (secretMap *SecretsMap) UnmarshalYAML(unmarshal func(interface{}) error) error {
-	*secretMap = SecretsMap{}
+// setList sets a list-valued secret from the items of a YAML sequence. Items
+// without a tag of their own are variables if the list is tagged !var, and
+// literals otherwise.
+func (spec *SecretSpec) setList(tag string, items []*yaml.Node) error {
+	if err := spec.SetYAML(tag, ""); err != nil {
+		return err
+	}
+	if !joinRegex.MatchString(tag) {
+		spec.Separator = DefaultSeparator
+	}
+
+	spec.Items = []SecretSpec{}
+	for i, node := range items {
+		node = resolveAlias(node)
+		if node.Kind != yaml.ScalarNode {
+			return fmt.Errorf("list item %d must be a string, number or boolean", i)
+		}
+		itemTag := node.Tag
+		if node.Style&yaml.TaggedStyle == 0 && spec.IsVar() {
+			itemTag = "!var"
+		}
+		item := SecretSpec{}
+		if err := item.SetYAML(itemTag, node.Value); err != nil {
+			return fmt.Errorf("list item %d: %s", i, err)
+		}
+		if item.IsFile() {
+			return fmt.Errorf("list item %d can't be a file, tag the list with !file instead", i)
+		}
+		// The items are checked, as the joined value is none of these types
+		if item.Type == AnyValue {
+			item.Type = spec.Type
+		}
+		spec.Items = append(spec.Items, item)
+	}
+	spec.Type = AnyValue
+	return nil
+}
+
+// resolveAlias follows a YAML alias (*name) to the node its anchor (&name)
+// is on, so that the alias gets the same tags
+func resolveAlias(node *yaml.Node) *yaml.Node {
+	for node.Kind == yaml.AliasNode && node.Alias != nil {
+		node = node.Alias
+	}
+	return node
+}
+
+// setNode sets the secret from its YAML node, a scalar or a list
+func (spec *SecretSpec) setNode(node *yaml.Node) error {
+	node = resolveAlias(node)
+	if node.Kind == yaml.SequenceNode {
+		return spec.setList(node.Tag, node.Content)
+	}
+	return spec.SetYAML(node.Tag, node.Value)
+}
 
+func (secretMap *SecretsMap) UnmarshalYAML(unmarshal func(interface{}) error) error {
 	m := map[string]yaml.Node{}
 	if err := unmarshal(&m); err != nil {
 		return err
 	}
 
-	for k, v := range m {
+	secrets, err := secretsFromNodes(m)
+	if err != nil {
+		return err
+	}
+	*secretMap = secrets
+	return nil
+}
+
+// secretsFromNodes sets the secrets from their YAML nodes
+func secretsFromNodes(nodes map[string]yaml.Node) (SecretsMap, error) {
+	secrets := SecretsMap{}
+	for k, v := range nodes {
+		if k == ProviderKey {
+			continue
+		}
 		spec := SecretSpec{}
-		err := spec.SetYAML(v.Tag, v.Value)
+		err := spec.setNode(&v)
 		if err != nil {
-			return err
+			return nil, err
 		}
 
-		(*secretMap)[k] = spec
+		secrets[k] = spec
 	}
-
-	return nil
+	return secrets, nil
 }
 
 // ParseFromString parses a string in secrets.yml format to a map.
@@ -139,6 +261,137 @@ func ParseFromFile(filepath, env string, subs map[string]string) (SecretsMap, er
 	return parse(string(data), env, subs)
 }
 
+// ParseFromPairs parses secrets given as NAME=VALUE pairs, e.g. on the command
+// line. VALUE is a secret path, or tags and a value as in secrets.yml (e.g.
+// "!var:file path/to/cert" or "!str literal").
+func ParseFromPairs(pairs []string, subs map[string]string) (SecretsMap, error) {
+	out := make(SecretsMap)
+
+	for _, pair := range pairs {
+		s := strings.SplitN(pair, "=", 2)
+		if len(s) != 2 || s[0] == "" {
+			return nil, fmt.Errorf("secret %q is not in NAME=VALUE format", pair)
+		}
+		key, value := s[0], s[1]
+
+		tag := "!var"
+		if strings.HasPrefix(value, "!") {
+			s = strings.SplitN(value, " ", 2)
+			tag, value = s[0], ""
+			if len(s) == 2 {
+				value = s[1]
+			}
+		}
+
+		spec := SecretSpec{}
+		if err := spec.SetYAML(tag, value); err != nil {
+			return nil, fmt.Errorf("secret %s: %s", key, err)
+		}
+		if err := spec.applySubstitutions(subs); err != nil {
+			return nil, err
+		}
+		out[key] = spec
+	}
+
+	return out, nil
+}
+
+// Validate checks that content is in secrets.yml format, with or without
+// environment sections, without applying substitutions.
+func Validate(content string) error {
+	document := map[string]yaml.Node{}
+	if err := yaml.Unmarshal([]byte(content), &document); err != nil {
+		return err
+	}
+	return validateDocument(document)
+}
+
+// validateDocument checks the top-level entries of a secrets file, whatever
+// its format
+func validateDocument(document map[string]yaml.Node) error {
+	if _, err := defaultSubstitutions(document); err != nil {
+		return err
+	}
+	if _, err := requirements(document); err != nil {
+		return err
+	}
+	if _, err := provider(document, ""); err != nil {
+		return err
+	}
+	nodes := withoutReservedKeys(document)
+
+	// Either every top-level value is a section, or none is
+	sections := 0
+	for _, node := range nodes {
+		if resolveAlias(&node).Kind == yaml.MappingNode {
+			sections++
+		}
+	}
+	if sections == 0 {
+		return validateSecrets(nodes)
+	}
+	if sections != len(nodes) {
+		return fmt.Errorf("secrets file mixes environment sections with top-level secrets")
+	}
+
+	for name, node := range nodes {
+		secrets := map[string]yaml.Node{}
+		if err := node.Decode(&secrets); err != nil {
+			return fmt.Errorf("section %s: %s", name, err)
+		}
+		if err := validateSecrets(secrets); err != nil {
+			return fmt.Errorf("section %s: %s", name, err)
+		}
+		if _, err := provider(document, name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func validateSecrets(nodes map[string]yaml.Node) error {
+	for key, node := range nodes {
+		if key == ProviderKey {
+			continue
+		}
+		node := resolveAlias(&node)
+		if node.Kind != yaml.ScalarNode && node.Kind != yaml.SequenceNode {
+			return fmt.Errorf("secret %s: value must be a string, number, boolean or list (line %d)", key, node.Line)
+		}
+		spec := SecretSpec{}
+		if err := spec.setNode(node); err != nil {
+			return fmt.Errorf("secret %s: %s (line %d)", key, err, node.Line)
+		}
+	}
+	return nil
+}
+
+// topLevelNodes returns the top-level entries of content, secrets or
+// environment sections, leaving out the keys that are neither
+func topLevelNodes(content string) (map[string]yaml.Node, error) {
+	nodes := map[string]yaml.Node{}
+	if err := yaml.Unmarshal([]byte(content), &nodes); err != nil {
+		return nil, err
+	}
+	return withoutReservedKeys(nodes), nil
+}
+
+// withoutReservedKeys returns the entries of nodes but the reserved keys
+// starting with a dot
+func withoutReservedKeys(nodes map[string]yaml.Node) map[string]yaml.Node {
+	out := make(map[string]yaml.Node, len(nodes))
+	for key, node := range nodes {
+		if !isReservedKey(key) {
+			out[key] = node
+		}
+	}
+	return out
+}
+
+func isReservedKey(key string) bool {
+	return key == SubstitutionsKey || key == RequiresKey || key == ProviderKey
+}
+
 // Wrapper for parsing yaml contents
 func parse(ymlContent, env string, subs map[string]string) (SecretsMap, error) {
 	if env == "" {
@@ -152,7 +405,15 @@ func parse(ymlContent, env string, subs map[string]string) (SecretsMap, error) {
 func parseEnvironment(ymlContent, env string, subs map[string]string) (SecretsMap, error) {
 	out := make(map[string]SecretsMap)
 
-	if err := yaml.Unmarshal([]byte(ymlContent), &out); err != nil {
+	nodes, err := topLevelNodes(ymlContent)
+	for name, node := range nodes {
+		section := SecretsMap{}
+		if err = node.Decode(&section); err != nil {
+			break
+		}
+		out[name] = section
+	}
+	if err != nil {
 		// Check if the error is due to there being no environment sections
 		if _, err = parseRegular(ymlContent, subs); err == nil {
 			// If a regular parse is successful, then the error is due to the environment not existing
@@ -207,9 +468,13 @@ func parseAndMergeCommon(out, secretsMap SecretsMap, subs map[string]string) (Se
 
 // Parse a secrets yaml that has no environment sections
 func parseRegular(ymlContent string, subs map[string]string) (SecretsMap, error) {
-	out := make(SecretsMap)
+	nodes, err := topLevelNodes(ymlContent)
+	if err != nil {
+		return nil, err
+	}
 
-	if err := yaml.Unmarshal([]byte(ymlContent), &out); err != nil {
+	out, err := secretsFromNodes(nodes)
+	if err != nil {
 		return nil, err
 	}
 
@@ -226,25 +491,24 @@ func parseRegular(ymlContent string, subs map[string]string) (SecretsMap, error)
 }
 
 func (spec *SecretSpec) applySubstitutions(subs map[string]string) error {
-	VAR_REGEX := regexp.MustCompile(`\$(\$|\w+)`)
-	var substitutionError error
-
-	subFunc := func(variable string) string {
-		variable = variable[1:]
-		if variable == "$" {
-			return "$"
-		}
+	lookup := func(variable string) (string, error) {
 		text, ok := subs[variable]
-		if ok {
-			return text
-		} else {
-			substitutionError = fmt.Errorf("variable %v not declared", variable)
-			return ""
+		if !ok {
+			return "", fmt.Errorf("variable %v not declared", variable)
 		}
+		return text, nil
 	}
 
-	spec.Path = VAR_REGEX.ReplaceAllStringFunc(spec.Path, subFunc)
-	return substitutionError
+	var err error
+	if spec.Path, err = expand(spec.Path, lookup); err != nil {
+		return err
+	}
+	for i := range spec.Items {
+		if spec.Items[i].Path, err = expand(spec.Items[i].Path, lookup); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
 // tagInSlice determines whether a YamlTag is in a list of YamlTag
@@ -0,0 +1,96 @@
+package secretsyml
+
+import (
+	"testing"
+)
+
+// Inputs that have crashed the fuzzers below are recorded by `go test -fuzz`
+// under testdata/fuzz/<FuzzName>/ and are replayed by every plain `go test`
+// run, so a fixed crash stays fixed.
+
+func FuzzParseFromString(f *testing.F) {
+	seeds := []struct {
+		content string
+		env     string
+	}{
+		{"SENTRY_API_KEY: !var $env/sentry/api_key", ""},
+		{"PRIVATE_KEY_FILE: !var:file $env/aws/ec2/private_key", ""},
+		{"DEFAULT_VAR: !var:default='defaultvalue':file $env/sentry/api_key", ""},
+		{"SOME_ESCAPING_VAR: FOO$$BAR\nINT: 27\nFLOAT: 27.1111\nBOOL: true", ""},
+		{"EMPTY_VAR:", ""},
+		{"common:\n  A: a\nprod:\n  B: !var $env/b", "prod"},
+		{"prod:\n  A: !file content", "missing"},
+		{"A: [1, 2]", ""},
+		{"A: {b: c}", ""},
+		{"- a\n- b", ""},
+		{"A: !unknown value", ""},
+		{"A: &x !var path\nB: *x", ""},
+	}
+	for _, seed := range seeds {
+		f.Add(seed.content, seed.env)
+	}
+
+	f.Fuzz(func(t *testing.T, content, env string) {
+		secrets, err := ParseFromString(content, env, map[string]string{"env": "prod"})
+		if err != nil {
+			return
+		}
+		for _, spec := range secrets {
+			for _, tag := range spec.Tags {
+				_ = tag.String()
+			}
+		}
+	})
+}
+
+func FuzzSetYAML(f *testing.F) {
+	for _, tag := range []string{
+		"",
+		"!var",
+		"!file",
+		"!var:file",
+		"!file:var",
+		"!str",
+		"!int",
+		"!default='x'",
+		"!var:default='':file",
+		"!var:default='a:b'",
+		"!!str",
+		"!bogus",
+	} {
+		f.Add(tag, "path/to/secret")
+	}
+
+	f.Fuzz(func(t *testing.T, tag, value string) {
+		spec := SecretSpec{}
+		if err := spec.SetYAML(tag, value); err != nil {
+			return
+		}
+		if len(spec.Tags) == 0 {
+			t.Fatalf("tag %q produced a spec without any tags", tag)
+		}
+		for _, yamlTag := range spec.Tags {
+			_ = yamlTag.String()
+		}
+	})
+}
+
+func FuzzApplySubstitutions(f *testing.F) {
+	for _, path := range []string{
+		"",
+		"$env/db/password",
+		"FOO$$BAR",
+		"$",
+		"$$",
+		"$$$env",
+		"$undeclared/path",
+		"prefix-$env-suffix",
+	} {
+		f.Add(path, "prod")
+	}
+
+	f.Fuzz(func(t *testing.T, path, value string) {
+		spec := SecretSpec{Path: path}
+		_ = spec.applySubstitutions(map[string]string{"env": value})
+	})
+}
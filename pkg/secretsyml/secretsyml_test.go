@@ -234,6 +234,178 @@ TestEnvironment:
 	})
 }
 
+func TestParseFromPairs(t *testing.T) {
+	t.Run("Given NAME=VALUE pairs", func(t *testing.T) {
+		pairs := []string{
+			"DB_PASS=$env/db/password",
+			"SSL_CERT=!var:file $env/ssl/cert",
+			"RAILS_ENV=!str $env",
+			"EQUALS_IN_PATH=path/with=sign",
+		}
+		testCases := []testCase{
+			{name: "DB_PASS", path: "prod/db/password", isVar: true},
+			{name: "SSL_CERT", path: "prod/ssl/cert", isVar: true, isFile: true},
+			{name: "RAILS_ENV", path: "prod", isLiteral: true},
+			{name: "EQUALS_IN_PATH", path: "path/with=sign", isVar: true},
+		}
+
+		t.Run("It should default to variables and honour tags", func(t *testing.T) {
+			parsed, err := ParseFromPairs(pairs, map[string]string{"env": "prod"})
+			assert.NoError(t, err)
+			assert.Len(t, parsed, len(testCases))
+
+			validateTestCases(t, testCases, parsed)
+		})
+	})
+
+	t.Run("Given a malformed pair", func(t *testing.T) {
+		_, err := ParseFromPairs([]string{"DB_PASS"}, nil)
+		assert.EqualError(t, err, `secret "DB_PASS" is not in NAME=VALUE format`)
+	})
+
+	t.Run("Given an undeclared substitution", func(t *testing.T) {
+		_, err := ParseFromPairs([]string{"DB_PASS=$env/db"}, nil)
+		assert.EqualError(t, err, "variable env not declared")
+	})
+}
+
+func TestListSecrets(t *testing.T) {
+	t.Run("Items of a !var list are variables unless tagged", func(t *testing.T) {
+		parsed, err := ParseFromString(`
+DB_HOSTS: !var:join=';'
+  - $env/db1/host
+  - !str db2.example.com
+  - !var:default='db3.example.com' $env/db3/host
+`, "", map[string]string{"env": "prod"})
+		assert.NoError(t, err)
+
+		spec := parsed["DB_HOSTS"]
+		assert.True(t, spec.IsList())
+		assert.True(t, spec.IsVar())
+		assert.Equal(t, ";", spec.Separator)
+		assert.Equal(t, []SecretSpec{
+			{Tags: []YamlTag{Var}, Path: "prod/db1/host"},
+			{Tags: []YamlTag{Literal}, Path: "db2.example.com"},
+			{Tags: []YamlTag{Var}, Path: "prod/db3/host", DefaultValue: "db3.example.com"},
+		}, spec.Items)
+	})
+
+	t.Run("Items of an untagged list are literals, joined with commas", func(t *testing.T) {
+		parsed, err := ParseFromString("HOSTS: [a.example.com, 8080, !var b/host]\n", "", nil)
+		assert.NoError(t, err)
+
+		spec := parsed["HOSTS"]
+		assert.Equal(t, DefaultSeparator, spec.Separator)
+		assert.Equal(t, []SecretSpec{
+			{Tags: []YamlTag{Literal}, Path: "a.example.com"},
+			{Tags: []YamlTag{Literal}, Path: "8080"},
+			{Tags: []YamlTag{Var}, Path: "b/host"},
+		}, spec.Items)
+	})
+
+	t.Run("Files are joined into one file", func(t *testing.T) {
+		parsed, err := ParseFromString("CA_BUNDLE: !var:file:join='%0A' [ca/root, ca/intermediate]\n", "", nil)
+		assert.NoError(t, err)
+
+		spec := parsed["CA_BUNDLE"]
+		assert.True(t, spec.IsFile())
+		assert.Equal(t, "\n", spec.Separator)
+		assert.Len(t, spec.Items, 2)
+	})
+}
+
+func TestAnchors(t *testing.T) {
+	t.Run("Aliases keep the tags of their anchor", func(t *testing.T) {
+		parsed, err := ParseFromString(`
+DB_PASS: &password !var:default='none' $env/db/password
+LEGACY_DB_PASS: *password
+HOSTS: &hosts !var [$env/db1, $env/db2]
+READ_HOSTS: *hosts
+BACKUP_HOSTS: [*password, !str backup.example.com]
+`, "", map[string]string{"env": "prod"})
+		assert.NoError(t, err)
+
+		assert.Equal(t, parsed["DB_PASS"], parsed["LEGACY_DB_PASS"])
+		assert.Equal(t, SecretSpec{Tags: []YamlTag{Var}, Path: "prod/db/password", DefaultValue: "none"},
+			parsed["LEGACY_DB_PASS"])
+		assert.Equal(t, parsed["HOSTS"], parsed["READ_HOSTS"])
+		assert.Equal(t, []SecretSpec{
+			{Tags: []YamlTag{Var}, Path: "prod/db/password", DefaultValue: "none"},
+			{Tags: []YamlTag{Literal}, Path: "backup.example.com"},
+		}, parsed["BACKUP_HOSTS"].Items)
+	})
+
+	t.Run("Merge keys bring in shared blocks", func(t *testing.T) {
+		input := `
+.db: &db
+  DB_USER: !var $env/db/user
+  DB_PASS: !var:file $env/db/password
+staging:
+  <<: *db
+production:
+  <<: *db
+  DB_PASS: !var prod/db/rotated-password
+`
+		assert.NoError(t, Validate(input))
+
+		staging, err := ParseFromString(input, "staging", map[string]string{"env": "staging"})
+		assert.NoError(t, err)
+		assert.Equal(t, SecretsMap{
+			"DB_USER": {Tags: []YamlTag{Var}, Path: "staging/db/user"},
+			"DB_PASS": {Tags: []YamlTag{Var, File}, Path: "staging/db/password"},
+		}, staging)
+
+		production, err := ParseFromString(input, "production", map[string]string{"env": "prod"})
+		assert.NoError(t, err)
+		assert.Equal(t, SecretsMap{
+			"DB_USER": {Tags: []YamlTag{Var}, Path: "prod/db/user"},
+			"DB_PASS": {Tags: []YamlTag{Var}, Path: "prod/db/rotated-password"},
+		}, production)
+	})
+
+	t.Run("Whole sections can be aliased", func(t *testing.T) {
+		input := "staging: &staging\n  A: !var a\nqa: *staging\n"
+		assert.NoError(t, Validate(input))
+
+		parsed, err := ParseFromString(input, "qa", nil)
+		assert.NoError(t, err)
+		assert.Equal(t, SecretsMap{"A": {Tags: []YamlTag{Var}, Path: "a"}}, parsed)
+	})
+}
+
+func TestValidate(t *testing.T) {
+	t.Run("Given valid secrets.yml content", func(t *testing.T) {
+		for _, input := range []string{
+			"",
+			"DB_PASS: !var $env/db/password\nRAILS_ENV: $env",
+			"common:\n  A: !var a\nproduction:\n  B: !var:file $env/b\n",
+		} {
+			assert.NoError(t, Validate(input))
+		}
+	})
+
+	t.Run("Given invalid YAML", func(t *testing.T) {
+		assert.Error(t, Validate("DB_PASS: !var [unterminated"))
+	})
+
+	t.Run("Given a secret that isn't a scalar or list", func(t *testing.T) {
+		err := Validate("production:\n  DB_PASS:\n    user: a\n")
+		assert.EqualError(t, err,
+			"section production: secret DB_PASS: value must be a string, number, boolean or list (line 3)")
+	})
+
+	t.Run("Given a list with a file item", func(t *testing.T) {
+		err := Validate("CA_BUNDLE:\n  - !var:file ca/root\n")
+		assert.EqualError(t, err,
+			"secret CA_BUNDLE: list item 0 can't be a file, tag the list with !file instead (line 2)")
+	})
+
+	t.Run("Given sections mixed with secrets", func(t *testing.T) {
+		err := Validate("A: !var a\nproduction:\n  B: !var b\n")
+		assert.EqualError(t, err, "secrets file mixes environment sections with top-level secrets")
+	})
+}
+
 func validateTestCases(t *testing.T, testCases []testCase, parsed SecretsMap) {
 	for _, tc := range testCases {
 		t.Run(tc.name, func(t *testing.T) {
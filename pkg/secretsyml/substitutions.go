@@ -0,0 +1,154 @@
+package secretsyml
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// SubstitutionsKey is the top-level key of secrets.yml declaring default
+// values of substitutions, used for those not given with -D
+const SubstitutionsKey = ".substitutions"
+
+// DefaultSubstitutions returns the default values of substitutions declared
+// in content under SubstitutionsKey. Content that isn't valid secrets.yml has
+// none; parsing it tells why.
+func DefaultSubstitutions(content string) (map[string]string, error) {
+	nodes := map[string]yaml.Node{}
+	if err := yaml.Unmarshal([]byte(content), &nodes); err != nil {
+		return nil, nil
+	}
+	return defaultSubstitutions(nodes)
+}
+
+func defaultSubstitutions(nodes map[string]yaml.Node) (map[string]string, error) {
+	node, ok := nodes[SubstitutionsKey]
+	if !ok {
+		return nil, nil
+	}
+
+	subs := map[string]string{}
+	if err := node.Decode(&subs); err != nil {
+		return nil, fmt.Errorf("%s must map names to values (line %d)", SubstitutionsKey, node.Line)
+	}
+	return subs, nil
+}
+
+// ResolveSubstitutions returns the values of subs with the references they
+// make, as $name or ${name}, replaced: by the value of the substitution of
+// that name, or else of the environment variable found with lookupEnv. $$ is
+// a literal $.
+func ResolveSubstitutions(subs map[string]string, lookupEnv func(string) (string, bool)) (map[string]string, error) {
+	r := &resolver{subs: subs, lookupEnv: lookupEnv, resolved: map[string]string{}}
+
+	// In order, so that the same error is reported every time
+	names := make([]string, 0, len(subs))
+	for name := range subs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		if _, err := r.resolve(name); err != nil {
+			return nil, err
+		}
+	}
+	return r.resolved, nil
+}
+
+type resolver struct {
+	subs      map[string]string
+	lookupEnv func(string) (string, bool)
+	resolved  map[string]string
+	// resolving are the substitutions being resolved, each referring to the
+	// next one
+	resolving []string
+}
+
+func (r *resolver) resolve(name string) (string, error) {
+	if value, ok := r.resolved[name]; ok {
+		return value, nil
+	}
+	for i, resolving := range r.resolving {
+		if resolving == name {
+			cycle := append(append([]string{}, r.resolving[i:]...), name)
+			return "", fmt.Errorf("substitution %s refers to itself: %s", name, strings.Join(cycle, " -> "))
+		}
+	}
+
+	r.resolving = append(r.resolving, name)
+	value, err := expand(r.subs[name], func(ref string) (string, error) {
+		if _, ok := r.subs[ref]; ok {
+			return r.resolve(ref)
+		}
+		if value, ok := r.lookupEnv(ref); ok {
+			return value, nil
+		}
+		return "", fmt.Errorf("substitution %s: $%s is neither a substitution nor an environment variable (write $$ for a literal $)", name, ref)
+	})
+	r.resolving = r.resolving[:len(r.resolving)-1]
+	if err != nil {
+		return "", err
+	}
+
+	r.resolved[name] = value
+	return value, nil
+}
+
+// expand replaces $name and ${name} in text with the value lookup returns
+// for name, and $$ with $. A $ followed by anything else is kept as is.
+func expand(text string, lookup func(name string) (string, error)) (string, error) {
+	var out strings.Builder
+	for i := 0; i < len(text); i++ {
+		if text[i] != '$' || i+1 == len(text) {
+			out.WriteByte(text[i])
+			continue
+		}
+
+		var name string
+		switch {
+		case text[i+1] == '$':
+			out.WriteByte('$')
+			i++
+			continue
+		case text[i+1] == '{':
+			end := strings.IndexByte(text[i+2:], '}')
+			if end < 0 {
+				return "", fmt.Errorf("missing } after ${ in %q", text)
+			}
+			name = text[i+2 : i+2+end]
+			if name == "" || wordLength(name) != len(name) {
+				return "", fmt.Errorf("invalid variable name %q in %q", name, text)
+			}
+			i += 2 + end
+		default:
+			n := wordLength(text[i+1:])
+			if n == 0 {
+				out.WriteByte('$')
+				continue
+			}
+			name = text[i+1 : i+1+n]
+			i += n
+		}
+
+		value, err := lookup(name)
+		if err != nil {
+			return "", err
+		}
+		out.WriteString(value)
+	}
+	return out.String(), nil
+}
+
+// wordLength returns the length of the letters, digits and underscores s
+// starts with
+func wordLength(s string) int {
+	for i, c := range []byte(s) {
+		if c != '_' && !('a' <= c && c <= 'z') && !('A' <= c && c <= 'Z') && !('0' <= c && c <= '9') {
+			return i
+		}
+	}
+	return len(s)
+}
@@ -0,0 +1,116 @@
+package secretsyml
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestResolveSubstitutions(t *testing.T) {
+	lookupEnv := func(name string) (string, bool) {
+		value, ok := map[string]string{"DEPLOY_ENV": "prod", "region": "from-env"}[name]
+		return value, ok
+	}
+
+	t.Run("Resolves references to other substitutions", func(t *testing.T) {
+		subs, err := ResolveSubstitutions(map[string]string{
+			"region": "us-east-1",
+			"path":   "apps/$region/db",
+			"url":    "https://${path}v2",
+		}, lookupEnv)
+		assert.NoError(t, err)
+		assert.Equal(t, map[string]string{
+			"region": "us-east-1",
+			"path":   "apps/us-east-1/db",
+			"url":    "https://apps/us-east-1/dbv2",
+		}, subs)
+	})
+
+	t.Run("Falls back to environment variables", func(t *testing.T) {
+		subs, err := ResolveSubstitutions(map[string]string{"env": "$DEPLOY_ENV/${DEPLOY_ENV}"}, lookupEnv)
+		assert.NoError(t, err)
+		assert.Equal(t, map[string]string{"env": "prod/prod"}, subs)
+	})
+
+	t.Run("Keeps literal dollars", func(t *testing.T) {
+		subs, err := ResolveSubstitutions(map[string]string{"price": "$$5 $-", "end": "a$"}, lookupEnv)
+		assert.NoError(t, err)
+		assert.Equal(t, map[string]string{"price": "$5 $-", "end": "a$"}, subs)
+	})
+
+	t.Run("Fails on unknown references", func(t *testing.T) {
+		_, err := ResolveSubstitutions(map[string]string{"path": "apps/$zone"}, lookupEnv)
+		assert.EqualError(t, err,
+			"substitution path: $zone is neither a substitution nor an environment variable (write $$ for a literal $)")
+	})
+
+	t.Run("Fails on cycles", func(t *testing.T) {
+		_, err := ResolveSubstitutions(map[string]string{
+			"a": "$b",
+			"b": "x/$c",
+			"c": "${a}",
+		}, lookupEnv)
+		assert.EqualError(t, err, "substitution a refers to itself: a -> b -> c -> a")
+
+		// A substitution shadows the environment variable of the same name
+		_, err = ResolveSubstitutions(map[string]string{"region": "$region"}, lookupEnv)
+		assert.EqualError(t, err, "substitution region refers to itself: region -> region")
+	})
+
+	t.Run("Fails on malformed references", func(t *testing.T) {
+		_, err := ResolveSubstitutions(map[string]string{"path": "${region"}, lookupEnv)
+		assert.EqualError(t, err, `missing } after ${ in "${region"`)
+
+		_, err = ResolveSubstitutions(map[string]string{"path": "${re-gion}"}, lookupEnv)
+		assert.EqualError(t, err, `invalid variable name "re-gion" in "${re-gion}"`)
+	})
+}
+
+func TestDefaultSubstitutions(t *testing.T) {
+	t.Run("Returns the declared defaults", func(t *testing.T) {
+		subs, err := DefaultSubstitutions(`
+.substitutions:
+  region: us-east-1
+  port: 5432
+DB_PASS: !var $region/db`)
+		assert.NoError(t, err)
+		assert.Equal(t, map[string]string{"region": "us-east-1", "port": "5432"}, subs)
+	})
+
+	t.Run("Returns none without declarations", func(t *testing.T) {
+		for _, content := range []string{"", "DB_PASS: !var db", "not: [valid"} {
+			subs, err := DefaultSubstitutions(content)
+			assert.NoError(t, err)
+			assert.Nil(t, subs)
+		}
+	})
+
+	t.Run("Fails unless names map to values", func(t *testing.T) {
+		_, err := DefaultSubstitutions(".substitutions:\n  region: [a, b]")
+		assert.EqualError(t, err, ".substitutions must map names to values (line 2)")
+	})
+}
+
+func TestParseWithDefaultSubstitutions(t *testing.T) {
+	subs := map[string]string{"region": "eu"}
+
+	t.Run("Aren't secrets", func(t *testing.T) {
+		secrets, err := ParseFromString(".substitutions:\n  region: us\nDB_PASS: !var $region/db", "", subs)
+		assert.NoError(t, err)
+		assert.Equal(t, SecretsMap{"DB_PASS": {Tags: []YamlTag{Var}, Path: "eu/db"}}, secrets)
+	})
+
+	t.Run("Aren't an environment", func(t *testing.T) {
+		content := ".substitutions:\n  region: us\nprod:\n  DB_PASS: !var $region/db"
+		secrets, err := ParseFromString(content, "prod", subs)
+		assert.NoError(t, err)
+		assert.Equal(t, SecretsMap{"DB_PASS": {Tags: []YamlTag{Var}, Path: "eu/db"}}, secrets)
+		assert.NoError(t, Validate(content))
+	})
+
+	t.Run("Are validated", func(t *testing.T) {
+		assert.NoError(t, Validate(".substitutions:\n  region: us\nDB_PASS: !var $region/db"))
+		assert.EqualError(t, Validate(".substitutions: us\nDB_PASS: !var db"),
+			".substitutions must map names to values (line 1)")
+	})
+}
@@ -0,0 +1,405 @@
+package secretsyml
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"gopkg.in/yaml.v3"
+)
+
+var (
+	tomlBareKeyRegex  = regexp.MustCompile(`^[A-Za-z0-9_-]+`)
+	tomlIntegerRegex  = regexp.MustCompile(`^[+-]?(0|[1-9](_?[0-9])*)$`)
+	tomlPrefixedRegex = regexp.MustCompile(`^0(x[0-9A-Fa-f](_?[0-9A-Fa-f])*|o[0-7](_?[0-7])*|b[01](_?[01])*)$`)
+	tomlFloatRegex    = regexp.MustCompile(`^[+-]?(0|[1-9](_?[0-9])*)(\.[0-9](_?[0-9])*)?([eE][+-]?[0-9](_?[0-9])*)?$|^[+-]?(inf|nan)$`)
+	// Dates and times are kept as strings, like in secrets.yml
+	tomlDateTimeRegex = regexp.MustCompile(`^(\d{4}-\d{2}-\d{2}([Tt]\d{2}:\d{2}:\d{2}(\.\d+)?([Zz]|[+-]\d{2}:\d{2})?)?|\d{2}:\d{2}:\d{2}(\.\d+)?)$`)
+)
+
+// decodeTOML decodes a secrets file in TOML to the document secrets.yml would
+// be decoded to, keeping the order of keys and their lines. Tables are
+// environment sections, or the map of .substitutions; arrays of tables have
+// no use in secrets files and aren't supported.
+func decodeTOML(content string) (*yaml.Node, error) {
+	p := &tomlParser{src: content, line: 1}
+	root := &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map", Line: 1}
+	table := root
+	// Tables defined by a header, which may not be defined again
+	defined := map[*yaml.Node]bool{}
+
+	for {
+		p.skipBlank(true)
+		if p.eof() {
+			return root, nil
+		}
+
+		if p.peek() == '[' {
+			p.pos++
+			if p.peek() == '[' {
+				return nil, p.errorf("arrays of tables are not supported")
+			}
+			keys, err := p.keys()
+			if err != nil {
+				return nil, err
+			}
+			if !p.consume(']') {
+				return nil, p.errorf("expected ] after table name")
+			}
+			if table, err = p.table(root, keys); err != nil {
+				return nil, err
+			}
+			if defined[table] {
+				return nil, p.errorf("table %s is defined twice", joinKeys(keys))
+			}
+			defined[table] = true
+		} else if err := p.keyValue(table); err != nil {
+			return nil, err
+		}
+
+		p.skipBlank(false)
+		if !p.eof() && !p.consume('\n') {
+			return nil, p.errorf("expected the end of the line")
+		}
+	}
+}
+
+type tomlParser struct {
+	src  string
+	pos  int
+	line int
+}
+
+func (p *tomlParser) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("%s (line %d)", fmt.Sprintf(format, args...), p.line)
+}
+
+func (p *tomlParser) eof() bool {
+	return p.pos >= len(p.src)
+}
+
+func (p *tomlParser) peek() byte {
+	if p.eof() {
+		return 0
+	}
+	return p.src[p.pos]
+}
+
+func (p *tomlParser) consume(c byte) bool {
+	if p.peek() != c {
+		return false
+	}
+	p.pos++
+	if c == '\n' {
+		p.line++
+	}
+	return true
+}
+
+// skipBlank skips spaces, tabs and comments, and newlines too if newlines is
+// set
+func (p *tomlParser) skipBlank(newlines bool) {
+	for !p.eof() {
+		switch c := p.peek(); {
+		case c == ' ' || c == '\t' || c == '\r':
+			p.pos++
+		case c == '\n' && newlines:
+			p.consume('\n')
+		case c == '#':
+			for !p.eof() && p.peek() != '\n' {
+				p.pos++
+			}
+		default:
+			return
+		}
+	}
+}
+
+// keys parses a key, dotted keys giving several
+func (p *tomlParser) keys() ([]*yaml.Node, error) {
+	var keys []*yaml.Node
+	for {
+		p.skipBlank(false)
+		line := p.line
+		var key string
+		switch p.peek() {
+		case '"', '\'':
+			value, err := p.string()
+			if err != nil {
+				return nil, err
+			}
+			key = value.Value
+		default:
+			key = tomlBareKeyRegex.FindString(p.src[p.pos:])
+			if key == "" {
+				return nil, p.errorf("expected a key")
+			}
+			p.pos += len(key)
+		}
+		keys = append(keys, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: key, Line: line})
+
+		p.skipBlank(false)
+		if !p.consume('.') {
+			return keys, nil
+		}
+	}
+}
+
+// table returns the table at the path keys from root, creating the missing
+// ones
+func (p *tomlParser) table(root *yaml.Node, keys []*yaml.Node) (*yaml.Node, error) {
+	table := root
+	for i, key := range keys {
+		next := mappingValue(table, key.Value)
+		if next == nil {
+			next = &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map", Line: key.Line}
+			table.Content = append(table.Content, key, next)
+		} else if next.Kind != yaml.MappingNode {
+			return nil, p.errorf("key %s is already defined", joinKeys(keys[:i+1]))
+		}
+		table = next
+	}
+	return table, nil
+}
+
+// keyValue parses key = value into table
+func (p *tomlParser) keyValue(table *yaml.Node) error {
+	keys, err := p.keys()
+	if err != nil {
+		return err
+	}
+	if !p.consume('=') {
+		return p.errorf("expected = after key %s", joinKeys(keys))
+	}
+	p.skipBlank(false)
+	value, err := p.value()
+	if err != nil {
+		return err
+	}
+
+	last := len(keys) - 1
+	if table, err = p.table(table, keys[:last]); err != nil {
+		return err
+	}
+	if mappingValue(table, keys[last].Value) != nil {
+		return p.errorf("key %s is defined twice", joinKeys(keys))
+	}
+	table.Content = append(table.Content, keys[last], value)
+	return nil
+}
+
+func (p *tomlParser) value() (*yaml.Node, error) {
+	switch p.peek() {
+	case '"', '\'':
+		return p.string()
+	case '[':
+		return p.array()
+	case '{':
+		return p.inlineTable()
+	}
+
+	line := p.line
+	end := p.pos
+	for end < len(p.src) && strings.IndexByte("+-.:_0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz", p.src[end]) >= 0 {
+		end++
+	}
+	token := p.src[p.pos:end]
+	p.pos = end
+
+	node := &yaml.Node{Kind: yaml.ScalarNode, Value: token, Line: line}
+	switch {
+	case token == "true" || token == "false":
+		node.Tag = "!!bool"
+	case tomlIntegerRegex.MatchString(token):
+		node.Tag = "!!int"
+		node.Value = strings.TrimPrefix(strings.ReplaceAll(token, "_", ""), "+")
+	case tomlPrefixedRegex.MatchString(token):
+		n, err := strconv.ParseInt(token, 0, 64)
+		if err != nil {
+			return nil, p.errorf("invalid integer %s", token)
+		}
+		node.Tag = "!!int"
+		node.Value = strconv.FormatInt(n, 10)
+	case tomlFloatRegex.MatchString(token):
+		node.Tag = "!!float"
+		node.Value = strings.TrimPrefix(strings.ReplaceAll(token, "_", ""), "+")
+	case tomlDateTimeRegex.MatchString(token):
+		node.Tag = "!!str"
+	case token == "":
+		return nil, p.errorf("expected a value")
+	default:
+		return nil, p.errorf("invalid value %s", token)
+	}
+	return node, nil
+}
+
+func (p *tomlParser) array() (*yaml.Node, error) {
+	array := &yaml.Node{Kind: yaml.SequenceNode, Tag: "!!seq", Line: p.line}
+	p.consume('[')
+	for {
+		p.skipBlank(true)
+		if p.consume(']') {
+			return array, nil
+		}
+		item, err := p.value()
+		if err != nil {
+			return nil, err
+		}
+		array.Content = append(array.Content, item)
+
+		p.skipBlank(true)
+		if !p.consume(',') {
+			p.skipBlank(true)
+			if !p.consume(']') {
+				return nil, p.errorf("expected , or ] in array")
+			}
+			return array, nil
+		}
+	}
+}
+
+func (p *tomlParser) inlineTable() (*yaml.Node, error) {
+	table := &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map", Line: p.line}
+	p.consume('{')
+	p.skipBlank(false)
+	if p.consume('}') {
+		return table, nil
+	}
+	for {
+		if err := p.keyValue(table); err != nil {
+			return nil, err
+		}
+		p.skipBlank(false)
+		if p.consume('}') {
+			return table, nil
+		}
+		if !p.consume(',') {
+			return nil, p.errorf("expected , or } in inline table")
+		}
+	}
+}
+
+// string parses a basic ("...") or literal ('...') string, on one line or,
+// with triple quotes, on several
+func (p *tomlParser) string() (*yaml.Node, error) {
+	node := &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Line: p.line}
+	quote := p.src[p.pos : p.pos+1]
+	literal := quote == "'"
+	delimiter := quote
+	if strings.HasPrefix(p.src[p.pos:], quote+quote+quote) {
+		delimiter = quote + quote + quote
+	}
+	multiline := len(delimiter) == 3
+	p.pos += len(delimiter)
+	// A newline right after the opening delimiter isn't part of the string
+	if multiline {
+		if strings.HasPrefix(p.src[p.pos:], "\r\n") {
+			p.pos++
+		}
+		p.consume('\n')
+	}
+
+	var value strings.Builder
+	for {
+		if p.eof() {
+			return nil, fmt.Errorf("unterminated string (line %d)", node.Line)
+		}
+		if strings.HasPrefix(p.src[p.pos:], delimiter) {
+			// Up to two quotes may end a multi-line string
+			for multiline && strings.HasPrefix(p.src[p.pos+1:], delimiter) {
+				value.WriteString(quote)
+				p.pos++
+			}
+			p.pos += len(delimiter)
+			node.Value = value.String()
+			return node, nil
+		}
+
+		c := p.peek()
+		switch {
+		case c == '\n' && !multiline:
+			return nil, p.errorf("unterminated string")
+		case c == '\n':
+			value.WriteByte(c)
+			p.consume('\n')
+		case c == '\\' && !literal:
+			if err := p.escape(&value, multiline); err != nil {
+				return nil, err
+			}
+		default:
+			r, size := utf8.DecodeRuneInString(p.src[p.pos:])
+			value.WriteRune(r)
+			p.pos += size
+		}
+	}
+}
+
+// escape parses the escape sequence of a basic string into value
+func (p *tomlParser) escape(value *strings.Builder, multiline bool) error {
+	p.pos++
+	c := p.peek()
+	p.pos++
+	switch c {
+	case 'b':
+		value.WriteByte('\b')
+	case 't':
+		value.WriteByte('\t')
+	case 'n':
+		value.WriteByte('\n')
+	case 'f':
+		value.WriteByte('\f')
+	case 'r':
+		value.WriteByte('\r')
+	case 'e':
+		value.WriteByte('\x1b')
+	case '"', '\\':
+		value.WriteByte(c)
+	case 'u', 'U':
+		size := 4
+		if c == 'U' {
+			size = 8
+		}
+		if p.pos+size > len(p.src) {
+			return p.errorf("invalid escape \\%c in string", c)
+		}
+		code, err := strconv.ParseUint(p.src[p.pos:p.pos+size], 16, 32)
+		if err != nil || !utf8.ValidRune(rune(code)) {
+			return p.errorf("invalid escape \\%c%s in string", c, p.src[p.pos:p.pos+size])
+		}
+		value.WriteRune(rune(code))
+		p.pos += size
+	default:
+		// A backslash at the end of a line trims the whitespace that follows
+		if multiline && (c == ' ' || c == '\t' || c == '\r' || c == '\n') {
+			p.pos--
+			for !p.eof() && strings.IndexByte(" \t\r\n", p.peek()) >= 0 {
+				if !p.consume('\n') {
+					p.pos++
+				}
+			}
+			return nil
+		}
+		return p.errorf("invalid escape \\%c in string", c)
+	}
+	return nil
+}
+
+// mappingValue returns the value of key in mapping, or nil
+func mappingValue(mapping *yaml.Node, key string) *yaml.Node {
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		if mapping.Content[i].Value == key {
+			return mapping.Content[i+1]
+		}
+	}
+	return nil
+}
+
+func joinKeys(keys []*yaml.Node) string {
+	names := make([]string, len(keys))
+	for i, key := range keys {
+		names[i] = key.Value
+	}
+	return strings.Join(names, ".")
+}
@@ -0,0 +1,44 @@
+package secretsyml
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+)
+
+// ValueType is the type the value of a secret is checked against once it is
+// resolved, set with the int, bool and url tags, e.g. !var:int
+type ValueType string
+
+const (
+	AnyValue  ValueType = ""
+	IntValue  ValueType = "int"
+	BoolValue ValueType = "bool"
+	URLValue  ValueType = "url"
+)
+
+// Check returns an error if value is not of type t. The error doesn't show
+// the value, which may be secret.
+func (t ValueType) Check(value string) error {
+	var ok bool
+	var expected string
+	switch t {
+	case AnyValue:
+		return nil
+	case IntValue:
+		_, err := strconv.ParseInt(value, 0, 64)
+		ok, expected = err == nil, "an integer"
+	case BoolValue:
+		_, err := strconv.ParseBool(value)
+		ok, expected = err == nil, "a boolean (true or false)"
+	case URLValue:
+		u, err := url.Parse(value)
+		ok, expected = err == nil && u.Scheme != "" && u.Host != "", "a URL with a scheme and host"
+	default:
+		return fmt.Errorf("unknown value type %q", string(t))
+	}
+	if !ok {
+		return fmt.Errorf("resolved value is not %s", expected)
+	}
+	return nil
+}
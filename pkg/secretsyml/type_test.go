@@ -0,0 +1,113 @@
+package secretsyml
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValueTypes(t *testing.T) {
+	t.Run("Type tags are parsed", func(t *testing.T) {
+		parsed, err := ParseFromString(`
+DB_PORT: !var:trim:int prod/db/port
+DEBUG: !var:bool prod/debug
+API_URL: !var:url:default='https://api.example.com' prod/api/url
+PLAIN_PORT: 8080
+PLAIN_FLAG: true
+`, "", nil)
+		assert.NoError(t, err)
+		assert.Equal(t, SecretSpec{
+			Tags:      []YamlTag{Var},
+			Path:      "prod/db/port",
+			Modifiers: []Modifier{{Name: ModifierTrim}},
+			Type:      IntValue,
+		}, parsed["DB_PORT"])
+		assert.Equal(t, SecretSpec{Tags: []YamlTag{Var}, Path: "prod/debug", Type: BoolValue}, parsed["DEBUG"])
+		assert.Equal(t, URLValue, parsed["API_URL"].Type)
+		assert.Equal(t, "https://api.example.com", parsed["API_URL"].DefaultValue)
+
+		// Plain values are left as they are
+		assert.Equal(t, SecretSpec{Tags: []YamlTag{Literal}, Path: "8080"}, parsed["PLAIN_PORT"])
+		assert.Equal(t, SecretSpec{Tags: []YamlTag{Literal}, Path: "true"}, parsed["PLAIN_FLAG"])
+	})
+
+	t.Run("Type tags alone are plain literals", func(t *testing.T) {
+		parsed, err := ParseFromString(`
+PORT: !int 8080
+DEBUG: !bool yes
+RATIO: !float 0.5
+API_URL: !url api.example.com
+PORTS: !int [8080, oops]
+`, "", nil)
+		assert.NoError(t, err)
+		assert.Equal(t, SecretSpec{Tags: []YamlTag{Literal}, Path: "8080"}, parsed["PORT"])
+		assert.Equal(t, SecretSpec{Tags: []YamlTag{Literal}, Path: "yes"}, parsed["DEBUG"])
+		assert.Equal(t, SecretSpec{Tags: []YamlTag{Literal}, Path: "0.5"}, parsed["RATIO"])
+		assert.Equal(t, SecretSpec{Tags: []YamlTag{Literal}, Path: "api.example.com"}, parsed["API_URL"])
+		assert.Equal(t, AnyValue, parsed["PORTS"].Items[1].Type)
+
+		debug := parsed["DEBUG"]
+		value, err := debug.Transform(debug.Path)
+		assert.NoError(t, err)
+		assert.Equal(t, "yes", value)
+	})
+
+	t.Run("Items of a list get the type of the list", func(t *testing.T) {
+		parsed, err := ParseFromString("PORTS: !var:int [a/port, !var:str b/port]\n", "", nil)
+		assert.NoError(t, err)
+		assert.Equal(t, AnyValue, parsed["PORTS"].Type)
+		assert.Equal(t, IntValue, parsed["PORTS"].Items[0].Type)
+		assert.Equal(t, IntValue, parsed["PORTS"].Items[1].Type)
+	})
+
+	t.Run("Files can't have a type", func(t *testing.T) {
+		_, err := ParseFromString("CERT: !var:file:url prod/cert\n", "", nil)
+		assert.EqualError(t, err, "!url checks the value of a variable, not a file")
+	})
+
+	t.Run("Check", func(t *testing.T) {
+		for _, tc := range []struct {
+			valueType ValueType
+			value     string
+			err       string
+		}{
+			{AnyValue, "anything", ""},
+			{IntValue, "5432", ""},
+			{IntValue, "-1", ""},
+			{IntValue, "0x1F", ""},
+			{IntValue, "oops", "resolved value is not an integer"},
+			{IntValue, "1.5", "resolved value is not an integer"},
+			{IntValue, "", "resolved value is not an integer"},
+			{BoolValue, "true", ""},
+			{BoolValue, "0", ""},
+			{BoolValue, "yes", "resolved value is not a boolean (true or false)"},
+			{URLValue, "https://api.example.com/v1", ""},
+			{URLValue, "postgres://user:secret@db:5432/app", ""},
+			{URLValue, "api.example.com", "resolved value is not a URL with a scheme and host"},
+			{URLValue, "localhost:5432", "resolved value is not a URL with a scheme and host"},
+			{URLValue, "http://[::1", "resolved value is not a URL with a scheme and host"},
+		} {
+			err := tc.valueType.Check(tc.value)
+			if tc.err == "" {
+				assert.NoError(t, err, tc.value)
+			} else {
+				assert.EqualError(t, err, tc.err, tc.value)
+			}
+		}
+	})
+
+	t.Run("Transform checks the value after modifiers and the default value", func(t *testing.T) {
+		spec := SecretSpec{Modifiers: []Modifier{{Name: ModifierTrim}}, DefaultValue: "80", Type: IntValue}
+
+		value, err := spec.Transform(" 8080\n")
+		assert.NoError(t, err)
+		assert.Equal(t, "8080", value)
+
+		value, err = spec.Transform("")
+		assert.NoError(t, err)
+		assert.Equal(t, "80", value)
+
+		_, err = spec.Transform("oops")
+		assert.EqualError(t, err, "resolved value is not an integer")
+	})
+}
@@ -0,0 +1,93 @@
+package summon
+
+import (
+	"fmt"
+	"os"
+
+	prov "github.com/cyberark/summon/pkg/provider"
+	"github.com/cyberark/summon/pkg/secretsyml"
+)
+
+// SecretCache stores secret values resolved by the provider so that later
+// runs can reuse them instead of calling the provider again
+type SecretCache interface {
+	Get(path string) ([]byte, bool)
+	Put(path string, value []byte) error
+}
+
+// resolveFromCache returns results for the secrets whose values are cached,
+// and the secrets that still need to be fetched from the provider
+func resolveFromCache(cache SecretCache, secrets secretsyml.SecretsMap,
+	tempFactory *TempFactory) ([]prov.Result, secretsyml.SecretsMap) {
+	if cache == nil {
+		return nil, secrets
+	}
+
+	results := []prov.Result{}
+	uncached := make(secretsyml.SecretsMap)
+
+	for key, spec := range secrets {
+		value, ok := cache.Get(spec.Path)
+		if !ok {
+			uncached[key] = spec
+			continue
+		}
+
+		// Values are cached as the provider returned them, with any metadata
+		v, _, err := prov.ParseResponse(string(value))
+		if err == nil {
+			v, err = spec.Transform(v)
+		}
+		if err != nil {
+			results = append(results, prov.Result{Key: key, Value: "", Error: err})
+			continue
+		}
+		k, v := formatForEnv(key, v, spec, tempFactory)
+		results = append(results, prov.Result{Key: k, Value: v, Error: nil})
+	}
+
+	return results, uncached
+}
+
+// cacheResults passes results from the provider through unchanged, storing
+// each value in the cache on the way
+func cacheResults(cache SecretCache, resultsCh chan prov.Result,
+	secrets secretsyml.SecretsMap, done <-chan struct{}) chan prov.Result {
+	if cache == nil {
+		return resultsCh
+	}
+
+	return pipeResults(resultsCh, done, func(result prov.Result) []prov.Result {
+		if result.Error == nil {
+			putInCache(cache, secrets[result.Key].Path, []byte(result.Value))
+		}
+		return []prov.Result{result}
+	})
+}
+
+// withCache wraps fetch so that cached values are returned without calling
+// the provider, and freshly fetched values are cached
+func withCache(fetch SecretFetcher, cache SecretCache) SecretFetcher {
+	if cache == nil {
+		return fetch
+	}
+
+	return func(path string) ([]byte, error) {
+		if value, ok := cache.Get(path); ok {
+			return value, nil
+		}
+		value, err := fetch(path)
+		if err == nil {
+			putInCache(cache, path, value)
+		}
+		return value, err
+	}
+}
+
+// putInCache stores the value of path, reporting a failure on stderr: the
+// value was resolved, so the run goes on without caching it
+func putInCache(cache SecretCache, path string, value []byte) {
+	if err := cache.Put(path, value); err != nil {
+		fmt.Fprintf(os.Stderr, "summon: unable to cache %s: %s\n", path, err)
+	}
+}
@@ -0,0 +1,110 @@
+package summon
+
+import (
+	"errors"
+	"testing"
+
+	prov "github.com/cyberark/summon/pkg/provider"
+	"github.com/cyberark/summon/pkg/secretsyml"
+	"github.com/stretchr/testify/assert"
+)
+
+type mapCache map[string][]byte
+
+func (m mapCache) Get(path string) ([]byte, bool) {
+	value, ok := m[path]
+	return value, ok
+}
+
+func (m mapCache) Put(path string, value []byte) error {
+	m[path] = value
+	return nil
+}
+
+func TestWithCache(t *testing.T) {
+	calls := 0
+	fetch := func(path string) ([]byte, error) {
+		calls++
+		if path == "missing" {
+			return nil, errors.New("not found")
+		}
+		return []byte("value-of-" + path), nil
+	}
+	cache := mapCache{"cached": []byte("cached-value")}
+
+	cachedFetch := withCache(fetch, cache)
+
+	value, err := cachedFetch("cached")
+	assert.NoError(t, err)
+	assert.Equal(t, "cached-value", string(value))
+	assert.Equal(t, 0, calls)
+
+	value, err = cachedFetch("fresh")
+	assert.NoError(t, err)
+	assert.Equal(t, "value-of-fresh", string(value))
+	assert.Equal(t, "value-of-fresh", string(cache["fresh"]))
+	assert.Equal(t, 1, calls)
+
+	_, err = cachedFetch("missing")
+	assert.Error(t, err)
+	assert.NotContains(t, cache, "missing")
+}
+
+func TestResolveFromCache(t *testing.T) {
+	tempFactory := NewTempFactory("")
+	defer tempFactory.Cleanup()
+
+	secrets := secretsyml.SecretsMap{
+		"CACHED":   secretsyml.SecretSpec{Path: "cached", Tags: []secretsyml.YamlTag{secretsyml.Var}},
+		"UNCACHED": secretsyml.SecretSpec{Path: "uncached", Tags: []secretsyml.YamlTag{secretsyml.Var}},
+	}
+	cache := mapCache{"cached": []byte("cached-value")}
+
+	results, uncached := resolveFromCache(cache, secrets, &tempFactory)
+
+	assert.Len(t, results, 1)
+	assert.Equal(t, "CACHED", results[0].Key)
+	assert.Equal(t, "cached-value", results[0].Value)
+	assert.Equal(t, secretsyml.SecretsMap{"UNCACHED": secrets["UNCACHED"]}, uncached)
+
+	_, all := resolveFromCache(nil, secrets, &tempFactory)
+	assert.Equal(t, secrets, all)
+}
+
+type failingCache struct{ mapCache }
+
+func (failingCache) Put(path string, value []byte) error {
+	return errors.New("disk full")
+}
+
+func TestCacheResults(t *testing.T) {
+	secrets := secretsyml.SecretsMap{
+		"DB_PASS": secretsyml.SecretSpec{Path: "db/password", Tags: []secretsyml.YamlTag{secretsyml.Var}},
+	}
+
+	t.Run("stores results on the way", func(t *testing.T) {
+		cache := mapCache{}
+		resultsCh := make(chan prov.Result, 1)
+		resultsCh <- prov.Result{Key: "DB_PASS", Value: "secret"}
+		close(resultsCh)
+
+		var results []prov.Result
+		for result := range cacheResults(cache, resultsCh, secrets, make(chan struct{})) {
+			results = append(results, result)
+		}
+		assert.Equal(t, []prov.Result{{Key: "DB_PASS", Value: "secret"}}, results)
+		assert.Equal(t, "secret", string(cache["db/password"]))
+	})
+
+	t.Run("passes results on if they can't be stored", func(t *testing.T) {
+		resultsCh := make(chan prov.Result, 1)
+		resultsCh <- prov.Result{Key: "DB_PASS", Value: "secret"}
+		close(resultsCh)
+
+		var results []prov.Result
+		for result := range cacheResults(failingCache{}, resultsCh, secrets, make(chan struct{})) {
+			results = append(results, result)
+		}
+		assert.Equal(t, []prov.Result{{Key: "DB_PASS", Value: "secret"}}, results)
+	})
+}
@@ -0,0 +1,73 @@
+package summon
+
+import (
+	"sort"
+	"sync"
+
+	prov "github.com/cyberark/summon/pkg/provider"
+	"github.com/cyberark/summon/pkg/secretsyml"
+)
+
+// SecretCheck is the outcome of checking that a variable can be resolved
+type SecretCheck struct {
+	// Key is the variable, or KEY[i] for the items of a list
+	Key  string
+	Path string
+	// Err is why the variable can't be resolved, nil if it can
+	Err error
+}
+
+// CheckSecrets loads secrets.yml as RunSubprocess does, and checks that the
+// provider can resolve every variable in it, without running anything. Paths
+// are checked with sc.CheckSecret if set. Otherwise they are resolved with
+// sc.FetchSecret, bypassing the cache, and the values are thrown away once
+// modifiers and type tags are known to apply to them. Checks are sorted by
+// key.
+func CheckSecrets(sc *SubprocessConfig) ([]SecretCheck, error) {
+	secrets, err := loadSecrets(sc)
+	if err != nil {
+		return nil, err
+	}
+
+	fetchSecret := withRetries(sc.FetchSecret, sc.Retries, sc.RetryBackoff)
+	if sc.CheckSecret != nil {
+		fetchSecret = func(path string) ([]byte, error) {
+			return nil, sc.CheckSecret(path)
+		}
+	}
+	// Each path is checked once, however many variables refer to it
+	fetchSecret = withMemo(fetchSecret)
+
+	resolving := expandLists(secrets)
+	keys := make([]string, 0, len(resolving))
+	for key, spec := range resolving {
+		if spec.IsVar() {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	checks := make([]SecretCheck, len(keys))
+	var wg sync.WaitGroup
+	for i, key := range keys {
+		spec := resolving[key]
+		checks[i] = SecretCheck{Key: key, Path: spec.Path}
+
+		wg.Add(1)
+		go func(check *SecretCheck, spec secretsyml.SecretSpec) {
+			defer wg.Done()
+			value, err := fetchSecret(spec.Path)
+			if err == nil && sc.CheckSecret == nil {
+				// The provider may have answered with a metadata envelope
+				var response string
+				if response, _, err = prov.ParseResponse(string(value)); err == nil {
+					_, err = spec.Transform(response)
+				}
+			}
+			check.Err = err
+		}(&checks[i], spec)
+	}
+	wg.Wait()
+
+	return checks, nil
+}
@@ -0,0 +1,91 @@
+package summon
+
+import (
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheckSecrets(t *testing.T) {
+	content := `
+production:
+  DB_PORT: !var:int prod/db/port
+  DB_PASS: !var prod/db/password
+  DB_PASS_AGAIN: !var prod/db/password
+  HOSTS: !var [prod/db/host, prod/missing]
+  LITERAL: not checked
+`
+
+	t.Run("Resolves every variable without running anything", func(t *testing.T) {
+		var mu sync.Mutex
+		fetched := map[string]int{}
+		checks, err := CheckSecrets(&SubprocessConfig{
+			Args:        []string{"false"},
+			YamlInline:  content,
+			Environment: "production",
+			FetchSecret: func(path string) ([]byte, error) {
+				mu.Lock()
+				defer mu.Unlock()
+				fetched[path]++
+				switch path {
+				case "prod/missing":
+					return nil, errors.New("404 Not Found")
+				case "prod/db/port":
+					return []byte("not a port"), nil
+				}
+				return []byte("value"), nil
+			},
+		})
+
+		assert.NoError(t, err)
+		assert.Equal(t, []SecretCheck{
+			{Key: "DB_PASS", Path: "prod/db/password"},
+			{Key: "DB_PASS_AGAIN", Path: "prod/db/password"},
+			{Key: "DB_PORT", Path: "prod/db/port", Err: errors.New("resolved value is not an integer")},
+			{Key: "HOSTS[0]", Path: "prod/db/host"},
+			{Key: "HOSTS[1]", Path: "prod/missing", Err: errors.New("404 Not Found")},
+		}, checks)
+		// Each path is asked for once
+		assert.Equal(t, map[string]int{
+			"prod/db/port":     1,
+			"prod/db/password": 1,
+			"prod/db/host":     1,
+			"prod/missing":     1,
+		}, fetched)
+	})
+
+	t.Run("Asks whether paths exist if the provider can tell", func(t *testing.T) {
+		checks, err := CheckSecrets(&SubprocessConfig{
+			YamlInline:  content,
+			Environment: "production",
+			FetchSecret: func(path string) ([]byte, error) {
+				t.Errorf("fetched %s", path)
+				return nil, nil
+			},
+			CheckSecret: func(path string) error {
+				if path == "prod/missing" {
+					return errors.New("no such secret")
+				}
+				return nil
+			},
+		})
+
+		assert.NoError(t, err)
+		assert.Len(t, checks, 5)
+		for _, check := range checks {
+			if check.Path == "prod/missing" {
+				assert.EqualError(t, check.Err, "no such secret")
+			} else {
+				assert.NoError(t, check.Err, check.Key)
+			}
+		}
+	})
+
+	t.Run("Fails like a run on invalid secrets.yml", func(t *testing.T) {
+		_, err := CheckSecrets(&SubprocessConfig{YamlInline: content, Environment: "staging"})
+		assert.EqualError(t, err, "No such environment 'staging' found in secrets file")
+		assert.Equal(t, ExitParseError, ExitCodeOf(err))
+	})
+}
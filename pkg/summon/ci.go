@@ -0,0 +1,194 @@
+package summon
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/cyberark/summon/pkg/secretsyml"
+)
+
+// CI systems summon can mask secrets for, see SubprocessConfig.CI
+const (
+	CIGitHub = "github"
+	CIGitLab = "gitlab"
+)
+
+// maskedValue replaces secrets in output masked by summon itself, as GitLab
+// shows masked variables
+const maskedValue = "[MASKED]"
+
+// maskingWriterMaxBuffer is how much of an unterminated line is held back
+// before it is written anyway
+const maskingWriterMaxBuffer = 64 * 1024
+
+// ciSecretValues returns the values to mask in CI logs: those of secrets that
+// came from the provider or a prompt. Literal values in secrets.yml aren't
+// secret, and for file secrets the content of the file is masked, not its path.
+func ciSecretValues(secrets secretsyml.SecretsMap, env map[string]string) []string {
+	var values []string
+	for key, value := range env {
+		spec, ok := secrets[key]
+		if !ok || !(spec.IsVar() || spec.IsPrompt()) {
+			continue
+		}
+		if spec.IsFile() {
+			content, err := os.ReadFile(value)
+			if err != nil {
+				continue
+			}
+			value = string(content)
+		}
+		values = append(values, value)
+	}
+	return values
+}
+
+// maskLines splits values into the lines to mask. Log lines are masked one at
+// a time, so a multi-line secret has to be masked line by line.
+func maskLines(values []string) []string {
+	seen := map[string]bool{}
+	var lines []string
+	for _, value := range values {
+		for _, line := range strings.Split(value, "\n") {
+			line = strings.TrimSuffix(line, "\r")
+			if strings.TrimSpace(line) == "" || seen[line] {
+				continue
+			}
+			seen[line] = true
+			lines = append(lines, line)
+		}
+	}
+	// Longer values first, so that a secret containing another is masked whole
+	sort.Slice(lines, func(i, j int) bool {
+		if len(lines[i]) != len(lines[j]) {
+			return len(lines[i]) > len(lines[j])
+		}
+		return lines[i] < lines[j]
+	})
+	return lines
+}
+
+// writeGitHubMasks writes an ::add-mask:: workflow command for every line of
+// values, which makes GitHub Actions hide them in the rest of the job's log
+func writeGitHubMasks(w io.Writer, values []string) error {
+	for _, line := range maskLines(values) {
+		// Workflow command data is percent-escaped
+		if _, err := fmt.Fprintf(w, "::add-mask::%s\n", strings.ReplaceAll(line, "%", "%25")); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// exportGitHubEnv appends the variables in env to the $GITHUB_ENV file at
+// path, so that later steps of the job see them. Every value is written as a
+// heredoc, which allows multi-line values.
+func exportGitHubEnv(path string, env map[string]string) error {
+	if path == "" {
+		return fmt.Errorf("GITHUB_ENV is not set, exporting secrets only works in a GitHub Actions job")
+	}
+
+	keys := make([]string, 0, len(env))
+	for key := range env {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var out strings.Builder
+	for _, key := range keys {
+		delimiter, err := heredocDelimiter(env[key])
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(&out, "%s<<%s\n%s\n%s\n", key, delimiter, env[key], delimiter)
+	}
+
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o600)
+	if err != nil {
+		return err
+	}
+	_, err = f.WriteString(out.String())
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// heredocDelimiter returns a random delimiter that doesn't occur in value
+func heredocDelimiter(value string) (string, error) {
+	random := make([]byte, 16)
+	if _, err := rand.Read(random); err != nil {
+		return "", err
+	}
+	delimiter := "ghadelimiter_" + hex.EncodeToString(random)
+	if strings.Contains(value, delimiter) {
+		return "", fmt.Errorf("unable to pick a delimiter for a value")
+	}
+	return delimiter, nil
+}
+
+// exportableEnv returns the secrets in env that can be exported to later
+// steps, named with naming. File secrets are left out, as their temp files are
+// removed as soon as summon exits.
+func exportableEnv(secrets secretsyml.SecretsMap, env map[string]string, naming EnvNaming) map[string]string {
+	out := make(map[string]string)
+	for key, value := range env {
+		if spec, ok := secrets[key]; ok && !spec.IsFile() {
+			out[naming.name(key)] = value
+		}
+	}
+	return out
+}
+
+// maskingWriter replaces secrets in everything written through it. GitLab has
+// no way to mask values at runtime, so summon masks the subcommand's output
+// itself. Output is masked a line at a time, so a partial line is held back
+// until it ends, or until the writer is flushed.
+type maskingWriter struct {
+	w        io.Writer
+	replacer *strings.Replacer
+	buf      []byte
+}
+
+func newMaskingWriter(w io.Writer, values []string) *maskingWriter {
+	var pairs []string
+	for _, line := range maskLines(values) {
+		pairs = append(pairs, line, maskedValue)
+	}
+	return &maskingWriter{w: w, replacer: strings.NewReplacer(pairs...)}
+}
+
+func (m *maskingWriter) Write(p []byte) (int, error) {
+	m.buf = append(m.buf, p...)
+
+	end := bytes.LastIndexAny(m.buf, "\r\n") + 1
+	if end == 0 && len(m.buf) >= maskingWriterMaxBuffer {
+		end = len(m.buf)
+	}
+	if end == 0 {
+		return len(p), nil
+	}
+
+	_, err := m.replacer.WriteString(m.w, string(m.buf[:end]))
+	m.buf = m.buf[:copy(m.buf, m.buf[end:])]
+	if err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// Flush writes out the partial line held back, if any
+func (m *maskingWriter) Flush() error {
+	if len(m.buf) == 0 {
+		return nil
+	}
+	_, err := m.replacer.WriteString(m.w, string(m.buf))
+	m.buf = m.buf[:0]
+	return err
+}
@@ -0,0 +1,108 @@
+package summon
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/cyberark/summon/pkg/secretsyml"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCISecretValues(t *testing.T) {
+	secrets, err := secretsyml.ParseFromString(`
+PASSWORD: !var db/password
+TOKEN: !prompt
+RAILS_ENV: production
+CERT: !var:file tls/cert
+`, "", nil)
+	assert.NoError(t, err)
+
+	certFile := filepath.Join(t.TempDir(), "cert")
+	assert.NoError(t, os.WriteFile(certFile, []byte("cert-content"), 0o600))
+
+	values := ciSecretValues(secrets, map[string]string{
+		"PASSWORD":  "hunter2",
+		"TOKEN":     "typed",
+		"RAILS_ENV": "production",
+		"CERT":      certFile,
+	})
+	assert.ElementsMatch(t, []string{"hunter2", "typed", "cert-content"}, values)
+}
+
+func TestWriteGitHubMasks(t *testing.T) {
+	var out bytes.Buffer
+	err := writeGitHubMasks(&out, []string{"short", "line one\r\nline two\n", "100%", "short"})
+
+	assert.NoError(t, err)
+	assert.Equal(t, "::add-mask::line one\n::add-mask::line two\n::add-mask::short\n::add-mask::100%25\n", out.String())
+}
+
+func TestExportGitHubEnv(t *testing.T) {
+	t.Run("Values are appended as heredocs", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "github_env")
+		assert.NoError(t, os.WriteFile(path, []byte("EXISTING=1\n"), 0o600))
+
+		err := exportGitHubEnv(path, map[string]string{"B": "multi\nline", "A": "value"})
+		assert.NoError(t, err)
+
+		content, _ := os.ReadFile(path)
+		lines := strings.Split(string(content), "\n")
+		assert.Len(t, lines, 9)
+		assert.Equal(t, "EXISTING=1", lines[0])
+		assert.Regexp(t, "^A<<ghadelimiter_[0-9a-f]{32}$", lines[1])
+		assert.Equal(t, []string{"value", strings.TrimPrefix(lines[1], "A<<")}, lines[2:4])
+		assert.Regexp(t, "^B<<ghadelimiter_[0-9a-f]{32}$", lines[4])
+		assert.Equal(t, []string{"multi", "line", strings.TrimPrefix(lines[4], "B<<"), ""}, lines[5:])
+	})
+
+	t.Run("Fails outside of GitHub Actions", func(t *testing.T) {
+		err := exportGitHubEnv("", map[string]string{"A": "value"})
+		assert.EqualError(t, err, "GITHUB_ENV is not set, exporting secrets only works in a GitHub Actions job")
+	})
+}
+
+func TestMaskingWriter(t *testing.T) {
+	t.Run("Secrets are masked line by line", func(t *testing.T) {
+		var out bytes.Buffer
+		w := newMaskingWriter(&out, []string{"hunter2", "hunter2-long", "multi\nline"})
+
+		w.Write([]byte("password is hun"))
+		assert.Equal(t, "", out.String())
+		w.Write([]byte("ter2\nlong one hunter2-long, multi\nline\n"))
+		assert.Equal(t, "password is [MASKED]\nlong one [MASKED], [MASKED]\n[MASKED]\n", out.String())
+	})
+
+	t.Run("Flush writes the partial line", func(t *testing.T) {
+		var out bytes.Buffer
+		w := newMaskingWriter(&out, []string{"hunter2"})
+
+		w.Write([]byte("Password: hunter2"))
+		assert.NoError(t, w.Flush())
+		assert.Equal(t, "Password: [MASKED]", out.String())
+	})
+
+	t.Run("Masks the subcommand's output in GitLab mode", func(t *testing.T) {
+		tempFile := filepath.Join(t.TempDir(), "outputFile.txt")
+		stdout := os.Stdout
+		f, err := os.Create(tempFile)
+		assert.NoError(t, err)
+		os.Stdout = f
+		defer func() { os.Stdout = stdout }()
+
+		code, err := RunSubprocess(&SubprocessConfig{
+			Args:        []string{"sh", "-c", "echo the password is $PASSWORD"},
+			YamlInline:  "PASSWORD: !var db/password",
+			FetchSecret: func(string) ([]byte, error) { return []byte("hunter2"), nil },
+			CI:          CIGitLab,
+		})
+		f.Close()
+
+		assert.NoError(t, err)
+		assert.Equal(t, 0, code)
+		content, _ := os.ReadFile(tempFile)
+		assert.Equal(t, "the password is [MASKED]\n", string(content))
+	})
+}
@@ -0,0 +1,132 @@
+package summon
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// controlsHelperName is the argv[0] summon is re-executed with to set up the
+// subcommand process before starting it, see SubcommandMain
+const controlsHelperName = "summon-subcommand"
+
+// RlimitInfinity means no limit, as "unlimited" in ParseRlimit
+const RlimitInfinity = ^uint64(0)
+
+// Rlimit is a resource limit set on the subcommand, such as the number of
+// files it may open
+type Rlimit struct {
+	// Resource names the limit, e.g. nofile or core
+	Resource string
+	Soft     uint64
+	Hard     uint64
+}
+
+// ParseRlimit parses a resource limit given as name=limit, or
+// name=soft:hard to set the soft and hard limits apart, e.g. nofile=1024 or
+// core=0. A limit may be "unlimited".
+func ParseRlimit(s string) (Rlimit, error) {
+	name, value, ok := strings.Cut(s, "=")
+	if !ok {
+		return Rlimit{}, fmt.Errorf("resource limit %q is not in name=limit format", s)
+	}
+	name = strings.ToLower(strings.TrimSpace(name))
+	if _, ok := rlimitResources[name]; !ok {
+		return Rlimit{}, fmt.Errorf("unknown resource limit %q, expected one of %s", name, rlimitNames())
+	}
+
+	soft, hard, ok := strings.Cut(value, ":")
+	if !ok {
+		hard = soft
+	}
+	limit := Rlimit{Resource: name}
+	var err error
+	if limit.Soft, err = parseRlimitValue(soft); err == nil {
+		limit.Hard, err = parseRlimitValue(hard)
+	}
+	if err != nil {
+		return Rlimit{}, fmt.Errorf("resource limit %s: %s", name, err)
+	}
+	if limit.Soft > limit.Hard {
+		return Rlimit{}, fmt.Errorf("resource limit %s: the soft limit is above the hard limit", name)
+	}
+	return limit, nil
+}
+
+func parseRlimitValue(s string) (uint64, error) {
+	s = strings.TrimSpace(s)
+	if s == "unlimited" || s == "infinity" {
+		return RlimitInfinity, nil
+	}
+	n, err := strconv.ParseUint(s, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid limit %q", s)
+	}
+	return n, nil
+}
+
+func (r Rlimit) String() string {
+	format := func(n uint64) string {
+		if n == RlimitInfinity {
+			return "unlimited"
+		}
+		return strconv.FormatUint(n, 10)
+	}
+	return r.Resource + "=" + format(r.Soft) + ":" + format(r.Hard)
+}
+
+// ParseUmask parses a file mode creation mask in octal, e.g. 027
+func ParseUmask(s string) (os.FileMode, error) {
+	umask, err := strconv.ParseUint(s, 8, 32)
+	if err != nil || umask > 0o777 {
+		return 0, fmt.Errorf("invalid umask %q, expected an octal mode such as 027", s)
+	}
+	return os.FileMode(umask), nil
+}
+
+// processControls are the privileges and resources the subcommand starts
+// with
+type processControls struct {
+	// asUser is set to run the subcommand as the user uid, in the group gid
+	// and the supplementary groups
+	asUser bool
+	uid    int
+	gid    int
+	groups []int
+	umask  *os.FileMode
+	limits []Rlimit
+}
+
+// newProcessControls returns the controls sc asks for, or nil if none
+func newProcessControls(sc *SubprocessConfig) (*processControls, error) {
+	if sc.User == "" && sc.Umask == nil && len(sc.Rlimits) == 0 {
+		return nil, nil
+	}
+	if err := controlsSupported(); err != nil {
+		return nil, err
+	}
+
+	controls := &processControls{umask: sc.Umask, limits: sc.Rlimits}
+	if sc.User != "" {
+		var err error
+		if controls.uid, controls.gid, controls.groups, err = lookupUser(sc.User); err != nil {
+			return nil, err
+		}
+		controls.asUser = true
+	}
+	return controls, nil
+}
+
+// SubcommandMain takes over the process if summon was re-executed to set up
+// the subcommand with a umask or resource limits; in that case it never
+// returns. Call it first thing in main.
+func SubcommandMain() {
+	if len(os.Args) == 0 || os.Args[0] != controlsHelperName {
+		return
+	}
+	// Only returns on failure
+	err := runControlsHelper(os.Args[1:])
+	os.Stderr.WriteString("summon: unable to start the command: " + err.Error() + "\n")
+	os.Exit(126)
+}
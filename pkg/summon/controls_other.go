@@ -0,0 +1,37 @@
+//go:build !linux && !darwin && !windows
+
+package summon
+
+import (
+	"fmt"
+	"os/exec"
+	"runtime"
+)
+
+// rlimitResources is empty, as resource limits are only set on Linux and macOS
+var rlimitResources = map[string]int{}
+
+func rlimitNames() string {
+	return "none on " + runtime.GOOS
+}
+
+func controlsSupported() error {
+	return fmt.Errorf("running the command as another user, with a umask or with resource limits is not supported on %s", runtime.GOOS)
+}
+
+func lookupUser(spec string) (uid, gid int, groups []int, err error) {
+	return 0, 0, nil, controlsSupported()
+}
+
+func applyControls(cmd *exec.Cmd, controls *processControls) error {
+	return controlsSupported()
+}
+
+func runControlsHelper(args []string) error {
+	return controlsSupported()
+}
+
+// keepOwner does nothing, as the command always runs as summon's user here
+func keepOwner(path, replacement string) error {
+	return nil
+}
@@ -0,0 +1,215 @@
+//go:build linux || darwin
+
+package summon
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/user"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// rlimitResources are the resource limits that can be set on the subcommand,
+// by name
+var rlimitResources = map[string]int{
+	"as":     syscall.RLIMIT_AS,
+	"core":   syscall.RLIMIT_CORE,
+	"cpu":    syscall.RLIMIT_CPU,
+	"data":   syscall.RLIMIT_DATA,
+	"fsize":  syscall.RLIMIT_FSIZE,
+	"nofile": syscall.RLIMIT_NOFILE,
+	"stack":  syscall.RLIMIT_STACK,
+}
+
+func rlimitNames() string {
+	names := make([]string, 0, len(rlimitResources))
+	for name := range rlimitResources {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
+
+func controlsSupported() error {
+	return nil
+}
+
+// lookupUser returns the IDs of the user and group given as user[:group],
+// each by name or ID, and the supplementary groups of the user. Without a
+// group, the user's primary group is used.
+func lookupUser(spec string) (uid, gid int, groups []int, err error) {
+	name, groupName, hasGroup := strings.Cut(spec, ":")
+	u, err := user.Lookup(name)
+	if err != nil {
+		if _, numErr := strconv.Atoi(name); numErr == nil {
+			u, err = user.LookupId(name)
+		}
+	}
+
+	switch {
+	case err == nil:
+		uid, _ = strconv.Atoi(u.Uid)
+		gid, _ = strconv.Atoi(u.Gid)
+		if ids, err := u.GroupIds(); err == nil {
+			for _, id := range ids {
+				if n, err := strconv.Atoi(id); err == nil {
+					groups = append(groups, n)
+				}
+			}
+		}
+	case hasGroup:
+		// A user ID without an entry, as often in containers
+		if uid, err = strconv.Atoi(name); err != nil {
+			return 0, 0, nil, fmt.Errorf("unknown user %s", name)
+		}
+	default:
+		return 0, 0, nil, fmt.Errorf("unknown user %s, give a known one or a user ID with its group, as %s:<group>", name, name)
+	}
+
+	if hasGroup {
+		g, err := user.LookupGroup(groupName)
+		if err != nil {
+			g, err = user.LookupGroupId(groupName)
+		}
+		if err == nil {
+			gid, _ = strconv.Atoi(g.Gid)
+		} else if gid, err = strconv.Atoi(groupName); err != nil {
+			return 0, 0, nil, fmt.Errorf("unknown group %s", groupName)
+		}
+	}
+	return uid, gid, groups, nil
+}
+
+// applyControls makes cmd start with controls. A umask and resource limits
+// can't be set on another process, so cmd then starts through the controls
+// helper, which sets them, and then switches user, before replacing itself
+// with the subcommand.
+func applyControls(cmd *exec.Cmd, controls *processControls) error {
+	if controls.umask == nil && len(controls.limits) == 0 {
+		if controls.asUser {
+			if cmd.SysProcAttr == nil {
+				cmd.SysProcAttr = &syscall.SysProcAttr{}
+			}
+			cmd.SysProcAttr.Credential = controls.credential()
+		}
+		return nil
+	}
+
+	self, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	userSpec, umask := "-", "-"
+	if controls.asUser {
+		groups := make([]string, len(controls.groups))
+		for i, group := range controls.groups {
+			groups[i] = strconv.Itoa(group)
+		}
+		userSpec = fmt.Sprintf("%d:%d:%s", controls.uid, controls.gid, strings.Join(groups, ","))
+	}
+	if controls.umask != nil {
+		umask = fmt.Sprintf("%03o", uint32(*controls.umask))
+	}
+	limits := make([]string, len(controls.limits))
+	for i, limit := range controls.limits {
+		limits[i] = limit.String()
+	}
+
+	cmd.Args = append([]string{controlsHelperName, userSpec, umask, strings.Join(limits, ","), cmd.Path}, cmd.Args...)
+	cmd.Path = self
+	return nil
+}
+
+func (c *processControls) credential() *syscall.Credential {
+	groups := make([]uint32, len(c.groups))
+	for i, group := range c.groups {
+		groups[i] = uint32(group)
+	}
+	return &syscall.Credential{Uid: uint32(c.uid), Gid: uint32(c.gid), Groups: groups}
+}
+
+// runControlsHelper sets up the process as applyControls asked, and replaces
+// it with the subcommand. args are the user as uid:gid:groups, the umask and
+// the resource limits, each "-" or empty if not set, then the path of the
+// subcommand and its arguments. Limits are set first, while the process may
+// still raise them.
+func runControlsHelper(args []string) error {
+	if len(args) < 5 {
+		return errors.New("missing command")
+	}
+	userSpec, umask, limits, path, argv := args[0], args[1], args[2], args[3], args[4:]
+
+	for _, spec := range strings.Split(limits, ",") {
+		if spec == "" {
+			continue
+		}
+		limit, err := ParseRlimit(spec)
+		if err != nil {
+			return err
+		}
+		if err := syscall.Setrlimit(rlimitResources[limit.Resource], &syscall.Rlimit{Cur: limit.Soft, Max: limit.Hard}); err != nil {
+			return fmt.Errorf("setting resource limit %s: %s", limit, err)
+		}
+	}
+
+	if umask != "-" {
+		mask, err := ParseUmask(umask)
+		if err != nil {
+			return err
+		}
+		syscall.Umask(int(mask))
+	}
+
+	if userSpec != "-" {
+		ids := strings.SplitN(userSpec, ":", 3)
+		if len(ids) != 3 {
+			return fmt.Errorf("invalid user %q", userSpec)
+		}
+		uid, err := strconv.Atoi(ids[0])
+		if err != nil {
+			return fmt.Errorf("invalid user %q", userSpec)
+		}
+		gid, err := strconv.Atoi(ids[1])
+		if err != nil {
+			return fmt.Errorf("invalid user %q", userSpec)
+		}
+		var groups []int
+		for _, id := range strings.Split(ids[2], ",") {
+			if group, err := strconv.Atoi(id); err == nil {
+				groups = append(groups, group)
+			}
+		}
+
+		// Groups first, as they can't be changed once the user is
+		if err := syscall.Setgroups(groups); err != nil {
+			return fmt.Errorf("setting supplementary groups: %s", err)
+		}
+		if err := syscall.Setgid(gid); err != nil {
+			return fmt.Errorf("setting group %d: %s", gid, err)
+		}
+		if err := syscall.Setuid(uid); err != nil {
+			return fmt.Errorf("setting user %d: %s", uid, err)
+		}
+	}
+
+	return syscall.Exec(path, argv, os.Environ())
+}
+
+// keepOwner gives the file at replacement the owner of the file at path it
+// replaces, e.g. a secret the subcommand reads as another user
+func keepOwner(path, replacement string) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil
+	}
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok || (int(stat.Uid) == os.Getuid() && int(stat.Gid) == os.Getgid()) {
+		return nil
+	}
+	return os.Chown(replacement, int(stat.Uid), int(stat.Gid))
+}
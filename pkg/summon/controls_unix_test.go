@@ -0,0 +1,109 @@
+//go:build linux || darwin
+
+package summon
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestMain lets the tests of process controls re-execute the test binary as
+// the controls helper
+func TestMain(m *testing.M) {
+	SubcommandMain()
+	os.Exit(m.Run())
+}
+
+func TestParseRlimit(t *testing.T) {
+	t.Run("one limit sets both", func(t *testing.T) {
+		limit, err := ParseRlimit("nofile=1024")
+		assert.NoError(t, err)
+		assert.Equal(t, Rlimit{Resource: "nofile", Soft: 1024, Hard: 1024}, limit)
+	})
+
+	t.Run("soft and hard limits", func(t *testing.T) {
+		limit, err := ParseRlimit("CPU=60:unlimited")
+		assert.NoError(t, err)
+		assert.Equal(t, Rlimit{Resource: "cpu", Soft: 60, Hard: RlimitInfinity}, limit)
+		assert.Equal(t, "cpu=60:unlimited", limit.String())
+	})
+
+	t.Run("invalid limits", func(t *testing.T) {
+		for spec, expected := range map[string]string{
+			"nofile":        `resource limit "nofile" is not in name=limit format`,
+			"files=1":       `unknown resource limit "files", expected one of as, core, cpu, data, fsize, nofile, stack`,
+			"nofile=many":   `resource limit nofile: invalid limit "many"`,
+			"nofile=200:10": "resource limit nofile: the soft limit is above the hard limit",
+		} {
+			_, err := ParseRlimit(spec)
+			assert.EqualError(t, err, expected, spec)
+		}
+	})
+}
+
+func TestParseUmask(t *testing.T) {
+	umask, err := ParseUmask("027")
+	assert.NoError(t, err)
+	assert.Equal(t, os.FileMode(0o027), umask)
+
+	for _, s := range []string{"", "8", "1777"} {
+		_, err := ParseUmask(s)
+		assert.Error(t, err, s)
+	}
+}
+
+func TestProcessControls(t *testing.T) {
+	t.Run("the command starts with the umask and resource limits", func(t *testing.T) {
+		out := filepath.Join(t.TempDir(), "out")
+		umask := os.FileMode(0o027)
+
+		err := runSubcommand(
+			[]string{"sh", "-c", "umask > " + out + "; ulimit -n >> " + out + "; ulimit -Hn >> " + out},
+			os.Environ(),
+			subcommandOptions{controls: &processControls{
+				umask:  &umask,
+				limits: []Rlimit{{Resource: "nofile", Soft: 64, Hard: 128}},
+			}},
+		)
+		assert.NoError(t, err)
+
+		content, err := os.ReadFile(out)
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"0027", "64", "128"}, strings.Fields(string(content)))
+	})
+
+	t.Run("the command runs as another user, with its temp files", func(t *testing.T) {
+		if os.Getuid() != 0 {
+			t.Skip("switching users needs root")
+		}
+		// The user can't write where the test does, so the command tells by
+		// its exit status
+		code, err := RunSubprocess(&SubprocessConfig{
+			Args:       []string{"sh", "-c", `[ "$(id -u)" = 65534 ] && [ "$(cat "$CERT")" = value-of-cert ]`},
+			YamlInline: "CERT: !var:file cert",
+			User:       "65534:65534",
+			FetchSecret: func(path string) ([]byte, error) {
+				return []byte("value-of-" + path), nil
+			},
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, 0, code)
+	})
+
+	t.Run("unknown users fail before secrets are resolved", func(t *testing.T) {
+		_, err := RunSubprocess(&SubprocessConfig{
+			Args:       []string{"true"},
+			YamlInline: "CERT: !var cert",
+			User:       "no-such-user-for-summon",
+			FetchSecret: func(path string) ([]byte, error) {
+				t.Error("secret resolved")
+				return nil, nil
+			},
+		})
+		assert.EqualError(t, err, "unknown user no-such-user-for-summon, give a known one or a user ID with its group, as no-such-user-for-summon:<group>")
+	})
+}
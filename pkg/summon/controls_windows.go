@@ -0,0 +1,36 @@
+//go:build windows
+
+package summon
+
+import (
+	"errors"
+	"os/exec"
+)
+
+// rlimitResources is empty, as Windows has no resource limits
+var rlimitResources = map[string]int{}
+
+func rlimitNames() string {
+	return "none on Windows"
+}
+
+func controlsSupported() error {
+	return errors.New("running the command as another user, with a umask or with resource limits is not supported on Windows")
+}
+
+func lookupUser(spec string) (uid, gid int, groups []int, err error) {
+	return 0, 0, nil, controlsSupported()
+}
+
+func applyControls(cmd *exec.Cmd, controls *processControls) error {
+	return controlsSupported()
+}
+
+func runControlsHelper(args []string) error {
+	return controlsSupported()
+}
+
+// keepOwner does nothing on Windows, where the command runs as summon's user
+func keepOwner(path, replacement string) error {
+	return nil
+}
@@ -0,0 +1,83 @@
+package summon
+
+import (
+	"sort"
+	"sync"
+
+	prov "github.com/cyberark/summon/pkg/provider"
+	"github.com/cyberark/summon/pkg/secretsyml"
+)
+
+// dedupeSecrets picks one key per distinct secret path, so that each path is
+// only sent to the provider once. It returns the secrets to fetch, keyed by
+// the chosen key, and for each chosen key all the keys sharing its path.
+func dedupeSecrets(secrets secretsyml.SecretsMap) (secretsyml.SecretsMap, map[string][]string) {
+	keys := make([]string, 0, len(secrets))
+	for key := range secrets {
+		keys = append(keys, key)
+	}
+	// Sort so the same key is picked for a path on every run
+	sort.Strings(keys)
+
+	unique := make(secretsyml.SecretsMap)
+	aliases := make(map[string][]string)
+	keyForPath := make(map[string]string)
+
+	for _, key := range keys {
+		spec := secrets[key]
+		first, seen := keyForPath[spec.Path]
+		if !seen {
+			keyForPath[spec.Path] = key
+			unique[key] = spec
+			first = key
+		}
+		aliases[first] = append(aliases[first], key)
+	}
+
+	return unique, aliases
+}
+
+// fanOutResults copies each result from the provider to every key that
+// shares its secret path
+func fanOutResults(resultsCh chan prov.Result, aliases map[string][]string, done <-chan struct{}) chan prov.Result {
+	return pipeResults(resultsCh, done, func(result prov.Result) []prov.Result {
+		keys, ok := aliases[result.Key]
+		if !ok {
+			keys = []string{result.Key}
+		}
+		results := make([]prov.Result, 0, len(keys))
+		for _, key := range keys {
+			results = append(results, prov.Result{Key: key, Value: result.Value, Error: result.Error})
+		}
+		return results
+	})
+}
+
+// fetchResult is the outcome of fetching one secret path
+type fetchResult struct {
+	once  sync.Once
+	value []byte
+	err   error
+}
+
+// withMemo wraps fetch so that each distinct path is fetched exactly once,
+// even when requested concurrently; later callers share the first result
+func withMemo(fetch SecretFetcher) SecretFetcher {
+	var mu sync.Mutex
+	fetched := make(map[string]*fetchResult)
+
+	return func(path string) ([]byte, error) {
+		mu.Lock()
+		result, ok := fetched[path]
+		if !ok {
+			result = &fetchResult{}
+			fetched[path] = result
+		}
+		mu.Unlock()
+
+		result.once.Do(func() {
+			result.value, result.err = fetch(path)
+		})
+		return result.value, result.err
+	}
+}
@@ -0,0 +1,76 @@
+package summon
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	prov "github.com/cyberark/summon/pkg/provider"
+	"github.com/cyberark/summon/pkg/secretsyml"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDedupeSecrets(t *testing.T) {
+	secrets := secretsyml.SecretsMap{
+		"DB_PASS":       secretsyml.SecretSpec{Path: "prod/db/pass", Tags: []secretsyml.YamlTag{secretsyml.Var}},
+		"DB_PASS_FILE":  secretsyml.SecretSpec{Path: "prod/db/pass", Tags: []secretsyml.YamlTag{secretsyml.Var, secretsyml.File}},
+		"API_KEY":       secretsyml.SecretSpec{Path: "prod/api/key", Tags: []secretsyml.YamlTag{secretsyml.Var}},
+		"DB_PASSWORD_2": secretsyml.SecretSpec{Path: "prod/db/pass", Tags: []secretsyml.YamlTag{secretsyml.Var}},
+	}
+
+	unique, aliases := dedupeSecrets(secrets)
+
+	assert.Equal(t, secretsyml.SecretsMap{
+		"API_KEY": secrets["API_KEY"],
+		"DB_PASS": secrets["DB_PASS"],
+	}, unique)
+	assert.Equal(t, map[string][]string{
+		"API_KEY": {"API_KEY"},
+		"DB_PASS": {"DB_PASS", "DB_PASSWORD_2", "DB_PASS_FILE"},
+	}, aliases)
+}
+
+func TestFanOutResults(t *testing.T) {
+	aliases := map[string][]string{"DB_PASS": {"DB_PASS", "DB_PASS_FILE"}}
+
+	t.Run("copies results to every key of the path", func(t *testing.T) {
+		resultsCh := make(chan prov.Result, 1)
+		resultsCh <- prov.Result{Key: "DB_PASS", Value: "secret"}
+		close(resultsCh)
+
+		var results []prov.Result
+		for result := range fanOutResults(resultsCh, aliases, make(chan struct{})) {
+			results = append(results, result)
+		}
+
+		assert.Equal(t, []prov.Result{
+			{Key: "DB_PASS", Value: "secret"},
+			{Key: "DB_PASS_FILE", Value: "secret"},
+		}, results)
+	})
+}
+
+func TestWithMemo(t *testing.T) {
+	var calls int32
+	fetch := withMemo(func(path string) ([]byte, error) {
+		atomic.AddInt32(&calls, 1)
+		return []byte("value-of-" + path), nil
+	})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			value, err := fetch("prod/db/pass")
+			assert.NoError(t, err)
+			assert.Equal(t, "value-of-prod/db/pass", string(value))
+		}()
+	}
+	wg.Wait()
+
+	assert.Equal(t, int32(1), atomic.LoadInt32(&calls))
+
+	fetch("prod/api/key")
+	assert.Equal(t, int32(2), atomic.LoadInt32(&calls))
+}
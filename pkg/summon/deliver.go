@@ -0,0 +1,43 @@
+package summon
+
+import (
+	"io"
+	"os"
+	"strconv"
+)
+
+// Ways secrets can be delivered to the subcommand, see
+// SubprocessConfig.Deliver
+const (
+	DeliverEnv = "env"
+	DeliverFD  = "fd"
+)
+
+// SecretsFDEnvVar names the variable that tells a subcommand which file
+// descriptor to read its secrets from, when they are delivered with DeliverFD
+const SecretsFDEnvVar = "SUMMON_SECRETS_FD"
+
+// secretsFD is the file descriptor the secrets are delivered on: the first
+// one after stdin, stdout and stderr
+const secretsFD = 3
+
+// secretsFDEnv returns the variable pointing the subcommand at its secrets
+func secretsFDEnv() string {
+	return SecretsFDEnvVar + "=" + strconv.Itoa(secretsFD)
+}
+
+// deliverSecrets writes entries to w, each terminated by a NUL byte like in
+// /proc/<pid>/environ, and closes w. Values may span lines, but can't hold
+// NUL bytes, as in the environment.
+func deliverSecrets(w *os.File, entries []string) error {
+	defer w.Close()
+	for _, entry := range entries {
+		if _, err := io.WriteString(w, entry); err != nil {
+			return err
+		}
+		if _, err := w.Write([]byte{0}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,70 @@
+package summon
+
+import (
+	"fmt"
+	"path"
+	"runtime"
+	"strings"
+)
+
+// cleanEnvKept are the variables a subcommand inherits with CleanEnv, on top
+// of those kept explicitly. They are what most programs need to run at all.
+var cleanEnvKept = []string{
+	"PATH", "HOME", "USER", "LOGNAME", "SHELL", "TERM", "TZ", "LANG", "LC_*", "TMPDIR",
+	// Windows programs can't start without some of these
+	"SYSTEMROOT", "SYSTEMDRIVE", "WINDIR", "COMSPEC", "PATHEXT", "TEMP", "TMP", "USERPROFILE",
+}
+
+// validateEnvPatterns checks that patterns are valid for filterEnviron
+func validateEnvPatterns(patterns []string) error {
+	for _, pattern := range patterns {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid environment pattern %q: %s", pattern, err)
+		}
+	}
+	return nil
+}
+
+// filterEnviron returns the variables of environ (as KEY=VALUE pairs) that the
+// subcommand should inherit. If keep is given, only variables matching one of
+// its patterns are inherited. Variables matching a pattern in exclude never
+// are. Patterns are shell globs, e.g. AWS_* or *_TOKEN.
+func filterEnviron(environ []string, keep, exclude []string) []string {
+	if len(keep) == 0 && len(exclude) == 0 {
+		return environ
+	}
+
+	var out []string
+	for _, pair := range environ {
+		name := strings.SplitN(pair, "=", 2)[0]
+		if len(keep) > 0 && !matchesAny(name, keep) {
+			continue
+		}
+		if matchesAny(name, exclude) {
+			continue
+		}
+		out = append(out, pair)
+	}
+	return out
+}
+
+// cleanEnvKeep returns the patterns of variables kept with CleanEnv
+func cleanEnvKeep(keep []string) []string {
+	return append(append([]string{}, cleanEnvKept...), keep...)
+}
+
+func matchesAny(name string, patterns []string) bool {
+	// Variable names are case insensitive on Windows, e.g. Path
+	if runtime.GOOS == "windows" {
+		name = strings.ToUpper(name)
+	}
+	for _, pattern := range patterns {
+		if runtime.GOOS == "windows" {
+			pattern = strings.ToUpper(pattern)
+		}
+		if matched, _ := path.Match(pattern, name); matched {
+			return true
+		}
+	}
+	return false
+}
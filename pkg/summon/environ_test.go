@@ -0,0 +1,78 @@
+package summon
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFilterEnviron(t *testing.T) {
+	environ := []string{"PATH=/bin", "HOME=/root", "AWS_SECRET_ACCESS_KEY=x", "GITHUB_TOKEN=y", "LC_ALL=C"}
+
+	t.Run("Everything is inherited without patterns", func(t *testing.T) {
+		assert.Equal(t, environ, filterEnviron(environ, nil, nil))
+	})
+
+	t.Run("Excluded variables are left out", func(t *testing.T) {
+		assert.Equal(t, []string{"PATH=/bin", "HOME=/root", "LC_ALL=C"},
+			filterEnviron(environ, nil, []string{"AWS_*", "*_TOKEN"}))
+	})
+
+	t.Run("Only kept variables are inherited", func(t *testing.T) {
+		assert.Equal(t, []string{"PATH=/bin", "LC_ALL=C"},
+			filterEnviron(environ, []string{"PATH", "LC_*"}, nil))
+	})
+
+	t.Run("Exclusions win over kept variables", func(t *testing.T) {
+		assert.Equal(t, []string{"PATH=/bin"},
+			filterEnviron(environ, []string{"PATH", "LC_*"}, []string{"LC_ALL"}))
+	})
+}
+
+func TestValidateEnvPatterns(t *testing.T) {
+	assert.NoError(t, validateEnvPatterns([]string{"AWS_*", "TOKEN_[0-9]"}))
+	assert.EqualError(t, validateEnvPatterns([]string{"AWS_["}),
+		`invalid environment pattern "AWS_[": syntax error in pattern`)
+}
+
+func TestRunSubprocessEnvPatterns(t *testing.T) {
+	t.Setenv("SUMMON_TEST_CLOUD_TOKEN", "parent-token")
+	tempFile := filepath.Join(t.TempDir(), "outputFile.txt")
+
+	code, err := RunSubprocess(&SubprocessConfig{
+		Args:       []string{"sh", "-c", "echo -n \"$SUMMON_TEST_CLOUD_TOKEN:$SECRET_TOKEN\" > " + tempFile},
+		YamlInline: "SECRET_TOKEN: from-secrets-yml",
+		EnvExclude: []string{"*_TOKEN"},
+	})
+
+	assert.NoError(t, err)
+	assert.Equal(t, 0, code)
+	// Secrets are never filtered, only the inherited environment
+	content, _ := os.ReadFile(tempFile)
+	assert.Equal(t, ":from-secrets-yml", string(content))
+}
+
+func TestRunSubprocessCleanEnv(t *testing.T) {
+	t.Setenv("SUMMON_TEST_CLOUD_TOKEN", "parent-token")
+	t.Setenv("SUMMON_TEST_KEPT", "kept")
+	tempFile := filepath.Join(t.TempDir(), "outputFile.txt")
+
+	code, err := RunSubprocess(&SubprocessConfig{
+		Args:        []string{"sh", "-c", "env > " + tempFile},
+		YamlInline:  "DB_PASSWORD: !var db/password",
+		FetchSecret: func(string) ([]byte, error) { return []byte("hunter2"), nil },
+		EnvKeep:     []string{"SUMMON_TEST_KEPT"},
+		CleanEnv:    true,
+	})
+
+	assert.NoError(t, err)
+	assert.Equal(t, 0, code)
+
+	content, _ := os.ReadFile(tempFile)
+	assert.Contains(t, string(content), "DB_PASSWORD=hunter2\n")
+	assert.Contains(t, string(content), "SUMMON_TEST_KEPT=kept\n")
+	assert.Contains(t, string(content), "PATH="+os.Getenv("PATH")+"\n")
+	assert.NotContains(t, string(content), "SUMMON_TEST_CLOUD_TOKEN")
+}
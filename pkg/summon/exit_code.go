@@ -0,0 +1,125 @@
+package summon
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	prov "github.com/cyberark/summon/pkg/provider"
+)
+
+// Exit codes summon uses when it fails itself, as opposed to mirroring the
+// exit status of the subcommand
+const (
+	// ExitParseError means secrets.yml could not be read or parsed
+	ExitParseError = 2
+	// ExitProviderError means the provider failed to resolve a secret
+	ExitProviderError = 3
+	// ExitProviderNotFound means no usable provider could be found
+	ExitProviderNotFound = 4
+	// ExitSubcommandFailed replaces the subcommand's non-zero exit status when
+	// exit code passthrough is disabled
+	ExitSubcommandFailed = 5
+	// ExitTimeout means the subcommand was stopped because it ran for longer
+	// than allowed, like timeout(1) reports it
+	ExitTimeout = 124
+	// ExitUnknownError covers every other failure of summon
+	ExitUnknownError = 127
+)
+
+// ExitCodeError is a failure of summon, tagged with the exit code it should
+// cause summon to exit with
+type ExitCodeError struct {
+	ExitCode int
+	Err      error
+}
+
+func (e *ExitCodeError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *ExitCodeError) Unwrap() error {
+	return e.Err
+}
+
+// FetchError is the failure to resolve a secret with the provider
+type FetchError struct {
+	// Key is the variable being resolved, empty if there is none
+	Key string
+	// Path is the secret path the provider was asked for
+	Path string
+	// Provider is the provider that was asked, if known
+	Provider string
+	Err      error
+}
+
+func (e *FetchError) Error() string {
+	if e.Key == "" {
+		return fmt.Sprintf("Error fetching %v: %v", e.Path, e.Err)
+	}
+	return fmt.Sprintf("Error fetching variable %v: %v", e.Key, e.Err)
+}
+
+func (e *FetchError) Unwrap() error {
+	return e.Err
+}
+
+// FetchErrors are all the secrets that failed to resolve in one run
+type FetchErrors []*FetchError
+
+// Error lists the failures grouped by provider and sorted by variable
+func (e FetchErrors) Error() string {
+	byProvider := map[string][]*FetchError{}
+	var providers []string
+	for _, failure := range e {
+		provider := failure.provider()
+		if _, ok := byProvider[provider]; !ok {
+			providers = append(providers, provider)
+		}
+		byProvider[provider] = append(byProvider[provider], failure)
+	}
+	sort.Strings(providers)
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "Error fetching %d variables:", len(e))
+	for _, provider := range providers {
+		failures := byProvider[provider]
+		sort.Slice(failures, func(i, j int) bool { return failures[i].Key < failures[j].Key })
+
+		fmt.Fprintf(&b, "\n  provider %s:", provider)
+		for _, failure := range failures {
+			fmt.Fprintf(&b, "\n    %v (%v): %v", failure.Key, failure.Path, failure.Err)
+		}
+	}
+	return b.String()
+}
+
+// Unwrap exposes the individual failures to errors.As
+func (e FetchErrors) Unwrap() []error {
+	errs := make([]error, len(e))
+	for i, failure := range e {
+		errs[i] = failure
+	}
+	return errs
+}
+
+// provider returns the provider that failed, as reported by the provider call
+// if possible
+func (e *FetchError) provider() string {
+	var callErr *prov.CallError
+	if errors.As(e.Err, &callErr) && callErr.Provider != "" {
+		return callErr.Provider
+	}
+	return e.Provider
+}
+
+// ExitCodeOf returns the exit code summon should exit with after failing
+// with err
+func ExitCodeOf(err error) int {
+	var exitCodeErr *ExitCodeError
+	if errors.As(err, &exitCodeErr) {
+		return exitCodeErr.ExitCode
+	}
+	return ExitUnknownError
+}
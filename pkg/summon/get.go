@@ -0,0 +1,76 @@
+package summon
+
+import (
+	"fmt"
+	"strings"
+
+	prov "github.com/cyberark/summon/pkg/provider"
+	"github.com/cyberark/summon/pkg/secretsyml"
+)
+
+// ResolveSecret resolves a single secret, written like a value in secrets.yml
+// (e.g. "prod/db/password" or "!var:default='none' $env/db/password"), with
+// the provider, substitutions, retries and cache of sc. Values without a tag
+// are variables. Unlike RunSubprocess it returns the value itself, so file
+// tags are rejected: the temp file would be gone as soon as summon exits.
+func ResolveSecret(sc *SubprocessConfig, secret string) (string, error) {
+	subs, err := Substitutions(sc.Subs, "")
+	if err != nil {
+		return "", &ExitCodeError{ExitCode: ExitParseError, Err: err}
+	}
+	secrets, err := secretsyml.ParseFromPairs([]string{"SECRET=" + secret}, subs)
+	if err != nil {
+		return "", &ExitCodeError{ExitCode: ExitParseError, Err: err}
+	}
+	spec := secrets["SECRET"]
+
+	if spec.IsFile() {
+		return "", &ExitCodeError{
+			ExitCode: ExitParseError,
+			Err:      fmt.Errorf("file tags are not supported when resolving a single secret"),
+		}
+	}
+
+	value, err := ResolveSpec(sc, spec)
+	if err != nil {
+		return "", &ExitCodeError{
+			ExitCode: ExitProviderError,
+			Err:      &FetchError{Path: spec.Path, Provider: sc.Provider, Err: err},
+		}
+	}
+	return value, nil
+}
+
+// ResolveSpec resolves a parsed secret to the value RunSubprocess would give
+// it: variables are fetched with the provider, retries and cache of sc, list
+// items are resolved and joined, and modifiers, defaults and the type check
+// are applied. Files aren't written; their content is returned.
+func ResolveSpec(sc *SubprocessConfig, spec secretsyml.SecretSpec) (string, error) {
+	return resolveSpec(withCache(withRetries(sc.FetchSecret, sc.Retries, sc.RetryBackoff), sc.Cache), spec)
+}
+
+func resolveSpec(fetch SecretFetcher, spec secretsyml.SecretSpec) (string, error) {
+	value := spec.Path
+	if spec.IsList() {
+		values := make([]string, len(spec.Items))
+		for i, item := range spec.Items {
+			var err error
+			if values[i], err = resolveSpec(fetch, item); err != nil {
+				return "", err
+			}
+		}
+		value = strings.Join(values, spec.Separator)
+	} else if spec.IsVar() {
+		valueBytes, err := fetch(spec.Path)
+		if err != nil {
+			return "", err
+		}
+		// The provider may have answered with a metadata envelope
+		if value, _, err = prov.ParseResponse(string(valueBytes)); err != nil {
+			return "", err
+		}
+	}
+
+	// Apply modifiers, and set a default value if the provider didn't return one
+	return spec.Transform(value)
+}
@@ -0,0 +1,92 @@
+package summon
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	prov "github.com/cyberark/summon/pkg/provider"
+	"github.com/cyberark/summon/pkg/secretsyml"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestResolveSecret(t *testing.T) {
+	sc := &SubprocessConfig{
+		Subs: []string{"env=prod"},
+		FetchSecret: func(path string) ([]byte, error) {
+			if path == "prod/empty" {
+				return []byte{}, nil
+			}
+			if path == "prod/missing" {
+				return nil, fmt.Errorf("not found")
+			}
+			if path == "prod/leased" {
+				return []byte(`{"summon_metadata": 1, "value": " leased ", "lease_duration": 60}`), nil
+			}
+			return []byte("value-of-" + path), nil
+		},
+	}
+
+	t.Run("resolves an untagged path as a variable", func(t *testing.T) {
+		value, err := ResolveSecret(sc, "$env/db/password")
+		assert.NoError(t, err)
+		assert.Equal(t, "value-of-prod/db/password", value)
+	})
+
+	t.Run("unwraps metadata envelopes", func(t *testing.T) {
+		value, err := ResolveSecret(sc, "!var:trim $env/leased")
+		assert.NoError(t, err)
+		assert.Equal(t, "leased", value)
+	})
+
+	t.Run("applies defaults", func(t *testing.T) {
+		value, err := ResolveSecret(sc, "!var:default='fallback' $env/empty")
+		assert.NoError(t, err)
+		assert.Equal(t, "fallback", value)
+	})
+
+	t.Run("returns literals as they are", func(t *testing.T) {
+		value, err := ResolveSecret(sc, "!str $env")
+		assert.NoError(t, err)
+		assert.Equal(t, "prod", value)
+	})
+
+	t.Run("rejects file tags", func(t *testing.T) {
+		_, err := ResolveSecret(sc, "!var:file $env/cert")
+		assert.Equal(t, ExitParseError, ExitCodeOf(err))
+	})
+
+	t.Run("fails with the provider error exit code", func(t *testing.T) {
+		_, err := ResolveSecret(sc, "$env/missing")
+		assert.EqualError(t, err, "Error fetching prod/missing: not found")
+		assert.Equal(t, ExitProviderError, ExitCodeOf(err))
+	})
+}
+
+func TestResolveSpec(t *testing.T) {
+	sleep = func(time.Duration) {}
+	defer func() { sleep = time.Sleep }()
+
+	attempts := 0
+	sc := &SubprocessConfig{
+		Retries: 1,
+		FetchSecret: func(path string) ([]byte, error) {
+			if attempts++; attempts == 1 {
+				return nil, &prov.CallError{ExitCode: 75, Err: errors.New("exit status 75")}
+			}
+			return []byte("value-of-" + path), nil
+		},
+	}
+
+	t.Run("retries the provider", func(t *testing.T) {
+		secrets, err := secretsyml.ParseFromString("HOSTS: !var [db1/host, !str db2.example.com]\n", "", nil)
+		assert.NoError(t, err)
+
+		value, err := ResolveSpec(sc, secrets["HOSTS"])
+		assert.NoError(t, err)
+		assert.Equal(t, "value-of-db1/host,db2.example.com", value)
+		assert.Equal(t, 2, attempts)
+	})
+}
@@ -0,0 +1,51 @@
+package summon
+
+import (
+	"sort"
+	"unsafe"
+)
+
+// envBuffer holds the NAME=VALUE entries of the secrets in the subcommand's
+// environment in a single buffer, which can be locked into memory, so it
+// isn't swapped out, and is wiped once the subcommand has started. Only this
+// final copy is: the values are still held, unlocked and never wiped, in the
+// strings they were resolved into, e.g. the env map the buffer is built from.
+type envBuffer struct {
+	buf    []byte
+	locked bool
+}
+
+// newEnvBuffer writes the variables in env to a new buffer and returns it
+// along with the entries, which share its memory. If lock is set, the buffer
+// is locked into memory where the platform allows it.
+func newEnvBuffer(env map[string]string, lock bool) (*envBuffer, []string) {
+	size := 0
+	for k, v := range env {
+		size += len(k) + len(v) + 1
+	}
+	b := &envBuffer{buf: make([]byte, 0, size)}
+	if lock && size > 0 {
+		b.locked = lockMemory(b.buf[:size]) == nil
+	}
+
+	entries := make([]string, 0, len(env))
+	for k, v := range env {
+		start := len(b.buf)
+		b.buf = append(b.buf, k...)
+		b.buf = append(b.buf, '=')
+		b.buf = append(b.buf, v...)
+		entries = append(entries, unsafe.String(&b.buf[start], len(b.buf)-start))
+	}
+	sort.Strings(entries)
+	return b, entries
+}
+
+// wipe zeroes the buffer, and with it the entries, and unlocks it. The entries
+// must not be used afterwards.
+func (b *envBuffer) wipe() {
+	clear(b.buf)
+	if b.locked {
+		unlockMemory(b.buf)
+		b.locked = false
+	}
+}
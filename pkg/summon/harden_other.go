@@ -0,0 +1,23 @@
+//go:build !linux && !darwin && !windows
+
+package summon
+
+import "errors"
+
+var errMemoryLockUnsupported = errors.New("locking memory is not supported on this platform")
+
+// disableCoreDumps does nothing on platforms other than Linux, macOS and
+// Windows
+func disableCoreDumps() error {
+	return nil
+}
+
+// lockMemory always fails on platforms other than Linux, macOS and Windows,
+// so the buffer is wiped but never unlocked
+func lockMemory(b []byte) error {
+	return errMemoryLockUnsupported
+}
+
+func unlockMemory(b []byte) error {
+	return nil
+}
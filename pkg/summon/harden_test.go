@@ -0,0 +1,51 @@
+package summon
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEnvBuffer(t *testing.T) {
+	t.Run("Entries are backed by the buffer", func(t *testing.T) {
+		buf, entries := newEnvBuffer(map[string]string{"B": "two", "A": "one", "EMPTY": ""}, true)
+
+		assert.Equal(t, []string{"A=one", "B=two", "EMPTY="}, entries)
+		assert.Len(t, buf.buf, 16)
+
+		buf.wipe()
+		assert.Equal(t, make([]byte, 16), buf.buf)
+		assert.False(t, buf.locked)
+		assert.Equal(t, "\x00\x00\x00\x00\x00", entries[0])
+	})
+
+	t.Run("Empty environments need no buffer", func(t *testing.T) {
+		buf, entries := newEnvBuffer(map[string]string{}, true)
+
+		assert.Empty(t, entries)
+		assert.False(t, buf.locked)
+		buf.wipe()
+	})
+}
+
+func TestHarden(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("core dumps can't be disabled on Windows")
+	}
+
+	out := filepath.Join(t.TempDir(), "out")
+	code, err := RunSubprocess(&SubprocessConfig{
+		Args:        []string{"sh", "-c", "echo $PASSWORD $(ulimit -c) > " + out},
+		YamlInline:  "PASSWORD: !var db/password",
+		FetchSecret: func(string) ([]byte, error) { return []byte("hunter2"), nil },
+		Harden:      true,
+	})
+
+	assert.NoError(t, err)
+	assert.Equal(t, 0, code)
+	content, _ := os.ReadFile(out)
+	assert.Equal(t, "hunter2 0\n", string(content))
+}
@@ -0,0 +1,22 @@
+//go:build linux || darwin
+
+package summon
+
+import "syscall"
+
+// disableCoreDumps keeps summon from writing a core dump, which would hold
+// the secrets in its memory. The limit is inherited by the provider and the
+// subcommand.
+func disableCoreDumps() error {
+	return syscall.Setrlimit(syscall.RLIMIT_CORE, &syscall.Rlimit{Cur: 0, Max: 0})
+}
+
+// lockMemory keeps b from being swapped out. This fails if it would exceed
+// RLIMIT_MEMLOCK.
+func lockMemory(b []byte) error {
+	return syscall.Mlock(b)
+}
+
+func unlockMemory(b []byte) error {
+	return syscall.Munlock(b)
+}
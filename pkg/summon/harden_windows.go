@@ -0,0 +1,32 @@
+//go:build windows
+
+package summon
+
+import "unsafe"
+
+var (
+	procVirtualLock   = kernel32.NewProc("VirtualLock")
+	procVirtualUnlock = kernel32.NewProc("VirtualUnlock")
+)
+
+// disableCoreDumps does nothing on Windows, where crash dumps are written by
+// Windows Error Reporting rather than the process
+func disableCoreDumps() error {
+	return nil
+}
+
+// lockMemory keeps b from being paged out. This fails if it would exceed the
+// process's minimum working set size.
+func lockMemory(b []byte) error {
+	if r, _, err := procVirtualLock.Call(uintptr(unsafe.Pointer(&b[0])), uintptr(len(b))); r == 0 {
+		return err
+	}
+	return nil
+}
+
+func unlockMemory(b []byte) error {
+	if r, _, err := procVirtualUnlock.Call(uintptr(unsafe.Pointer(&b[0])), uintptr(len(b))); r == 0 {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,62 @@
+package summon
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/cyberark/summon/pkg/secretsyml"
+)
+
+// listItemKey names an item of a list-valued secret while it is resolved
+func listItemKey(key string, i int) string {
+	return fmt.Sprintf("%s[%d]", key, i)
+}
+
+// expandLists returns secrets with every list-valued secret replaced by its
+// items, named KEY[0], KEY[1], ..., so that the items are resolved like any
+// other secret
+func expandLists(secrets secretsyml.SecretsMap) secretsyml.SecretsMap {
+	out := make(secretsyml.SecretsMap, len(secrets))
+	for key, spec := range secrets {
+		if !spec.IsList() {
+			out[key] = spec
+			continue
+		}
+		for i, item := range spec.Items {
+			out[listItemKey(key, i)] = item
+		}
+	}
+	return out
+}
+
+// joinLists replaces the items of every list-valued secret in env with the
+// list itself, its items' values joined in order. A list with an item missing
+// from env, because its error was ignored, is left out. Modifiers of the list
+// apply to the joined value.
+func joinLists(secrets secretsyml.SecretsMap, env map[string]string, tempFactory *TempFactory) error {
+	for key, spec := range secrets {
+		if !spec.IsList() {
+			continue
+		}
+
+		values := make([]string, len(spec.Items))
+		complete := true
+		for i := range spec.Items {
+			itemKey := listItemKey(key, i)
+			value, ok := env[itemKey]
+			values[i] = value
+			complete = complete && ok
+			delete(env, itemKey)
+		}
+		if !complete {
+			continue
+		}
+
+		value, err := spec.Transform(strings.Join(values, spec.Separator))
+		if err != nil {
+			return &FetchError{Key: key, Err: err}
+		}
+		_, env[key] = formatForEnv(key, value, spec, tempFactory)
+	}
+	return nil
+}
@@ -0,0 +1,59 @@
+package summon
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/cyberark/summon/pkg/secretsyml"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestListSecrets(t *testing.T) {
+	fetchSecret := func(path string) ([]byte, error) {
+		if path == "missing" {
+			return nil, os.ErrNotExist
+		}
+		return []byte("value-of-" + path), nil
+	}
+
+	t.Run("Items are resolved and joined in order", func(t *testing.T) {
+		tempFile := filepath.Join(t.TempDir(), "outputFile.txt")
+
+		code, err := RunSubprocess(&SubprocessConfig{
+			Args: []string{"sh", "-c", "echo -n \"$HOSTS|$(cat $BUNDLE)\" > " + tempFile},
+			YamlInline: `
+HOSTS: !var [db1, !str db2.example.com, db3]
+BUNDLE: !var:file:join='%0A' [ca/root, ca/intermediate]
+`,
+			FetchSecret: fetchSecret,
+		})
+
+		assert.NoError(t, err)
+		assert.Equal(t, 0, code)
+		content, _ := os.ReadFile(tempFile)
+		assert.Equal(t, "value-of-db1,db2.example.com,value-of-db3|value-of-ca/root\nvalue-of-ca/intermediate", string(content))
+	})
+
+	t.Run("Failing items are reported by index", func(t *testing.T) {
+		_, err := RunSubprocess(&SubprocessConfig{
+			Args:        []string{"true"},
+			YamlInline:  "HOSTS: !var [db1, missing]\n",
+			FetchSecret: fetchSecret,
+		})
+
+		assert.EqualError(t, err, "Error fetching variable HOSTS[1]: file does not exist")
+	})
+
+	t.Run("Lists with ignored errors are left out", func(t *testing.T) {
+		env := map[string]string{"HOSTS[0]": "a"}
+		secrets := secretsyml.SecretsMap{"HOSTS": {
+			Tags:      []secretsyml.YamlTag{secretsyml.Var},
+			Items:     []secretsyml.SecretSpec{{Path: "a"}, {Path: "b"}},
+			Separator: ",",
+		}}
+
+		assert.NoError(t, joinLists(secrets, env, nil))
+		assert.Empty(t, env)
+	})
+}
@@ -0,0 +1,36 @@
+package summon
+
+import prov "github.com/cyberark/summon/pkg/provider"
+
+// pipeResults passes each result from in through fn, and sends on what fn
+// returns for it. The results of interactive mode go through several such
+// stages on their way to the run; they all stop once done is closed, so none
+// is left waiting on a provider, or on a run that no longer reads results,
+// e.g. after the provider failed.
+func pipeResults(in chan prov.Result, done <-chan struct{}, fn func(prov.Result) []prov.Result) chan prov.Result {
+	out := make(chan prov.Result)
+	go func() {
+		defer close(out)
+		for {
+			var result prov.Result
+			var ok bool
+			select {
+			case result, ok = <-in:
+				if !ok {
+					return
+				}
+			case <-done:
+				return
+			}
+
+			for _, r := range fn(result) {
+				select {
+				case out <- r:
+				case <-done:
+					return
+				}
+			}
+		}
+	}()
+	return out
+}
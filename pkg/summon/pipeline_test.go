@@ -0,0 +1,63 @@
+package summon
+
+import (
+	"testing"
+	"time"
+
+	prov "github.com/cyberark/summon/pkg/provider"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPipeResults(t *testing.T) {
+	double := func(result prov.Result) []prov.Result {
+		return []prov.Result{result, result}
+	}
+	// drain reads out until it is closed, failing if that takes too long
+	drain := func(t *testing.T, out chan prov.Result) []prov.Result {
+		var results []prov.Result
+		timeout := time.After(5 * time.Second)
+		for {
+			select {
+			case result, ok := <-out:
+				if !ok {
+					return results
+				}
+				results = append(results, result)
+			case <-timeout:
+				t.Fatal("still waiting on the provider")
+			}
+		}
+	}
+
+	t.Run("sends on what fn returns for each result", func(t *testing.T) {
+		in := make(chan prov.Result, 1)
+		in <- prov.Result{Key: "DB_PASS", Value: "secret"}
+		close(in)
+
+		assert.Equal(t, []prov.Result{
+			{Key: "DB_PASS", Value: "secret"},
+			{Key: "DB_PASS", Value: "secret"},
+		}, drain(t, pipeResults(in, make(chan struct{}), double)))
+	})
+
+	t.Run("stops waiting on the provider when the run is done", func(t *testing.T) {
+		done := make(chan struct{})
+		// The provider never answers
+		out := pipeResults(make(chan prov.Result), done, double)
+		close(done)
+
+		assert.Empty(t, drain(t, out))
+	})
+
+	t.Run("stops sending when the run is done", func(t *testing.T) {
+		in := make(chan prov.Result, 1)
+		in <- prov.Result{Key: "DB_PASS", Value: "secret"}
+		done := make(chan struct{})
+		out := pipeResults(in, done, double)
+		// Only the first copy is read, and the provider stays open
+		<-out
+		close(done)
+
+		drain(t, out)
+	})
+}
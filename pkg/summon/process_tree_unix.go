@@ -0,0 +1,12 @@
+//go:build !windows
+
+package summon
+
+import (
+	"os/exec"
+)
+
+// trackProcessTree is a no-op outside Windows
+func trackProcessTree(cmd *exec.Cmd) func() {
+	return func() {}
+}
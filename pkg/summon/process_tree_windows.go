@@ -0,0 +1,79 @@
+//go:build windows
+
+package summon
+
+import (
+	"os/exec"
+	"syscall"
+	"unsafe"
+)
+
+const (
+	jobObjectExtendedLimitInformationClass = 9
+	jobObjectLimitKillOnJobClose           = 0x2000
+	processSetQuota                        = 0x0100
+	processTerminate                       = 0x0001
+)
+
+var (
+	kernel32                     = syscall.NewLazyDLL("kernel32.dll")
+	procCreateJobObjectW         = kernel32.NewProc("CreateJobObjectW")
+	procSetInformationJobObject  = kernel32.NewProc("SetInformationJobObject")
+	procAssignProcessToJobObject = kernel32.NewProc("AssignProcessToJobObject")
+)
+
+// jobObjectExtendedLimitInformation mirrors JOBOBJECT_EXTENDED_LIMIT_INFORMATION
+type jobObjectExtendedLimitInformation struct {
+	PerProcessUserTimeLimit int64
+	PerJobUserTimeLimit     int64
+	LimitFlags              uint32
+	MinimumWorkingSetSize   uintptr
+	MaximumWorkingSetSize   uintptr
+	ActiveProcessLimit      uint32
+	Affinity                uintptr
+	PriorityClass           uint32
+	SchedulingClass         uint32
+	IoCounters              [6]uint64
+	ProcessMemoryLimit      uintptr
+	JobMemoryLimit          uintptr
+	PeakProcessMemoryUsed   uintptr
+	PeakJobMemoryUsed       uintptr
+}
+
+// trackProcessTree puts the started child into a Job Object that kills every
+// process in it once the job handle is closed. The returned function closes
+// the handle, terminating any processes the child left behind; if summon
+// itself is terminated, Windows closes the handle for us.
+//
+// Processes the child starts before it is assigned to the job escape it, but
+// that window is only as long as summon takes to make the assignment.
+func trackProcessTree(cmd *exec.Cmd) func() {
+	job, _, _ := procCreateJobObjectW.Call(0, 0)
+	if job == 0 {
+		return func() {}
+	}
+	release := func() { syscall.CloseHandle(syscall.Handle(job)) }
+
+	info := jobObjectExtendedLimitInformation{LimitFlags: jobObjectLimitKillOnJobClose}
+	r, _, _ := procSetInformationJobObject.Call(
+		job, jobObjectExtendedLimitInformationClass,
+		uintptr(unsafe.Pointer(&info)), unsafe.Sizeof(info))
+	if r == 0 {
+		release()
+		return func() {}
+	}
+
+	process, err := syscall.OpenProcess(processSetQuota|processTerminate, false, uint32(cmd.Process.Pid))
+	if err != nil {
+		release()
+		return func() {}
+	}
+	defer syscall.CloseHandle(process)
+
+	if r, _, _ := procAssignProcessToJobObject.Call(job, uintptr(process)); r == 0 {
+		release()
+		return func() {}
+	}
+
+	return release
+}
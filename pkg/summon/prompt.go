@@ -0,0 +1,94 @@
+package summon
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	prov "github.com/cyberark/summon/pkg/provider"
+	"github.com/cyberark/summon/pkg/secretsyml"
+	"golang.org/x/term"
+)
+
+// Prompter asks the user for the value of a secret, showing message
+type Prompter func(message string) (string, error)
+
+// ErrNoTerminal is returned by TerminalPrompt and TerminalConfirm when stdin
+// isn't a terminal
+var ErrNoTerminal = errors.New("stdin is not a terminal")
+
+// TerminalPrompt asks for a secret on the terminal without echoing it
+func TerminalPrompt(message string) (string, error) {
+	fd := int(os.Stdin.Fd())
+	if !term.IsTerminal(fd) {
+		return "", ErrNoTerminal
+	}
+
+	fmt.Fprint(os.Stderr, message)
+	value, err := term.ReadPassword(fd)
+	fmt.Fprintln(os.Stderr)
+	return string(value), err
+}
+
+// Confirmer asks the user a yes or no question
+type Confirmer func(question string) (bool, error)
+
+// TerminalConfirm asks a question on the terminal, taking anything but y or
+// yes as a no
+func TerminalConfirm(question string) (bool, error) {
+	if !term.IsTerminal(int(os.Stdin.Fd())) {
+		return false, ErrNoTerminal
+	}
+
+	fmt.Fprintf(os.Stderr, "%s [y/N] ", question)
+	// A byte at a time, so as not to consume input meant for the subcommand
+	var answer []byte
+	b := make([]byte, 1)
+	for {
+		n, err := os.Stdin.Read(b)
+		if n == 0 || err != nil || b[0] == '\n' {
+			break
+		}
+		answer = append(answer, b[0])
+	}
+	switch strings.ToLower(strings.TrimSpace(string(answer))) {
+	case "y", "yes":
+		return true, nil
+	}
+	return false, nil
+}
+
+// resolvePrompts asks for the value of every secret tagged !prompt
+func resolvePrompts(prompt Prompter, secrets secretsyml.SecretsMap, tempFactory *TempFactory) ([]prov.Result, error) {
+	var results []prov.Result
+	for key, spec := range secrets {
+		if !spec.IsPrompt() {
+			continue
+		}
+		message := spec.Path
+		if message == "" {
+			message = fmt.Sprintf("Enter value for %s: ", key)
+		}
+		value, err := promptFor(prompt, key, message, spec)
+		if err != nil {
+			return nil, &ExitCodeError{ExitCode: ExitProviderError, Err: err}
+		}
+		k, v := formatForEnv(key, value, spec, tempFactory)
+		results = append(results, prov.Result{Key: k, Value: v})
+	}
+	return results, nil
+}
+
+// promptFor asks for the value of the secret key, applying its modifiers and
+// falling back to its default value if the answer is empty
+func promptFor(prompt Prompter, key, message string, spec secretsyml.SecretSpec) (string, error) {
+	if prompt == nil {
+		return "", fmt.Errorf("cannot prompt for %s: prompting is not available", key)
+	}
+	value, err := prompt(message)
+	if err != nil {
+		return "", fmt.Errorf("unable to prompt for %s: %s", key, err)
+	}
+	return spec.Transform(value)
+}
@@ -0,0 +1,68 @@
+package summon
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPrompt(t *testing.T) {
+	var messages []string
+	prompt := func(message string) (string, error) {
+		messages = append(messages, message)
+		return "typed-value", nil
+	}
+
+	t.Run("Secrets tagged !prompt are asked for", func(t *testing.T) {
+		messages = nil
+		tempFile := filepath.Join(t.TempDir(), "outputFile.txt")
+
+		code, err := RunSubprocess(&SubprocessConfig{
+			Args:       []string{"sh", "-c", "echo -n $PASSWORD > " + tempFile},
+			YamlInline: "PASSWORD: !prompt 'Break-glass password: '",
+			Prompt:     prompt,
+		})
+
+		assert.NoError(t, err)
+		assert.Equal(t, 0, code)
+		assert.Equal(t, []string{"Break-glass password: "}, messages)
+
+		content, _ := os.ReadFile(tempFile)
+		assert.Equal(t, "typed-value", string(content))
+	})
+
+	t.Run("Provider failures are asked for with PromptOnFailure", func(t *testing.T) {
+		messages = nil
+		tempFile := filepath.Join(t.TempDir(), "outputFile.txt")
+
+		code, err := RunSubprocess(&SubprocessConfig{
+			Args:       []string{"sh", "-c", "echo -n $DB_PASS > " + tempFile},
+			YamlInline: "DB_PASS: !var prod/db/password",
+			FetchSecret: func(string) ([]byte, error) {
+				return nil, errors.New("not found")
+			},
+			Prompt:          prompt,
+			PromptOnFailure: true,
+		})
+
+		assert.NoError(t, err)
+		assert.Equal(t, 0, code)
+		assert.Equal(t, []string{"Unable to fetch DB_PASS (prod/db/password): not found\nEnter value for DB_PASS: "}, messages)
+
+		content, _ := os.ReadFile(tempFile)
+		assert.Equal(t, "typed-value", string(content))
+	})
+
+	t.Run("Prompting fails without a prompter", func(t *testing.T) {
+		_, err := RunSubprocess(&SubprocessConfig{
+			Args:       []string{"true"},
+			YamlInline: "PASSWORD: !prompt",
+		})
+
+		assert.EqualError(t, err, "cannot prompt for PASSWORD: prompting is not available")
+		assert.Equal(t, ExitProviderError, ExitCodeOf(err))
+	})
+}
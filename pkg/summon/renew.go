@@ -0,0 +1,222 @@
+package summon
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	prov "github.com/cyberark/summon/pkg/provider"
+	"github.com/cyberark/summon/pkg/secretsyml"
+)
+
+// renewRetryDelay is how long to wait before trying again when renewing a
+// secret failed
+var renewRetryDelay = 10 * time.Second
+
+// leases records when the values providers returned for secret paths expire,
+// as reported in their metadata. A nil *leases records nothing.
+type leases struct {
+	mu      sync.Mutex
+	expires map[string]time.Time
+}
+
+func newLeases() *leases {
+	return &leases{expires: make(map[string]time.Time)}
+}
+
+// record notes the lease in a provider's response for path, if it has one
+func (l *leases) record(path, response string) {
+	if l == nil {
+		return
+	}
+	_, metadata, err := prov.ParseResponse(response)
+	if err != nil || metadata == nil || metadata.LeaseDuration <= 0 {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.expires[path] = time.Now().Add(metadata.LeaseDuration)
+}
+
+func (l *leases) get(path string) (time.Time, bool) {
+	if l == nil {
+		return time.Time{}, false
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	expires, ok := l.expires[path]
+	return expires, ok
+}
+
+// withLeases wraps fetch so that the leases in its responses are recorded
+func withLeases(fetch SecretFetcher, l *leases) SecretFetcher {
+	if l == nil {
+		return fetch
+	}
+	return func(path string) ([]byte, error) {
+		value, err := fetch(path)
+		if err == nil {
+			l.record(path, string(value))
+		}
+		return value, err
+	}
+}
+
+// recordLeases passes results from the provider through unchanged, recording
+// the leases of their values on the way
+func recordLeases(l *leases, resultsCh chan prov.Result, secrets secretsyml.SecretsMap,
+	done <-chan struct{}) chan prov.Result {
+	if l == nil {
+		return resultsCh
+	}
+
+	return pipeResults(resultsCh, done, func(result prov.Result) []prov.Result {
+		if result.Error == nil {
+			l.record(secrets[result.Key].Path, result.Value)
+		}
+		return []prov.Result{result}
+	})
+}
+
+// leasedFile is a !file secret whose value expires
+type leasedFile struct {
+	key     string
+	spec    secretsyml.SecretSpec
+	file    string
+	expires time.Time
+}
+
+// leasedFiles returns the !file secrets in env whose values are leased
+func leasedFiles(secrets secretsyml.SecretsMap, env map[string]string, l *leases) []leasedFile {
+	var files []leasedFile
+	for key, file := range env {
+		spec, ok := secrets[key]
+		if !ok || !spec.IsVar() || !spec.IsFile() || spec.IsList() {
+			continue
+		}
+		if expires, ok := l.get(spec.Path); ok {
+			files = append(files, leasedFile{key: key, spec: spec, file: file, expires: expires})
+		}
+	}
+	return files
+}
+
+// renewal refreshes leased !file secrets while the subcommand runs
+type renewal struct {
+	fetch SecretFetcher
+	// notify is called after a file was refreshed, if set
+	notify func()
+
+	// mu keeps files from being replaced once the renewal is stopped, as the
+	// temp files are about to be removed
+	mu      sync.Mutex
+	stopped bool
+	done    chan struct{}
+}
+
+// renewFiles refreshes every file in files when two thirds of its lease
+// have passed, until the returned function is called. A file is replaced
+// atomically, so readers see either the old value or the new one.
+func renewFiles(files []leasedFile, fetch SecretFetcher, notify func()) func() {
+	r := &renewal{fetch: fetch, notify: notify, done: make(chan struct{})}
+	for _, file := range files {
+		go r.renew(file)
+	}
+	return r.stop
+}
+
+func (r *renewal) stop() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if !r.stopped {
+		r.stopped = true
+		close(r.done)
+	}
+}
+
+func (r *renewal) renew(file leasedFile) {
+	delay := renewDelay(time.Now(), file.expires)
+	for {
+		select {
+		case <-r.done:
+			return
+		case <-time.After(delay):
+		}
+
+		expires, err := r.refresh(file)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "summon: unable to renew %s: %s\n", file.key, err)
+			delay = renewRetryDelay
+			continue
+		}
+		if expires.IsZero() {
+			// The new value isn't leased
+			return
+		}
+		delay = renewDelay(time.Now(), expires)
+	}
+}
+
+// renewDelay returns how long to wait before renewing a value that expires
+// at expires: until two thirds of the remaining lease have passed
+func renewDelay(now, expires time.Time) time.Duration {
+	return expires.Sub(now) * 2 / 3
+}
+
+// refresh fetches a new value for file and replaces its temp file with it.
+// It returns when the new value expires, or the zero time if it isn't leased.
+func (r *renewal) refresh(file leasedFile) (time.Time, error) {
+	response, err := r.fetch(file.spec.Path)
+	if err != nil {
+		return time.Time{}, err
+	}
+	fetched := time.Now()
+	value, metadata, err := prov.ParseResponse(string(response))
+	if err != nil {
+		return time.Time{}, err
+	}
+	if value, err = file.spec.Transform(value); err != nil {
+		return time.Time{}, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.stopped {
+		return time.Time{}, nil
+	}
+	if err := replaceFile(file.file, value); err != nil {
+		return time.Time{}, err
+	}
+	if r.notify != nil {
+		r.notify()
+	}
+
+	if metadata == nil || metadata.LeaseDuration <= 0 {
+		return time.Time{}, nil
+	}
+	return fetched.Add(metadata.LeaseDuration), nil
+}
+
+// replaceFile atomically replaces the content of path with value
+func replaceFile(path, value string) error {
+	f, err := os.CreateTemp(filepath.Dir(path), ".summon")
+	if err != nil {
+		return err
+	}
+	_, err = f.WriteString(value)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = keepOwner(path, f.Name())
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), path)
+	}
+	if err != nil {
+		os.Remove(f.Name())
+	}
+	return err
+}
@@ -0,0 +1,86 @@
+package summon
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/cyberark/summon/pkg/secretsyml"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLeasedFiles(t *testing.T) {
+	secrets, err := secretsyml.ParseFromString(`
+CREDS: !var:file db/creds
+CERT: !var:file tls/cert
+PASSWORD: !var db/creds
+`, "", nil)
+	assert.NoError(t, err)
+
+	l := newLeases()
+	l.record("db/creds", `{"summon_metadata": 1, "value": "x", "lease_duration": 60}`)
+	l.record("tls/cert", "plain")
+
+	files := leasedFiles(secrets, map[string]string{
+		"CREDS":    "/tmp/creds",
+		"CERT":     "/tmp/cert",
+		"PASSWORD": "x",
+	}, l)
+
+	// Only file secrets can be updated while the command runs
+	assert.Len(t, files, 1)
+	assert.Equal(t, "CREDS", files[0].key)
+	assert.Equal(t, "/tmp/creds", files[0].file)
+	assert.WithinDuration(t, time.Now().Add(time.Minute), files[0].expires, time.Second)
+
+	assert.Empty(t, leasedFiles(secrets, map[string]string{"CREDS": "/tmp/creds"}, nil))
+}
+
+func TestRenewDelay(t *testing.T) {
+	now := time.Now()
+	assert.Equal(t, 40*time.Second, renewDelay(now, now.Add(time.Minute)))
+	assert.Equal(t, -20*time.Second, renewDelay(now, now.Add(-30*time.Second)))
+}
+
+func TestRenewFiles(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "creds")
+	assert.NoError(t, os.WriteFile(file, []byte("cred-0"), 0o600))
+
+	var fetches, notifications int32
+	fetch := func(path string) ([]byte, error) {
+		n := atomic.AddInt32(&fetches, 1)
+		return []byte(fmt.Sprintf(`{"summon_metadata": 1, "value": "cred-%d", "lease_duration": 1}`, n)), nil
+	}
+	notify := func() { atomic.AddInt32(&notifications, 1) }
+
+	stop := renewFiles([]leasedFile{{
+		key:     "CREDS",
+		spec:    secretsyml.SecretSpec{Path: "db/creds", Tags: []secretsyml.YamlTag{secretsyml.Var, secretsyml.File}},
+		file:    file,
+		expires: time.Now().Add(30 * time.Millisecond),
+	}}, fetch, notify)
+
+	assert.Eventually(t, func() bool {
+		content, _ := os.ReadFile(file)
+		return string(content) == "cred-1"
+	}, time.Second, 5*time.Millisecond)
+	stop()
+
+	assert.Equal(t, int32(1), atomic.LoadInt32(&fetches))
+	assert.Equal(t, int32(1), atomic.LoadInt32(&notifications))
+	// The file was replaced rather than rewritten, so nothing is left behind
+	entries, _ := os.ReadDir(filepath.Dir(file))
+	assert.Len(t, entries, 1)
+}
+
+func TestRenewWithCache(t *testing.T) {
+	_, err := RunSubprocess(&SubprocessConfig{
+		Args:  []string{"true"},
+		Renew: true,
+		Cache: mapCache{},
+	})
+	assert.EqualError(t, err, "renewing leased secrets can't be combined with caching them")
+}
@@ -0,0 +1,55 @@
+package summon
+
+import (
+	"errors"
+	"math/rand"
+	"time"
+
+	prov "github.com/cyberark/summon/pkg/provider"
+)
+
+// DefaultRetryBackoff is the delay before the first retry of a failed
+// provider call. It doubles with every further attempt.
+const DefaultRetryBackoff = 500 * time.Millisecond
+
+// sleep is swapped out in tests to avoid waiting on real backoff delays
+var sleep = time.Sleep
+
+// withRetries wraps fetch so that transient provider failures are retried up
+// to `retries` times, with exponential backoff and jitter between attempts.
+func withRetries(fetch SecretFetcher, retries int, backoff time.Duration) SecretFetcher {
+	if retries <= 0 {
+		return fetch
+	}
+	if backoff <= 0 {
+		backoff = DefaultRetryBackoff
+	}
+
+	return func(path string) ([]byte, error) {
+		value, err := fetch(path)
+		for attempt := 0; attempt < retries && isTransient(err); attempt++ {
+			sleep(backoffDelay(backoff, attempt))
+			value, err = fetch(path)
+		}
+		return value, err
+	}
+}
+
+// backoffDelay returns the delay before retry number `attempt` (zero based):
+// base * 2^attempt, randomly reduced by up to half so that concurrent
+// fetches don't retry in lockstep.
+func backoffDelay(base time.Duration, attempt int) time.Duration {
+	delay := base << uint(attempt)
+	if delay <= 0 {
+		// Overflowed; don't let absurd attempt counts wrap around
+		delay = base
+	}
+	half := int64(delay / 2)
+	return time.Duration(half + rand.Int63n(half+1))
+}
+
+// isTransient reports whether err is a provider failure worth retrying
+func isTransient(err error) bool {
+	var callErr *prov.CallError
+	return errors.As(err, &callErr) && callErr.Transient()
+}
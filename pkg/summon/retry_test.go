@@ -0,0 +1,74 @@
+package summon
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	prov "github.com/cyberark/summon/pkg/provider"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWithRetries(t *testing.T) {
+	var delays []time.Duration
+	sleep = func(d time.Duration) { delays = append(delays, d) }
+	defer func() { sleep = time.Sleep }()
+
+	transient := &prov.CallError{ExitCode: 75, Err: errors.New("exit status 75")}
+	permanent := &prov.CallError{ExitCode: 1, Err: errors.New("exit status 1")}
+
+	// failingFetcher fails with err `failures` times before succeeding
+	failingFetcher := func(failures int, err error) (SecretFetcher, *int) {
+		calls := 0
+		return func(path string) ([]byte, error) {
+			calls++
+			if calls <= failures {
+				return nil, err
+			}
+			return []byte(path), nil
+		}, &calls
+	}
+
+	t.Run("retries transient failures until the provider succeeds", func(t *testing.T) {
+		delays = nil
+		fetch, calls := failingFetcher(2, transient)
+
+		value, err := withRetries(fetch, 3, time.Second)("path")
+
+		assert.NoError(t, err)
+		assert.Equal(t, "path", string(value))
+		assert.Equal(t, 3, *calls)
+		assert.Len(t, delays, 2)
+	})
+
+	t.Run("gives up after the configured number of retries", func(t *testing.T) {
+		delays = nil
+		fetch, calls := failingFetcher(10, transient)
+
+		_, err := withRetries(fetch, 2, time.Second)("path")
+
+		assert.Equal(t, transient, err)
+		assert.Equal(t, 3, *calls)
+	})
+
+	t.Run("does not retry permanent failures", func(t *testing.T) {
+		delays = nil
+		fetch, calls := failingFetcher(1, permanent)
+
+		_, err := withRetries(fetch, 3, time.Second)("path")
+
+		assert.Equal(t, permanent, err)
+		assert.Equal(t, 1, *calls)
+		assert.Empty(t, delays)
+	})
+}
+
+func TestBackoffDelay(t *testing.T) {
+	base := 100 * time.Millisecond
+	for attempt := 0; attempt < 5; attempt++ {
+		max := base << uint(attempt)
+		delay := backoffDelay(base, attempt)
+		assert.GreaterOrEqual(t, delay, max/2)
+		assert.LessOrEqual(t, delay, max)
+	}
+}
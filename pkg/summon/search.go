@@ -0,0 +1,134 @@
+package summon
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// SearchBoundary limits how far up FindInParentTreeWithin looks. The zero
+// value searches up to the root of the file system.
+type SearchBoundary struct {
+	// Root, if set, is the highest directory searched. It doesn't apply to
+	// searches starting outside of it.
+	Root string
+	// StopMarkers are names of files or directories, such as .git, marking
+	// the top of a project: the directory holding one is the last searched
+	StopMarkers []string
+}
+
+// FindInParentTree recursively searches for secretsFile starting at leafDir and in the
+// directories above leafDir until it is found or the root of the file system is reached.
+// If found, returns the absolute path to the file. Besides secrets.yml it is used to
+// locate the project's .summonrc.
+func FindInParentTree(secretsFile string, leafDir string) (string, error) {
+	return FindInParentTreeWithin(secretsFile, leafDir, SearchBoundary{})
+}
+
+// FindInParentTreeWithin is FindInParentTree, stopping at the boundary
+func FindInParentTreeWithin(secretsFile string, leafDir string, boundary SearchBoundary) (string, error) {
+	if filepath.IsAbs(secretsFile) {
+		return "", fmt.Errorf(
+			"file specified (%s) is an absolute path: will not recurse up", secretsFile)
+	}
+
+	root := ""
+	if boundary.Root != "" {
+		var err error
+		if root, err = filepath.Abs(boundary.Root); err != nil {
+			return "", err
+		}
+		if !isWithin(leafDir, root) {
+			root = ""
+		}
+	}
+
+	for {
+		joinedPath := filepath.Join(leafDir, secretsFile)
+
+		_, err := os.Stat(joinedPath)
+
+		if err != nil {
+			// If the file is not present, we just move up one level and run the next loop
+			// iteration
+			if os.IsNotExist(err) {
+				if leafDir == root {
+					return "", fmt.Errorf(
+						"unable to locate file specified (%s): reached search root %s", secretsFile, root)
+				}
+				if marker, ok := findMarker(leafDir, boundary.StopMarkers); ok {
+					return "", fmt.Errorf(
+						"unable to locate file specified (%s): reached %s, marked by %s", secretsFile, leafDir, marker)
+				}
+
+				upOne := filepath.Dir(leafDir)
+				if upOne == leafDir {
+					return "", fmt.Errorf(
+						"unable to locate file specified (%s): reached root of file system", secretsFile)
+				}
+
+				leafDir = upOne
+				continue
+			}
+
+			// If we have an unexpected error, we fail-fast
+			return "", fmt.Errorf("unable to locate file specified (%s): %s", secretsFile, err)
+		}
+
+		// If there's no error, we found the file so we return it
+		return joinedPath, nil
+	}
+}
+
+// findMarker returns the first of markers present in dir
+func findMarker(dir string, markers []string) (string, bool) {
+	for _, marker := range markers {
+		if _, err := os.Lstat(filepath.Join(dir, marker)); err == nil {
+			return marker, true
+		}
+	}
+	return "", false
+}
+
+// isWithin tells whether path is dir or below it
+func isWithin(path, dir string) bool {
+	rel, err := filepath.Rel(dir, path)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// RepoRoot returns the top directory of the git repository dir is in, if any
+func RepoRoot(dir string) (string, bool) {
+	for {
+		if _, ok := findMarker(dir, []string{".git"}); ok {
+			return dir, true
+		}
+		upOne := filepath.Dir(dir)
+		if upOne == dir {
+			return "", false
+		}
+		dir = upOne
+	}
+}
+
+// confirmOutsideRepo asks the user with confirm whether to use path, a
+// secrets file found by searching up from dir, if it lies outside the git
+// repository dir is in
+func confirmOutsideRepo(confirm Confirmer, path, dir string) error {
+	repo, ok := RepoRoot(dir)
+	if !ok || isWithin(path, repo) {
+		return nil
+	}
+
+	if confirm == nil {
+		return fmt.Errorf("%s was found outside the repository at %s, and can't be confirmed", path, repo)
+	}
+	yes, err := confirm(fmt.Sprintf("%s is outside the repository at %s. Use it?", path, repo))
+	if err != nil {
+		return fmt.Errorf("%s was found outside the repository at %s, and can't be confirmed: %s", path, repo, err)
+	}
+	if !yes {
+		return fmt.Errorf("not using %s, found outside the repository at %s", path, repo)
+	}
+	return nil
+}
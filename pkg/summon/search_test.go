@@ -0,0 +1,94 @@
+package summon
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// searchTree creates top/secrets.yml and top/repo/.git, and returns top and
+// top/repo/dir, where searches start
+func searchTree(t *testing.T) (string, string) {
+	top := t.TempDir()
+	leaf := filepath.Join(top, "repo", "dir")
+	assert.NoError(t, os.MkdirAll(leaf, 0o700))
+	assert.NoError(t, os.Mkdir(filepath.Join(top, "repo", ".git"), 0o700))
+	assert.NoError(t, os.WriteFile(filepath.Join(top, "secrets.yml"), nil, 0o600))
+	return top, leaf
+}
+
+func TestFindInParentTreeWithin(t *testing.T) {
+	t.Run("Stops at a directory holding a stop marker", func(t *testing.T) {
+		top, leaf := searchTree(t)
+
+		_, err := FindInParentTreeWithin("secrets.yml", leaf, SearchBoundary{StopMarkers: []string{".hg", ".git"}})
+		assert.EqualError(t, err, "unable to locate file specified (secrets.yml): reached "+
+			filepath.Join(top, "repo")+", marked by .git")
+	})
+
+	t.Run("Searches the directory holding a stop marker", func(t *testing.T) {
+		top, leaf := searchTree(t)
+		inRepo := filepath.Join(top, "repo", "secrets.yml")
+		assert.NoError(t, os.WriteFile(inRepo, nil, 0o600))
+
+		path, err := FindInParentTreeWithin("secrets.yml", leaf, SearchBoundary{StopMarkers: []string{".git"}})
+		assert.NoError(t, err)
+		assert.Equal(t, inRepo, path)
+	})
+
+	t.Run("Stops at the search root", func(t *testing.T) {
+		top, leaf := searchTree(t)
+
+		_, err := FindInParentTreeWithin("secrets.yml", leaf, SearchBoundary{Root: filepath.Join(top, "repo")})
+		assert.EqualError(t, err, "unable to locate file specified (secrets.yml): reached search root "+
+			filepath.Join(top, "repo"))
+	})
+
+	t.Run("Ignores a search root the search doesn't start in", func(t *testing.T) {
+		top, leaf := searchTree(t)
+
+		path, err := FindInParentTreeWithin("secrets.yml", leaf, SearchBoundary{Root: t.TempDir()})
+		assert.NoError(t, err)
+		assert.Equal(t, filepath.Join(top, "secrets.yml"), path)
+	})
+}
+
+func TestConfirmOutsideRepo(t *testing.T) {
+	top, leaf := searchTree(t)
+	outside := filepath.Join(top, "secrets.yml")
+	answer := func(yes bool, err error) Confirmer {
+		return func(string) (bool, error) { return yes, err }
+	}
+
+	t.Run("Files in the repository are used without asking", func(t *testing.T) {
+		inRepo := filepath.Join(top, "repo", "secrets.yml")
+		assert.NoError(t, confirmOutsideRepo(nil, inRepo, leaf))
+	})
+
+	t.Run("Files outside the repository are used if confirmed", func(t *testing.T) {
+		var asked string
+		err := confirmOutsideRepo(func(question string) (bool, error) {
+			asked = question
+			return true, nil
+		}, outside, leaf)
+		assert.NoError(t, err)
+		assert.Equal(t, outside+" is outside the repository at "+filepath.Join(top, "repo")+". Use it?", asked)
+	})
+
+	t.Run("Files outside the repository are refused otherwise", func(t *testing.T) {
+		repo := filepath.Join(top, "repo")
+		assert.EqualError(t, confirmOutsideRepo(answer(false, nil), outside, leaf),
+			"not using "+outside+", found outside the repository at "+repo)
+		assert.EqualError(t, confirmOutsideRepo(answer(false, errors.New("no terminal")), outside, leaf),
+			outside+" was found outside the repository at "+repo+", and can't be confirmed: no terminal")
+		assert.EqualError(t, confirmOutsideRepo(nil, outside, leaf),
+			outside+" was found outside the repository at "+repo+", and can't be confirmed")
+	})
+
+	t.Run("Nothing is asked outside of a repository", func(t *testing.T) {
+		assert.NoError(t, confirmOutsideRepo(nil, outside, top))
+	})
+}
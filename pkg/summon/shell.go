@@ -0,0 +1,40 @@
+package summon
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// DefaultShell returns the shell scripts are run with when none is chosen:
+// /bin/sh, or the command interpreter in %COMSPEC% on Windows
+func DefaultShell() string {
+	if runtime.GOOS != "windows" {
+		return "/bin/sh"
+	}
+	if comspec := os.Getenv("COMSPEC"); comspec != "" {
+		return comspec
+	}
+	return "cmd.exe"
+}
+
+// shellCommand returns the command that runs script with shell, given how
+// that shell takes a script on its command line. cmdLine is the raw command
+// line to start it with on Windows, where cmd.exe doesn't follow the quoting
+// rules other programs do; it is empty if the usual quoting works.
+func shellCommand(shell, script string) (args []string, cmdLine string) {
+	name := strings.ToLower(strings.TrimSuffix(filepath.Base(shell), filepath.Ext(shell)))
+	// filepath.Base doesn't split on backslashes outside Windows
+	name = name[strings.LastIndex(name, `\`)+1:]
+
+	switch name {
+	case "cmd":
+		// With /s, cmd.exe strips the outer quotes and runs the rest as is
+		return []string{shell, "/d", "/s", "/c", script}, `"` + shell + `" /d /s /c "` + script + `"`
+	case "powershell", "pwsh":
+		return []string{shell, "-NoLogo", "-NoProfile", "-NonInteractive", "-Command", script}, ""
+	default:
+		return []string{shell, "-c", script}, ""
+	}
+}
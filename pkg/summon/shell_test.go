@@ -0,0 +1,39 @@
+package summon
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestShellCommand(t *testing.T) {
+	script := `echo "a b" && type file | findstr x`
+
+	t.Run("POSIX shells take the script with -c", func(t *testing.T) {
+		args, cmdLine := shellCommand("/bin/bash", script)
+		assert.Equal(t, []string{"/bin/bash", "-c", script}, args)
+		assert.Equal(t, "", cmdLine)
+	})
+
+	t.Run("cmd.exe is given the script verbatim", func(t *testing.T) {
+		args, cmdLine := shellCommand(`C:\Windows\system32\CMD.EXE`, script)
+		assert.Equal(t, []string{`C:\Windows\system32\CMD.EXE`, "/d", "/s", "/c", script}, args)
+		assert.Equal(t, `"C:\Windows\system32\CMD.EXE" /d /s /c "`+script+`"`, cmdLine)
+	})
+
+	t.Run("PowerShell takes the script with -Command", func(t *testing.T) {
+		for _, shell := range []string{"powershell", "pwsh.exe"} {
+			args, cmdLine := shellCommand(shell, script)
+			assert.Equal(t, []string{shell, "-NoLogo", "-NoProfile", "-NonInteractive", "-Command", script}, args)
+			assert.Equal(t, "", cmdLine)
+		}
+	})
+}
+
+func TestShellRequiresOneScript(t *testing.T) {
+	_, err := RunSubprocess(&SubprocessConfig{
+		Args:  []string{"echo", "hello"},
+		Shell: "/bin/sh",
+	})
+	assert.EqualError(t, err, "a shell runs a single script, got 2 arguments")
+}
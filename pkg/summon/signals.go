@@ -0,0 +1,121 @@
+package summon
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+)
+
+// isTermination tells whether sig asks summon to stop, as opposed to e.g.
+// SIGWINCH or SIGUSR1, which are only passed on to the subcommand
+func isTermination(sig os.Signal) bool {
+	return sig == syscall.SIGINT || sig == syscall.SIGTERM || sig == syscall.SIGHUP
+}
+
+// signalRelay handles the signals sent to summon for the length of a run, so
+// that none of them can stop summon before it has cleaned up. Until the
+// subcommand has started, a signal asking summon to stop interrupts the run;
+// from then on, signals are forwarded to the subcommand.
+type signalRelay struct {
+	signals chan os.Signal
+	done    chan struct{}
+	// interrupted is closed when the run was interrupted
+	interrupted chan struct{}
+
+	mu           sync.Mutex
+	interruption os.Signal
+	forward      func(os.Signal)
+	cleanups     []func()
+}
+
+// relaySignals starts handling the signals sent to summon, until stop is
+// called
+func relaySignals() *signalRelay {
+	r := &signalRelay{
+		signals:     make(chan os.Signal, 1),
+		done:        make(chan struct{}),
+		interrupted: make(chan struct{}),
+	}
+	signal.Notify(r.signals)
+	go func() {
+		for {
+			select {
+			case <-r.done:
+				return
+			case sig := <-r.signals:
+				r.handle(sig)
+			}
+		}
+	}()
+	return r
+}
+
+func (r *signalRelay) stop() {
+	signal.Stop(r.signals)
+	close(r.done)
+}
+
+func (r *signalRelay) handle(sig os.Signal) {
+	// SIGPIPE is raised by summon's own writes, e.g. to a provider that
+	// exited early, and isn't meant for anyone
+	if sig == syscall.SIGPIPE {
+		return
+	}
+
+	r.mu.Lock()
+	forward := r.forward
+	if forward == nil && isTermination(sig) && r.interruption == nil {
+		r.interruption = sig
+		// Nothing may be left behind, even though the run is still going
+		for _, cleanup := range r.cleanups {
+			cleanup()
+		}
+		close(r.interrupted)
+	}
+	r.mu.Unlock()
+
+	if forward != nil {
+		forward(sig)
+	}
+}
+
+// onInterrupt registers cleanup to be run if the run is interrupted before
+// the subcommand starts
+func (r *signalRelay) onInterrupt(cleanup func()) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.cleanups = append(r.cleanups, cleanup)
+}
+
+// start calls startSubcommand unless the run was interrupted, and from then
+// on passes signals to forward
+func (r *signalRelay) start(startSubcommand func() error, forward func(os.Signal)) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.interruption != nil {
+		return r.interruptedError()
+	}
+	if err := startSubcommand(); err != nil {
+		return err
+	}
+	r.forward = forward
+	return nil
+}
+
+// interruptedError is the failure of a run interrupted by a signal, exiting
+// with 128+N like a process terminated by signal N
+func (r *signalRelay) interruptedError() error {
+	sig, ok := r.interruption.(syscall.Signal)
+	if !ok {
+		return &ExitCodeError{
+			ExitCode: ExitUnknownError,
+			Err:      fmt.Errorf("interrupted by %s before running the command", r.interruption),
+		}
+	}
+	return &ExitCodeError{
+		ExitCode: 128 + int(sig),
+		Err:      fmt.Errorf("interrupted by signal %d (%s) before running the command", int(sig), sig),
+	}
+}
@@ -0,0 +1,92 @@
+package summon
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSignalRelay(t *testing.T) {
+	t.Run("Stopping before the subcommand starts interrupts the run", func(t *testing.T) {
+		r := relaySignals()
+		defer r.stop()
+		cleanedUp := false
+		r.onInterrupt(func() { cleanedUp = true })
+
+		r.handle(syscall.SIGTERM)
+
+		assert.True(t, cleanedUp)
+		assert.NotNil(t, r.interruptedError())
+		select {
+		case <-r.interrupted:
+		default:
+			t.Error("run wasn't interrupted")
+		}
+
+		started := false
+		err := r.start(func() error { started = true; return nil }, func(os.Signal) {})
+		assert.False(t, started)
+		assert.EqualError(t, err, "interrupted by signal 15 (terminated) before running the command")
+		assert.Equal(t, 128+15, ExitCodeOf(err))
+	})
+
+	t.Run("Other signals before the subcommand starts are ignored", func(t *testing.T) {
+		r := relaySignals()
+		defer r.stop()
+
+		r.handle(syscall.SIGQUIT)
+
+		started := false
+		assert.NoError(t, r.start(func() error { started = true; return nil }, func(os.Signal) {}))
+		assert.True(t, started)
+	})
+
+	t.Run("Signals are forwarded once the subcommand started", func(t *testing.T) {
+		r := relaySignals()
+		defer r.stop()
+		var forwarded []os.Signal
+		assert.NoError(t, r.start(func() error { return nil }, func(sig os.Signal) { forwarded = append(forwarded, sig) }))
+
+		r.handle(syscall.SIGPIPE)
+		r.handle(syscall.SIGTERM)
+		r.handle(syscall.SIGQUIT)
+
+		assert.Equal(t, []os.Signal{syscall.SIGTERM, syscall.SIGQUIT}, forwarded)
+		select {
+		case <-r.interrupted:
+			t.Error("run was interrupted")
+		default:
+		}
+	})
+
+	t.Run("Failing to start the subcommand is returned", func(t *testing.T) {
+		r := relaySignals()
+		defer r.stop()
+		assert.EqualError(t, r.start(func() error { return errors.New("failed") }, nil), "failed")
+	})
+}
+
+func TestTempFactoryCleanup(t *testing.T) {
+	dir := t.TempDir()
+	tempFactory := NewTempFactory(dir)
+	file := tempFactory.Push("value")
+	assert.FileExists(t, file)
+
+	tempFactory.Cleanup()
+	assert.NoFileExists(t, file)
+
+	// Nothing can be left behind once cleaned up
+	assert.Equal(t, "", tempFactory.Push("value"))
+	_, err := tempFactory.Create()
+	assert.Error(t, err)
+	entries, _ := os.ReadDir(dir)
+	assert.Empty(t, entries)
+	tempFactory.Cleanup()
+
+	_, statErr := os.Stat(filepath.Dir(file))
+	assert.True(t, os.IsNotExist(statErr), "temp dir wasn't removed")
+}
@@ -0,0 +1,188 @@
+package summon
+
+import (
+	"io"
+	"os"
+	"unicode/utf8"
+
+	prov "github.com/cyberark/summon/pkg/provider"
+	"github.com/cyberark/summon/pkg/secretsyml"
+)
+
+// SecretStreamer writes the value of the secret at path to w as the provider
+// returns it, as is
+type SecretStreamer func(path string, w io.Writer) error
+
+// streamChunkSize is how much of a file is moved at a time when trimming it
+const streamChunkSize = 64 * 1024
+
+// streamFileSecrets writes the values of !file secrets straight to their temp
+// files, so that large values are never held in memory. It returns results for
+// those, and the secrets that still need to be fetched. Secrets with modifiers
+// need their whole value, and values can't be cached without holding them, so
+// those are left to the provider as usual. So is everything when secrets are
+// renewed, as streamed values carry no lease.
+func streamFileSecrets(sc *SubprocessConfig, secrets secretsyml.SecretsMap,
+	tempFactory *TempFactory) ([]prov.Result, secretsyml.SecretsMap) {
+	if sc.StreamSecret == nil || sc.Cache != nil || sc.Renew {
+		return nil, secrets
+	}
+
+	results := []prov.Result{}
+	remaining := make(secretsyml.SecretsMap)
+	for key, spec := range secrets {
+		if !spec.IsFile() || len(spec.Modifiers) > 0 {
+			remaining[key] = spec
+			continue
+		}
+		path, err := streamToTempFile(sc, spec, tempFactory)
+		results = append(results, prov.Result{Key: key, Value: path, Error: err})
+	}
+	return results, remaining
+}
+
+// streamToTempFile writes the value of spec to a new temp file and returns its
+// path. Like values returned by the provider in memory, text is trimmed of
+// surrounding (ASCII) whitespace, and an empty value is replaced by the
+// default.
+func streamToTempFile(sc *SubprocessConfig, spec secretsyml.SecretSpec, tempFactory *TempFactory) (string, error) {
+	f, err := tempFactory.Create()
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	trimmer := &trimWriter{w: f}
+	err = sc.StreamSecret(spec.Path, trimmer)
+	for attempt := 0; attempt < sc.Retries && isTransient(err); attempt++ {
+		backoff := sc.RetryBackoff
+		if backoff <= 0 {
+			backoff = DefaultRetryBackoff
+		}
+		sleep(backoffDelay(backoff, attempt))
+
+		if err := restartFile(f); err != nil {
+			return "", err
+		}
+		trimmer = &trimWriter{w: f}
+		err = sc.StreamSecret(spec.Path, trimmer)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	if err := trimmer.trim(f); err != nil {
+		return "", err
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		return "", err
+	}
+	if info.Size() == 0 && spec.DefaultValue != "" {
+		if _, err := f.WriteString(spec.DefaultValue); err != nil {
+			return "", err
+		}
+	}
+	return f.Name(), f.Close()
+}
+
+// restartFile empties f to write it again
+func restartFile(f *os.File) error {
+	if err := f.Truncate(0); err != nil {
+		return err
+	}
+	_, err := f.Seek(0, io.SeekStart)
+	return err
+}
+
+// trimWriter passes a value through to w, keeping track of what is needed to
+// trim it once it's complete: whether it is text, and how much whitespace it
+// starts and ends with
+type trimWriter struct {
+	w    io.Writer
+	size int64
+	// binary is set once the value is known not to be valid UTF-8
+	binary bool
+	// partial holds the bytes of a character split across writes
+	partial  []byte
+	nonSpace bool
+	leading  int64
+	trailing int64
+}
+
+func (t *trimWriter) Write(p []byte) (int, error) {
+	n, err := t.w.Write(p)
+	t.observe(p[:n])
+	return n, err
+}
+
+func (t *trimWriter) observe(p []byte) {
+	t.size += int64(len(p))
+
+	if !t.binary {
+		data := append(t.partial, p...)
+		complete := len(data)
+		for i := len(data) - 1; i >= 0 && i >= len(data)-utf8.UTFMax; i-- {
+			if utf8.RuneStart(data[i]) {
+				if !utf8.FullRune(data[i:]) {
+					complete = i
+				}
+				break
+			}
+		}
+		t.binary = !utf8.Valid(data[:complete])
+		t.partial = append([]byte{}, data[complete:]...)
+	}
+
+	for _, b := range p {
+		if isASCIISpace(b) {
+			t.trailing++
+			if !t.nonSpace {
+				t.leading++
+			}
+		} else {
+			t.trailing = 0
+			t.nonSpace = true
+		}
+	}
+}
+
+// trim removes the surrounding whitespace from f, which holds the complete
+// value, if it is text. Binary values are kept byte for byte.
+func (t *trimWriter) trim(f *os.File) error {
+	if t.binary || len(t.partial) > 0 {
+		return nil
+	}
+	if !t.nonSpace {
+		return restartFile(f)
+	}
+
+	end := t.size - t.trailing
+	if t.leading > 0 {
+		// Move the value to the start of the file
+		buf := make([]byte, streamChunkSize)
+		for offset := t.leading; offset < end; offset += int64(len(buf)) {
+			chunk := buf[:min(int64(len(buf)), end-offset)]
+			if _, err := f.ReadAt(chunk, offset); err != nil {
+				return err
+			}
+			if _, err := f.WriteAt(chunk, offset-t.leading); err != nil {
+				return err
+			}
+		}
+	}
+	if err := f.Truncate(end - t.leading); err != nil {
+		return err
+	}
+	_, err := f.Seek(0, io.SeekEnd)
+	return err
+}
+
+func isASCIISpace(b byte) bool {
+	switch b {
+	case ' ', '\t', '\n', '\v', '\f', '\r':
+		return true
+	}
+	return false
+}
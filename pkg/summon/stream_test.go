@@ -0,0 +1,141 @@
+package summon
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	prov "github.com/cyberark/summon/pkg/provider"
+	"github.com/cyberark/summon/pkg/secretsyml"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStreamToTempFile(t *testing.T) {
+	// streamer writes value to w in chunks of size bytes
+	streamer := func(value string, size int) SecretStreamer {
+		return func(path string, w io.Writer) error {
+			for i := 0; i < len(value); i += size {
+				if _, err := io.WriteString(w, value[i:min(i+size, len(value))]); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+	}
+	stream := func(t *testing.T, sc *SubprocessConfig, spec secretsyml.SecretSpec) string {
+		tempFactory := NewTempFactory(t.TempDir())
+		path, err := streamToTempFile(sc, spec, &tempFactory)
+		assert.NoError(t, err)
+		content, _ := os.ReadFile(path)
+		return string(content)
+	}
+
+	t.Run("Text is trimmed", func(t *testing.T) {
+		sc := &SubprocessConfig{StreamSecret: streamer(" \n\tsecret\nvalue \n", 3)}
+		assert.Equal(t, "secret\nvalue", stream(t, sc, secretsyml.SecretSpec{Path: "path"}))
+	})
+
+	t.Run("Text split inside a character is trimmed", func(t *testing.T) {
+		sc := &SubprocessConfig{StreamSecret: streamer(" héllo wörld\n", 2)}
+		assert.Equal(t, "héllo wörld", stream(t, sc, secretsyml.SecretSpec{Path: "path"}))
+	})
+
+	t.Run("Binary values are kept byte for byte", func(t *testing.T) {
+		value := "\n\x00\x01\xff \n"
+		sc := &SubprocessConfig{StreamSecret: streamer(value, 1)}
+		assert.Equal(t, value, stream(t, sc, secretsyml.SecretSpec{Path: "path"}))
+	})
+
+	t.Run("Values larger than a chunk are moved whole", func(t *testing.T) {
+		value := strings.Repeat("0123456789", streamChunkSize/5)
+		sc := &SubprocessConfig{StreamSecret: streamer("   "+value+"\n", 4096)}
+		assert.Equal(t, value, stream(t, sc, secretsyml.SecretSpec{Path: "path"}))
+	})
+
+	t.Run("Empty values get the default", func(t *testing.T) {
+		sc := &SubprocessConfig{StreamSecret: streamer(" \n", 1)}
+		spec := secretsyml.SecretSpec{Path: "path", DefaultValue: "default"}
+		assert.Equal(t, "default", stream(t, sc, spec))
+	})
+
+	t.Run("Retries start the file over", func(t *testing.T) {
+		sleep = func(time.Duration) {}
+		defer func() { sleep = time.Sleep }()
+
+		calls := 0
+		sc := &SubprocessConfig{
+			Retries: 2,
+			StreamSecret: func(path string, w io.Writer) error {
+				calls++
+				io.WriteString(w, "partial")
+				if calls < 3 {
+					return &prov.CallError{ExitCode: 75, Err: errors.New("exit status 75")}
+				}
+				return nil
+			},
+		}
+		assert.Equal(t, "partial", stream(t, sc, secretsyml.SecretSpec{Path: "path"}))
+		assert.Equal(t, 3, calls)
+	})
+
+	t.Run("Errors are returned", func(t *testing.T) {
+		tempFactory := NewTempFactory(t.TempDir())
+		sc := &SubprocessConfig{StreamSecret: func(string, io.Writer) error { return errors.New("failed") }}
+		_, err := streamToTempFile(sc, secretsyml.SecretSpec{Path: "path"}, &tempFactory)
+		assert.EqualError(t, err, "failed")
+	})
+}
+
+func TestStreamFileSecrets(t *testing.T) {
+	secrets, err := secretsyml.ParseFromString(`
+CERT: !var:file tls/cert
+KEY: !var:file:trim tls/key
+PASSWORD: !var db/password
+`, "", nil)
+	assert.NoError(t, err)
+
+	tempFactory := NewTempFactory(t.TempDir())
+	sc := &SubprocessConfig{StreamSecret: func(path string, w io.Writer) error {
+		_, err := io.WriteString(w, "streamed "+path)
+		return err
+	}}
+	results, remaining := streamFileSecrets(sc, secrets, &tempFactory)
+
+	// Secrets with modifiers need their whole value, so aren't streamed
+	assert.Len(t, remaining, 2)
+	assert.Contains(t, remaining, "KEY")
+	assert.Contains(t, remaining, "PASSWORD")
+	assert.Len(t, results, 1)
+	assert.Equal(t, "CERT", results[0].Key)
+	content, _ := os.ReadFile(results[0].Value)
+	assert.Equal(t, "streamed tls/cert", string(content))
+}
+
+func TestStreamedSecretsWithoutInteractiveMode(t *testing.T) {
+	out := filepath.Join(t.TempDir(), "out")
+	var fetched []string
+	code, err := RunSubprocess(&SubprocessConfig{
+		Args:       []string{"sh", "-c", "echo $PASSWORD $(cat $CERT) > " + out},
+		YamlInline: "PASSWORD: !var db/password\nCERT: !var:file tls/cert",
+		// Doesn't support interactive mode, so secrets are fetched one by one
+		Provider: "false",
+		FetchSecret: func(path string) ([]byte, error) {
+			fetched = append(fetched, path)
+			return []byte("fetched"), nil
+		},
+		StreamSecret: func(path string, w io.Writer) error {
+			_, err := io.WriteString(w, "streamed")
+			return err
+		},
+	})
+
+	assert.NoError(t, err)
+	assert.Equal(t, 0, code)
+	assert.Equal(t, []string{"db/password"}, fetched)
+	content, _ := os.ReadFile(out)
+	assert.Equal(t, "fetched streamed\n", string(content))
+}
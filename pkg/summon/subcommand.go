@@ -1,18 +1,71 @@
 package summon
 
 import (
+	"fmt"
+	"io"
 	"os"
 	"os/exec"
-	"os/signal"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
 	"syscall"
+	"time"
 )
 
+// DefaultGracePeriod is how long the subcommand is given to exit once asked
+// to, before it is killed
+const DefaultGracePeriod = 10 * time.Second
+
+// subcommandOptions tune how the subcommand is started
+type subcommandOptions struct {
+	// newProcessGroup starts the subcommand in its own process group (a new
+	// session on Unix), and forwards signals to the whole group
+	newProcessGroup bool
+	// stdin replaces summon's own stdin as the subcommand's input, if set
+	stdin io.Reader
+	// mask lists secrets to replace in the subcommand's stdout and stderr
+	mask []string
+	// secrets, if set, are delivered to the subcommand on a pipe instead of
+	// in its environment, see DeliverFD
+	secrets []string
+	// started is called once the subcommand has its own copy of the secrets,
+	// if set
+	started func()
+	// background, if set, is started along with the subcommand and given a
+	// way to signal it. The function it returns is called to stop it once
+	// the subcommand has exited.
+	background func(signal func(os.Signal)) func()
+	// signals relays the signals sent to summon; runSubcommand relays them
+	// itself if nil
+	signals *signalRelay
+	// timeout, if set, is how long the subcommand may run before it is asked
+	// to terminate
+	timeout time.Duration
+	// grace is how long the subcommand is given to exit once it was asked to,
+	// by a signal or because it timed out, before it is killed;
+	// DefaultGracePeriod if not set
+	grace time.Duration
+	// cmdLine, if set, is the raw command line to start the subcommand with
+	// on Windows, instead of one quoted from its arguments
+	cmdLine string
+	// dir, if set, is the working directory of the subcommand, which
+	// relative paths to it are resolved against
+	dir string
+	// controls, if set, are the user, umask and resource limits the
+	// subcommand starts with
+	controls *processControls
+}
+
 // runSubcommand executes a command with arguments in the context
 // of an environment populated with secret values. Since we have to
 // clean up our temp directories, we remain resident and shuffle
 // signals around to the chld and back
-func runSubcommand(command []string, env []string) error {
-	binary, lookupErr := exec.LookPath(command[0])
+func runSubcommand(command []string, env []string, opts subcommandOptions) error {
+	binary := command[0]
+	if opts.dir != "" && !filepath.IsAbs(binary) && filepath.Base(binary) != binary {
+		binary = filepath.Join(opts.dir, binary)
+	}
+	binary, lookupErr := exec.LookPath(binary)
 	if lookupErr != nil {
 		return lookupErr
 	}
@@ -22,26 +75,133 @@ func runSubcommand(command []string, env []string) error {
 	runner.Stdout = os.Stdout
 	runner.Stderr = os.Stderr
 	runner.Env = env
+	runner.Dir = opts.dir
+	if opts.stdin != nil {
+		runner.Stdin = opts.stdin
+	}
+	if len(opts.mask) > 0 {
+		stdout := newMaskingWriter(os.Stdout, opts.mask)
+		stderr := newMaskingWriter(os.Stderr, opts.mask)
+		defer stdout.Flush()
+		defer stderr.Flush()
+		runner.Stdout = stdout
+		runner.Stderr = stderr
+	}
 
-	signalChannel := make(chan os.Signal, 1)
-	signal.Notify(signalChannel)
+	if opts.newProcessGroup {
+		startInNewProcessGroup(runner)
+	}
+	if opts.cmdLine != "" {
+		setCommandLine(runner, opts.cmdLine)
+	}
+	if opts.controls != nil {
+		if err := applyControls(runner, opts.controls); err != nil {
+			return err
+		}
+	}
 
-	if startErr := runner.Start(); startErr != nil {
-		return startErr
+	var secretsWriter *os.File
+	if opts.secrets != nil {
+		secretsReader, w, err := os.Pipe()
+		if err != nil {
+			return err
+		}
+		defer secretsReader.Close()
+		defer w.Close()
+		secretsWriter = w
+		runner.ExtraFiles = []*os.File{secretsReader}
+		runner.Env = append(runner.Env, secretsFDEnv())
+	}
+
+	signals := opts.signals
+	if signals == nil {
+		signals = relaySignals()
+		defer signals.stop()
+	}
+	grace := opts.grace
+	if grace <= 0 {
+		grace = DefaultGracePeriod
+	}
+
+	// Once asked to stop, the subcommand is given grace to exit before it is
+	// killed, so that it is gone before its temp files are removed
+	exited := make(chan struct{})
+	defer close(exited)
+	var stopping sync.Once
+	killAfterGrace := func() {
+		stopping.Do(func() {
+			go func() {
+				select {
+				case <-exited:
+				case <-time.After(grace):
+					killSubcommand(runner)
+				}
+			}()
+		})
 	}
 
 	// Forward all signals to the child process
-	go func() {
-		for {
-			receivedSignal := <-signalChannel
-			runner.Process.Signal(receivedSignal)
+	startErr := signals.start(runner.Start, func(sig os.Signal) {
+		forwardSignal(runner, sig)
+		if isTermination(sig) {
+			killAfterGrace()
 		}
-	}()
+	})
+	if startErr != nil {
+		return startErr
+	}
 
-	if waitErr := runner.Wait(); waitErr != nil {
-		runner.Process.Signal(syscall.SIGKILL)
-		return waitErr
+	started := opts.started
+	if started == nil {
+		started = func() {}
+	}
+	if secretsWriter != nil {
+		// Only the subcommand should hold the read end now, so that writing
+		// fails instead of blocking if it exits without reading
+		runner.ExtraFiles[0].Close()
+		delivered := make(chan struct{})
+		go func() {
+			deliverSecrets(secretsWriter, opts.secrets)
+			started()
+			close(delivered)
+		}()
+		// Unblock the delivery if the subcommand leaves it unread
+		defer func() {
+			secretsWriter.Close()
+			<-delivered
+		}()
+	} else {
+		started()
+	}
+
+	// Make sure processes started by the child don't outlive it
+	releaseProcessTree := trackProcessTree(runner)
+	defer releaseProcessTree()
+
+	if opts.background != nil {
+		stopBackground := opts.background(func(sig os.Signal) { forwardSignal(runner, sig) })
+		defer stopBackground()
+	}
+
+	var timedOut atomic.Bool
+	if opts.timeout > 0 {
+		go func() {
+			select {
+			case <-exited:
+			case <-time.After(opts.timeout):
+				timedOut.Store(true)
+				terminateSubcommand(runner)
+				killAfterGrace()
+			}
+		}()
 	}
 
-	return nil
+	waitErr := runner.Wait()
+	if waitErr != nil {
+		runner.Process.Signal(syscall.SIGKILL)
+	}
+	if timedOut.Load() {
+		return &ExitCodeError{ExitCode: ExitTimeout, Err: fmt.Errorf("command timed out after %s", opts.timeout)}
+	}
+	return waitErr
 }
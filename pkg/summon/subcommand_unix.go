@@ -0,0 +1,68 @@
+//go:build !windows
+
+package summon
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"syscall"
+)
+
+// signalNames are the signals that can be sent to the subcommand by name,
+// e.g. with SubprocessConfig.RenewSignal
+var signalNames = map[string]syscall.Signal{
+	"HUP":  syscall.SIGHUP,
+	"INT":  syscall.SIGINT,
+	"QUIT": syscall.SIGQUIT,
+	"TERM": syscall.SIGTERM,
+	"USR1": syscall.SIGUSR1,
+	"USR2": syscall.SIGUSR2,
+}
+
+// ParseSignal returns the signal named name, with or without the SIG prefix
+// (e.g. HUP or SIGHUP)
+func ParseSignal(name string) (os.Signal, error) {
+	sig, ok := signalNames[strings.TrimPrefix(strings.ToUpper(name), "SIG")]
+	if !ok {
+		return nil, fmt.Errorf("unknown signal %q", name)
+	}
+	return sig, nil
+}
+
+// startInNewProcessGroup makes cmd start in a new session, and therefore a
+// new process group, detached from summon's controlling terminal
+func startInNewProcessGroup(cmd *exec.Cmd) {
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.Setsid = true
+}
+
+// setCommandLine does nothing outside Windows, where programs are given
+// their arguments as they are
+func setCommandLine(cmd *exec.Cmd, cmdLine string) {}
+
+// forwardSignal passes a signal received by summon on to the child, or to
+// every process in its group if it was started in a new one
+func forwardSignal(cmd *exec.Cmd, sig os.Signal) {
+	if cmd.SysProcAttr != nil && cmd.SysProcAttr.Setsid {
+		if sysSig, ok := sig.(syscall.Signal); ok {
+			syscall.Kill(-cmd.Process.Pid, sysSig)
+			return
+		}
+	}
+	cmd.Process.Signal(sig)
+}
+
+// terminateSubcommand asks the subcommand (and its group, if it has its own)
+// to exit, with SIGTERM
+func terminateSubcommand(cmd *exec.Cmd) {
+	forwardSignal(cmd, syscall.SIGTERM)
+}
+
+// killSubcommand kills the subcommand, and its group if it has its own
+func killSubcommand(cmd *exec.Cmd) {
+	forwardSignal(cmd, syscall.SIGKILL)
+}
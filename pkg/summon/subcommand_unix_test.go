@@ -0,0 +1,280 @@
+//go:build !windows
+
+package summon
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewProcessGroup(t *testing.T) {
+	t.Run("command runs as the leader of its own process group", func(t *testing.T) {
+		out := filepath.Join(t.TempDir(), "out")
+
+		err := runSubcommand(
+			[]string{"sh", "-c", "echo $$ $(ps -o pgid= -p $$) > " + out},
+			os.Environ(),
+			subcommandOptions{newProcessGroup: true},
+		)
+		assert.NoError(t, err)
+
+		content, err := os.ReadFile(out)
+		assert.NoError(t, err)
+		fields := strings.Fields(string(content))
+		assert.Len(t, fields, 2)
+		if len(fields) == 2 {
+			assert.Equal(t, fields[0], fields[1])
+		}
+	})
+
+	t.Run("signals are forwarded to the whole group", func(t *testing.T) {
+		pidFile := filepath.Join(t.TempDir(), "pid")
+		cmd := exec.Command("sh", "-c", "sleep 30 & echo $! > "+pidFile+"; wait")
+		startInNewProcessGroup(cmd)
+		assert.NoError(t, cmd.Start())
+
+		var workerPid int
+		assert.Eventually(t, func() bool {
+			content, err := os.ReadFile(pidFile)
+			if err != nil {
+				return false
+			}
+			workerPid, err = strconv.Atoi(strings.TrimSpace(string(content)))
+			return err == nil
+		}, 5*time.Second, 10*time.Millisecond)
+
+		forwardSignal(cmd, syscall.SIGTERM)
+		cmd.Wait()
+
+		assert.Eventually(t, func() bool {
+			return syscall.Kill(workerPid, 0) == syscall.ESRCH
+		}, 5*time.Second, 10*time.Millisecond, "background worker survived")
+	})
+}
+
+func TestSigpipeIsNotForwarded(t *testing.T) {
+	dir := t.TempDir()
+	ready, out := filepath.Join(dir, "ready"), filepath.Join(dir, "out")
+
+	go func() {
+		for i := 0; i < 500; i++ {
+			if _, err := os.Stat(ready); err == nil {
+				syscall.Kill(os.Getpid(), syscall.SIGPIPE)
+				return
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}()
+
+	err := runSubcommand(
+		[]string{"sh", "-c", "touch " + ready + "; sleep 1; echo ok > " + out},
+		os.Environ(),
+		subcommandOptions{},
+	)
+	assert.NoError(t, err)
+
+	content, err := os.ReadFile(out)
+	assert.NoError(t, err)
+	assert.Equal(t, "ok\n", string(content))
+}
+
+func TestDeliverFD(t *testing.T) {
+	run := func(command string, value []byte) (int, error) {
+		return RunSubprocess(&SubprocessConfig{
+			Args:        []string{"sh", "-c", command},
+			YamlInline:  "PASSWORD: !var db/password\nRAILS_ENV: production",
+			FetchSecret: func(string) ([]byte, error) { return value, nil },
+			Deliver:     DeliverFD,
+		})
+	}
+
+	t.Run("secrets are written to the pipe instead of the environment", func(t *testing.T) {
+		out := filepath.Join(t.TempDir(), "out")
+
+		code, err := run(`echo "$SUMMON_SECRETS_FD ${PASSWORD-unset}" > `+out+`; tr '\0' '\n' <&3 >> `+out, []byte("multi\nline"))
+		assert.NoError(t, err)
+		assert.Equal(t, 0, code)
+
+		content, _ := os.ReadFile(out)
+		assert.Equal(t, "3 unset\nPASSWORD=multi\nline\nRAILS_ENV=production\n", string(content))
+	})
+
+	t.Run("secrets the command doesn't read don't block summon", func(t *testing.T) {
+		code, err := run("exit 0", []byte(strings.Repeat("x", 1<<20)))
+		assert.NoError(t, err)
+		assert.Equal(t, 0, code)
+	})
+
+	t.Run("unknown delivery modes are rejected", func(t *testing.T) {
+		_, err := RunSubprocess(&SubprocessConfig{Args: []string{"true"}, Deliver: "socket"})
+		assert.EqualError(t, err, `unknown delivery mode "socket", expected env or fd`)
+	})
+}
+
+func TestTimeout(t *testing.T) {
+	t.Run("command is terminated, and temp files removed, when it runs too long", func(t *testing.T) {
+		out := filepath.Join(t.TempDir(), "out")
+
+		start := time.Now()
+		code, err := RunSubprocess(&SubprocessConfig{
+			Args: []string{"sh", "-c", "echo $CERT > " + out + "; " +
+				"trap 'kill $!; echo terminated >> " + out + "; exit 0' TERM; sleep 30 & wait"},
+			YamlInline:  "CERT: !var:file tls/cert",
+			FetchSecret: func(string) ([]byte, error) { return []byte("cert"), nil },
+			Timeout:     100 * time.Millisecond,
+			GracePeriod: 10 * time.Second,
+		})
+		assert.EqualError(t, err, "command timed out after 100ms")
+		assert.Equal(t, ExitTimeout, ExitCodeOf(err))
+		assert.Equal(t, 0, code)
+		assert.Less(t, time.Since(start), 10*time.Second, "command wasn't terminated gracefully")
+
+		content, _ := os.ReadFile(out)
+		lines := strings.Fields(string(content))
+		if assert.Len(t, lines, 2) {
+			assert.Equal(t, "terminated", lines[1])
+			assert.NoFileExists(t, lines[0])
+		}
+	})
+
+	t.Run("command ignoring SIGTERM is killed after the grace period", func(t *testing.T) {
+		start := time.Now()
+		err := runSubcommand(
+			[]string{"sh", "-c", "trap '' TERM; sleep 30 & wait"},
+			os.Environ(),
+			subcommandOptions{newProcessGroup: true, timeout: 50 * time.Millisecond, grace: 50 * time.Millisecond},
+		)
+		assert.Equal(t, ExitTimeout, ExitCodeOf(err))
+		assert.Less(t, time.Since(start), 10*time.Second)
+	})
+
+	t.Run("command finishing in time is unaffected", func(t *testing.T) {
+		err := runSubcommand([]string{"sh", "-c", "exit 3"}, os.Environ(), subcommandOptions{timeout: time.Minute})
+		code, err := returnStatusOfError(err)
+		assert.NoError(t, err)
+		assert.Equal(t, 3, code)
+	})
+}
+
+func TestShutdownOrdering(t *testing.T) {
+	t.Run("stopping summon while resolving secrets abandons the run", func(t *testing.T) {
+		out := filepath.Join(t.TempDir(), "out")
+		fetching := make(chan struct{})
+		release := make(chan struct{})
+		defer close(release)
+
+		go func() {
+			<-fetching
+			syscall.Kill(os.Getpid(), syscall.SIGINT)
+		}()
+		code, err := RunSubprocess(&SubprocessConfig{
+			Args:       []string{"sh", "-c", "touch " + out},
+			YamlInline: "PASSWORD: !var db/password",
+			FetchSecret: func(string) ([]byte, error) {
+				close(fetching)
+				<-release
+				return []byte("password"), nil
+			},
+		})
+		assert.Equal(t, 0, code)
+		assert.EqualError(t, err, "interrupted by signal 2 (interrupt) before running the command")
+		assert.Equal(t, 130, ExitCodeOf(err))
+
+		// The abandoned run can't start the command once the fetch completes
+		release <- struct{}{}
+		assert.Never(t, func() bool {
+			_, err := os.Stat(out)
+			return err == nil
+		}, 200*time.Millisecond, 10*time.Millisecond)
+	})
+
+	t.Run("command ignoring a forwarded SIGTERM is killed after the grace period", func(t *testing.T) {
+		signals := relaySignals()
+		defer signals.stop()
+
+		start := time.Now()
+		err := runSubcommand(
+			[]string{"sh", "-c", "trap '' TERM; sleep 30 & wait"},
+			os.Environ(),
+			subcommandOptions{
+				newProcessGroup: true,
+				signals:         signals,
+				grace:           50 * time.Millisecond,
+				started: func() {
+					// Give the shell time to ignore SIGTERM
+					time.AfterFunc(100*time.Millisecond, func() { signals.handle(syscall.SIGTERM) })
+				},
+			},
+		)
+		code, err := returnStatusOfError(err)
+		assert.NoError(t, err)
+		assert.Equal(t, 128+int(syscall.SIGKILL), code)
+		assert.Less(t, time.Since(start), 10*time.Second)
+	})
+}
+
+func TestShell(t *testing.T) {
+	out := filepath.Join(t.TempDir(), "out")
+
+	code, err := RunSubprocess(&SubprocessConfig{
+		Args:        []string{`echo "$PASSWORD" | tr a-z A-Z > ` + out + ` && cat $CERT >> ` + out + `; exit 3`},
+		Shell:       "/bin/sh",
+		YamlInline:  "PASSWORD: !var db/password\nCERT: !var:file tls/cert",
+		FetchSecret: func(path string) ([]byte, error) { return []byte("value of " + path), nil },
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 3, code)
+
+	content, _ := os.ReadFile(out)
+	assert.Equal(t, "VALUE OF DB/PASSWORD\nvalue of tls/cert", string(content))
+}
+
+func TestChdir(t *testing.T) {
+	t.Run("command runs in the directory, found relative to it", func(t *testing.T) {
+		dir := t.TempDir()
+		out := filepath.Join(dir, "out")
+		script := "#!/bin/sh\necho \"$PASSWORD $(pwd -P) $PWD\" > " + out + "\n"
+		assert.NoError(t, os.WriteFile(filepath.Join(dir, "run.sh"), []byte(script), 0700))
+
+		code, err := RunSubprocess(&SubprocessConfig{
+			Args:        []string{"./run.sh"},
+			Dir:         dir,
+			YamlInline:  "PASSWORD: !var db/password",
+			FetchSecret: func(string) ([]byte, error) { return []byte("password"), nil },
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, 0, code)
+
+		realDir, _ := filepath.EvalSymlinks(dir)
+		content, _ := os.ReadFile(out)
+		assert.Equal(t, "password "+realDir+" "+dir+"\n", string(content))
+	})
+
+	t.Run("missing directory fails before resolving secrets", func(t *testing.T) {
+		_, err := RunSubprocess(&SubprocessConfig{
+			Args:       []string{"true"},
+			Dir:        filepath.Join(t.TempDir(), "missing"),
+			YamlInline: "PASSWORD: !var db/password",
+			FetchSecret: func(string) ([]byte, error) {
+				t.Error("secret was fetched")
+				return nil, nil
+			},
+		})
+		assert.ErrorContains(t, err, "unable to run the command in ")
+	})
+
+	t.Run("file is not a directory", func(t *testing.T) {
+		file := filepath.Join(t.TempDir(), "file")
+		os.WriteFile(file, nil, 0600)
+		_, err := subcommandDir(file)
+		assert.EqualError(t, err, "unable to run the command in "+file+": not a directory")
+	})
+}
@@ -0,0 +1,71 @@
+//go:build windows
+
+package summon
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"syscall"
+)
+
+const ctrlBreakEvent = 1
+
+var procGenerateConsoleCtrlEvent = kernel32.NewProc("GenerateConsoleCtrlEvent")
+
+// ParseSignal fails on Windows, which can't send signals to the subcommand
+func ParseSignal(name string) (os.Signal, error) {
+	return nil, fmt.Errorf("sending signals to the command is not supported on Windows")
+}
+
+// startInNewProcessGroup makes cmd start in a new console process group, so
+// that Ctrl+C in the console only reaches it through summon
+func startInNewProcessGroup(cmd *exec.Cmd) {
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.CreationFlags |= syscall.CREATE_NEW_PROCESS_GROUP
+}
+
+// setCommandLine makes cmd start with cmdLine as its command line, rather
+// than one quoted from its arguments
+func setCommandLine(cmd *exec.Cmd, cmdLine string) {
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.CmdLine = cmdLine
+}
+
+// forwardSignal passes a console control event received by summon on to the
+// child. Windows can't deliver Unix-style signals, and killing the child
+// would deny it a graceful shutdown.
+//
+// A child sharing summon's console process group receives Ctrl+C (and
+// console close events) from the console just like summon does, so nothing
+// needs forwarding. A child in its own process group can only be sent
+// CTRL_BREAK, which reaches the whole group and which console programs handle
+// like Ctrl+C by default.
+func forwardSignal(cmd *exec.Cmd, sig os.Signal) {
+	if sig != os.Interrupt || !inOwnProcessGroup(cmd) {
+		return
+	}
+	procGenerateConsoleCtrlEvent.Call(ctrlBreakEvent, uintptr(cmd.Process.Pid))
+}
+
+func inOwnProcessGroup(cmd *exec.Cmd) bool {
+	return cmd.SysProcAttr != nil &&
+		cmd.SysProcAttr.CreationFlags&syscall.CREATE_NEW_PROCESS_GROUP != 0
+}
+
+// terminateSubcommand asks the subcommand to exit with CTRL_BREAK, if it
+// runs in its own process group. Otherwise there is no way to ask, and it is
+// left to be killed.
+func terminateSubcommand(cmd *exec.Cmd) {
+	forwardSignal(cmd, os.Interrupt)
+}
+
+// killSubcommand terminates the subcommand. Processes it started are
+// terminated along with it when summon releases its process tree.
+func killSubcommand(cmd *exec.Cmd) {
+	cmd.Process.Kill()
+}
@@ -1,19 +1,32 @@
 package summon
 
 import (
+	"errors"
 	"fmt"
+	"io"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"runtime"
 	"sort"
 	"strings"
 	"sync"
 	"syscall"
+	"time"
 
 	prov "github.com/cyberark/summon/pkg/provider"
+	"github.com/cyberark/summon/pkg/remote"
 	"github.com/cyberark/summon/pkg/secretsyml"
+	"github.com/cyberark/summon/pkg/telemetry"
 )
 
+// StdinPath, given as the secrets file or as inline YAML, reads secrets.yml
+// from stdin
+const StdinPath = "-"
+
+// secretsStdin is where secrets.yml is read from with StdinPath
+var secretsStdin io.Reader = os.Stdin
+
 // SubprocessConfig is an object that holds all the info needed to run
 // a Summon instance
 type SubprocessConfig struct {
@@ -28,6 +41,99 @@ type SubprocessConfig struct {
 	RecurseUp            bool
 	ShowProviderVersions bool
 	FetchSecret          SecretFetcher
+	Retries              int
+	RetryBackoff         time.Duration
+	Cache                SecretCache
+	ProviderOptions      prov.Options
+	ReportSignal         bool
+	NewProcessGroup      bool
+	StdinSecret          string
+	// Secrets are NAME=VALUE pairs defining secrets in addition to, or instead
+	// of, the secrets file
+	Secrets []string
+	// Prompt asks the user for values of secrets tagged !prompt; nil means
+	// prompting is not possible
+	Prompt Prompter
+	// PromptOnFailure asks the user for the value of any secret the provider
+	// failed to resolve, instead of failing
+	PromptOnFailure bool
+	// CI masks secrets in the logs of a CI system: CIGitHub, CIGitLab, or ""
+	// for none
+	CI string
+	// CIExport makes secrets available to later steps of a GitHub Actions job,
+	// through $GITHUB_ENV
+	CIExport bool
+	// EnvKeep, if set, limits the variables the subcommand inherits from
+	// summon's environment to those matching one of these glob patterns
+	EnvKeep []string
+	// EnvExclude keeps variables matching these glob patterns from being
+	// inherited by the subcommand
+	EnvExclude []string
+	// CleanEnv passes only a minimal set of variables (PATH, HOME, ...) and
+	// those in EnvKeep on to the subcommand, besides the secrets
+	CleanEnv bool
+	// Naming changes the names secrets are given in the subcommand's
+	// environment
+	Naming EnvNaming
+	// StreamSecret, if set, writes the values of !file secrets straight to
+	// their temp files instead of holding them in memory
+	StreamSecret SecretStreamer
+	// Harden disables core dumps, and locks the subcommand's environment into
+	// memory while it is built, wiping it once the subcommand has started
+	Harden bool
+	// Deliver is how secrets are passed to the subcommand: DeliverEnv (or "")
+	// for its environment, or DeliverFD for a pipe it can read them from
+	Deliver string
+	// Renew refreshes !file secrets whose values the provider reported a
+	// lease for, before the lease ends, while the subcommand runs
+	Renew bool
+	// RenewSignal, if set, is sent to the subcommand after a secret was
+	// renewed
+	RenewSignal os.Signal
+	// Telemetry, if set, records spans and metrics for the run: how long
+	// resolving the secrets and running the subcommand took, provider calls,
+	// retries and cache lookups
+	Telemetry *telemetry.Telemetry
+	// Timeout, if set, limits how long the subcommand may run. It is then
+	// asked to terminate, and summon fails with ExitTimeout.
+	Timeout time.Duration
+	// GracePeriod is how long the subcommand is given to exit once asked to,
+	// when it timed out or summon was told to stop, before it is killed;
+	// DefaultGracePeriod if not set
+	GracePeriod time.Duration
+	// Shell, if set, is the shell that runs the subcommand: Args then holds
+	// a single script, such as "make && make test | tee log"
+	Shell string
+	// Dir, if set, is the working directory of the subcommand. Everything
+	// else, such as finding the secrets file, happens in summon's own.
+	Dir string
+	// SearchBoundary limits how far up RecurseUp looks for the secrets file
+	SearchBoundary SearchBoundary
+	// ConfirmOutsideRepo asks with Confirm before using a secrets file that
+	// RecurseUp found above the git repository of the working directory
+	ConfirmOutsideRepo bool
+	// Confirm asks the user a yes or no question; nil means asking is not
+	// possible
+	Confirm Confirmer
+	// UseProvider, if set, is called once secrets.yml is parsed, with the
+	// provider it declares for Environment ("" if none), to set Provider and
+	// what goes with it: FetchSecret, StreamSecret, ProviderOptions and Cache
+	UseProvider func(sc *SubprocessConfig, declared string) error
+	// CheckSecret, if set, tells whether the provider can resolve a path
+	// without fetching its value, for CheckSecrets
+	CheckSecret func(path string) error
+	// Format is the format of the secrets file; "" means the one its
+	// extension tells, and YAML for inline secrets or stdin
+	Format secretsyml.Format
+	// User, if set, is the user the subcommand runs as, by name or ID, with
+	// its supplementary groups, e.g. app, or app:app to give the group too.
+	// Temp files are made its own. Unix only, summon must be privileged.
+	User string
+	// Umask, if set, is the file mode creation mask of the subcommand (Unix
+	// only)
+	Umask *os.FileMode
+	// Rlimits are resource limits set on the subcommand (Unix only)
+	Rlimits []Rlimit
 }
 
 const ENV_FILE_MAGIC = "@SUMMONENVFILE"
@@ -37,63 +143,198 @@ const SUMMON_ENV_KEY_NAME = "SUMMON_ENV"
 type SecretFetcher func(string) ([]byte, error)
 
 // RunSubprocess encapsulates the logic of fetching secrets, executing the subprocess with the secrets injected.
+//
+// Signals sent to summon during the run don't stop it. Before the subprocess
+// starts, SIGINT, SIGTERM or SIGHUP interrupt the run: temp files are removed
+// and RunSubprocess returns right away, even if a provider call or prompt is
+// still going. Afterwards, signals are forwarded to the subprocess, which is
+// killed if it hasn't exited GracePeriod after being asked to stop; temp
+// files are only removed once it is gone.
 func RunSubprocess(sc *SubprocessConfig) (int, error) {
+	signals := relaySignals()
+	defer signals.stop()
+
+	trace := &runTrace{root: sc.Telemetry.Start("summon.run", nil)}
+	trace.resolve = sc.Telemetry.Start("summon.resolve", trace.root)
+
+	type outcome struct {
+		code int
+		err  error
+	}
+	done := make(chan outcome, 1)
+	go func() {
+		code, err := runSubprocess(instrumented(sc, trace.resolve), trace, signals)
+		done <- outcome{code, err}
+	}()
+
+	var code int
+	var err error
+	select {
+	case result := <-done:
+		code, err = result.code, result.err
+	case <-signals.interrupted:
+		// The run is abandoned where it is, as it can no longer start the
+		// subprocess nor create temp files
+		err = signals.interruptedError()
+		trace.resolve.End(err)
+		trace.root.End(err)
+		return 0, err
+	}
+
+	// The error is the subcommand's if it was started, otherwise it failed
+	// resolving the secrets
+	if trace.command != nil {
+		trace.command.SetAttributes(telemetry.Int("summon.command.exit_code", int64(code)))
+		trace.command.End(err)
+	} else {
+		trace.resolve.End(err)
+	}
+	trace.root.End(err)
+	return code, err
+}
+
+func runSubprocess(sc *SubprocessConfig, trace *runTrace, signals *signalRelay) (int, error) {
 	var (
 		secrets secretsyml.SecretsMap
 		err     error
 	)
 
-	subs := convertSubsToMap(sc.Subs)
-
-	if sc.RecurseUp {
-		currentDir, err := os.Getwd()
-		if err != nil {
-			return 0, err
+	switch sc.Deliver {
+	case "", DeliverEnv:
+	case DeliverFD:
+		if runtime.GOOS == "windows" {
+			return 0, fmt.Errorf("delivering secrets on a file descriptor is not supported on Windows")
 		}
-		sc.Filepath, err = findInParentTree(sc.Filepath, currentDir)
-		if err != nil {
-			return 0, err
+	default:
+		return 0, fmt.Errorf("unknown delivery mode %q, expected env or fd", sc.Deliver)
+	}
+
+	if sc.Shell != "" && len(sc.Args) != 1 {
+		return 0, fmt.Errorf("a shell runs a single script, got %d arguments", len(sc.Args))
+	}
+
+	dir, err := subcommandDir(sc.Dir)
+	if err != nil {
+		return 0, err
+	}
+	// Before any secret is resolved, in case the user doesn't exist
+	controls, err := newProcessControls(sc)
+	if err != nil {
+		return 0, err
+	}
+
+	// Before any secret is in memory
+	if sc.Harden {
+		if err := disableCoreDumps(); err != nil {
+			return 0, fmt.Errorf("unable to disable core dumps: %s", err)
 		}
 	}
 
-	switch sc.YamlInline {
-	case "":
-		secrets, err = secretsyml.ParseFromFile(sc.Filepath, sc.Environment, subs)
-	default:
-		secrets, err = secretsyml.ParseFromString(sc.YamlInline, sc.Environment, subs)
+	for _, patterns := range [][]string{sc.EnvKeep, sc.EnvExclude} {
+		if err := validateEnvPatterns(patterns); err != nil {
+			return 0, &ExitCodeError{ExitCode: ExitParseError, Err: err}
+		}
 	}
 
+	secrets, err = loadSecrets(sc)
 	if err != nil {
 		return 0, err
 	}
 
+	if sc.Renew && sc.Cache != nil {
+		return 0, fmt.Errorf("renewing leased secrets can't be combined with caching them")
+	}
+	var renewLeases *leases
+	if sc.Renew {
+		renewLeases = newLeases()
+	}
+
+	// The items of list-valued secrets are resolved one by one, and joined
+	// once they all are
+	resolving := expandLists(secrets)
+
 	env := make(map[string]string)
 	tempFactory := NewTempFactory("")
 	defer tempFactory.Cleanup()
+	if controls != nil && controls.asUser {
+		// For the subcommand to read its !file secrets
+		tempFactory.SetOwner(controls.uid, controls.gid)
+	}
+	signals.onInterrupt(tempFactory.Cleanup)
 
 	var results []prov.Result
 
+	// Ask for prompted secrets up front, before anything is fetched
+	promptResults, err := resolvePrompts(sc.Prompt, resolving, &tempFactory)
+	if err != nil {
+		return 0, err
+	}
+
 	// Filter out non variables
-	filteredResults, filteredSecrets := filterNonVariables(secrets, &tempFactory)
+	filteredResults, filteredSecrets := filterNonVariables(resolving, &tempFactory)
 	results = append(results, filteredResults...)
 
-	// Call provider with no arguments
-	resultsCh, errorsCh, cleanup := prov.CallInteractiveMode(sc.Provider, filteredSecrets)
-	defer cleanup()
+	// Skip the provider for secrets that were resolved recently
+	cachedResults, filteredSecrets := resolveFromCache(sc.Cache, filteredSecrets, &tempFactory)
+	results = append(results, cachedResults...)
+
+	// Write file secrets straight to disk, however large they are
+	streamedResults, filteredSecrets := streamFileSecrets(sc, filteredSecrets, &tempFactory)
+	results = append(results, streamedResults...)
+
+	// Only start the provider if there is something left for it to fetch
+	if len(filteredSecrets) > 0 {
+		// Ask the provider for each distinct path only once
+		uniqueSecrets, aliases := dedupeSecrets(filteredSecrets)
+
+		// Call provider with no arguments
+		batch := sc.Telemetry.Start("summon.provider.batch", trace.resolve, telemetry.Int("summon.secrets", int64(len(uniqueSecrets))))
+		resultsCh, errorsCh, cleanup := prov.CallInteractiveModeWithOptions(sc.Provider, uniqueSecrets, sc.ProviderOptions)
+		defer cleanup()
+		// Stops handling results the run didn't wait for, e.g. after the
+		// provider failed
+		done := make(chan struct{})
+		defer close(done)
+		resultsCh = observeResults(sc.Telemetry, resultsCh, time.Now(), done)
+		resultsCh = recordLeases(renewLeases, resultsCh, uniqueSecrets, done)
+		resultsCh = fanOutResults(cacheResults(sc.Cache, resultsCh, uniqueSecrets, done), aliases, done)
+
+		// This extracts the logic of handling results from provider interactive mode
+		resultsFromProvider, err := handleResultsFromProvider(resultsCh, errorsCh, filteredSecrets, &tempFactory)
+		results = append(results, resultsFromProvider...)
+		batch.End(err)
+
+		// Only what was left for the provider is fetched again, so file
+		// secrets already written to disk aren't read into memory after all
+		if err != nil {
+			fallback := *sc
+			fallback.FetchSecret = withLeases(sc.FetchSecret, renewLeases)
+			results = append(results, nonInteractiveProviderFallback(filteredSecrets, &fallback, &tempFactory)...)
+		}
+	}
 
-	// This extracts the logic of handling results from provider interactive mode
-	resultsFromProvider, err := handleResultsFromProvider(resultsCh, errorsCh, filteredSecrets, &tempFactory)
-	results = append(results, resultsFromProvider...)
+	results = append(results, promptResults...)
 
-	if err != nil {
-		results = nonInteractiveProviderFallback(secrets, sc, &tempFactory)
-	}
+	// Report every secret that failed, not just the first
+	var failures FetchErrors
 
 EnvLoop:
 	for _, envvar := range results {
 		if envvar.Error == nil {
 			env[envvar.Key] = envvar.Value
 		} else {
+			if sc.PromptOnFailure {
+				spec := resolving[envvar.Key]
+				message := fmt.Sprintf("Unable to fetch %s (%s): %s\nEnter value for %s: ",
+					envvar.Key, spec.Path, envvar.Error, envvar.Key)
+				value, err := promptFor(sc.Prompt, envvar.Key, message, spec)
+				if err == nil {
+					_, env[envvar.Key] = formatForEnv(envvar.Key, value, spec, &tempFactory)
+					continue EnvLoop
+				}
+				envvar.Error = err
+			}
+
 			if sc.IgnoreAll {
 				continue EnvLoop
 			}
@@ -103,10 +344,64 @@ EnvLoop:
 					continue EnvLoop
 				}
 			}
-			return 0, fmt.Errorf("Error fetching variable %v: %v", envvar.Key, envvar.Error.Error())
+			failures = append(failures, &FetchError{
+				Key:      envvar.Key,
+				Path:     resolving[envvar.Key].Path,
+				Provider: sc.Provider,
+				Err:      envvar.Error,
+			})
 		}
 	}
 
+	if len(failures) == 1 {
+		return 0, &ExitCodeError{ExitCode: ExitProviderError, Err: failures[0]}
+	}
+	if len(failures) > 1 {
+		return 0, &ExitCodeError{ExitCode: ExitProviderError, Err: failures}
+	}
+
+	// The temp files of leased secrets are kept up to date while the
+	// subcommand runs
+	renewable := leasedFiles(resolving, env, renewLeases)
+
+	// Mask secrets in CI logs before the subcommand gets a chance to print
+	// them. The items of lists are masked one by one.
+	var mask []string
+	switch sc.CI {
+	case CIGitHub:
+		if err := writeGitHubMasks(os.Stdout, ciSecretValues(resolving, env)); err != nil {
+			return 0, err
+		}
+	case CIGitLab:
+		mask = ciSecretValues(resolving, env)
+	}
+
+	if err := joinLists(secrets, env, &tempFactory); err != nil {
+		return 0, &ExitCodeError{ExitCode: ExitProviderError, Err: err}
+	}
+
+	stdin, err := takeStdinSecret(sc.StdinSecret, secrets, env)
+	if err != nil {
+		return 0, err
+	}
+
+	// Name the variables the way the subcommand expects them
+	namedEnv, err := sc.Naming.rename(env)
+	if err != nil {
+		return 0, &ExitCodeError{ExitCode: ExitParseError, Err: err}
+	}
+
+	// The stdin secret was masked above, but is never exported
+	if sc.CIExport {
+		if sc.CI != CIGitHub {
+			return 0, fmt.Errorf("exporting secrets is only supported on GitHub Actions")
+		}
+		if err := exportGitHubEnv(os.Getenv("GITHUB_ENV"), exportableEnv(secrets, env, sc.Naming)); err != nil {
+			return 0, fmt.Errorf("unable to export secrets: %s", err)
+		}
+	}
+	env = namedEnv
+
 	// Append environment variable if one is specified
 	if sc.Environment != "" {
 		env[SUMMON_ENV_KEY_NAME] = sc.Environment
@@ -114,29 +409,192 @@ EnvLoop:
 
 	setupEnvFile(sc.Args, env, &tempFactory)
 
-	var e []string
-	for k, v := range env {
-		e = append(e, fmt.Sprintf("%s=%s", k, v))
-	}
+	envBuf, e := newEnvBuffer(env, sc.Harden)
+	defer envBuf.wipe()
 
-	err = runSubcommand(sc.Args, append(os.Environ(), e...))
+	envKeep := sc.EnvKeep
+	if sc.CleanEnv {
+		envKeep = cleanEnvKeep(envKeep)
+	}
+	environ := filterEnviron(os.Environ(), envKeep, sc.EnvExclude)
+	opts := subcommandOptions{
+		newProcessGroup: sc.NewProcessGroup,
+		stdin:           stdin,
+		mask:            mask,
+		timeout:         sc.Timeout,
+		grace:           sc.GracePeriod,
+		dir:             dir,
+		controls:        controls,
+		signals:         signals,
+		started: func() {
+			// The subcommand has its own copy of the secrets now
+			if sc.Harden {
+				envBuf.wipe()
+			}
+		},
+	}
+	if len(renewable) > 0 {
+		opts.background = func(signal func(os.Signal)) func() {
+			var notify func()
+			if sc.RenewSignal != nil {
+				notify = func() { signal(sc.RenewSignal) }
+			}
+			return renewFiles(renewable, withRetries(sc.FetchSecret, sc.Retries, sc.RetryBackoff), notify)
+		}
+	}
+	if sc.Deliver == DeliverFD {
+		// Keep the secrets out of the environment block entirely
+		opts.secrets, e = e, nil
+	}
+	trace.resolve.End(nil)
+	trace.command = sc.Telemetry.Start("summon.command", trace.root)
+	// Let the subcommand join the trace
+	if traceparent := trace.command.Traceparent(); traceparent != "" {
+		environ = append(environ, "TRACEPARENT="+traceparent)
+	}
+	if dir != "" && runtime.GOOS != "windows" {
+		// Shells trust PWD if it names the working directory
+		environ = append(environ, "PWD="+dir)
+	}
+	command := sc.Args
+	if sc.Shell != "" {
+		command, opts.cmdLine = shellCommand(sc.Shell, sc.Args[0])
+	}
+	err = runSubcommand(command, append(environ, e...), opts)
 	if err != nil {
+		if sc.ReportSignal {
+			reportSignal(err)
+		}
 		return returnStatusOfError(err)
 	}
 
 	return 0, nil
 }
 
+// loadSecrets finds, reads and parses the secrets file, or inline secrets.yml,
+// adds the secrets given as pairs, and sets up the provider to resolve them
+// with. Errors carry the exit code summon should fail with.
+func loadSecrets(sc *SubprocessConfig) (secretsyml.SecretsMap, error) {
+	var secrets secretsyml.SecretsMap
+	var err error
+
+	if sc.RecurseUp && sc.Filepath == StdinPath {
+		return nil, &ExitCodeError{ExitCode: ExitParseError, Err: errors.New("can't search up for a secrets file read from stdin")}
+	}
+	if sc.RecurseUp && remote.IsRemote(sc.Filepath) {
+		return nil, &ExitCodeError{ExitCode: ExitParseError, Err: errors.New("can't search up for a remote secrets file")}
+	}
+	if sc.RecurseUp && sc.Filepath != "" {
+		currentDir, err := os.Getwd()
+		if err != nil {
+			return nil, err
+		}
+		sc.Filepath, err = FindInParentTreeWithin(sc.Filepath, currentDir, sc.SearchBoundary)
+		if err != nil {
+			return nil, &ExitCodeError{ExitCode: ExitParseError, Err: err}
+		}
+		if sc.ConfirmOutsideRepo {
+			if err := confirmOutsideRepo(sc.Confirm, sc.Filepath, currentDir); err != nil {
+				return nil, &ExitCodeError{ExitCode: ExitParseError, Err: err}
+			}
+		}
+	}
+
+	var content []byte
+	// source names the secrets file in errors
+	var source string
+	var isRemote bool
+	format := sc.Format
+	switch {
+	case sc.YamlInline == StdinPath, sc.YamlInline == "" && sc.Filepath == StdinPath:
+		source = "secrets.yml from stdin"
+		if content, err = io.ReadAll(secretsStdin); err != nil {
+			err = fmt.Errorf("unable to read secrets.yml from stdin: %s", err)
+		}
+	case sc.YamlInline != "":
+		source = "inline secrets.yml"
+		content = []byte(sc.YamlInline)
+	case sc.Filepath != "":
+		source = sc.Filepath
+		if format == "" {
+			format = secretsyml.FormatOf(sc.Filepath)
+		}
+		isRemote = remote.IsRemote(sc.Filepath)
+		content, err = remote.ReadFile(sc.Filepath)
+	}
+	if err == nil && content != nil {
+		// Everything else reads the secrets.yml equivalent
+		var converted string
+		if converted, err = secretsyml.Convert(string(content), format); err == nil {
+			content = []byte(converted)
+		}
+	}
+	if err != nil {
+		return nil, &ExitCodeError{ExitCode: ExitParseError, Err: err}
+	}
+
+	subs, err := Substitutions(sc.Subs, string(content))
+	if err != nil {
+		return nil, &ExitCodeError{ExitCode: ExitParseError, Err: err}
+	}
+
+	var declaredProvider string
+	if content != nil {
+		secrets, err = secretsyml.ParseFromString(string(content), sc.Environment, subs)
+		if err != nil {
+			return nil, &ExitCodeError{ExitCode: ExitParseError, Err: err}
+		}
+		// Whoever serves a remote file doesn't get to pick what runs here
+		if isRemote {
+			if declared, _ := secretsyml.Provider(string(content), sc.Environment); declared != "" {
+				fmt.Fprintf(os.Stderr, "summon: ignoring the provider declared by remote %s\n", source)
+			}
+		} else if declaredProvider, err = secretsyml.Provider(string(content), sc.Environment); err != nil {
+			return nil, &ExitCodeError{ExitCode: ExitParseError, Err: err}
+		}
+	} else {
+		secrets = make(secretsyml.SecretsMap)
+	}
+
+	if sc.UseProvider != nil {
+		if err := sc.UseProvider(sc, declaredProvider); err != nil {
+			return nil, err
+		}
+	}
+	if err := checkProviderRequirements(sc.Provider, string(content), source); err != nil {
+		return nil, err
+	}
+
+	// Secrets given on the command line take precedence over the secrets file
+	flagSecrets, err := secretsyml.ParseFromPairs(sc.Secrets, subs)
+	if err != nil {
+		return nil, &ExitCodeError{ExitCode: ExitParseError, Err: err}
+	}
+	for key, spec := range flagSecrets {
+		secrets[key] = spec
+	}
+	return secrets, nil
+}
+
 func filterNonVariables(secrets secretsyml.SecretsMap, tempFactory *TempFactory) ([]prov.Result, secretsyml.SecretsMap) {
 	filteredSecrets := make(secretsyml.SecretsMap)
 	results := []prov.Result{}
 
 	for key, spec := range secrets {
+		if spec.IsPrompt() {
+			// Resolved by resolvePrompts
+			continue
+		}
 		if spec.IsVar() {
 			filteredSecrets[key] = spec
 		} else {
-			k, v := formatForEnv(key, spec.Path, spec, tempFactory)
-			result := prov.Result{k, v, nil}
+			value, err := spec.Transform(spec.Path)
+			if err != nil {
+				results = append(results, prov.Result{Key: key, Value: "", Error: err})
+				continue
+			}
+			k, v := formatForEnv(key, value, spec, tempFactory)
+			result := prov.Result{Key: k, Value: v, Error: nil}
 			results = append(results, result)
 		}
 	}
@@ -150,17 +608,27 @@ func handleResultsFromProvider(resultsCh chan prov.Result, errorsCh chan error,
 		select {
 		case result, ok := <-resultsCh:
 			if !ok {
+				// The provider stopped early, e.g. on a line it couldn't write
+				if len(results) < len(filteredSecrets) {
+					return nil, fmt.Errorf("provider returned %d of %d secrets", len(results), len(filteredSecrets))
+				}
 				return results, nil
 			}
 
 			spec := filteredSecrets[result.Key]
 
-			// Set a default value if the provider didn't return one for the item
-			if result.Value == "" && spec.DefaultValue != "" {
-				result.Value = spec.DefaultValue
+			// Apply modifiers, and set a default value if the provider didn't
+			// return one for the item
+			value, _, transformErr := prov.ParseResponse(result.Value)
+			if transformErr == nil {
+				value, transformErr = spec.Transform(value)
+			}
+			if transformErr != nil {
+				results = append(results, prov.Result{Key: result.Key, Value: "", Error: transformErr})
+				continue
 			}
-			k, v := formatForEnv(result.Key, result.Value, spec, tempFactory)
-			result = prov.Result{k, v, nil}
+			k, v := formatForEnv(result.Key, value, spec, tempFactory)
+			result = prov.Result{Key: k, Value: v, Error: nil}
 			results = append(results, result)
 
 		// Fallback to the old implementation if either provider doesn't support interactive mode or an error occured
@@ -172,32 +640,47 @@ func handleResultsFromProvider(resultsCh chan prov.Result, errorsCh chan error,
 
 func nonInteractiveProviderFallback(secrets secretsyml.SecretsMap, sc *SubprocessConfig, tempFactory *TempFactory) []prov.Result {
 	results := make(chan prov.Result, len(secrets))
+	fetchSecret := withRetries(sc.FetchSecret, sc.Retries, sc.RetryBackoff)
+	fetchSecret = withMemo(withCache(fetchSecret, sc.Cache))
 	var wg sync.WaitGroup
 
 	for key, spec := range secrets {
+		if spec.IsPrompt() {
+			// Resolved by resolvePrompts
+			continue
+		}
 		wg.Add(1)
 		go func(key string, spec secretsyml.SecretSpec) {
 			var value string
 			if spec.IsVar() {
-				valueBytes, err := sc.FetchSecret(spec.Path)
+				valueBytes, err := fetchSecret(spec.Path)
 				if err != nil {
-					results <- prov.Result{key, "", err}
+					results <- prov.Result{Key: key, Value: "", Error: err}
+					wg.Done()
+					return
+				}
+				// The provider may have answered with a metadata envelope
+				if value, _, err = prov.ParseResponse(string(valueBytes)); err != nil {
+					results <- prov.Result{Key: key, Value: "", Error: err}
 					wg.Done()
 					return
 				}
-				value = string(valueBytes)
 			} else {
 				// If the spec isn't a variable, use its value as-is
 				value = spec.Path
 			}
 
-			// Set a default value if the provider didn't return one for the item
-			if value == "" && spec.DefaultValue != "" {
-				value = spec.DefaultValue
+			// Apply modifiers, and set a default value if the provider didn't
+			// return one for the item
+			value, err := spec.Transform(value)
+			if err != nil {
+				results <- prov.Result{Key: key, Value: "", Error: err}
+				wg.Done()
+				return
 			}
 
 			k, v := formatForEnv(key, value, spec, tempFactory)
-			results <- prov.Result{k, v, nil}
+			results <- prov.Result{Key: k, Value: v, Error: nil}
 			wg.Done()
 		}(key, spec)
 	}
@@ -211,17 +694,52 @@ func nonInteractiveProviderFallback(secrets secretsyml.SecretsMap, sc *Subproces
 	return resultsSlice
 }
 
+// subcommandDir checks that dir, the working directory asked for the
+// subcommand, is one, and returns its absolute path; "" if none was asked for
+func subcommandDir(dir string) (string, error) {
+	if dir == "" {
+		return "", nil
+	}
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return "", err
+	}
+	info, err := os.Stat(abs)
+	if err != nil {
+		return "", fmt.Errorf("unable to run the command in %s: %s", dir, err)
+	}
+	if !info.IsDir() {
+		return "", fmt.Errorf("unable to run the command in %s: not a directory", dir)
+	}
+	return abs, nil
+}
+
+// returnStatusOfError converts the error of a finished subcommand into the
+// exit status summon should mirror: the subcommand's own exit status, or
+// 128+N if it was terminated by signal N, as shells report it
 func returnStatusOfError(err error) (int, error) {
 	if eerr, ok := err.(*exec.ExitError); ok {
 		if ws, ok := eerr.Sys().(syscall.WaitStatus); ok {
 			if ws.Exited() {
 				return ws.ExitStatus(), nil
 			}
+			if ws.Signaled() {
+				return 128 + int(ws.Signal()), nil
+			}
 		}
 	}
 	return 0, err
 }
 
+// reportSignal prints the signal that terminated the subcommand, if any
+func reportSignal(err error) {
+	if eerr, ok := err.(*exec.ExitError); ok {
+		if ws, ok := eerr.Sys().(syscall.WaitStatus); ok && ws.Signaled() {
+			fmt.Fprintf(os.Stderr, "summon: command terminated by signal %d (%s)\n", int(ws.Signal()), ws.Signal())
+		}
+	}
+}
+
 // formatForEnv returns a string in %k=%v format, where %k=namespace of the secret and
 // %v=the secret value or path to a temporary file containing the secret
 func formatForEnv(key string, value string, spec secretsyml.SecretSpec, tempFactory *TempFactory) (string, string) {
@@ -233,53 +751,75 @@ func formatForEnv(key string, value string, spec secretsyml.SecretSpec, tempFact
 	return key, value
 }
 
-func joinEnv(env map[string]string) string {
-	var envs []string
-	for k, v := range env {
-		envs = append(envs, fmt.Sprintf("%s=%s", k, v))
-	}
-
-	// Sort to ensure predictable results
-	sort.Strings(envs)
+// Cases variable names can be converted to, see EnvNaming
+const (
+	UpperCase = "upper"
+	LowerCase = "lower"
+)
 
-	return strings.Join(envs, "\n") + "\n"
+// EnvNaming changes the names of variables from the secrets file, so that one
+// secrets file can serve programs with different naming conventions
+type EnvNaming struct {
+	// Prefix is prepended to every name, as given
+	Prefix string
+	// Case is UpperCase or LowerCase to convert names to, or "" to keep them
+	Case string
 }
 
-// findInParentTree recursively searches for secretsFile starting at leafDir and in the
-// directories above leafDir until it is found or the root of the file system is reached.
-// If found, returns the absolute path to the file.
-func findInParentTree(secretsFile string, leafDir string) (string, error) {
-	if filepath.IsAbs(secretsFile) {
-		return "", fmt.Errorf(
-			"file specified (%s) is an absolute path: will not recurse up", secretsFile)
+// name returns the variable name for the secret key
+func (n EnvNaming) name(key string) string {
+	switch n.Case {
+	case UpperCase:
+		key = strings.ToUpper(key)
+	case LowerCase:
+		key = strings.ToLower(key)
 	}
+	return n.Prefix + key
+}
 
-	for {
-		joinedPath := filepath.Join(leafDir, secretsFile)
-
-		_, err := os.Stat(joinedPath)
-
-		if err != nil {
-			// If the file is not present, we just move up one level and run the next loop
-			// iteration
-			if os.IsNotExist(err) {
-				upOne := filepath.Dir(leafDir)
-				if upOne == leafDir {
-					return "", fmt.Errorf(
-						"unable to locate file specified (%s): reached root of file system", secretsFile)
-				}
-
-				leafDir = upOne
-				continue
+// rename returns env with every variable renamed. It fails if two variables
+// end up with the same name.
+func (n EnvNaming) rename(env map[string]string) (map[string]string, error) {
+	out := make(map[string]string, len(env))
+	from := make(map[string]string, len(env))
+	for key, value := range env {
+		name := n.name(key)
+		if other, ok := from[name]; ok {
+			if other > key {
+				other, key = key, other
 			}
-
-			// If we have an unexpected error, we fail-fast
-			return "", fmt.Errorf("unable to locate file specified (%s): %s", secretsFile, err)
+			return nil, fmt.Errorf("secrets %s and %s would both be named %s", other, key, name)
 		}
+		from[name] = key
+		out[name] = value
+	}
+	return out, nil
+}
+
+func joinEnv(env map[string]string) string {
+	keys := make([]string, 0, len(env))
+	size := 0
+	for k, v := range env {
+		keys = append(keys, k)
+		size += len(k) + len(v) + 2
+	}
 
-		// If there's no error, we found the file so we return it
-		return joinedPath, nil
+	// Sort to ensure predictable results
+	sort.Strings(keys)
+
+	// Copy every value only once
+	var out strings.Builder
+	out.Grow(size)
+	for _, k := range keys {
+		out.WriteString(k)
+		out.WriteByte('=')
+		out.WriteString(env[k])
+		out.WriteByte('\n')
+	}
+	if len(keys) == 0 {
+		out.WriteByte('\n')
 	}
+	return out.String()
 }
 
 // scans arguments for the magic string; if found,
@@ -302,14 +842,72 @@ func setupEnvFile(args []string, env map[string]string, tempFactory *TempFactory
 	return envFile
 }
 
-// convertSubsToMap converts the list of substitutions passed in via
-// command line to a map
-func convertSubsToMap(subs []string) map[string]string {
-	out := make(map[string]string)
-	for _, sub := range subs {
-		s := strings.SplitN(sub, "=", 2)
-		key, val := s[0], s[1]
-		out[key] = val
+// takeStdinSecret removes the secret named key from env, so that it can be
+// fed to the subcommand's stdin instead. Returns nil if key is empty.
+func takeStdinSecret(key string, secrets secretsyml.SecretsMap, env map[string]string) (io.Reader, error) {
+	if key == "" {
+		return nil, nil
+	}
+
+	spec, ok := secrets[key]
+	if !ok {
+		return nil, fmt.Errorf("stdin secret %s is not defined in the secrets file", key)
+	}
+	if spec.IsFile() {
+		return nil, fmt.Errorf("stdin secret %s can't be a file secret", key)
+	}
+
+	value, ok := env[key]
+	if !ok {
+		// The secret was ignored, so there is nothing to feed
+		return nil, nil
+	}
+	delete(env, key)
+	return strings.NewReader(value), nil
+}
+
+// checkProviderRequirements checks the provider against the versions of it
+// the secrets file in content requires, if any
+func checkProviderRequirements(provider, content, source string) error {
+	constraints, err := secretsyml.Requirements(content)
+	if err != nil {
+		return &ExitCodeError{ExitCode: ExitParseError, Err: err}
+	}
+
+	requirements := make([]prov.Requirement, len(constraints))
+	for i, constraint := range constraints {
+		if requirements[i], err = prov.ParseRequirement(constraint); err != nil {
+			return &ExitCodeError{ExitCode: ExitParseError, Err: err}
+		}
+	}
+	// Secrets can be resolved without a provider, e.g. in tests
+	if provider == "" {
+		return nil
+	}
+	if err := prov.CheckRequirements(provider, requirements, source); err != nil {
+		return &ExitCodeError{ExitCode: ExitProviderNotFound, Err: err}
+	}
+	return nil
+}
+
+// Substitutions returns the values of the $variables of the secrets.yml in
+// content: the var=value pairs given, later ones overriding earlier ones, over
+// the defaults declared in content. References in values, to substitutions or
+// else environment variables, are resolved.
+func Substitutions(pairs []string, content string) (map[string]string, error) {
+	subs, err := secretsyml.DefaultSubstitutions(content)
+	if err != nil {
+		return nil, err
+	}
+	if subs == nil {
+		subs = make(map[string]string)
+	}
+	for _, pair := range pairs {
+		key, value, ok := strings.Cut(pair, "=")
+		if !ok {
+			return nil, fmt.Errorf("substitution %q is not in var=value format", pair)
+		}
+		subs[key] = value
 	}
-	return out
+	return secretsyml.ResolveSubstitutions(subs, os.LookupEnv)
 }
@@ -1,12 +1,16 @@
 package summon
 
 import (
+	"crypto/sha256"
 	"errors"
 	"fmt"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"strconv"
+	"strings"
 	"testing"
 	"time"
 
@@ -74,6 +78,287 @@ func TestRunSubprocess(t *testing.T) {
 		assert.NoError(t, err)
 		assert.Equal(t, 0, code)
 	})
+
+	t.Run("Fetches a remote secrets file", func(t *testing.T) {
+		yml := "DB_PASS: !var prod/db/pass"
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprint(w, yml)
+		}))
+		defer server.Close()
+		tempFile := filepath.Join(t.TempDir(), "outputFile.txt")
+
+		code, err := RunSubprocess(&SubprocessConfig{
+			Args:     []string{"sh", "-c", "echo -n \"$DB_PASS\" > " + tempFile},
+			Filepath: fmt.Sprintf("%s/secrets.yml?checksum=sha256:%x", server.URL, sha256.Sum256([]byte(yml))),
+			FetchSecret: func(path string) ([]byte, error) {
+				return []byte("value-of-" + path), nil
+			},
+		})
+
+		assert.NoError(t, err)
+		assert.Equal(t, 0, code)
+		content, _ := os.ReadFile(tempFile)
+		assert.Equal(t, "value-of-prod/db/pass", string(content))
+
+		_, err = RunSubprocess(&SubprocessConfig{
+			Args:      []string{"true"},
+			Filepath:  server.URL + "/secrets.yml",
+			RecurseUp: true,
+		})
+		assert.EqualError(t, err, "can't search up for a remote secrets file")
+		assert.Equal(t, ExitParseError, ExitCodeOf(err))
+	})
+
+	t.Run("Reads secrets.yml from stdin", func(t *testing.T) {
+		defer func() { secretsStdin = os.Stdin }()
+		tempFile := filepath.Join(t.TempDir(), "outputFile.txt")
+
+		for _, sc := range []SubprocessConfig{{YamlInline: StdinPath}, {Filepath: StdinPath}} {
+			secretsStdin = strings.NewReader("DB_PASS: !var prod/db/pass")
+			sc.Args = []string{"sh", "-c", "echo -n \"$DB_PASS\" > " + tempFile}
+			sc.FetchSecret = func(path string) ([]byte, error) {
+				return []byte("value-of-" + path), nil
+			}
+
+			code, err := RunSubprocess(&sc)
+			assert.NoError(t, err)
+			assert.Equal(t, 0, code)
+			content, _ := os.ReadFile(tempFile)
+			assert.Equal(t, "value-of-prod/db/pass", string(content))
+		}
+
+		_, err := RunSubprocess(&SubprocessConfig{
+			Args:      []string{"true"},
+			Filepath:  StdinPath,
+			RecurseUp: true,
+		})
+		assert.EqualError(t, err, "can't search up for a secrets file read from stdin")
+		assert.Equal(t, ExitParseError, ExitCodeOf(err))
+	})
+
+	t.Run("Secrets can be given without a secrets file", func(t *testing.T) {
+		tempFile := filepath.Join(t.TempDir(), "outputFile.txt")
+
+		code, err := RunSubprocess(&SubprocessConfig{
+			Args:    []string{"sh", "-c", "echo -n \"$DB_PASS\" > " + tempFile},
+			Secrets: []string{"DB_PASS=prod/db/pass"},
+			FetchSecret: func(path string) ([]byte, error) {
+				return []byte("value-of-" + path), nil
+			},
+		})
+
+		assert.NoError(t, err)
+		assert.Equal(t, 0, code)
+
+		content, err := os.ReadFile(tempFile)
+		assert.NoError(t, err)
+		assert.Equal(t, "value-of-prod/db/pass", string(content))
+	})
+
+	t.Run("Invalid secrets YAML fails with the parse error exit code", func(t *testing.T) {
+		_, err := RunSubprocess(&SubprocessConfig{
+			Args:       []string{"true"},
+			YamlInline: "FOO: [",
+		})
+
+		assert.Error(t, err)
+		assert.Equal(t, ExitParseError, ExitCodeOf(err))
+	})
+
+	t.Run("Provider failure fails with the provider error exit code", func(t *testing.T) {
+		_, err := RunSubprocess(&SubprocessConfig{
+			Args:       []string{"true"},
+			YamlInline: "FOO: !var path/to/secret",
+			FetchSecret: func(string) ([]byte, error) {
+				return nil, errors.New("not found")
+			},
+		})
+
+		assert.EqualError(t, err, "Error fetching variable FOO: not found")
+		assert.Equal(t, ExitProviderError, ExitCodeOf(err))
+	})
+
+	t.Run("Values of the wrong type fail like provider failures", func(t *testing.T) {
+		_, err := RunSubprocess(&SubprocessConfig{
+			Args:       []string{"true"},
+			YamlInline: "DB_PORT: !var:int db/port\nDB_HOST: !var db/host",
+			FetchSecret: func(string) ([]byte, error) {
+				return []byte("oops"), nil
+			},
+		})
+
+		assert.EqualError(t, err, "Error fetching variable DB_PORT: resolved value is not an integer")
+		assert.Equal(t, ExitProviderError, ExitCodeOf(err))
+	})
+
+	t.Run("Uses the provider the environment declares", func(t *testing.T) {
+		var declared []string
+		useProvider := func(sc *SubprocessConfig, provider string) error {
+			declared = append(declared, provider)
+			sc.Provider = provider
+			sc.FetchSecret = func(path string) ([]byte, error) {
+				return []byte(provider + ":" + path), nil
+			}
+			return nil
+		}
+		content := ".provider: summon-conjur\nproduction:\n  DB_PASS: !var db\n" +
+			"development:\n  .provider: summon-file\n  DB_PASS: !var db\n"
+
+		for _, env := range []string{"production", "development"} {
+			out := filepath.Join(t.TempDir(), "out")
+			_, err := RunSubprocess(&SubprocessConfig{
+				Args:        []string{"sh", "-c", "printf %s \"$DB_PASS\" > " + out},
+				YamlInline:  content,
+				Environment: env,
+				UseProvider: useProvider,
+			})
+			assert.NoError(t, err)
+			value, err := os.ReadFile(out)
+			assert.NoError(t, err)
+			assert.Equal(t, map[string]string{"production": "summon-conjur:db", "development": "summon-file:db"}[env], string(value))
+		}
+		assert.Equal(t, []string{"summon-conjur", "summon-file"}, declared)
+	})
+
+	t.Run("Reads secrets files in the format of their extension", func(t *testing.T) {
+		dir := t.TempDir()
+		secretsFile := filepath.Join(dir, "secrets.json")
+		assert.NoError(t, os.WriteFile(secretsFile, []byte(`{"DB_PASS": "!var db", "DB_USER": "app"}`), 0600))
+		out := filepath.Join(dir, "out")
+
+		_, err := RunSubprocess(&SubprocessConfig{
+			Args:     []string{"sh", "-c", "printf %s \"$DB_USER:$DB_PASS\" > " + out},
+			Filepath: secretsFile,
+			FetchSecret: func(path string) ([]byte, error) {
+				return []byte("value-of-" + path), nil
+			},
+		})
+		assert.NoError(t, err)
+		value, err := os.ReadFile(out)
+		assert.NoError(t, err)
+		assert.Equal(t, "app:value-of-db", string(value))
+
+		_, err = RunSubprocess(&SubprocessConfig{
+			Args:       []string{"true"},
+			YamlInline: `DB_PASS = "!var db"`,
+			Format:     secretsyml.TOML,
+			FetchSecret: func(path string) ([]byte, error) {
+				return []byte(path), nil
+			},
+		})
+		assert.NoError(t, err)
+	})
+
+	t.Run("Ignores the provider a remote secrets file declares", func(t *testing.T) {
+		yml := ".provider: summon-evil\nDB_PASS: !var db\n"
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprint(w, yml)
+		}))
+		defer server.Close()
+
+		var declared []string
+		_, err := RunSubprocess(&SubprocessConfig{
+			Args:     []string{"true"},
+			Filepath: fmt.Sprintf("%s/secrets.yml?checksum=sha256:%x", server.URL, sha256.Sum256([]byte(yml))),
+			UseProvider: func(sc *SubprocessConfig, provider string) error {
+				declared = append(declared, provider)
+				sc.FetchSecret = func(path string) ([]byte, error) {
+					return []byte("value-of-" + path), nil
+				}
+				return nil
+			},
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, []string{""}, declared)
+	})
+
+	t.Run("Providers not matching the required version fail before resolving", func(t *testing.T) {
+		provider := filepath.Join(t.TempDir(), "summon-conjur")
+		assert.NoError(t, os.WriteFile(provider, []byte("#!/bin/sh\necho 0.6.2\n"), 0755))
+		fetched := false
+
+		_, err := RunSubprocess(&SubprocessConfig{
+			Args:       []string{"true"},
+			Provider:   provider,
+			YamlInline: ".requires: summon-conjur >= 0.7.0\nDB_PASS: !var db/password",
+			FetchSecret: func(string) ([]byte, error) {
+				fetched = true
+				return []byte("secret"), nil
+			},
+		})
+
+		assert.EqualError(t, err, "inline secrets.yml requires summon-conjur >= 0.7.0, but provider "+provider+
+			" is version 0.6.2: install a matching version, e.g. with summon providers install")
+		assert.Equal(t, ExitProviderNotFound, ExitCodeOf(err))
+		assert.False(t, fetched)
+	})
+
+	t.Run("Every provider failure is reported at once", func(t *testing.T) {
+		_, err := RunSubprocess(&SubprocessConfig{
+			Args:       []string{"true"},
+			Provider:   "provider",
+			YamlInline: "FOO: !var path/to/foo\nBAR: !var path/to/bar\nOK: !var path/to/ok",
+			FetchSecret: func(path string) ([]byte, error) {
+				if path == "path/to/ok" {
+					return []byte("ok"), nil
+				}
+				return nil, errors.New("not found")
+			},
+		})
+
+		assert.EqualError(t, err, `Error fetching 2 variables:
+  provider provider:
+    BAR (path/to/bar): not found
+    FOO (path/to/foo): not found`)
+		assert.Equal(t, ExitProviderError, ExitCodeOf(err))
+	})
+}
+
+func TestStdinSecret(t *testing.T) {
+	t.Run("Secret is written to stdin and left out of the environment", func(t *testing.T) {
+		tempFile := filepath.Join(t.TempDir(), "outputFile.txt")
+
+		code, err := RunSubprocess(&SubprocessConfig{
+			Args:        []string{"sh", "-c", "echo \"$(cat):${PASSWORD-unset}\" > " + tempFile},
+			YamlInline:  "PASSWORD: !var path/to/password",
+			StdinSecret: "PASSWORD",
+			FetchSecret: func(string) ([]byte, error) {
+				return []byte("s3cr3t"), nil
+			},
+		})
+
+		assert.NoError(t, err)
+		assert.Equal(t, 0, code)
+
+		content, err := os.ReadFile(tempFile)
+		assert.NoError(t, err)
+		assert.Equal(t, "s3cr3t:unset\n", string(content))
+	})
+
+	t.Run("Fails if the secret isn't defined", func(t *testing.T) {
+		_, err := RunSubprocess(&SubprocessConfig{
+			Args:        []string{"true"},
+			YamlInline:  "FOO: bar",
+			StdinSecret: "PASSWORD",
+		})
+
+		assert.EqualError(t, err, "stdin secret PASSWORD is not defined in the secrets file")
+	})
+
+	t.Run("Fails for a file secret", func(t *testing.T) {
+		_, err := RunSubprocess(&SubprocessConfig{
+			Args:        []string{"true"},
+			YamlInline:  "PASSWORD: !file bar",
+			StdinSecret: "PASSWORD",
+		})
+
+		assert.EqualError(t, err, "stdin secret PASSWORD can't be a file secret")
+	})
+}
+
+func TestExitCodeOf(t *testing.T) {
+	assert.Equal(t, ExitProviderNotFound, ExitCodeOf(&ExitCodeError{ExitCode: ExitProviderNotFound, Err: errors.New("x")}))
+	assert.Equal(t, ExitUnknownError, ExitCodeOf(errors.New("x")))
 }
 
 func TestHandleResultsFromProvider(t *testing.T) {
@@ -160,6 +445,29 @@ func TestHandleResultsFromProvider(t *testing.T) {
 		assert.Equal(t, prov.ErrInteractiveModeNotSupported, err)
 		assert.Nil(t, results)
 	})
+
+	t.Run("Returns error when provider stops before returning every secret", func(t *testing.T) {
+		resultsCh := make(chan prov.Result)
+		errorsCh := make(chan error, 1)
+
+		tempFactory := NewTempFactory("")
+		defer tempFactory.Cleanup()
+
+		filteredSecrets := secretsyml.SecretsMap{
+			"KEY1": secretsyml.SecretSpec{Path: "path/1", Tags: []secretsyml.YamlTag{secretsyml.Var}},
+			"KEY2": secretsyml.SecretSpec{Path: "path/2", Tags: []secretsyml.YamlTag{secretsyml.Var}},
+		}
+
+		go func() {
+			resultsCh <- prov.Result{Key: "KEY1", Value: "value"}
+			close(resultsCh)
+		}()
+
+		results, err := handleResultsFromProvider(resultsCh, errorsCh, filteredSecrets, &tempFactory)
+
+		assert.EqualError(t, err, "provider returned 1 of 2 secrets")
+		assert.Nil(t, results)
+	})
 }
 
 func TestFilterNonVariables(t *testing.T) {
@@ -199,6 +507,31 @@ func TestFilterNonVariables(t *testing.T) {
 		assert.Equal(t, expectedResults, results)
 		assert.Equal(t, expectedFilteredSecrets, filteredSecrets)
 	})
+
+	t.Run("Applies the default value of literals without a value", func(t *testing.T) {
+		tempFactory := NewTempFactory("")
+		defer tempFactory.Cleanup()
+
+		secrets := secretsyml.SecretsMap{
+			"EMPTY": secretsyml.SecretSpec{
+				Tags:         []secretsyml.YamlTag{secretsyml.Literal},
+				DefaultValue: "fallback",
+			},
+			"SET": secretsyml.SecretSpec{
+				Path:         "value",
+				Tags:         []secretsyml.YamlTag{secretsyml.Literal},
+				DefaultValue: "fallback",
+			},
+		}
+
+		results, filteredSecrets := filterNonVariables(secrets, &tempFactory)
+
+		assert.ElementsMatch(t, []prov.Result{
+			{Key: "EMPTY", Value: "fallback"},
+			{Key: "SET", Value: "value"},
+		}, results)
+		assert.Empty(t, filteredSecrets)
+	})
 }
 
 func TestDefaultVariableResolution(t *testing.T) {
@@ -236,6 +569,38 @@ func TestDefaultVariableResolution(t *testing.T) {
 	})
 }
 
+func TestModifierPipeline(t *testing.T) {
+	fetchSecret := func(path string) ([]byte, error) {
+		return []byte(`{"apikey": "c2VjcmV0Cg=="}`), nil
+	}
+
+	t.Run("Modifiers transform the provider's value in order", func(t *testing.T) {
+		tempFile := filepath.Join(t.TempDir(), "outputFile.txt")
+
+		code, err := RunSubprocess(&SubprocessConfig{
+			Args:        []string{"sh", "-c", "echo -n \"$API_KEY\" > " + tempFile},
+			YamlInline:  "API_KEY: !var:json=apikey:base64:trim prod/api",
+			FetchSecret: fetchSecret,
+		})
+
+		assert.NoError(t, err)
+		assert.Equal(t, 0, code)
+		content, _ := os.ReadFile(tempFile)
+		assert.Equal(t, "secret", string(content))
+	})
+
+	t.Run("Modifier errors are reported like provider errors", func(t *testing.T) {
+		_, err := RunSubprocess(&SubprocessConfig{
+			Args:        []string{"true"},
+			YamlInline:  "API_KEY: !var:json=token prod/api",
+			FetchSecret: fetchSecret,
+		})
+
+		assert.EqualError(t, err, "Error fetching variable API_KEY: json=token: key token not found")
+		assert.Equal(t, ExitProviderError, ExitCodeOf(err))
+	})
+}
+
 func TestDefaultVariableResolutionWithValue(t *testing.T) {
 	t.Run("Variable resolution correctly resolves variables", func(t *testing.T) {
 		expectedValue := "valueOfVariable"
@@ -271,7 +636,7 @@ func TestDefaultVariableResolutionWithValue(t *testing.T) {
 	})
 }
 
-func TestConvertSubsToMap(t *testing.T) {
+func TestSubstitutions(t *testing.T) {
 	t.Run("Substitutions are returned as a map used later for interpolation", func(t *testing.T) {
 		input := []string{
 			"policy=accounts-database",
@@ -283,10 +648,37 @@ func TestConvertSubsToMap(t *testing.T) {
 			"environment": "production",
 		}
 
-		output := convertSubsToMap(input)
+		output, err := Substitutions(input, "")
 
+		assert.NoError(t, err)
 		assert.EqualValues(t, expected, output)
 	})
+
+	t.Run("Pairs override the defaults of secrets.yml, and may refer to them", func(t *testing.T) {
+		t.Setenv("SUMMON_TEST_ACCOUNT", "1234")
+		content := `
+.substitutions:
+  region: us-east-1
+  env: dev
+DB_PASS: !var $path/password
+`
+		output, err := Substitutions([]string{
+			"env=prod",
+			"path=apps/$env/$region/$SUMMON_TEST_ACCOUNT",
+		}, content)
+
+		assert.NoError(t, err)
+		assert.Equal(t, map[string]string{
+			"region": "us-east-1",
+			"env":    "prod",
+			"path":   "apps/prod/us-east-1/1234",
+		}, output)
+	})
+
+	t.Run("Rejects pairs without a value", func(t *testing.T) {
+		_, err := Substitutions([]string{"env"}, "")
+		assert.EqualError(t, err, `substitution "env" is not in var=value format`)
+	})
 }
 
 func TestFormatForEnvString(t *testing.T) {
@@ -341,6 +733,49 @@ func TestJoinEnv(t *testing.T) {
 	})
 }
 
+func TestEnvNaming(t *testing.T) {
+	env := map[string]string{"db_password": "x", "Token": "y"}
+
+	t.Run("Names are kept by default", func(t *testing.T) {
+		named, err := EnvNaming{}.rename(env)
+		assert.NoError(t, err)
+		assert.Equal(t, env, named)
+	})
+
+	t.Run("The prefix is prepended as given", func(t *testing.T) {
+		named, err := EnvNaming{Prefix: "app_", Case: UpperCase}.rename(env)
+		assert.NoError(t, err)
+		assert.Equal(t, map[string]string{"app_DB_PASSWORD": "x", "app_TOKEN": "y"}, named)
+	})
+
+	t.Run("Names can be converted to lower case", func(t *testing.T) {
+		named, err := EnvNaming{Case: LowerCase}.rename(env)
+		assert.NoError(t, err)
+		assert.Equal(t, map[string]string{"db_password": "x", "token": "y"}, named)
+	})
+
+	t.Run("Names must stay unique", func(t *testing.T) {
+		_, err := EnvNaming{Case: UpperCase}.rename(map[string]string{"token": "x", "TOKEN": "y"})
+		assert.EqualError(t, err, "secrets TOKEN and token would both be named TOKEN")
+	})
+
+	t.Run("Applies to the subcommand's environment", func(t *testing.T) {
+		tempFile := filepath.Join(t.TempDir(), "outputFile.txt")
+
+		code, err := RunSubprocess(&SubprocessConfig{
+			Args:        []string{"sh", "-c", "echo -n $SPRING_DB_PASSWORD > " + tempFile},
+			YamlInline:  "db_password: !var db/password",
+			FetchSecret: func(string) ([]byte, error) { return []byte("hunter2"), nil },
+			Naming:      EnvNaming{Prefix: "SPRING_", Case: UpperCase},
+		})
+
+		assert.NoError(t, err)
+		assert.Equal(t, 0, code)
+		content, _ := os.ReadFile(tempFile)
+		assert.Equal(t, "hunter2", string(content))
+	})
+}
+
 func TestLocateFileRecurseUp(t *testing.T) {
 	filename := "test.txt"
 
@@ -351,7 +786,7 @@ func TestLocateFileRecurseUp(t *testing.T) {
 		_, err := os.Create(localFilePath)
 		assert.NoError(t, err)
 
-		gotPath, err := findInParentTree(filename, topDir)
+		gotPath, err := FindInParentTree(filename, topDir)
 		assert.NoError(t, err)
 
 		assert.Equal(t, localFilePath, gotPath)
@@ -369,7 +804,7 @@ func TestLocateFileRecurseUp(t *testing.T) {
 		err = os.MkdirAll(downDir, 0o700)
 		assert.NoError(t, err)
 
-		gotPath, err := findInParentTree(filename, downDir)
+		gotPath, err := FindInParentTree(filename, downDir)
 		assert.NoError(t, err)
 
 		assert.Equal(t, fileAbovePath, gotPath)
@@ -384,7 +819,7 @@ func TestLocateFileRecurseUp(t *testing.T) {
 			"unable to locate file specified (%s): reached root of file system",
 			nonExistingFileName)
 
-		_, err := findInParentTree(nonExistingFileName, topDir)
+		_, err := FindInParentTree(nonExistingFileName, topDir)
 		assert.EqualError(t, err, wantErrMsg)
 	})
 
@@ -394,7 +829,7 @@ func TestLocateFileRecurseUp(t *testing.T) {
 		absFileName := "/foo/bar/baz"
 		wantErrMsg := "file specified (/foo/bar/baz) is an absolute path: will not recurse up"
 
-		_, err := findInParentTree(absFileName, topDir)
+		_, err := FindInParentTree(absFileName, topDir)
 		assert.EqualError(t, err, wantErrMsg)
 	})
 
@@ -404,7 +839,7 @@ func TestLocateFileRecurseUp(t *testing.T) {
 		fileNameWithNulByte := "pizza\x00margherita"
 		wantErrMsg := "unable to locate file specified (pizza\x00margherita): stat"
 
-		_, err := findInParentTree(fileNameWithNulByte, topDir)
+		_, err := FindInParentTree(fileNameWithNulByte, topDir)
 		assert.Contains(t, err.Error(), wantErrMsg)
 	})
 }
@@ -423,6 +858,13 @@ func TestReturnStatusOfError(t *testing.T) {
 		assert.Equal(t, 1, res)
 	})
 
+	t.Run("returns 128+N for a command terminated by signal N", func(t *testing.T) {
+		exit := exec.Command("sh", "-c", "kill -TERM $$").Run()
+		res, err := returnStatusOfError(exit)
+		assert.NoError(t, err)
+		assert.Equal(t, 128+15, res)
+	})
+
 	t.Run("returns other errors unchanged", func(t *testing.T) {
 		expected := errors.New("test")
 		_, err := returnStatusOfError(expected)
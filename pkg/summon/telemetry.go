@@ -0,0 +1,121 @@
+package summon
+
+import (
+	"io"
+	"sync"
+	"time"
+
+	prov "github.com/cyberark/summon/pkg/provider"
+	"github.com/cyberark/summon/pkg/telemetry"
+)
+
+// Names of the metrics summon records
+const (
+	metricFetchDuration = "summon.secret.fetch.duration"
+	metricRetries       = "summon.provider.retries"
+	metricCacheLookups  = "summon.cache.lookups"
+)
+
+// runTrace holds the spans of a run: the whole run, resolving the secrets,
+// and running the subcommand
+type runTrace struct {
+	root    *telemetry.Span
+	resolve *telemetry.Span
+	command *telemetry.Span
+}
+
+// instrumented returns a copy of sc whose provider calls and cache lookups
+// are recorded in its telemetry, as children of parent. Without telemetry, sc
+// is returned as is.
+func instrumented(sc *SubprocessConfig, parent *telemetry.Span) *SubprocessConfig {
+	tel := sc.Telemetry
+	if tel == nil {
+		return sc
+	}
+
+	out := *sc
+	retries := &retryTracker{failed: map[string]bool{}}
+	if sc.FetchSecret != nil {
+		out.FetchSecret = func(path string) ([]byte, error) {
+			span := tel.Start("summon.provider.fetch", parent, pathAttributes(tel, path)...)
+			start := time.Now()
+			value, err := sc.FetchSecret(path)
+			observeFetch(tel, span, start, path, retries, err)
+			return value, err
+		}
+	}
+	if sc.StreamSecret != nil {
+		out.StreamSecret = func(path string, w io.Writer) error {
+			span := tel.Start("summon.provider.stream", parent, pathAttributes(tel, path)...)
+			start := time.Now()
+			err := sc.StreamSecret(path, w)
+			observeFetch(tel, span, start, path, retries, err)
+			return err
+		}
+	}
+	if sc.Cache != nil {
+		out.Cache = &observedCache{SecretCache: sc.Cache, tel: tel}
+	}
+	return &out
+}
+
+// pathAttributes returns the attributes naming path on a span, if the user
+// opted in to recording secret paths
+func pathAttributes(tel *telemetry.Telemetry, path string) []telemetry.Attribute {
+	if !tel.RecordsSecretPaths() {
+		return nil
+	}
+	return []telemetry.Attribute{telemetry.String("summon.secret.path", path)}
+}
+
+// retryTracker tells retries apart from other repeated fetches of a path,
+// such as renewals: a retry follows a transient failure
+type retryTracker struct {
+	mu     sync.Mutex
+	failed map[string]bool
+}
+
+// observeFetch records a call to the provider for path that started at start
+func observeFetch(tel *telemetry.Telemetry, span *telemetry.Span, start time.Time,
+	path string, retries *retryTracker, err error) {
+	retries.mu.Lock()
+	if retries.failed[path] {
+		tel.Add(metricRetries, "{retry}", 1)
+		span.SetAttributes(telemetry.String("summon.retry", "true"))
+	}
+	retries.failed[path] = isTransient(err)
+	retries.mu.Unlock()
+
+	tel.RecordDuration(metricFetchDuration, start)
+	span.End(err)
+}
+
+// observedCache records whether lookups in a cache were hits or misses
+type observedCache struct {
+	SecretCache
+	tel *telemetry.Telemetry
+}
+
+func (c *observedCache) Get(path string) ([]byte, bool) {
+	value, ok := c.SecretCache.Get(path)
+	result := "miss"
+	if ok {
+		result = "hit"
+	}
+	c.tel.Add(metricCacheLookups, "{lookup}", 1, telemetry.String("summon.cache.result", result))
+	return value, ok
+}
+
+// observeResults passes results from the provider in interactive mode through
+// unchanged, recording how long each took since start
+func observeResults(tel *telemetry.Telemetry, resultsCh chan prov.Result,
+	start time.Time, done <-chan struct{}) chan prov.Result {
+	if tel == nil {
+		return resultsCh
+	}
+
+	return pipeResults(resultsCh, done, func(result prov.Result) []prov.Result {
+		tel.RecordDuration(metricFetchDuration, start)
+		return []prov.Result{result}
+	})
+}
@@ -0,0 +1,126 @@
+package summon
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	prov "github.com/cyberark/summon/pkg/provider"
+	"github.com/cyberark/summon/pkg/telemetry"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRunSubprocessTelemetry(t *testing.T) {
+	sleep = func(time.Duration) {}
+	defer func() { sleep = time.Sleep }()
+
+	payloads := map[string]string{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		payloads[r.URL.Path] = string(body)
+	}))
+	defer server.Close()
+
+	tel, err := telemetry.FromEnv(func(name string) string {
+		if name == "OTEL_EXPORTER_OTLP_ENDPOINT" {
+			return server.URL
+		}
+		return ""
+	}, "test")
+	assert.NoError(t, err)
+
+	out := filepath.Join(t.TempDir(), "out")
+	calls := 0
+	code, err := RunSubprocess(&SubprocessConfig{
+		Args:       []string{"sh", "-c", "echo $TRACEPARENT > " + out},
+		YamlInline: "PASSWORD: !var db/password\nTOKEN: !var api/token",
+		// Doesn't support interactive mode, so secrets are fetched one by one
+		Provider: "false",
+		Retries:  1,
+		Cache:    mapCache{"api/token": []byte("cached")},
+		FetchSecret: func(path string) ([]byte, error) {
+			calls++
+			if calls == 1 {
+				return nil, &prov.CallError{ExitCode: 75, Err: errors.New("exit status 75")}
+			}
+			return []byte("fetched"), nil
+		},
+		Telemetry: tel,
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 0, code)
+	assert.NoError(t, tel.Shutdown(context.Background()))
+
+	t.Run("Spans cover the run", func(t *testing.T) {
+		var traces struct {
+			ResourceSpans []struct {
+				ScopeSpans []struct {
+					Spans []struct {
+						Name         string
+						SpanID       string
+						ParentSpanID string
+					}
+				}
+			}
+		}
+		assert.NoError(t, json.Unmarshal([]byte(payloads["/v1/traces"]), &traces))
+
+		ids := map[string]string{}
+		parents := map[string]string{}
+		var names []string
+		for _, span := range traces.ResourceSpans[0].ScopeSpans[0].Spans {
+			names = append(names, span.Name)
+			ids[span.Name] = span.SpanID
+			parents[span.Name] = span.ParentSpanID
+		}
+		// The failed attempt at interactive mode is recorded too
+		assert.ElementsMatch(t, []string{
+			"summon.provider.batch", "summon.provider.fetch", "summon.provider.fetch",
+			"summon.resolve", "summon.command", "summon.run",
+		}, names)
+		assert.Equal(t, ids["summon.resolve"], parents["summon.provider.fetch"])
+		assert.Equal(t, ids["summon.run"], parents["summon.resolve"])
+		assert.Equal(t, ids["summon.run"], parents["summon.command"])
+
+		// The subcommand joins the trace as a child of its span
+		content, _ := os.ReadFile(out)
+		assert.Contains(t, string(content), "-"+ids["summon.command"]+"-")
+	})
+
+	t.Run("Metrics count retries and cache lookups", func(t *testing.T) {
+		metrics := payloads["/v1/metrics"]
+		assert.Contains(t, metrics, `"name":"summon.provider.retries"`)
+		assert.Contains(t, metrics, `"asInt":"1"`)
+		assert.Contains(t, metrics, `"name":"summon.cache.lookups"`)
+		assert.True(t, strings.Contains(metrics, `"stringValue":"hit"`) && strings.Contains(metrics, `"stringValue":"miss"`))
+		assert.Contains(t, metrics, `"name":"summon.secret.fetch.duration"`)
+	})
+
+	t.Run("Secret paths are left out unless opted in to", func(t *testing.T) {
+		for _, payload := range payloads {
+			assert.NotContains(t, payload, "db/password")
+			assert.NotContains(t, payload, "summon.secret.path")
+		}
+	})
+}
+
+func TestPathAttributes(t *testing.T) {
+	tel, err := telemetry.FromEnv(func(name string) string {
+		return map[string]string{
+			"OTEL_EXPORTER_OTLP_ENDPOINT": "http://collector:4318",
+			telemetry.SecretPathsEnv:      "true",
+		}[name]
+	}, "test")
+	assert.NoError(t, err)
+	assert.Equal(t, []telemetry.Attribute{telemetry.String("summon.secret.path", "db/password")}, pathAttributes(tel, "db/password"))
+
+	assert.Empty(t, pathAttributes(nil, "db/password"))
+}
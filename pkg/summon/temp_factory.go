@@ -1,27 +1,59 @@
 package summon
 
 import (
+	"encoding/json"
+	"errors"
 	"os"
-	"strings"
+	"path/filepath"
+	"sync"
+	"time"
 )
 
 // DEVSHM is the default *nix shared-memory directory path
 const DEVSHM = "/dev/shm"
 
+// InventoryName is the name of the manifest listing the temp files of a run,
+// in the directory holding them
+const InventoryName = "inventory.json"
+
 // TempFactory handels transient files that require cleaning up
-// after the child process exits.
+// after the child process exits. The files of a run are all kept in a
+// directory of their own, only accessible to the user, along with an
+// inventory of them, so that those of a run that crashed can be found.
 type TempFactory struct {
-	path  string
-	files []string
+	path string
+	// dir is the directory of the run in path, created with the first file
+	dir     string
+	created time.Time
+	files   []string
+	// mu guards the files, as secrets are resolved concurrently, and cleanup
+	// may happen while they still are (see RunSubprocess)
+	mu      *sync.Mutex
+	cleaned bool
+	// owner is set to give the directory and files to the user uid and group
+	// gid
+	owner    bool
+	uid, gid int
+}
+
+// inventory is the manifest of the temp files of a run
+type inventory struct {
+	PID     int       `json:"pid"`
+	Created time.Time `json:"created"`
+	Files   []string  `json:"files"`
 }
 
-// NewTempFactory creates a new temporary file factory.
+// errCleanedUp is returned when creating a temp file after Cleanup
+var errCleanedUp = errors.New("temp files have been cleaned up")
+
+// NewTempFactory creates a new temporary file factory, creating the
+// directory of the run in path, or DefaultTempPath if empty.
 // defer Cleanup() if you want the files removed.
 func NewTempFactory(path string) TempFactory {
 	if path == "" {
 		path = DefaultTempPath()
 	}
-	return TempFactory{path: path}
+	return TempFactory{path: path, mu: &sync.Mutex{}}
 }
 
 // DefaultTempPath returns the best possible temp folder path for temp files
@@ -32,31 +64,114 @@ func DefaultTempPath() string {
 	}
 	home, err := os.UserHomeDir()
 	if err == nil {
-		dir, _ := os.MkdirTemp(home, ".tmp")
-		return dir
+		return home
 	}
 	return os.TempDir()
 }
 
-// Push creates a temp file with given value. Returns the path.
+// SetOwner makes the user uid and the group gid own the directory of the run
+// and the files created in it, e.g. for a subcommand running as another user
+// to read them. Call it before creating any.
+func (tf *TempFactory) SetOwner(uid, gid int) {
+	tf.mu.Lock()
+	defer tf.mu.Unlock()
+	tf.owner, tf.uid, tf.gid = true, uid, gid
+}
+
+// Push creates a temp file with given value. Returns the path, or "" after
+// Cleanup.
 func (tf *TempFactory) Push(value string) string {
-	f, _ := os.CreateTemp(tf.path, ".summon")
+	f, err := tf.Create()
+	if err != nil {
+		return ""
+	}
 	defer f.Close()
 
-	f.Write([]byte(value))
-	name := f.Name()
-	tf.files = append(tf.files, name)
-	return name
+	// Without a copy of value
+	f.WriteString(value)
+	return f.Name()
+}
+
+// Create creates an empty temp file, for values written to it directly.
+// Cleanup removes it like the files created with Push.
+func (tf *TempFactory) Create() (*os.File, error) {
+	tf.mu.Lock()
+	defer tf.mu.Unlock()
+	if tf.cleaned {
+		return nil, errCleanedUp
+	}
+	if tf.dir == "" {
+		// Only accessible to the user
+		dir, err := os.MkdirTemp(tf.path, ".summon-run")
+		if err != nil {
+			return nil, err
+		}
+		if tf.owner {
+			if err := os.Chown(dir, tf.uid, tf.gid); err != nil {
+				os.Remove(dir)
+				return nil, err
+			}
+		}
+		tf.dir, tf.created = dir, time.Now()
+	}
+
+	f, err := os.CreateTemp(tf.dir, ".summon")
+	if err != nil {
+		return nil, err
+	}
+	if tf.owner {
+		if err := os.Chown(f.Name(), tf.uid, tf.gid); err != nil {
+			f.Close()
+			os.Remove(f.Name())
+			return nil, err
+		}
+	}
+	tf.files = append(tf.files, f.Name())
+	if err := tf.writeInventory(); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		tf.files = tf.files[:len(tf.files)-1]
+		return nil, err
+	}
+	return f, nil
+}
+
+// writeInventory replaces the inventory of the run with the files created so
+// far, atomically so that it can be read at any time
+func (tf *TempFactory) writeInventory() error {
+	data, err := json.Marshal(inventory{PID: os.Getpid(), Created: tf.created, Files: tf.files})
+	if err != nil {
+		return err
+	}
+
+	f, err := os.CreateTemp(tf.dir, ".inventory")
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(data)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), filepath.Join(tf.dir, InventoryName))
+	}
+	if err != nil {
+		os.Remove(f.Name())
+	}
+	return err
 }
 
-// Cleanup removes the temporary files created with this factory.
+// Cleanup removes the directory of the run, with the temporary files created
+// with this factory. No more can be created afterwards, and cleaning up again
+// does nothing.
 func (tf *TempFactory) Cleanup() {
-	for _, file := range tf.files {
-		os.Remove(file)
+	tf.mu.Lock()
+	defer tf.mu.Unlock()
+	if tf.cleaned {
+		return
 	}
-	// Also remove the tempdir if it's not DEVSHM
-	if !strings.Contains(tf.path, DEVSHM) {
-		os.Remove(tf.path)
+	tf.cleaned = true
+	if tf.dir != "" {
+		os.RemoveAll(tf.dir)
 	}
-	tf = nil
 }
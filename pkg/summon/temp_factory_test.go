@@ -0,0 +1,83 @@
+package summon
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTempFactory(t *testing.T) {
+	t.Run("Keeps the files of a run in a directory of their own", func(t *testing.T) {
+		base := t.TempDir()
+		tempFactory := NewTempFactory(base)
+		defer tempFactory.Cleanup()
+
+		first := tempFactory.Push("first")
+		second := tempFactory.Push("second")
+		dir := filepath.Dir(first)
+		assert.Equal(t, dir, filepath.Dir(second))
+		assert.Equal(t, base, filepath.Dir(dir))
+
+		if runtime.GOOS != "windows" {
+			info, err := os.Stat(dir)
+			assert.NoError(t, err)
+			assert.Equal(t, os.FileMode(0700), info.Mode().Perm())
+		}
+	})
+
+	t.Run("Creates the directory only when needed", func(t *testing.T) {
+		base := t.TempDir()
+		tempFactory := NewTempFactory(base)
+		tempFactory.Cleanup()
+
+		entries, err := os.ReadDir(base)
+		assert.NoError(t, err)
+		assert.Empty(t, entries)
+	})
+
+	t.Run("Lists the files in an inventory", func(t *testing.T) {
+		tempFactory := NewTempFactory(t.TempDir())
+		defer tempFactory.Cleanup()
+		first := tempFactory.Push("first")
+		second := tempFactory.Push("second")
+
+		data, err := os.ReadFile(filepath.Join(filepath.Dir(first), InventoryName))
+		assert.NoError(t, err)
+		var inv inventory
+		assert.NoError(t, json.Unmarshal(data, &inv))
+		assert.Equal(t, os.Getpid(), inv.PID)
+		assert.False(t, inv.Created.IsZero())
+		assert.Equal(t, []string{first, second}, inv.Files)
+	})
+
+	t.Run("Cleans up files created concurrently, once", func(t *testing.T) {
+		base := t.TempDir()
+		tempFactory := NewTempFactory(base)
+
+		var wg sync.WaitGroup
+		for i := 0; i < 20; i++ {
+			wg.Add(2)
+			go func() {
+				defer wg.Done()
+				tempFactory.Push("value")
+			}()
+			go func() {
+				defer wg.Done()
+				if i%5 == 4 {
+					tempFactory.Cleanup()
+				}
+			}()
+		}
+		wg.Wait()
+		tempFactory.Cleanup()
+
+		entries, err := os.ReadDir(base)
+		assert.NoError(t, err)
+		assert.Empty(t, entries)
+	})
+}
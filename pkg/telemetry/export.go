@@ -0,0 +1,208 @@
+package telemetry
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// OTLP enum values, see opentelemetry-proto
+const (
+	spanKindInternal            = 1
+	statusCodeError             = 2
+	aggregationTemporalityCumul = 2
+)
+
+// scopeName names summon as the instrumentation scope of what it exports
+const scopeName = "github.com/cyberark/summon"
+
+// Shutdown exports everything recorded, giving up when ctx is done. Spans
+// that haven't ended are left out.
+func (t *Telemetry) Shutdown(ctx context.Context) error {
+	if t == nil {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(ctx, t.timeout)
+	defer cancel()
+
+	t.mu.Lock()
+	traces, metrics := t.tracesJSON(), t.metricsJSON()
+	t.mu.Unlock()
+
+	if t.tracesURL != "" && traces != nil {
+		if err := t.post(ctx, t.tracesURL, traces); err != nil {
+			return fmt.Errorf("unable to export traces: %s", err)
+		}
+	}
+	if t.metricsURL != "" && metrics != nil {
+		if err := t.post(ctx, t.metricsURL, metrics); err != nil {
+			return fmt.Errorf("unable to export metrics: %s", err)
+		}
+	}
+	return nil
+}
+
+func (t *Telemetry) post(ctx context.Context, url string, payload interface{}) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for key, value := range t.headers {
+		req.Header.Set(key, value)
+	}
+
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("%s returned %s", url, resp.Status)
+	}
+	return nil
+}
+
+type object map[string]interface{}
+
+func (t *Telemetry) scope() object {
+	return object{"name": scopeName, "version": t.version}
+}
+
+func (t *Telemetry) resourceJSON() object {
+	return object{"attributes": attributesJSON(t.resource)}
+}
+
+func (t *Telemetry) tracesJSON() object {
+	if len(t.spans) == 0 {
+		return nil
+	}
+	spans := make([]object, 0, len(t.spans))
+	for _, s := range t.spans {
+		span := object{
+			"traceId":           hex.EncodeToString(t.traceID[:]),
+			"spanId":            hex.EncodeToString(s.id[:]),
+			"name":              s.name,
+			"kind":              spanKindInternal,
+			"startTimeUnixNano": nanos(s.start),
+			"endTimeUnixNano":   nanos(s.end),
+			"attributes":        attributesJSON(s.attrs),
+		}
+		if s.parent != [8]byte{} {
+			span["parentSpanId"] = hex.EncodeToString(s.parent[:])
+		}
+		if s.err != "" {
+			span["status"] = object{"code": statusCodeError, "message": s.err}
+		}
+		spans = append(spans, span)
+	}
+	return object{"resourceSpans": []object{{
+		"resource":   t.resourceJSON(),
+		"scopeSpans": []object{{"scope": t.scope(), "spans": spans}},
+	}}}
+}
+
+func (t *Telemetry) metricsJSON() object {
+	if len(t.counters) == 0 && len(t.histos) == 0 {
+		return nil
+	}
+	start, now := nanos(t.start), nanos(time.Now())
+
+	var metrics []object
+	for _, name := range sortedKeys(t.counters) {
+		c := t.counters[name]
+		var points []object
+		for _, key := range sortedKeys(c.values) {
+			p := c.values[key]
+			points = append(points, object{
+				"attributes":        attributesJSON(p.attrs),
+				"startTimeUnixNano": start,
+				"timeUnixNano":      now,
+				"asInt":             strconv.FormatInt(p.value, 10),
+			})
+		}
+		metrics = append(metrics, object{
+			"name": name,
+			"unit": c.unit,
+			"sum": object{
+				"dataPoints":             points,
+				"aggregationTemporality": aggregationTemporalityCumul,
+				"isMonotonic":            true,
+			},
+		})
+	}
+	for _, name := range sortedKeys(t.histos) {
+		h := t.histos[name]
+		var points []object
+		for _, key := range sortedKeys(h.values) {
+			p := h.values[key]
+			buckets := make([]string, len(p.buckets))
+			for i, n := range p.buckets {
+				buckets[i] = strconv.FormatUint(n, 10)
+			}
+			points = append(points, object{
+				"attributes":        attributesJSON(p.attrs),
+				"startTimeUnixNano": start,
+				"timeUnixNano":      now,
+				"count":             strconv.FormatUint(p.count, 10),
+				"sum":               p.sum,
+				"min":               p.min,
+				"max":               p.max,
+				"bucketCounts":      buckets,
+				"explicitBounds":    histogramBounds,
+			})
+		}
+		metrics = append(metrics, object{
+			"name": name,
+			"unit": h.unit,
+			"histogram": object{
+				"dataPoints":             points,
+				"aggregationTemporality": aggregationTemporalityCumul,
+			},
+		})
+	}
+	return object{"resourceMetrics": []object{{
+		"resource":     t.resourceJSON(),
+		"scopeMetrics": []object{{"scope": t.scope(), "metrics": metrics}},
+	}}}
+}
+
+// attributesJSON encodes attributes as OTLP KeyValues. 64-bit integers are
+// strings in OTLP's JSON encoding.
+func attributesJSON(attrs []Attribute) []object {
+	out := make([]object, 0, len(attrs))
+	for _, attr := range attrs {
+		var value object
+		switch v := attr.Value.(type) {
+		case int64:
+			value = object{"intValue": strconv.FormatInt(v, 10)}
+		default:
+			value = object{"stringValue": fmt.Sprint(v)}
+		}
+		out = append(out, object{"key": attr.Key, "value": value})
+	}
+	return out
+}
+
+func nanos(t time.Time) string {
+	return strconv.FormatInt(t.UnixNano(), 10)
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
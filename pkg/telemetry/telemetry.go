@@ -0,0 +1,338 @@
+// Package telemetry records OpenTelemetry spans and metrics for a run of
+// summon, and exports them with OTLP over HTTP (JSON encoded) when the run
+// ends. It is configured with the standard OTEL_* environment variables and
+// does nothing unless an OTLP endpoint is set.
+package telemetry
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Telemetry collects the spans and metrics of a single run. A nil *Telemetry
+// records nothing, so callers don't need to check whether it is enabled.
+type Telemetry struct {
+	tracesURL  string
+	metricsURL string
+	headers    map[string]string
+	timeout    time.Duration
+	resource   []Attribute
+	version    string
+	client     *http.Client
+	// secretPaths is whether secret paths may be recorded on spans
+	secretPaths bool
+
+	traceID [16]byte
+	// parentID is the span summon's spans are children of, if it was started
+	// as part of a trace (see TRACEPARENT)
+	parentID [8]byte
+	start    time.Time
+
+	mu       sync.Mutex
+	spans    []*Span
+	counters map[string]*counter
+	histos   map[string]*histogram
+}
+
+// Attribute is a key-value pair describing a span or a metric
+type Attribute struct {
+	Key   string
+	Value interface{}
+}
+
+// String returns a string attribute
+func String(key, value string) Attribute {
+	return Attribute{Key: key, Value: value}
+}
+
+// Int returns an integer attribute
+func Int(key string, value int64) Attribute {
+	return Attribute{Key: key, Value: value}
+}
+
+// SecretPathsEnv opts in to recording secret paths on spans. Paths can be
+// sensitive, and are never recorded on metrics.
+const SecretPathsEnv = "SUMMON_OTEL_SECRET_PATHS"
+
+// FromEnv sets up telemetry from the OTEL_* variables read with getenv,
+// tagging what it exports with version. It returns nil if no OTLP endpoint is
+// set or the SDK is disabled, and an error if the configuration can't be used.
+func FromEnv(getenv func(string) string, version string) (*Telemetry, error) {
+	if strings.EqualFold(getenv("OTEL_SDK_DISABLED"), "true") {
+		return nil, nil
+	}
+
+	t := &Telemetry{
+		tracesURL:  signalURL(getenv, "TRACES", "/v1/traces"),
+		metricsURL: signalURL(getenv, "METRICS", "/v1/metrics"),
+		headers:    map[string]string{},
+		timeout:    10 * time.Second,
+		version:    version,
+		start:      time.Now(),
+		counters:   map[string]*counter{},
+		histos:     map[string]*histogram{},
+	}
+	if getenv("OTEL_TRACES_EXPORTER") == "none" {
+		t.tracesURL = ""
+	}
+	if getenv("OTEL_METRICS_EXPORTER") == "none" {
+		t.metricsURL = ""
+	}
+	if t.tracesURL == "" && t.metricsURL == "" {
+		return nil, nil
+	}
+
+	if protocol := getenv("OTEL_EXPORTER_OTLP_PROTOCOL"); protocol != "" && protocol != "http/json" {
+		return nil, fmt.Errorf("unsupported OTLP protocol %q, only http/json is supported", protocol)
+	}
+	if timeout := getenv("OTEL_EXPORTER_OTLP_TIMEOUT"); timeout != "" {
+		ms, err := strconv.Atoi(timeout)
+		if err != nil || ms <= 0 {
+			return nil, fmt.Errorf("invalid OTEL_EXPORTER_OTLP_TIMEOUT %q", timeout)
+		}
+		t.timeout = time.Duration(ms) * time.Millisecond
+	}
+	t.client = &http.Client{Timeout: t.timeout}
+
+	headers, err := parsePairs(getenv("OTEL_EXPORTER_OTLP_HEADERS"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid OTEL_EXPORTER_OTLP_HEADERS: %s", err)
+	}
+	for _, header := range headers {
+		t.headers[header.Key] = header.Value.(string)
+	}
+
+	resource, err := parsePairs(getenv("OTEL_RESOURCE_ATTRIBUTES"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid OTEL_RESOURCE_ATTRIBUTES: %s", err)
+	}
+	serviceName := getenv("OTEL_SERVICE_NAME")
+	if serviceName == "" {
+		serviceName = "summon"
+	}
+	t.resource = append([]Attribute{String("service.name", serviceName)}, resource...)
+	t.secretPaths = strings.EqualFold(getenv(SecretPathsEnv), "true")
+
+	if _, err := rand.Read(t.traceID[:]); err != nil {
+		return nil, err
+	}
+	if traceID, parentID, ok := parseTraceparent(getenv("TRACEPARENT")); ok {
+		t.traceID, t.parentID = traceID, parentID
+	}
+	return t, nil
+}
+
+// signalURL returns the endpoint to export a signal to: its own endpoint if
+// set, otherwise path under the common one
+func signalURL(getenv func(string) string, signal, path string) string {
+	if endpoint := getenv("OTEL_EXPORTER_OTLP_" + signal + "_ENDPOINT"); endpoint != "" {
+		return endpoint
+	}
+	if endpoint := getenv("OTEL_EXPORTER_OTLP_ENDPOINT"); endpoint != "" {
+		return strings.TrimSuffix(endpoint, "/") + path
+	}
+	return ""
+}
+
+// parsePairs parses a list of key=value pairs separated by commas, with
+// URL-encoded values, as in OTEL_EXPORTER_OTLP_HEADERS
+func parsePairs(s string) ([]Attribute, error) {
+	var pairs []Attribute
+	for _, pair := range strings.Split(s, ",") {
+		if strings.TrimSpace(pair) == "" {
+			continue
+		}
+		key, value, ok := strings.Cut(pair, "=")
+		if !ok {
+			return nil, fmt.Errorf("%q is not a key=value pair", pair)
+		}
+		value, err := url.QueryUnescape(strings.TrimSpace(value))
+		if err != nil {
+			return nil, err
+		}
+		pairs = append(pairs, String(strings.TrimSpace(key), value))
+	}
+	return pairs, nil
+}
+
+// parseTraceparent parses a W3C traceparent header, e.g.
+// 00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01
+func parseTraceparent(s string) (traceID [16]byte, spanID [8]byte, ok bool) {
+	parts := strings.Split(s, "-")
+	if len(parts) != 4 || len(parts[1]) != 32 || len(parts[2]) != 16 {
+		return traceID, spanID, false
+	}
+	if _, err := hex.Decode(traceID[:], []byte(parts[1])); err != nil {
+		return traceID, spanID, false
+	}
+	if _, err := hex.Decode(spanID[:], []byte(parts[2])); err != nil {
+		return traceID, spanID, false
+	}
+	return traceID, spanID, traceID != [16]byte{} && spanID != [8]byte{}
+}
+
+// Span is a timed operation within the run
+type Span struct {
+	t      *Telemetry
+	name   string
+	id     [8]byte
+	parent [8]byte
+	start  time.Time
+	end    time.Time
+	attrs  []Attribute
+	err    string
+}
+
+// RecordsSecretPaths reports whether secret paths may be recorded on spans,
+// see SecretPathsEnv
+func (t *Telemetry) RecordsSecretPaths() bool {
+	return t != nil && t.secretPaths
+}
+
+// Start starts a span named name, as a child of parent if it isn't nil
+func (t *Telemetry) Start(name string, parent *Span, attrs ...Attribute) *Span {
+	if t == nil {
+		return nil
+	}
+	s := &Span{t: t, name: name, parent: t.parentID, start: time.Now(), attrs: attrs}
+	if parent != nil {
+		s.parent = parent.id
+	}
+	rand.Read(s.id[:])
+	return s
+}
+
+// SetAttributes adds attributes to the span
+func (s *Span) SetAttributes(attrs ...Attribute) {
+	if s == nil {
+		return
+	}
+	s.attrs = append(s.attrs, attrs...)
+}
+
+// End ends the span, marking it as failed if err isn't nil. Ending a span
+// again does nothing.
+func (s *Span) End(err error) {
+	if s == nil {
+		return
+	}
+	s.t.mu.Lock()
+	defer s.t.mu.Unlock()
+	if !s.end.IsZero() {
+		return
+	}
+	s.end = time.Now()
+	if err != nil {
+		s.err = err.Error()
+	}
+	s.t.spans = append(s.t.spans, s)
+}
+
+// Traceparent returns the W3C traceparent of the span, for processes started
+// within it to join the trace, or "" if s is nil
+func (s *Span) Traceparent() string {
+	if s == nil {
+		return ""
+	}
+	return fmt.Sprintf("00-%s-%s-01", hex.EncodeToString(s.t.traceID[:]), hex.EncodeToString(s.id[:]))
+}
+
+type counter struct {
+	unit   string
+	values map[string]*counterPoint
+}
+
+type counterPoint struct {
+	attrs []Attribute
+	value int64
+}
+
+// Add adds n to the counter named name, for attrs
+func (t *Telemetry) Add(name, unit string, n int64, attrs ...Attribute) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	c, ok := t.counters[name]
+	if !ok {
+		c = &counter{unit: unit, values: map[string]*counterPoint{}}
+		t.counters[name] = c
+	}
+	key := attributesKey(attrs)
+	if _, ok := c.values[key]; !ok {
+		c.values[key] = &counterPoint{attrs: attrs}
+	}
+	c.values[key].value += n
+}
+
+// histogramBounds are the bucket boundaries of histograms, suited to
+// durations in milliseconds
+var histogramBounds = []float64{0, 5, 10, 25, 50, 75, 100, 250, 500, 750, 1000, 2500, 5000, 7500, 10000}
+
+type histogram struct {
+	unit   string
+	values map[string]*histogramPoint
+}
+
+type histogramPoint struct {
+	attrs    []Attribute
+	count    uint64
+	sum      float64
+	min, max float64
+	buckets  []uint64
+}
+
+// Record records value in the histogram named name, for attrs
+func (t *Telemetry) Record(name, unit string, value float64, attrs ...Attribute) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	h, ok := t.histos[name]
+	if !ok {
+		h = &histogram{unit: unit, values: map[string]*histogramPoint{}}
+		t.histos[name] = h
+	}
+	key := attributesKey(attrs)
+	p, ok := h.values[key]
+	if !ok {
+		p = &histogramPoint{attrs: attrs, min: value, max: value, buckets: make([]uint64, len(histogramBounds)+1)}
+		h.values[key] = p
+	}
+	p.count++
+	p.sum += value
+	p.min = min(p.min, value)
+	p.max = max(p.max, value)
+	bucket := len(histogramBounds)
+	for i, bound := range histogramBounds {
+		if value <= bound {
+			bucket = i
+			break
+		}
+	}
+	p.buckets[bucket]++
+}
+
+// RecordDuration records the time since start, in milliseconds, in the
+// histogram named name
+func (t *Telemetry) RecordDuration(name string, start time.Time, attrs ...Attribute) {
+	t.Record(name, "ms", float64(time.Since(start).Microseconds())/1000, attrs...)
+}
+
+// attributesKey identifies a set of attributes, to aggregate metrics by
+func attributesKey(attrs []Attribute) string {
+	var b strings.Builder
+	for _, attr := range attrs {
+		fmt.Fprintf(&b, "%s=%v\x00", attr.Key, attr.Value)
+	}
+	return b.String()
+}
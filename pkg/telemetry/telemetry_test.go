@@ -0,0 +1,200 @@
+package telemetry
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// env returns a getenv function for the variables in vars
+func env(vars map[string]string) func(string) string {
+	return func(name string) string { return vars[name] }
+}
+
+func TestFromEnv(t *testing.T) {
+	t.Run("Is off without an endpoint", func(t *testing.T) {
+		tel, err := FromEnv(env(nil), "1.0")
+		assert.NoError(t, err)
+		assert.Nil(t, tel)
+	})
+
+	t.Run("Is off when the SDK is disabled", func(t *testing.T) {
+		tel, err := FromEnv(env(map[string]string{
+			"OTEL_EXPORTER_OTLP_ENDPOINT": "http://collector:4318",
+			"OTEL_SDK_DISABLED":           "true",
+		}), "1.0")
+		assert.NoError(t, err)
+		assert.Nil(t, tel)
+	})
+
+	t.Run("Is off when every exporter is none", func(t *testing.T) {
+		tel, err := FromEnv(env(map[string]string{
+			"OTEL_EXPORTER_OTLP_ENDPOINT": "http://collector:4318",
+			"OTEL_TRACES_EXPORTER":        "none",
+			"OTEL_METRICS_EXPORTER":       "none",
+		}), "1.0")
+		assert.NoError(t, err)
+		assert.Nil(t, tel)
+	})
+
+	t.Run("Exports each signal under the common endpoint", func(t *testing.T) {
+		tel, err := FromEnv(env(map[string]string{
+			"OTEL_EXPORTER_OTLP_ENDPOINT":         "http://collector:4318/",
+			"OTEL_EXPORTER_OTLP_METRICS_ENDPOINT": "http://metrics:4318/custom",
+			"OTEL_EXPORTER_OTLP_HEADERS":          "x-api-key=abc%3D, x-team=platform",
+			"OTEL_RESOURCE_ATTRIBUTES":            "deployment.environment=prod",
+		}), "1.0")
+		assert.NoError(t, err)
+		assert.Equal(t, "http://collector:4318/v1/traces", tel.tracesURL)
+		assert.Equal(t, "http://metrics:4318/custom", tel.metricsURL)
+		assert.Equal(t, map[string]string{"x-api-key": "abc=", "x-team": "platform"}, tel.headers)
+		assert.Equal(t, []Attribute{
+			String("service.name", "summon"),
+			String("deployment.environment", "prod"),
+		}, tel.resource)
+	})
+
+	t.Run("Joins the trace in TRACEPARENT", func(t *testing.T) {
+		tel, err := FromEnv(env(map[string]string{
+			"OTEL_EXPORTER_OTLP_ENDPOINT": "http://collector:4318",
+			"TRACEPARENT":                 "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+		}), "1.0")
+		assert.NoError(t, err)
+
+		span := tel.Start("span", nil)
+		assert.Equal(t, "00f067aa0ba902b7", hex.EncodeToString(span.parent[:]))
+		assert.Regexp(t, "^00-4bf92f3577b34da6a3ce929d0e0e4736-[0-9a-f]{16}-01$", span.Traceparent())
+	})
+
+	t.Run("Records secret paths only when opted in to", func(t *testing.T) {
+		vars := map[string]string{"OTEL_EXPORTER_OTLP_ENDPOINT": "http://collector:4318"}
+		tel, err := FromEnv(env(vars), "1.0")
+		assert.NoError(t, err)
+		assert.False(t, tel.RecordsSecretPaths())
+
+		vars[SecretPathsEnv] = "true"
+		tel, err = FromEnv(env(vars), "1.0")
+		assert.NoError(t, err)
+		assert.True(t, tel.RecordsSecretPaths())
+	})
+
+	t.Run("Rejects protocols other than http/json", func(t *testing.T) {
+		_, err := FromEnv(env(map[string]string{
+			"OTEL_EXPORTER_OTLP_ENDPOINT": "http://collector:4317",
+			"OTEL_EXPORTER_OTLP_PROTOCOL": "grpc",
+		}), "1.0")
+		assert.EqualError(t, err, `unsupported OTLP protocol "grpc", only http/json is supported`)
+	})
+
+	t.Run("Rejects malformed headers", func(t *testing.T) {
+		_, err := FromEnv(env(map[string]string{
+			"OTEL_EXPORTER_OTLP_ENDPOINT": "http://collector:4318",
+			"OTEL_EXPORTER_OTLP_HEADERS":  "x-api-key",
+		}), "1.0")
+		assert.EqualError(t, err, `invalid OTEL_EXPORTER_OTLP_HEADERS: "x-api-key" is not a key=value pair`)
+	})
+}
+
+func TestNilTelemetry(t *testing.T) {
+	var tel *Telemetry
+	span := tel.Start("span", nil)
+	span.SetAttributes(String("key", "value"))
+	span.End(nil)
+	tel.Add("counter", "1", 1)
+	tel.Record("histogram", "ms", 1)
+
+	assert.Equal(t, "", span.Traceparent())
+	assert.False(t, tel.RecordsSecretPaths())
+	assert.NoError(t, tel.Shutdown(context.Background()))
+}
+
+func TestShutdown(t *testing.T) {
+	payloads := map[string]interface{}{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+		assert.Equal(t, "platform", r.Header.Get("X-Team"))
+		body, _ := io.ReadAll(r.Body)
+		var payload interface{}
+		assert.NoError(t, json.Unmarshal(body, &payload))
+		payloads[r.URL.Path] = payload
+	}))
+	defer server.Close()
+
+	tel, err := FromEnv(env(map[string]string{
+		"OTEL_EXPORTER_OTLP_ENDPOINT": server.URL,
+		"OTEL_EXPORTER_OTLP_HEADERS":  "x-team=platform",
+	}), "1.0")
+	assert.NoError(t, err)
+
+	root := tel.Start("root", nil)
+	child := tel.Start("child", root, String("path", "db/password"))
+	child.End(errors.New("failed"))
+	root.End(nil)
+	tel.Add("retries", "{retry}", 2)
+	tel.Record("duration", "ms", 7)
+	tel.Record("duration", "ms", 300)
+
+	assert.NoError(t, tel.Shutdown(context.Background()))
+
+	t.Run("Spans", func(t *testing.T) {
+		spans := dig(payloads["/v1/traces"], "resourceSpans", 0, "scopeSpans", 0, "spans")
+		assert.Len(t, spans, 2)
+		assert.Equal(t, "child", dig(spans, 0, "name"))
+		assert.Equal(t, dig(spans, 1, "spanId"), dig(spans, 0, "parentSpanId"))
+		assert.Equal(t, "db/password", dig(spans, 0, "attributes", 0, "value", "stringValue"))
+		assert.Equal(t, map[string]interface{}{"code": 2.0, "message": "failed"}, dig(spans, 0, "status"))
+		assert.Nil(t, dig(spans, 1, "parentSpanId"))
+	})
+
+	t.Run("Metrics", func(t *testing.T) {
+		metrics := dig(payloads["/v1/metrics"], "resourceMetrics", 0, "scopeMetrics", 0, "metrics")
+		assert.Len(t, metrics, 2)
+		assert.Equal(t, "retries", dig(metrics, 0, "name"))
+		assert.Equal(t, "2", dig(metrics, 0, "sum", "dataPoints", 0, "asInt"))
+
+		assert.Equal(t, "duration", dig(metrics, 1, "name"))
+		point := dig(metrics, 1, "histogram", "dataPoints", 0)
+		assert.Equal(t, "2", dig(point, "count"))
+		assert.Equal(t, 307.0, dig(point, "sum"))
+		// 7ms falls in (5, 10], 300ms in (250, 500]
+		assert.Equal(t, "1", dig(point, "bucketCounts", 2))
+		assert.Equal(t, "1", dig(point, "bucketCounts", 8))
+	})
+
+	t.Run("Fails when the collector does", func(t *testing.T) {
+		failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}))
+		defer failing.Close()
+
+		tel, _ := FromEnv(env(map[string]string{"OTEL_EXPORTER_OTLP_TRACES_ENDPOINT": failing.URL}), "1.0")
+		tel.Start("span", nil).End(nil)
+		assert.EqualError(t, tel.Shutdown(context.Background()),
+			"unable to export traces: "+failing.URL+" returned 503 Service Unavailable")
+	})
+}
+
+// dig returns the value at path in decoded JSON, or nil if there is none
+func dig(v interface{}, path ...interface{}) interface{} {
+	for _, p := range path {
+		switch key := p.(type) {
+		case string:
+			m, _ := v.(map[string]interface{})
+			v = m[key]
+		case int:
+			a, _ := v.([]interface{})
+			if key >= len(a) {
+				return nil
+			}
+			v = a[key]
+		}
+	}
+	return v
+}